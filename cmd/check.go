@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+	"github.com/fbettag/unifi-gate-opener/internal/gate"
+	"github.com/fbettag/unifi-gate-opener/internal/unifi"
+	"github.com/sirupsen/logrus"
+)
+
+// checkResult is one line of the --check report
+type checkResult struct {
+	Name   string
+	Detail string // what was checked, or why it was skipped
+	Err    error
+	Passed bool
+}
+
+func pass(name, detail string) checkResult {
+	return checkResult{Name: name, Detail: detail, Passed: true}
+}
+
+func fail(name string, err error) checkResult {
+	return checkResult{Name: name, Err: err}
+}
+
+// skipped reports checks that can't run because reason
+func skipped(reason string, names ...string) []checkResult {
+	results := make([]checkResult, len(names))
+	for i, name := range names {
+		results[i] = checkResult{Name: name, Detail: reason}
+	}
+	return results
+}
+
+// runChecks validates what serving needs, in order: the config file, the
+// database, logging in to the UniFi controller and listing its clients, and
+// reaching each gate. Checks depending on a failed one are skipped. The
+// database path overrides the configured one unless empty.
+func runChecks(configPath, databasePath string, logger *logrus.Logger) []checkResult {
+	cfg, err := loadExistingConfig(configPath)
+	if err != nil {
+		return append([]checkResult{fail("config", err)},
+			skipped("needs config", "database", "unifi login", "unifi clients", "gate")...)
+	}
+	results := []checkResult{pass("config", configPath)}
+
+	if databasePath == "" {
+		databasePath = cfg.DatabasePath
+	}
+	results = append(results, checkDatabase(databasePath))
+
+	if !cfg.IsConfigured() {
+		results = append(results, fail("setup", fmt.Errorf("setup wizard not completed")))
+		return append(results, skipped("needs setup", "unifi login", "unifi clients", "gate")...)
+	}
+
+	results = append(results, checkUniFi(cfg, logger)...)
+	return append(results, checkGates(cfg, logger)...)
+}
+
+// loadExistingConfig loads the config file, failing if there is none rather
+// than writing a fresh one like serving does
+func loadExistingConfig(path string) (*config.Config, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return config.LoadOrInitialize(path)
+}
+
+// checkDatabase opens the existing database read-only and checks its schema
+// version, leaving creating and migrating it to serving
+func checkDatabase(path string) checkResult {
+	version, err := database.Inspect(path)
+	if err != nil {
+		return fail("database", err)
+	}
+	detail := fmt.Sprintf("%s, schema version %d", path, version)
+	if version < database.LatestSchemaVersion() {
+		detail += fmt.Sprintf(", migrated to %d on start", database.LatestSchemaVersion())
+	}
+	return pass("database", detail)
+}
+
+// checkUniFi logs in to the controller and lists the active clients of the
+// configured site, like every poll does
+func checkUniFi(cfg *config.Config, logger *logrus.Logger) []checkResult {
+	client := unifi.NewClient(cfg.UniFi.ControllerURL, cfg.UniFi.Username, cfg.UniFi.Password, unifi.NewLogrusAdapter(logger))
+	client.SetLoginOptions(time.Duration(cfg.UniFi.LoginTimeout)*time.Second, cfg.UniFi.LoginRetries)
+	client.SetUnifiOS(cfg.UniFi.UnifiOS)
+	if err := client.Login(); err != nil {
+		return append([]checkResult{fail("unifi login", err)}, skipped("needs unifi login", "unifi clients")...)
+	}
+
+	clients, err := client.GetActiveClients(cfg.UniFi.SiteID)
+	if err != nil {
+		return []checkResult{pass("unifi login", cfg.UniFi.ControllerURL), fail("unifi clients", err)}
+	}
+	return []checkResult{
+		pass("unifi login", cfg.UniFi.ControllerURL),
+		pass("unifi clients", fmt.Sprintf("%d active on site %s", len(clients), cfg.UniFi.SiteID)),
+	}
+}
+
+// checkGates reaches the primary gate's relay and those of any further gates
+// without switching them
+func checkGates(cfg *config.Config, logger *logrus.Logger) []checkResult {
+	check := func(name, triggerURL string) checkResult {
+		controller := gate.NewController(triggerURL, logger)
+		controller.SetAuth(cfg.Shelly.Username, cfg.Shelly.Password, cfg.Shelly.BearerToken)
+		if err := controller.TestConnection(); err != nil {
+			return fail(name, err)
+		}
+		return pass(name, triggerURL)
+	}
+
+	results := []checkResult{check("gate", cfg.Shelly.BuildTriggerURL())}
+	for _, g := range cfg.Gates {
+		results = append(results, check("gate "+g.Name, g.TriggerURL))
+	}
+	return results
+}
+
+// printReport writes one line per check and reports whether all passed
+func printReport(w io.Writer, results []checkResult) bool {
+	ok := true
+	for _, r := range results {
+		switch {
+		case r.Passed:
+			fmt.Fprintf(w, "PASS  %-14s %s\n", r.Name, r.Detail)
+		case r.Err != nil:
+			ok = false
+			fmt.Fprintf(w, "FAIL  %-14s %v\n", r.Name, r.Err)
+		default:
+			ok = false
+			fmt.Fprintf(w, "SKIP  %-14s %s\n", r.Name, r.Detail)
+		}
+	}
+	return ok
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+	"github.com/sirupsen/logrus"
+)
+
+// newMockUniFi serves a login and an active client, enough for the checks
+func newMockUniFi(t *testing.T) *httptest.Server {
+	t.Helper()
+	writeData := func(w http.ResponseWriter, data interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"meta": map[string]interface{}{"rc": "ok"},
+			"data": data,
+		})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "unifises", Value: "mock-session-token", Path: "/"})
+		writeData(w, nil)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		writeData(w, nil)
+	})
+	mux.HandleFunc("/api/s/default/stat/sta", func(w http.ResponseWriter, r *http.Request) {
+		writeData(w, []map[string]interface{}{{
+			"mac":       "aa:bb:cc:dd:ee:01",
+			"ap_mac":    "11:22:33:44:55:66",
+			"is_wired":  false,
+			"last_seen": time.Now().Unix(),
+			"uptime":    120,
+		}})
+	})
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// writeCheckConfig writes a completed setup pointing at controllerURL and
+// triggerURL, with its database, returning the config path
+func writeCheckConfig(t *testing.T, controllerURL, triggerURL string) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	db, err := database.Initialize(filepath.Join(dir, "gate_opener.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Close()
+	yaml := fmt.Sprintf(`setup_complete: true
+session_secret: test-session-secret-32-characters!
+database_path: %s
+admin:
+  username: admin
+unifi:
+  controller_url: %s
+  username: user
+  password: pass
+  site_id: default
+  login_retries: 0
+shelly:
+  trigger_url: %s
+`, filepath.Join(dir, "gate_opener.db"), controllerURL, triggerURL)
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestRunChecks(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	t.Run("Passing config", func(t *testing.T) {
+		relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodHead {
+				t.Errorf("Expected the relay to be checked without switching it, got %s", r.Method)
+			}
+		}))
+		defer relay.Close()
+
+		results := runChecks(writeCheckConfig(t, newMockUniFi(t).URL, relay.URL+"/relay/0?turn=on"), "", logger)
+
+		var report bytes.Buffer
+		if !printReport(&report, results) {
+			t.Fatalf("Expected every check to pass:\n%s", report.String())
+		}
+		for _, name := range []string{"config", "database", "unifi login", "unifi clients", "gate"} {
+			if !strings.Contains(report.String(), "PASS  "+name) {
+				t.Errorf("Expected %s to pass:\n%s", name, report.String())
+			}
+		}
+		if !strings.Contains(report.String(), "1 active on site default") {
+			t.Errorf("Expected the client count in the report:\n%s", report.String())
+		}
+	})
+
+	t.Run("Unreachable gate", func(t *testing.T) {
+		relay := httptest.NewServer(http.NotFoundHandler())
+		relayURL := relay.URL
+		relay.Close()
+
+		results := runChecks(writeCheckConfig(t, newMockUniFi(t).URL, relayURL+"/relay/0?turn=on"), "", logger)
+
+		var report bytes.Buffer
+		if printReport(&report, results) {
+			t.Fatalf("Expected the check to fail:\n%s", report.String())
+		}
+		if !strings.Contains(report.String(), "PASS  unifi clients") || !strings.Contains(report.String(), "FAIL  gate") {
+			t.Errorf("Expected only the gate to fail:\n%s", report.String())
+		}
+	})
+
+	t.Run("Missing database", func(t *testing.T) {
+		path := writeCheckConfig(t, newMockUniFi(t).URL, "http://127.0.0.1:1/relay/0?turn=on")
+		dbPath := filepath.Join(filepath.Dir(path), "gate_opener.db")
+		if err := os.Remove(dbPath); err != nil {
+			t.Fatalf("Failed to remove database: %v", err)
+		}
+
+		var report bytes.Buffer
+		printReport(&report, runChecks(path, "", logger))
+		if !strings.Contains(report.String(), "FAIL  database") {
+			t.Errorf("Expected the database to fail:\n%s", report.String())
+		}
+		if _, err := os.Stat(dbPath); !os.IsNotExist(err) {
+			t.Error("The check shouldn't create a database")
+		}
+	})
+
+	t.Run("Database isn't migrated", func(t *testing.T) {
+		path := writeCheckConfig(t, newMockUniFi(t).URL, "http://127.0.0.1:1/relay/0?turn=on")
+		dbPath := filepath.Join(filepath.Dir(path), "gate_opener.db")
+		db, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		if _, err := db.Exec(`UPDATE schema_version SET version = 2`); err != nil {
+			t.Fatalf("Failed to downgrade schema version: %v", err)
+		}
+		db.Close()
+
+		var report bytes.Buffer
+		printReport(&report, runChecks(path, "", logger))
+		if !strings.Contains(report.String(), "PASS  database") || !strings.Contains(report.String(), "schema version 2") {
+			t.Errorf("Expected the older schema to pass:\n%s", report.String())
+		}
+		if version, err := database.Inspect(dbPath); err != nil || version != 2 {
+			t.Errorf("Expected the schema to be left at version 2, got %d (%v)", version, err)
+		}
+	})
+
+	t.Run("Missing config", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		results := runChecks(path, "", logger)
+
+		var report bytes.Buffer
+		if printReport(&report, results) {
+			t.Fatal("Expected the check to fail")
+		}
+		if !strings.Contains(report.String(), "FAIL  config") || !strings.Contains(report.String(), "SKIP  gate") {
+			t.Errorf("Expected the config to fail and the rest to be skipped:\n%s", report.String())
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Error("The check shouldn't write a config")
+		}
+	})
+}
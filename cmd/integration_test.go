@@ -102,7 +102,7 @@ func setupIntegrationTestServer(t *testing.T) *integrationTestServer {
 	}
 
 	// Set up routes
-	router := setupRoutes(app)
+	router := app.Routes()
 
 	// Create test server
 	server := &http.Server{
@@ -4,7 +4,6 @@ import (
 	"embed"
 	"flag"
 	"fmt"
-	"io/fs"
 	"net/http"
 	"os"
 	"os/signal"
@@ -15,8 +14,8 @@ import (
 	"github.com/fbettag/unifi-gate-opener/internal/config"
 	"github.com/fbettag/unifi-gate-opener/internal/database"
 	"github.com/fbettag/unifi-gate-opener/internal/handlers"
+	"github.com/fbettag/unifi-gate-opener/internal/notify"
 	"github.com/fbettag/unifi-gate-opener/internal/unifi"
-	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
@@ -35,6 +34,8 @@ var (
 	dbPath      = flag.String("database", "", "Path to database file (overrides config)")
 	logLevel    = flag.String("log-level", "info", "Log level (debug, info, warn, error)")
 	showVersion = flag.Bool("version", false, "Show version and exit")
+	setupLogin  = flag.Bool("require-setup-login", false, "Require logging in after the setup wizard (overrides config)")
+	check       = flag.Bool("check", false, "Check the config, database, UniFi controller and gate, print a report and exit")
 )
 
 func main() {
@@ -67,6 +68,15 @@ func main() {
 		logger.SetLevel(logrus.InfoLevel)
 	}
 
+	// Check everything serving needs instead of serving, exiting non-zero
+	// if anything fails, e.g. as a deploy smoke test
+	if *check {
+		if !printReport(os.Stdout, runChecks(*configFile, *dbPath, logger)) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	logger.Infof("Starting UniFi Gate Opener %s", Version)
 
 	// Load or initialize configuration
@@ -75,6 +85,8 @@ func main() {
 		logger.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	logger.Infof("Instance name: %s", cfg.Server.Instance())
+
 	// Override database path if provided via flag
 	databasePath := cfg.DatabasePath
 	if *dbPath != "" {
@@ -88,23 +100,55 @@ func main() {
 		logger.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
+	db.SetDedupeWindow(time.Duration(cfg.Database.LogDedupeWindow) * time.Second)
+	db.SetWriteRetries(cfg.Database.WriteRetries)
 
 	// Initialize session store
-	sessionStore := auth.NewSessionStore(cfg.SessionSecret)
+	sessionStore, err := newSessionStore(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to initialize session store: %v", err)
+	}
+	sessionStore.SetIdleTimeout(time.Duration(cfg.Server.SessionIdleTimeout) * time.Minute)
+	sessionStore.SetSingleSession(cfg.Server.SingleSession)
 
 	// Create app context
 	app := &handlers.App{
 		Config:       cfg,
+		ConfigPath:   *configFile,
 		DB:           db,
 		Logger:       logger,
 		WebFS:        webFiles,
 		SessionStore: sessionStore,
+
+		// Logging in after setup if requested via flag, not saved to the config
+		RequireSetupLogin: *setupLogin,
+	}
+	if err := app.LoadDevices(); err != nil {
+		logger.Fatalf("Failed to load devices: %v", err)
 	}
+	if notifier := newNotifier(cfg.Notifications); notifier != nil {
+		app.Notifier = notifier
+		if group, ok := notifier.(notify.Group); ok && cfg.Notifications.BatchWindow > 0 {
+			app.Notifier = group.Batched(time.Duration(cfg.Notifications.BatchWindow)*time.Second, func(err error) {
+				logger.Errorf("Failed to send batched notification: %v", err)
+			})
+		}
+		// The Telegram chat hears about every open, not only notifications.events
+		if group, ok := app.Notifier.(notify.Group); ok {
+			app.GateNotifier = group.Only([]string{"telegram"})
+		}
+	}
+	if cfg.Notifications.TTS.WebhookURL != "" {
+		app.Announcer = notify.NewWebhook(cfg.Notifications.TTS.WebhookURL)
+	}
+	stopEventWebhook := app.StartEventWebhook()
 
 	// Initialize UniFi client if configured
 	if cfg.IsConfigured() {
 		unifiLogger := unifi.NewLogrusAdapter(logger)
 		unifiClient := unifi.NewClient(cfg.UniFi.ControllerURL, cfg.UniFi.Username, cfg.UniFi.Password, unifiLogger)
+		unifiClient.SetLoginOptions(time.Duration(cfg.UniFi.LoginTimeout)*time.Second, cfg.UniFi.LoginRetries)
+		unifiClient.SetUnifiOS(cfg.UniFi.UnifiOS)
 		app.UniFiClient = unifiClient
 
 		// Start monitoring in background
@@ -112,7 +156,7 @@ func main() {
 	}
 
 	// Setup routes
-	router := setupRoutes(app)
+	router := app.Routes()
 
 	// Start server
 	addr := fmt.Sprintf(":%d", *port)
@@ -124,68 +168,59 @@ func main() {
 	go func() {
 		<-c
 		logger.Info("Shutting down...")
+		app.Shutdown()
+		stopEventWebhook()
+		// Arrivals still held back for batching
+		if group, ok := app.Notifier.(notify.Group); ok {
+			if err := group.Flush(); err != nil {
+				logger.Errorf("Failed to send batched notification: %v", err)
+			}
+		}
 		os.Exit(0)
 	}()
 
 	// Create server with timeouts
-	server := &http.Server{
-		Addr:         addr,
-		Handler:      router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
-	}
+	server := newHTTPServer(addr, router, cfg.Server)
 
 	if err := server.ListenAndServe(); err != nil {
 		logger.Fatalf("Failed to start server: %v", err)
 	}
 }
 
-func setupRoutes(app *handlers.App) *mux.Router {
-	router := mux.NewRouter()
-
-	// Check if setup is complete middleware (must be first)
-	router.Use(app.CheckSetupMiddleware)
-
-	// Static files
-	staticFS, _ := fs.Sub(webFiles, "web/static")
-	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
-
-	// Setup wizard routes (no auth required)
-	router.HandleFunc("/setup", app.SetupWizardHandler).Methods("GET")
-	router.HandleFunc("/api/setup", app.SetupAPIHandler).Methods("POST")
-	router.HandleFunc("/api/test-unifi", app.TestUniFiHandler).Methods("POST")
-	router.HandleFunc("/api/test-unifi-sites", app.TestUniFiSitesHandler).Methods("POST")
-
-	// Public routes
-	router.HandleFunc("/", app.IndexHandler).Methods("GET")
-	router.HandleFunc("/login", app.LoginPageHandler).Methods("GET")
-	router.HandleFunc("/api/login", app.LoginHandler).Methods("POST")
-
-	// Protected routes (require authentication)
-	protected := router.PathPrefix("/").Subrouter()
-	protected.Use(app.AuthMiddleware)
-
-	// Dashboard
-	protected.HandleFunc("/dashboard", app.DashboardHandler).Methods("GET")
-	protected.HandleFunc("/logout", app.LogoutHandler).Methods("GET", "POST")
-
-	// API routes
-	api := protected.PathPrefix("/api").Subrouter()
-	api.HandleFunc("/devices", app.GetDevicesHandler).Methods("GET")
-	api.HandleFunc("/devices", app.AddDeviceHandler).Methods("POST")
-	api.HandleFunc("/devices/{id}", app.UpdateDeviceHandler).Methods("PUT")
-	api.HandleFunc("/devices/{id}", app.DeleteDeviceHandler).Methods("DELETE")
-
-	api.HandleFunc("/settings", app.GetSettingsHandler).Methods("GET")
-	api.HandleFunc("/settings", app.UpdateSettingsHandler).Methods("PUT")
-
-	api.HandleFunc("/logs", app.GetLogsHandler).Methods("GET")
-	api.HandleFunc("/status", app.GetStatusHandler).Methods("GET")
+// newHTTPServer creates the web server with the configured timeouts
+func newHTTPServer(addr string, handler http.Handler, cfg config.ServerConfig) *http.Server {
+	return &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  time.Duration(cfg.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(cfg.WriteTimeout) * time.Second,
+		IdleTimeout:  time.Duration(cfg.IdleTimeout) * time.Second,
+	}
+}
 
-	api.HandleFunc("/unifi/aps", app.GetAccessPointsHandler).Methods("GET")
-	api.HandleFunc("/unifi/clients", app.GetUniFiClientsHandler).Methods("GET")
-	api.HandleFunc("/test-gate", app.TestGateHandler).Methods("POST")
+// newNotifier creates the configured notification providers, nil if none
+func newNotifier(cfg config.NotifyConfig) notify.Notifier {
+	var group notify.Group
+	if cfg.WebhookURL != "" {
+		group = append(group, notify.Named{Name: "webhook", Notifier: notify.NewWebhook(cfg.WebhookURL)})
+	}
+	if cfg.Telegram.Enabled() {
+		group = append(group, notify.Named{Name: "telegram", Notifier: notify.NewTelegram(cfg.Telegram.BotToken, cfg.Telegram.ChatID)})
+	}
+	if len(group) == 0 {
+		return nil
+	}
+	return group
+}
 
-	return router
+// newSessionStore creates the session store for the configured backend
+func newSessionStore(cfg *config.Config) (*auth.SessionStore, error) {
+	switch cfg.Server.SessionBackend {
+	case "", "cookie":
+		return auth.NewSessionStore(cfg.SessionSecret), nil
+	case "filesystem":
+		return auth.NewFilesystemSessionStore(cfg.SessionSecret, cfg.Server.SessionDir)
+	default:
+		return nil, fmt.Errorf("unknown session backend %q", cfg.Server.SessionBackend)
+	}
 }
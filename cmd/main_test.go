@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+	"github.com/fbettag/unifi-gate-opener/internal/notify"
+)
+
+func TestNewHTTPServer(t *testing.T) {
+	handler := http.NewServeMux()
+	server := newHTTPServer(":8080", handler, config.ServerConfig{
+		ReadTimeout:  30,
+		WriteTimeout: 300,
+		IdleTimeout:  120,
+	})
+
+	if server.Addr != ":8080" {
+		t.Errorf("Expected addr :8080, got %s", server.Addr)
+	}
+	if server.ReadTimeout != 30*time.Second {
+		t.Errorf("Expected read timeout 30s, got %v", server.ReadTimeout)
+	}
+	if server.WriteTimeout != 300*time.Second {
+		t.Errorf("Expected write timeout 300s, got %v", server.WriteTimeout)
+	}
+	if server.IdleTimeout != 120*time.Second {
+		t.Errorf("Expected idle timeout 120s, got %v", server.IdleTimeout)
+	}
+}
+
+func TestNewSessionStore(t *testing.T) {
+	cfg := &config.Config{SessionSecret: "test-session-secret-32-characters!"}
+
+	t.Run("Cookie backend by default", func(t *testing.T) {
+		store, err := newSessionStore(cfg)
+		if err != nil || store == nil {
+			t.Fatalf("Failed to create cookie session store: %v", err)
+		}
+	})
+
+	t.Run("Filesystem backend", func(t *testing.T) {
+		fsCfg := *cfg
+		fsCfg.Server.SessionBackend = "filesystem"
+		fsCfg.Server.SessionDir = filepath.Join(t.TempDir(), "sessions")
+
+		if _, err := newSessionStore(&fsCfg); err != nil {
+			t.Fatalf("Failed to create filesystem session store: %v", err)
+		}
+		if _, err := os.Stat(fsCfg.Server.SessionDir); err != nil {
+			t.Errorf("Session directory should be created: %v", err)
+		}
+	})
+
+	t.Run("Unknown backend", func(t *testing.T) {
+		badCfg := *cfg
+		badCfg.Server.SessionBackend = "memcached"
+
+		if _, err := newSessionStore(&badCfg); err == nil {
+			t.Error("Expected error for unknown session backend")
+		}
+	})
+}
+
+func TestNewNotifier(t *testing.T) {
+	if notifier := newNotifier(config.NotifyConfig{}); notifier != nil {
+		t.Errorf("Expected no notifier without providers, got %v", notifier)
+	}
+
+	// Telegram needs both the bot token and the chat
+	notifier := newNotifier(config.NotifyConfig{
+		WebhookURL: "https://example.com/hook",
+		Telegram:   config.TelegramConfig{BotToken: "123:abc"},
+	})
+	if group, _ := notifier.(notify.Group); len(group) != 1 || group[0].Name != "webhook" {
+		t.Errorf("Expected only the webhook, got %v", notifier)
+	}
+
+	notifier = newNotifier(config.NotifyConfig{
+		Telegram: config.TelegramConfig{BotToken: "123:abc", ChatID: "42"},
+	})
+	if group, _ := notifier.(notify.Group); len(group) != 1 || group[0].Name != "telegram" {
+		t.Errorf("Expected Telegram, got %v", notifier)
+	}
+}
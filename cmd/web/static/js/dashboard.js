@@ -37,6 +37,13 @@ function showTab(tabName) {
     }
 }
 
+// escapeHtml makes text safe to put into markup and quoted attributes
+function escapeHtml(text) {
+    return String(text ?? '').replace(/[&<>"']/g, c => ({
+        '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;'
+    })[c]);
+}
+
 // Device management
 async function loadDevices() {
     try {
@@ -54,10 +61,15 @@ async function loadDevices() {
             const row = document.createElement('tr');
             row.innerHTML = `
                 <td class="px-6 py-4 whitespace-nowrap">
-                    <div class="text-sm font-medium text-gray-900 dark:text-white">${device.name}</div>
+                    <div class="flex items-center">
+                        <div class="text-sm font-medium text-gray-900 dark:text-white">${escapeHtml(device.name)}</div>
+                    </div>
                 </td>
                 <td class="px-6 py-4 whitespace-nowrap">
-                    <div class="text-sm text-gray-500 dark:text-gray-400">${device.mac}</div>
+                    <div class="text-sm text-gray-500 dark:text-gray-400">${escapeHtml(device.mac)}</div>
+                    ${device.gate && device.gate !== 'main'
+                        ? `<div class="text-xs text-gray-400"><i class="fas fa-door-open"></i> ${escapeHtml(device.gate)}</div>`
+                        : ''}
                 </td>
                 <td class="px-6 py-4 whitespace-nowrap">
                     <span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium ${
@@ -77,6 +89,14 @@ async function loadDevices() {
                     </button>
                 </td>
             `;
+            if (device.avatar_url) {
+                // Set as a property so the URL is never parsed as markup
+                const img = document.createElement('img');
+                img.src = device.avatar_url;
+                img.alt = '';
+                img.className = 'h-8 w-8 rounded-full object-cover mr-3';
+                row.querySelector('.flex').prepend(img);
+            }
             tbody.appendChild(row);
         });
     } catch (error) {
@@ -88,6 +108,7 @@ let unifiClients = [];
 
 async function showAddDevice() {
     document.getElementById('add-device-modal').classList.remove('hidden');
+    loadGateChoices();
     
     // Load UniFi clients
     try {
@@ -108,14 +129,103 @@ async function showAddDevice() {
     }
 }
 
+// Offer the configured gates, the choice is hidden with only the primary one
+async function loadGateChoices() {
+    try {
+        const response = await fetch('/api/settings');
+        const settings = await response.json();
+        const gates = settings.gates || [];
+        
+        const select = document.getElementById('new-device-gate');
+        select.innerHTML = '';
+        gates.forEach(gate => {
+            const option = document.createElement('option');
+            option.value = gate;
+            option.textContent = gate;
+            select.appendChild(option);
+        });
+        document.getElementById('new-device-gate-field').classList.toggle('hidden', gates.length < 2);
+    } catch (error) {
+        console.error('Error loading gates:', error);
+    }
+}
+
 function hideAddDevice() {
     document.getElementById('add-device-modal').classList.add('hidden');
     document.getElementById('new-device-name').value = '';
     document.getElementById('new-device-mac').value = '';
+    document.getElementById('new-device-avatar').value = '';
     document.getElementById('client-search').value = '';
+    document.getElementById('known-client-list').innerHTML = '';
+    document.getElementById('add-known-clients').classList.add('hidden');
     hideClientDropdown();
 }
 
+// Named clients from the controller, to add several devices at once
+async function loadKnownClients() {
+    const list = document.getElementById('known-client-list');
+    try {
+        const response = await fetch('/api/unifi/known-clients', {
+            credentials: 'same-origin'
+        });
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        const clients = await response.json();
+        
+        list.innerHTML = '';
+        clients.forEach(client => {
+            const li = document.createElement('li');
+            li.innerHTML = `
+                <label class="inline-flex items-center text-sm ${client.tracked ? 'text-gray-400' : 'text-gray-700'}">
+                    <input type="checkbox" class="known-client rounded border-gray-300 text-indigo-600"
+                           value="${escapeHtml(client.mac)}" data-name="${escapeHtml(client.name)}" ${client.tracked ? 'disabled checked' : ''}>
+                    <span class="ml-2">${escapeHtml(client.name)} <span class="text-xs text-gray-500">${escapeHtml(client.mac)}</span></span>
+                </label>
+            `;
+            list.appendChild(li);
+        });
+        if (clients.length === 0) {
+            list.innerHTML = '<li class="text-sm text-gray-500">No named clients found</li>';
+        }
+        document.getElementById('add-known-clients').classList.toggle('hidden', clients.length === 0);
+    } catch (error) {
+        alert('Failed to load known clients: ' + error.message);
+    }
+}
+
+async function addKnownClients() {
+    const gate = document.getElementById('new-device-gate').value;
+    const devices = Array.from(document.querySelectorAll('.known-client:checked:not(:disabled)'))
+        .map(input => ({ mac: input.value, name: input.dataset.name, gate }));
+    if (devices.length === 0) {
+        alert('Please select at least one client');
+        return;
+    }
+    
+    try {
+        const response = await fetch('/api/devices/bulk', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ devices })
+        });
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        
+        const result = await response.json();
+        if (result.skipped.length > 0) {
+            alert('Not added:\n' + result.skipped.map(s => `${s.mac}: ${s.error}`).join('\n'));
+        }
+        hideAddDevice();
+        loadDevices();
+    } catch (error) {
+        alert('Failed to add devices: ' + error.message);
+    }
+}
+
 function showClientDropdown() {
     console.log('Showing client dropdown');
     document.getElementById('client-dropdown').classList.remove('hidden');
@@ -147,10 +257,10 @@ function renderClientList(clients) {
         li.innerHTML = `
             <div class="flex justify-between items-center">
                 <div>
-                    <div class="text-sm font-medium text-gray-900 dark:text-white">${displayName}</div>
-                    <div class="text-xs text-gray-500 dark:text-gray-400">${client.mac}</div>
+                    <div class="text-sm font-medium text-gray-900 dark:text-white">${escapeHtml(displayName)}</div>
+                    <div class="text-xs text-gray-500 dark:text-gray-400">${escapeHtml(client.mac)}</div>
                 </div>
-                ${client.ip ? `<div class="text-xs text-gray-400 dark:text-gray-300">${client.ip}</div>` : ''}
+                ${client.ip ? `<div class="text-xs text-gray-400 dark:text-gray-300">${escapeHtml(client.ip)}</div>` : ''}
             </div>
         `;
         li.onclick = () => selectClient(client);
@@ -176,6 +286,8 @@ function selectClient(client) {
 async function addDevice() {
     const name = document.getElementById('new-device-name').value;
     const mac = document.getElementById('new-device-mac').value.toUpperCase();
+    const avatar_url = document.getElementById('new-device-avatar').value.trim();
+    const gate = document.getElementById('new-device-gate').value;
     
     if (!name || !mac) {
         alert('Please fill in all fields');
@@ -195,7 +307,7 @@ async function addDevice() {
             headers: {
                 'Content-Type': 'application/json',
             },
-            body: JSON.stringify({ name, mac })
+            body: JSON.stringify({ name, mac, avatar_url, gate })
         });
         
         if (!response.ok) {
@@ -232,10 +344,39 @@ async function deleteDevice(mac) {
 }
 
 // Logs
+const logsPageSize = 100;
+let logsOffset = 0;
+
+// Start over on the first page when a filter changes
+function filterLogs() {
+    logsOffset = 0;
+    loadLogs();
+}
+
+function pageLogs(direction) {
+    logsOffset = Math.max(0, logsOffset + direction * logsPageSize);
+    loadLogs();
+}
+
 async function loadLogs() {
     try {
-        const response = await fetch('/api/logs?limit=100');
+        const params = new URLSearchParams({ limit: logsPageSize, offset: logsOffset });
+        const event = document.getElementById('logs-event').value;
+        const from = document.getElementById('logs-from').value;
+        const to = document.getElementById('logs-to').value;
+        if (event) params.set('event', event);
+        if (from) params.set('from', new Date(from).toISOString());
+        if (to) params.set('to', new Date(to).toISOString());
+
+        const response = await fetch('/api/logs?' + params);
         const logs = await response.json();
+
+        const total = parseInt(response.headers.get('X-Total-Count') || '0', 10);
+        const shown = Array.isArray(logs) ? logs.length : 0;
+        document.getElementById('logs-range').textContent = total === 0 ? 'No entries' :
+            `${logsOffset + 1}–${logsOffset + shown} of ${total}`;
+        document.getElementById('logs-prev').disabled = logsOffset === 0;
+        document.getElementById('logs-next').disabled = logsOffset + shown >= total;
         
         const tbody = document.getElementById('logs-list');
         tbody.innerHTML = '';
@@ -248,7 +389,7 @@ async function loadLogs() {
                     ${new Date(log.timestamp).toLocaleString()}
                 </td>
                 <td class="px-6 py-4 whitespace-nowrap text-sm text-gray-900 dark:text-white">
-                    ${log.device_name} (${log.device_mac})
+                    ${escapeHtml(log.device_name)} (${escapeHtml(log.device_mac)})
                 </td>
                 <td class="px-6 py-4 whitespace-nowrap">
                     <span class="inline-flex items-center px-2.5 py-0.5 rounded-full text-xs font-medium ${
@@ -256,9 +397,11 @@ async function loadLogs() {
                         log.event === 'connected' ? 'bg-blue-100 text-blue-800' :
                         log.event === 'disconnected' ? 'bg-gray-100 text-gray-800' :
                         log.event === 'roamed' ? 'bg-yellow-100 text-yellow-800' :
+                        log.event === 'would_open' ? 'bg-purple-100 text-purple-800' :
+                        log.event === 'ignored_weak_signal' ? 'bg-gray-100 text-gray-800' :
                         'bg-red-100 text-red-800'
                     }">
-                        ${log.event.replace('_', ' ')}
+                        ${log.event.replace(/_/g, ' ')}
                     </span>
                 </td>
                 <td class="px-6 py-4 whitespace-nowrap text-sm text-gray-500 dark:text-gray-400">
@@ -268,7 +411,7 @@ async function loadLogs() {
                     ${log.gate_opened ? '<i class="fas fa-check text-green-500"></i>' : '-'}
                 </td>
                 <td class="px-6 py-4 text-sm text-gray-500 dark:text-gray-400">
-                    ${log.message}
+                    ${escapeHtml(log.message)}${log.count > 1 ? ` (×${log.count})` : ''}
                 </td>
             `;
             tbody.appendChild(row);
@@ -290,11 +433,13 @@ async function loadSettings() {
         document.getElementById('settings-unifi-username').value = settings.unifi.username;
         document.getElementById('settings-unifi-site').value = settings.unifi.site_id;
         document.getElementById('settings-poll-interval').value = settings.unifi.poll_interval;
+        document.getElementById('settings-min-signal').value = settings.unifi.min_signal || 0;
         
         // Gate settings
         document.getElementById('settings-shelly-url').value = settings.shelly.trigger_url;
         document.getElementById('settings-open-duration').value = settings.gate.open_duration;
         document.getElementById('settings-log-activity').checked = settings.gate.log_activity || false;
+        document.getElementById('settings-observe-only').checked = settings.gate.observe_only || false;
         
         // Load access points
         const apsResponse = await fetch('/api/unifi/aps');
@@ -327,14 +472,16 @@ async function saveSettings() {
             password: document.getElementById('settings-unifi-password').value,
             site_id: document.getElementById('settings-unifi-site').value,
             gate_ap_mac: document.getElementById('settings-gate-ap').value,
-            poll_interval: parseInt(document.getElementById('settings-poll-interval').value)
+            poll_interval: parseInt(document.getElementById('settings-poll-interval').value),
+            min_signal: parseInt(document.getElementById('settings-min-signal').value) || 0
         },
         shelly: {
             trigger_url: document.getElementById('settings-shelly-url').value
         },
         gate: {
             open_duration: parseInt(document.getElementById('settings-open-duration').value),
-            log_activity: document.getElementById('settings-log-activity').checked
+            log_activity: document.getElementById('settings-log-activity').checked,
+            observe_only: document.getElementById('settings-observe-only').checked
         }
     };
     
@@ -404,6 +551,23 @@ async function saveSettings() {
     }
 }
 
+// Send a test message through the configured notification providers
+async function testNotification() {
+    try {
+        const response = await fetch('/api/test-notification', {
+            method: 'POST'
+        });
+        const result = await response.json();
+        if (!response.ok) {
+            throw new Error(result.error || 'Failed to send test notification');
+        }
+        
+        alert('Test notification sent!');
+    } catch (error) {
+        alert('Failed to send test notification: ' + error.message);
+    }
+}
+
 // Gate control
 async function testGate() {
     if (!confirm('Are you sure you want to open the gate?')) {
@@ -411,12 +575,25 @@ async function testGate() {
     }
     
     try {
-        const response = await fetch('/api/test-gate', {
+        // One-time confirmation, required when the server enforces it
+        const confirmation = await fetch('/api/test-gate/confirm', {
             method: 'POST'
         });
+        if (!confirmation.ok) {
+            throw new Error('Failed to confirm gate open');
+        }
+        const { nonce } = await confirmation.json();
+        
+        const response = await fetch('/api/test-gate', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ nonce })
+        });
         
         if (!response.ok) {
-            throw new Error('Failed to trigger gate');
+            throw new Error((await response.text()).trim() || 'Failed to trigger gate');
         }
         
         alert('Gate opened successfully!');
@@ -427,6 +604,30 @@ async function testGate() {
     }
 }
 
+// Build and send the open request somewhere harmless, to check its shape
+async function dryOpenGate() {
+    try {
+        const response = await fetch('/api/test-gate?dry=true', {
+            method: 'POST'
+        });
+        if (!response.headers.get('Content-Type')?.includes('application/json')) {
+            throw new Error((await response.text()).trim() || 'Dry run failed');
+        }
+        const result = await response.json();
+        const request = result.request;
+        const headers = Object.entries(request.headers || {})
+            .map(([name, value]) => `  ${name}: ${value}`)
+            .join('\n');
+        
+        alert((result.success ? 'Dry run succeeded, the gate was not opened.' : 'Dry run failed: ' + result.error) + '\n\n' +
+            `${request.method} ${request.url}\n${headers}` +
+            (request.body ? `\n\n${request.body}` : '') +
+            `\n\nSent as ${request.sent_method} to ${request.sent_to}, status ${request.status}`);
+    } catch (error) {
+        alert('Dry run failed: ' + error.message);
+    }
+}
+
 // Real-time updates
 async function updateStatus() {
     try {
@@ -475,6 +676,10 @@ async function updateRecentActivity() {
                     icon = 'fa-exchange-alt';
                     iconColor = 'text-yellow-500';
                     break;
+                case 'would_open':
+                    icon = 'fa-eye';
+                    iconColor = 'text-purple-500';
+                    break;
                 default:
                     icon = 'fa-info-circle';
                     iconColor = 'text-gray-500';
@@ -488,10 +693,10 @@ async function updateRecentActivity() {
                         </div>
                         <div class="ml-3">
                             <p class="text-sm font-medium text-gray-900 dark:text-white">
-                                ${log.device_name} ${log.device_mac ? `(${log.device_mac})` : ''}
+                                ${escapeHtml(log.device_name)} ${log.device_mac ? `(${escapeHtml(log.device_mac)})` : ''}
                             </p>
                             <p class="text-sm text-gray-500 dark:text-gray-400">
-                                ${log.message}
+                                ${escapeHtml(log.message)}
                             </p>
                         </div>
                     </div>
@@ -509,10 +714,31 @@ async function updateRecentActivity() {
     }
 }
 
+// Live updates, refreshes as soon as a device moves or the gate opens
+function connectLiveUpdates() {
+    const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+    const socket = new WebSocket(`${protocol}//${window.location.host}/api/ws`);
+    
+    socket.onmessage = () => {
+        updateStatus();
+        updateRecentActivity();
+        loadDevices();
+    };
+    socket.onclose = (event) => {
+        // 1008: logged out or the session was revoked
+        if (event.code === 1008) {
+            window.location.href = '/login';
+            return;
+        }
+        setTimeout(connectLiveUpdates, 5000);
+    };
+}
+
 // Initialize and set up auto-refresh
 document.addEventListener('DOMContentLoaded', () => {
     updateStatus();
     updateRecentActivity();
+    connectLiveUpdates();
     
     // Update every 10 seconds
     setInterval(() => {
@@ -90,6 +90,25 @@ async function validateStep(step) {
             testBtn.innerHTML = '<i class="fas fa-spinner fa-spin mr-2"></i>Testing Connection...';
             
             try {
+                // Find out which API paths the controller uses, UniFi OS
+                // consoles like the UDM Pro differ from standalone controllers
+                const probeResponse = await fetch('/api/test-unifi-paths', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                    },
+                    body: JSON.stringify({
+                        controller_url: url,
+                        username: unifiUser,
+                        password: unifiPass
+                    })
+                });
+                const probe = await probeResponse.json();
+                if (!probe.success) {
+                    throw new Error(probe.error || 'Failed to connect to UniFi Controller');
+                }
+                setupData.unifi.unifi_os = probe.unifi_os;
+
                 const response = await fetch('/api/test-unifi', {
                     method: 'POST',
                     headers: {
@@ -99,7 +118,8 @@ async function validateStep(step) {
                         controller_url: url,
                         username: unifiUser,
                         password: unifiPass,
-                        site_id: 'default' // Test with default site first
+                        site_id: 'default', // Test with default site first
+                        unifi_os: probe.unifi_os
                     })
                 });
                 
@@ -213,7 +233,8 @@ async function loadSites() {
         controller_url: setupData.unifi.controller_url,
         username: setupData.unifi.username,
         password: setupData.unifi.password,
-        site_id: 'default' // Get sites from default first
+        site_id: 'default', // Get sites from default first
+        unifi_os: setupData.unifi.unifi_os
     };
     
     try {
@@ -299,7 +320,8 @@ async function loadAccessPoints() {
         controller_url: setupData.unifi.controller_url,
         username: setupData.unifi.username,
         password: setupData.unifi.password,
-        site_id: setupData.unifi.site_id
+        site_id: setupData.unifi.site_id,
+        unifi_os: setupData.unifi.unifi_os
     };
     
     try {
@@ -381,21 +403,27 @@ async function finishSetup() {
         });
         
         if (!response.ok) {
-            throw new Error('Setup failed');
+            const message = (await response.text()).trim();
+            throw new Error(message || 'Setup failed');
         }
         
+        const result = await response.json();
+        
         // Show success message
         document.getElementById('setup-form').classList.add('hidden');
         document.getElementById('setup-success').classList.remove('hidden');
+        if (result.login_required) {
+            document.getElementById('setup-redirect').textContent = 'Redirecting to login...';
+        }
         
-        // Redirect to dashboard after 2 seconds
+        // Redirect to dashboard, or to log in first, after 2 seconds
         setTimeout(() => {
-            window.location.href = '/dashboard';
+            window.location.href = result.login_required ? '/login' : '/dashboard';
         }, 2000);
         
     } catch (error) {
         console.error('Setup error:', error);
-        alert('Setup failed. Please check your settings and try again.');
+        alert(`Setup failed: ${error.message}. Please check your settings and try again.`);
     }
 }
 
@@ -5,19 +5,22 @@ go 1.23
 toolchain go1.24.1
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.4.3
 	github.com/gorilla/mux v1.8.1
+	github.com/gorilla/securecookie v1.1.2
 	github.com/gorilla/sessions v1.2.2
+	github.com/gorilla/websocket v1.5.3
 	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/viper v1.18.2
 	github.com/unpoller/unifi/v5 v5.1.0
 	golang.org/x/crypto v0.31.0
+	golang.org/x/sync v0.10.0
 )
 
 require (
 	github.com/brianvoe/gofakeit/v6 v6.28.0 // indirect
 	github.com/fsnotify/fsnotify v1.7.0 // indirect
-	github.com/gorilla/securecookie v1.1.2 // indirect
 	github.com/hashicorp/hcl v1.0.1-vault-5 // indirect
 	github.com/magiconair/properties v1.8.7 // indirect
 	github.com/mitchellh/mapstructure v1.5.0 // indirect
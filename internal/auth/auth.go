@@ -1,24 +1,84 @@
 package auth
 
 import (
+	"encoding/base32"
+	"fmt"
+	"math/rand/v2"
 	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
 
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 )
 
 const (
-	SessionName = "gate-opener-session"
-	UserKey     = "authenticated"
+	SessionName     = "gate-opener-session"
+	UserKey         = "authenticated"
+	LastActivityKey = "last_activity"
+	VersionKey      = "session_version"
 )
 
 type SessionStore struct {
-	store *sessions.CookieStore
+	store       sessions.Store
+	idleTimeout time.Duration
+	now         func() time.Time
+
+	// Set with the filesystem backend, whose sessions can be listed
+	fs  *sessions.FilesystemStore
+	dir string
+
+	// With singleSession each login bumps version and only the session
+	// carrying the current version stays valid. It starts at a random value
+	// so cookies from before a restart don't match again.
+	singleSession bool
+	version       atomic.Int64
 }
 
 func NewSessionStore(secret string) *SessionStore {
-	return &SessionStore{
+	s := &SessionStore{
 		store: sessions.NewCookieStore([]byte(secret)),
+		now:   time.Now,
 	}
+	s.seedVersion()
+	return s
+}
+
+// NewFilesystemSessionStore keeps session data in dir and only an ID in the
+// cookie, so logging out revokes the session on the server as well
+func NewFilesystemSessionStore(secret, dir string) (*SessionStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	fs := sessions.NewFilesystemStore(dir, []byte(secret))
+	s := &SessionStore{
+		store: fs,
+		now:   time.Now,
+		fs:    fs,
+		dir:   dir,
+	}
+	s.seedVersion()
+	return s, nil
+}
+
+// seedVersion starts the single-session version at a random value, leaving
+// room for plenty of logins before it could overflow
+func (s *SessionStore) seedVersion() {
+	s.version.Store(rand.Int64N(1 << 62))
+}
+
+// SetIdleTimeout logs sessions out after the given period without an
+// authenticated request. Zero disables the idle check.
+func (s *SessionStore) SetIdleTimeout(timeout time.Duration) {
+	s.idleTimeout = timeout
+}
+
+// SetSingleSession makes every login invalidate all earlier sessions. The
+// version lives in memory, so a restart logs everyone out in this mode.
+func (s *SessionStore) SetSingleSession(single bool) {
+	s.singleSession = single
 }
 
 func (s *SessionStore) GetSession(r *http.Request) (*sessions.Session, error) {
@@ -51,16 +111,80 @@ func (s *SessionStore) IsAuthenticated(r *http.Request) bool {
 	}
 
 	auth, ok := session.Values[UserKey].(bool)
-	return ok && auth
+	if !ok || !auth {
+		return false
+	}
+
+	return !s.idle(session) && !s.superseded(session)
+}
+
+// superseded reports whether a newer login replaced the session
+func (s *SessionStore) superseded(session *sessions.Session) bool {
+	if !s.singleSession {
+		return false
+	}
+
+	version, ok := session.Values[VersionKey].(int64)
+	return !ok || version != s.version.Load()
+}
+
+// idle reports whether the session has gone unused for longer than the idle timeout
+func (s *SessionStore) idle(session *sessions.Session) bool {
+	if s.idleTimeout <= 0 {
+		return false
+	}
+
+	lastActivity, ok := session.Values[LastActivityKey].(int64)
+	if !ok {
+		return true
+	}
+	return s.now().Sub(time.Unix(lastActivity, 0)) > s.idleTimeout
+}
+
+// Touch records activity on an authenticated session so the idle timeout
+// starts over. Without an idle timeout it only keeps the last activity of
+// server-side sessions roughly current for the session list.
+func (s *SessionStore) Touch(r *http.Request, w http.ResponseWriter) error {
+	if s.idleTimeout <= 0 && s.fs == nil {
+		return nil
+	}
+
+	session, err := s.GetSession(r)
+	if err != nil {
+		return err
+	}
+	if s.idleTimeout <= 0 {
+		// Don't rewrite the session file on every request
+		if last, ok := session.Values[LastActivityKey].(int64); ok && s.now().Sub(time.Unix(last, 0)) < activityInterval {
+			return nil
+		}
+	}
+
+	session.Values[LastActivityKey] = s.now().Unix()
+	return s.SaveSession(r, w, session)
 }
 
 func (s *SessionStore) Login(r *http.Request, w http.ResponseWriter) error {
+	return s.LoginAs(r, w, "")
+}
+
+// LoginAs logs in like Login and records which admin user logged in, see
+// Username
+func (s *SessionStore) LoginAs(r *http.Request, w http.ResponseWriter, username string) error {
 	session, err := s.GetSession(r)
 	if err != nil {
 		return err
 	}
 
 	session.Values[UserKey] = true
+	session.Values[UsernameKey] = username
+	session.Values[CreatedKey] = s.now().Unix()
+	session.Values[LastActivityKey] = s.now().Unix()
+	session.Values[IPKey] = remoteIP(r)
+	session.Values[LoginKey] = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(securecookie.GenerateRandomKey(16))
+	if s.singleSession {
+		session.Values[VersionKey] = s.version.Add(1)
+	}
 	return s.SaveSession(r, w, session)
 }
 
@@ -1,8 +1,12 @@
 package auth
 
 import (
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestNewSessionStore(t *testing.T) {
@@ -308,4 +312,204 @@ func TestAuthenticationEdgeCases(t *testing.T) {
 			t.Error("Session authenticated value should be true")
 		}
 	})
-}
\ No newline at end of file
+}
+func TestFilesystemSessionStore(t *testing.T) {
+	secret := "test-secret-key-32-characters!!"
+	dir := filepath.Join(t.TempDir(), "sessions")
+
+	store, err := NewFilesystemSessionStore(secret, dir)
+	if err != nil {
+		t.Fatalf("Failed to create filesystem session store: %v", err)
+	}
+
+	sessionCookie := func(w *httptest.ResponseRecorder) *http.Cookie {
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == SessionName {
+				return cookie
+			}
+		}
+		t.Fatal("Session cookie should be set")
+		return nil
+	}
+	sessionFiles := func() int {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("Failed to read session directory: %v", err)
+		}
+		return len(entries)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	if store.IsAuthenticated(req) {
+		t.Error("User should not be authenticated initially")
+	}
+
+	w := httptest.NewRecorder()
+	if err := store.Login(req, w); err != nil {
+		t.Fatalf("Failed to login user: %v", err)
+	}
+	cookie := sessionCookie(w)
+	if sessionFiles() != 1 {
+		t.Errorf("Expected one session file after login, got %d", sessionFiles())
+	}
+
+	authReq := httptest.NewRequest("GET", "/", nil)
+	authReq.AddCookie(cookie)
+	if !store.IsAuthenticated(authReq) {
+		t.Error("User should be authenticated after login")
+	}
+
+	if err := store.Logout(authReq, httptest.NewRecorder()); err != nil {
+		t.Fatalf("Failed to logout user: %v", err)
+	}
+	if sessionFiles() != 0 {
+		t.Errorf("Expected session file to be removed on logout, got %d", sessionFiles())
+	}
+
+	// Unlike the cookie store, replaying the old cookie no longer works
+	replayReq := httptest.NewRequest("GET", "/", nil)
+	replayReq.AddCookie(cookie)
+	if store.IsAuthenticated(replayReq) {
+		t.Error("Old session cookie should be revoked after logout")
+	}
+}
+
+func TestSessionIdleTimeout(t *testing.T) {
+	store := NewSessionStore("test-secret-key-32-characters!!")
+	store.SetIdleTimeout(15 * time.Minute)
+
+	clock := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return clock }
+
+	// withCookie builds a fresh request carrying the latest session cookie
+	var cookie *http.Cookie
+	withCookie := func() *http.Request {
+		req := httptest.NewRequest("GET", "/", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		return req
+	}
+	saveCookie := func(w *httptest.ResponseRecorder) {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == SessionName {
+				cookie = c
+			}
+		}
+	}
+
+	w := httptest.NewRecorder()
+	if err := store.Login(withCookie(), w); err != nil {
+		t.Fatalf("Failed to login user: %v", err)
+	}
+	saveCookie(w)
+
+	t.Run("Active within idle window", func(t *testing.T) {
+		clock = clock.Add(10 * time.Minute)
+		req := withCookie()
+		if !store.IsAuthenticated(req) {
+			t.Fatal("User should still be authenticated within the idle window")
+		}
+
+		w := httptest.NewRecorder()
+		if err := store.Touch(req, w); err != nil {
+			t.Fatalf("Failed to touch session: %v", err)
+		}
+		saveCookie(w)
+	})
+
+	t.Run("Activity restarts the idle window", func(t *testing.T) {
+		// 20 minutes since login, but only 10 since the last request
+		clock = clock.Add(10 * time.Minute)
+		if !store.IsAuthenticated(withCookie()) {
+			t.Error("User should be authenticated after recent activity")
+		}
+	})
+
+	t.Run("Idle past the timeout", func(t *testing.T) {
+		clock = clock.Add(6 * time.Minute)
+		if store.IsAuthenticated(withCookie()) {
+			t.Error("User should be logged out after the idle timeout")
+		}
+	})
+
+	t.Run("Disabled idle timeout", func(t *testing.T) {
+		store.SetIdleTimeout(0)
+		if !store.IsAuthenticated(withCookie()) {
+			t.Error("User should be authenticated when the idle timeout is disabled")
+		}
+	})
+}
+
+func TestSingleSession(t *testing.T) {
+	// login returns the cookie of a fresh login from another browser
+	login := func(t *testing.T, store *SessionStore) *http.Cookie {
+		t.Helper()
+		w := httptest.NewRecorder()
+		if err := store.Login(httptest.NewRequest("POST", "/login", nil), w); err != nil {
+			t.Fatalf("Failed to login user: %v", err)
+		}
+		for _, c := range w.Result().Cookies() {
+			if c.Name == SessionName {
+				return c
+			}
+		}
+		t.Fatal("Login did not set a session cookie")
+		return nil
+	}
+	authenticated := func(store *SessionStore, cookie *http.Cookie) bool {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(cookie)
+		return store.IsAuthenticated(req)
+	}
+
+	t.Run("New login invalidates older sessions", func(t *testing.T) {
+		store := NewSessionStore("test-secret-key-32-characters!!")
+		store.SetSingleSession(true)
+
+		first := login(t, store)
+		if !authenticated(store, first) {
+			t.Fatal("First session should be authenticated")
+		}
+
+		second := login(t, store)
+		if authenticated(store, first) {
+			t.Error("First session should be invalidated by the second login")
+		}
+		if !authenticated(store, second) {
+			t.Error("Second session should be authenticated")
+		}
+	})
+
+	t.Run("Sessions from before a restart are invalid", func(t *testing.T) {
+		store := NewSessionStore("test-secret-key-32-characters!!")
+		store.SetSingleSession(true)
+		old := login(t, store)
+
+		restarted := NewSessionStore("test-secret-key-32-characters!!")
+		restarted.SetSingleSession(true)
+		if authenticated(restarted, old) {
+			t.Error("Session from before the restart should not be authenticated")
+		}
+	})
+
+	t.Run("Sessions from before enabling are invalid", func(t *testing.T) {
+		store := NewSessionStore("test-secret-key-32-characters!!")
+		old := login(t, store)
+
+		store.SetSingleSession(true)
+		if authenticated(store, old) {
+			t.Error("Session without a version should not be authenticated")
+		}
+	})
+
+	t.Run("Multiple sessions allowed by default", func(t *testing.T) {
+		store := NewSessionStore("test-secret-key-32-characters!!")
+
+		first := login(t, store)
+		second := login(t, store)
+		if !authenticated(store, first) || !authenticated(store, second) {
+			t.Error("Both sessions should stay authenticated")
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	CreatedKey = "created"
+	IPKey      = "ip"
+	LoginKey   = "login" // random per login, see LoginID
+	// UsernameKey is the admin user who logged in, empty for sessions of
+	// versions with a single admin
+	UsernameKey = "username"
+
+	// sessionFilePrefix is how the filesystem store names its session files
+	sessionFilePrefix = "session_"
+
+	// activityInterval throttles recording activity just for the listing
+	activityInterval = time.Minute
+)
+
+var (
+	ErrSessionsNotTracked = errors.New("sessions are only tracked with the filesystem session backend")
+	ErrSessionNotFound    = errors.New("session not found")
+)
+
+// SessionInfo describes an active server-side session
+type SessionInfo struct {
+	ID           string    `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastActivity time.Time `json:"last_activity"`
+	IP           string    `json:"ip"`
+	Username     string    `json:"username,omitempty"`
+}
+
+// TracksSessions reports whether sessions live on the server, so they can be
+// listed and revoked
+func (s *SessionStore) TracksSessions() bool {
+	return s.fs != nil
+}
+
+// SessionID returns the server-side ID of the request's session, empty if it
+// has none
+func (s *SessionStore) SessionID(r *http.Request) string {
+	if s.fs == nil {
+		return ""
+	}
+	session, err := s.GetSession(r)
+	if err != nil || session.IsNew {
+		return ""
+	}
+	return session.ID
+}
+
+// LoginID returns an ID shared by all requests of the same login, however
+// often its cookie was rewritten since, empty without a session
+func (s *SessionStore) LoginID(r *http.Request) string {
+	session, err := s.GetSession(r)
+	if err != nil || session.IsNew {
+		return ""
+	}
+	if id, ok := session.Values[LoginKey].(string); ok {
+		return id
+	}
+	// Logged in before login IDs were recorded
+	return session.ID
+}
+
+// Username returns the admin user the request's session logged in as,
+// empty if it isn't logged in or logged in before there were several
+func (s *SessionStore) Username(r *http.Request) string {
+	session, err := s.GetSession(r)
+	if err != nil || session.IsNew {
+		return ""
+	}
+	username, _ := session.Values[UsernameKey].(string)
+	return username
+}
+
+// Sessions lists the authenticated sessions, most recently active first
+func (s *SessionStore) Sessions() ([]SessionInfo, error) {
+	if s.fs == nil {
+		return nil, ErrSessionsNotTracked
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session directory: %w", err)
+	}
+
+	list := []SessionInfo{}
+	for _, entry := range entries {
+		id, ok := strings.CutPrefix(entry.Name(), sessionFilePrefix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		session, err := s.loadSession(id)
+		if err != nil {
+			// Expired or written with another secret
+			continue
+		}
+		if auth, _ := session.Values[UserKey].(bool); !auth || s.idle(session) || s.superseded(session) {
+			continue
+		}
+
+		info := SessionInfo{ID: id}
+		if created, ok := session.Values[CreatedKey].(int64); ok {
+			info.CreatedAt = time.Unix(created, 0)
+		}
+		if lastActivity, ok := session.Values[LastActivityKey].(int64); ok {
+			info.LastActivity = time.Unix(lastActivity, 0)
+		}
+		info.IP, _ = session.Values[IPKey].(string)
+		info.Username, _ = session.Values[UsernameKey].(string)
+		list = append(list, info)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastActivity.After(list[j].LastActivity)
+	})
+	return list, nil
+}
+
+// Revoke ends a session, whoever holds its cookie is logged out
+func (s *SessionStore) Revoke(id string) error {
+	if s.fs == nil {
+		return ErrSessionsNotTracked
+	}
+	// IDs are base32, anything else could escape the directory
+	if id == "" || strings.Trim(id, "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567") != "" {
+		return ErrSessionNotFound
+	}
+
+	if err := os.Remove(filepath.Join(s.dir, sessionFilePrefix+id)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrSessionNotFound
+		}
+		return fmt.Errorf("failed to remove session: %w", err)
+	}
+	return nil
+}
+
+// loadSession decodes a session file the way the filesystem store does
+func (s *SessionStore) loadSession(id string) (*sessions.Session, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, sessionFilePrefix+id))
+	if err != nil {
+		return nil, err
+	}
+
+	session := sessions.NewSession(s.fs, SessionName)
+	session.ID = id
+	if err := securecookie.DecodeMulti(SessionName, string(data), &session.Values, s.fs.Codecs...); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// remoteIP is the address the request came from, without the port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionListing(t *testing.T) {
+	newStore := func(t *testing.T) (*SessionStore, string) {
+		dir := filepath.Join(t.TempDir(), "sessions")
+		store, err := NewFilesystemSessionStore("test-secret-key-32-characters!!", dir)
+		if err != nil {
+			t.Fatalf("Failed to create filesystem session store: %v", err)
+		}
+		return store, dir
+	}
+	login := func(t *testing.T, store *SessionStore, remoteAddr string) *http.Cookie {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/login", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		if err := store.Login(req, w); err != nil {
+			t.Fatalf("Failed to login user: %v", err)
+		}
+		for _, c := range w.Result().Cookies() {
+			if c.Name == SessionName {
+				return c
+			}
+		}
+		t.Fatal("Login did not set a session cookie")
+		return nil
+	}
+	request := func(cookie *http.Cookie) *http.Request {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(cookie)
+		return req
+	}
+
+	t.Run("Lists and revokes sessions", func(t *testing.T) {
+		store, _ := newStore(t)
+		now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		store.now = func() time.Time { return now }
+
+		laptop := login(t, store, "192.168.1.10:51234")
+		now = now.Add(time.Hour)
+		phone := login(t, store, "[fd00::20]:443")
+
+		sessions, err := store.Sessions()
+		if err != nil {
+			t.Fatalf("Failed to list sessions: %v", err)
+		}
+		if len(sessions) != 2 {
+			t.Fatalf("Expected 2 sessions, got %+v", sessions)
+		}
+		// Most recently active first
+		if sessions[0].IP != "fd00::20" || !sessions[0].CreatedAt.Equal(now) {
+			t.Errorf("Expected the phone session first, got %+v", sessions[0])
+		}
+		if sessions[1].IP != "192.168.1.10" {
+			t.Errorf("Expected the laptop session second, got %+v", sessions[1])
+		}
+		if id := store.SessionID(request(phone)); id != sessions[0].ID {
+			t.Errorf("Expected the phone's session ID %q, got %q", sessions[0].ID, id)
+		}
+
+		if err := store.Revoke(sessions[0].ID); err != nil {
+			t.Fatalf("Failed to revoke session: %v", err)
+		}
+		if store.IsAuthenticated(request(phone)) {
+			t.Error("Revoked session should not be authenticated")
+		}
+		if !store.IsAuthenticated(request(laptop)) {
+			t.Error("Other session should stay authenticated")
+		}
+		if sessions, _ := store.Sessions(); len(sessions) != 1 {
+			t.Errorf("Expected 1 session left, got %+v", sessions)
+		}
+	})
+
+	t.Run("Touch records activity", func(t *testing.T) {
+		store, _ := newStore(t)
+		now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		store.now = func() time.Time { return now }
+		cookie := login(t, store, "192.168.1.10:51234")
+
+		now = now.Add(10 * time.Minute)
+		if err := store.Touch(request(cookie), httptest.NewRecorder()); err != nil {
+			t.Fatalf("Failed to touch session: %v", err)
+		}
+
+		sessions, _ := store.Sessions()
+		if len(sessions) != 1 || !sessions[0].LastActivity.Equal(now) {
+			t.Errorf("Expected last activity at %v, got %+v", now, sessions)
+		}
+	})
+
+	t.Run("Logged out sessions aren't listed", func(t *testing.T) {
+		store, dir := newStore(t)
+		cookie := login(t, store, "192.168.1.10:51234")
+		if err := store.Logout(request(cookie), httptest.NewRecorder()); err != nil {
+			t.Fatalf("Failed to logout user: %v", err)
+		}
+		// A stray file isn't a session either
+		if err := os.WriteFile(filepath.Join(dir, "session_BOGUS"), []byte("garbage"), 0600); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+
+		if sessions, err := store.Sessions(); err != nil || len(sessions) != 0 {
+			t.Errorf("Expected no sessions, got %+v (%v)", sessions, err)
+		}
+	})
+
+	t.Run("Revoke rejects unknown IDs", func(t *testing.T) {
+		store, _ := newStore(t)
+		for _, id := range []string{"", "MISSING", "../config.yaml", "abc"} {
+			if err := store.Revoke(id); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("Revoke(%q): expected ErrSessionNotFound, got %v", id, err)
+			}
+		}
+	})
+
+	t.Run("Cookie sessions can't be listed", func(t *testing.T) {
+		store := NewSessionStore("test-secret-key-32-characters!!")
+		if _, err := store.Sessions(); !errors.Is(err, ErrSessionsNotTracked) {
+			t.Errorf("Expected ErrSessionsNotTracked, got %v", err)
+		}
+		if err := store.Revoke("ABC"); !errors.Is(err, ErrSessionsNotTracked) {
+			t.Errorf("Expected ErrSessionsNotTracked, got %v", err)
+		}
+	})
+}
+
+func TestSessionUsername(t *testing.T) {
+	store, err := NewFilesystemSessionStore("test-secret-key-32-characters!!", filepath.Join(t.TempDir(), "sessions"))
+	if err != nil {
+		t.Fatalf("Failed to create filesystem session store: %v", err)
+	}
+	login := func(username string) *http.Request {
+		w := httptest.NewRecorder()
+		if err := store.LoginAs(httptest.NewRequest("POST", "/login", nil), w, username); err != nil {
+			t.Fatalf("Failed to login: %v", err)
+		}
+		req := httptest.NewRequest("GET", "/", nil)
+		for _, c := range w.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		return req
+	}
+
+	req := login("alice")
+	if got := store.Username(req); got != "alice" {
+		t.Errorf("Expected username alice, got %q", got)
+	}
+	sessions, err := store.Sessions()
+	if err != nil || len(sessions) != 1 || sessions[0].Username != "alice" {
+		t.Errorf("Expected alice's session listed, got %+v (%v)", sessions, err)
+	}
+
+	if got := store.Username(login("")); got != "" {
+		t.Errorf("Expected no username for a plain login, got %q", got)
+	}
+	if got := store.Username(httptest.NewRequest("GET", "/", nil)); got != "" {
+		t.Errorf("Expected no username without a session, got %q", got)
+	}
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// APITokenPrefix starts every API token, so they are easy to spot in
+// scripts and secret scanners
+const APITokenPrefix = "ugo_"
+
+// NewAPIToken generates an API token of the form ugo_<id>_<secret>. The ID
+// is stored in the clear to find the token again, only the bcrypt hash of
+// the whole token is kept, the same as the admin password.
+func NewAPIToken() (token, id, hash string, err error) {
+	idBytes := make([]byte, 4)
+	secret := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	id = hex.EncodeToString(idBytes)
+	token = APITokenPrefix + id + "_" + hex.EncodeToString(secret)
+	hashed, err := bcrypt.GenerateFromPassword([]byte(token), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", "", err
+	}
+	return token, id, string(hashed), nil
+}
+
+// APITokenID returns the ID part of an API token, false if it isn't one
+func APITokenID(token string) (string, bool) {
+	rest, ok := strings.CutPrefix(token, APITokenPrefix)
+	if !ok {
+		return "", false
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// VerifyAPIToken reports whether token matches the stored hash
+func VerifyAPIToken(hash, token string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(token)) == nil
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAPITokens(t *testing.T) {
+	token, id, hash, err := NewAPIToken()
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if !strings.HasPrefix(token, APITokenPrefix+id+"_") || strings.Contains(hash, token) {
+		t.Fatalf("Unexpected token %q with ID %q and hash %q", token, id, hash)
+	}
+
+	if got, ok := APITokenID(token); !ok || got != id {
+		t.Errorf("Expected ID %q, got %q (%v)", id, got, ok)
+	}
+	for _, bad := range []string{"", "ugo_", "ugo_abc", "ugo__secret", "abc_def", id} {
+		if _, ok := APITokenID(bad); ok {
+			t.Errorf("%q: expected not to be a token", bad)
+		}
+	}
+
+	if !VerifyAPIToken(hash, token) {
+		t.Error("Expected the token to match its hash")
+	}
+	if VerifyAPIToken(hash, token+"x") {
+		t.Error("Expected another token not to match")
+	}
+
+	other, otherID, _, err := NewAPIToken()
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if other == token || otherID == id {
+		t.Error("Expected tokens to differ")
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BundleVersion is the current portable bundle format
+const BundleVersion = 1
+
+// Bundle is the portable part of a configuration, used to clone devices and
+// gate behavior to another instance. UniFi credentials, the gate relays and
+// anything else tied to a particular site are left out, so devices keep
+// their gate assignment only where the target has a gate of that name.
+type Bundle struct {
+	Version    int            `json:"version"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Devices    []DeviceConfig `json:"devices"`
+	Gate       GateConfig     `json:"gate"`
+}
+
+// ExportBundle returns the portable part of the configuration
+func (c *Config) ExportBundle() Bundle {
+	now := time.Now()
+	devices := make([]DeviceConfig, 0, len(c.Devices))
+	for _, d := range c.Devices {
+		// Temporary devices that already ran out would only be removed again
+		if d.ExpiresAt != nil && !now.Before(*d.ExpiresAt) {
+			continue
+		}
+		// Presence history belongs to this instance
+		d.LastSeen = time.Time{}
+		d.LastTriggered = time.Time{}
+		devices = append(devices, d)
+	}
+
+	return Bundle{
+		Version:    BundleVersion,
+		ExportedAt: now.UTC(),
+		Devices:    devices,
+		Gate:       c.Gate,
+	}
+}
+
+// Validate checks that a bundle can be imported
+func (b Bundle) Validate() error {
+	if b.Version != BundleVersion {
+		return fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	if b.Gate.OpenDuration < 0 {
+		return fmt.Errorf("gate open duration must not be negative")
+	}
+	if b.Gate.PreOpenDelay < 0 {
+		return fmt.Errorf("gate pre-open delay must not be negative")
+	}
+
+	seen := make(map[string]bool, len(b.Devices))
+	for i, d := range b.Devices {
+		key, err := NormalizeMAC(d.MAC)
+		if err != nil {
+			return fmt.Errorf("device %d: invalid MAC address %q", i+1, d.MAC)
+		}
+		if seen[key] {
+			return fmt.Errorf("device %d: duplicate MAC address %s", i+1, d.MAC)
+		}
+		seen[key] = true
+		if err := d.Notifications.Validate(); err != nil {
+			return fmt.Errorf("device %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// ImportBundle validates b and replaces the devices and gate settings with it.
+// Nothing is changed when b is refused.
+func (c *Config) ImportBundle(b Bundle) error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	next := *c
+	next.Gate = b.Gate
+	if err := next.CheckCloseOnDeparture(); err != nil {
+		return err
+	}
+
+	devices := make([]DeviceConfig, len(b.Devices))
+	for i, d := range b.Devices {
+		if strings.TrimSpace(d.Name) == "" {
+			d.Name = d.MAC
+		}
+		d.MAC, _ = NormalizeMAC(d.MAC) // validated above
+		gateName, err := c.ResolveGate(d.Gate)
+		if err != nil {
+			return fmt.Errorf("device %s: %w", d.MAC, err)
+		}
+		d.Gate = gateName
+		d.LastSeen = time.Time{}
+		d.LastTriggered = time.Time{}
+		devices[i] = d
+	}
+
+	c.Devices = devices
+	c.Gate = b.Gate
+	return nil
+}
@@ -4,27 +4,80 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/spf13/viper"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// MaxDeviceNameLength is the longest device name kept, in characters
+const MaxDeviceNameLength = 64
+
+// Errors returned by the device management methods
+var (
+	ErrDeviceExists        = errors.New("device already exists")
+	ErrDeviceNotFound      = errors.New("device not found")
+	ErrDuplicateDeviceName = errors.New("another device already has this name")
+	ErrInvalidMAC          = errors.New("invalid MAC address")
+)
+
+// Password policy applied when the policy settings are left at zero
+const (
+	DefaultMinPasswordLength  = 8
+	DefaultMinPasswordClasses = 2
+)
+
+// Log retention applied when the retention settings are left at zero
+const (
+	DefaultLogRetentionDays      = 30
+	DefaultGateOpenRetentionDays = 365
+)
+
 type Config struct {
 	Admin         AdminConfig    `mapstructure:"admin"`
 	UniFi         UniFiConfig    `mapstructure:"unifi"`
 	Shelly        ShellyConfig   `mapstructure:"shelly"`
 	Gate          GateConfig     `mapstructure:"gate"`
+	Server        ServerConfig   `mapstructure:"server"`
+	Notifications NotifyConfig   `mapstructure:"notifications"`
+	MQTT          MQTTConfig     `mapstructure:"mqtt"`
+	Database      DatabaseConfig `mapstructure:"database"`
 	DatabasePath  string         `mapstructure:"database_path"`
 	SessionSecret string         `mapstructure:"session_secret"`
 	Devices       []DeviceConfig `mapstructure:"devices"`
+	Gates         []RelayConfig  `mapstructure:"gates"` // gates besides the primary one under shelly
 	SetupComplete bool           `mapstructure:"setup_complete"`
+
+	UniqueDeviceNames bool `mapstructure:"unique_device_names"` // reject a name another device already uses
+
+	// Activity log message per event, e.g. gate_triggered, replacing the
+	// built-in English ones. Placeholders: {device}, {ap}, {direction} and
+	// {message}, the built-in message.
+	LogMessages map[string]string `mapstructure:"log_messages"`
 }
 
 type AdminConfig struct {
+	// Username and PasswordHash are the single admin of older versions,
+	// moved into Users when the config is loaded
 	Username     string `mapstructure:"username"`
 	PasswordHash string `mapstructure:"password_hash"`
+
+	Users []AdminUser `mapstructure:"users"`
+
+	// LegacyUser is the single admin that was moved into Users. Sessions
+	// from before the move carry no username and belong to this user.
+	LegacyUser string `mapstructure:"legacy_user"`
+
+	MinPasswordLength  int `mapstructure:"min_password_length"`  // 0 uses the default
+	MinPasswordClasses int `mapstructure:"min_password_classes"` // of lowercase, uppercase, digits and symbols, 0 uses the default
 }
 
 type UniFiConfig struct {
@@ -34,23 +87,337 @@ type UniFiConfig struct {
 	SiteID        string `mapstructure:"site_id"`
 	GateAPMAC     string `mapstructure:"gate_ap_mac"`
 	PollInterval  int    `mapstructure:"poll_interval"` // seconds
+	LoginTimeout  int    `mapstructure:"login_timeout"` // seconds per login attempt
+	LoginRetries  int    `mapstructure:"login_retries"` // retries for slow or unreachable controllers
+	StartupDelay  int    `mapstructure:"startup_delay"` // seconds to wait before logging in and polling the first time
+
+	// Use the UniFi OS API paths of consoles like the UDM Pro or Cloud Key
+	// Gen2 instead of detecting them, for when the detection gets it wrong
+	UnifiOS bool `mapstructure:"unifi_os"`
+
+	// Seconds the client list behind the add device picker is reused for, so
+	// a busy dashboard can't hammer the controller. 0 fetches every time.
+	ClientsCacheTTL int `mapstructure:"clients_cache_ttl"`
+
+	// Fewest seconds between two fetches of that client list, even with
+	// the cache disabled. Requests in between get the last list.
+	ClientsMinInterval int `mapstructure:"clients_min_interval"`
+
+	// Weakest signal in dBm, e.g. -70, a device may have at the gate AP to
+	// open the gate, so phones out on the street can't trigger it. 0 disables.
+	MinSignal int `mapstructure:"min_signal"`
+
+	// Seconds the newest last_seen reported by the controller may stay the
+	// same before its data counts as stale, e.g. a frozen or caching
+	// controller, and opens are suppressed. 0 disables.
+	StaleAfter int `mapstructure:"stale_after"`
+
+	// APs inside the property; leaving them for the gate AP or dropping off
+	// the network from them counts as leaving
+	InteriorAPMACs []string `mapstructure:"interior_ap_macs"`
+
+	// Daily periods when the controller is expected to be down; polling
+	// pauses instead of logging errors
+	MaintenanceWindows []MaintenanceWindow `mapstructure:"maintenance_windows"`
 }
 
 type ShellyConfig struct {
-	TriggerURL string `mapstructure:"trigger_url"`
+	TriggerURL string `mapstructure:"trigger_url"` // raw URL, takes precedence over host/channel/timer
+	Host       string `mapstructure:"host"`        // Gen1 relay host, e.g. 192.168.1.100
+	Channel    int    `mapstructure:"channel"`     // relay index
+	Timer      int    `mapstructure:"timer"`       // seconds until auto-off, 0 to leave on
+	CloseURL   string `mapstructure:"close_url"`   // closes the gate, for relays with a separate close action
+	Method     string `mapstructure:"method"`      // GET, POST or PUT for the trigger URL
+	Body       string `mapstructure:"body"`        // sent with POST and PUT, JSON or form data
+
+	// Credentials for relays behind an authenticating proxy: the bearer token
+	// wins, otherwise basic auth is sent with a username
+	Username    string `mapstructure:"username"`
+	Password    string `mapstructure:"password"`
+	BearerToken string `mapstructure:"bearer_token"`
+
+	// Relays that answer 200 without switching can be checked by their JSON
+	// response: the value at SuccessKey, e.g. "ison", must be SuccessValue
+	SuccessKey   string `mapstructure:"success_key"`
+	SuccessValue string `mapstructure:"success_value"`
+
+	// "gen1" GETs the trigger URL, "gen2" posts a Switch.Set RPC call for
+	// channel and timer to it, for Shelly Plus and Pro devices
+	APIVersion string `mapstructure:"api_version"`
+
+	// Where dry opens from the test-gate flow send the open request instead
+	// of the relay, e.g. an echo service. Dry opens fail without it.
+	DryOpenURL string `mapstructure:"dry_open_url"`
+
+	// Reuse connections to the relay. Off by default, relays on flaky links
+	// drop idle connections and the next open would fail on the stale one.
+	// With it on, idle connections are closed after IdleTimeout seconds.
+	KeepAlive   bool `mapstructure:"keep_alive"`
+	IdleTimeout int  `mapstructure:"idle_timeout"`
+}
+
+// PrimaryGate names the gate configured under shelly, which devices without
+// a gate of their own open
+const PrimaryGate = "main"
+
+// RelayConfig is an additional gate devices can be assigned to by name. Its
+// relay shares the shelly settings besides its URLs.
+type RelayConfig struct {
+	Name         string `mapstructure:"name" json:"name"`
+	TriggerURL   string `mapstructure:"trigger_url" json:"trigger_url"`
+	CloseURL     string `mapstructure:"close_url" json:"close_url,omitempty"`
+	OpenDuration int    `mapstructure:"open_duration" json:"open_duration"` // minutes, also the cooldown; 0 uses gate.open_duration
+}
+
+// IsGen2 reports whether the relay speaks the Gen2 RPC API
+func (s ShellyConfig) IsGen2() bool {
+	return s.APIVersion == "gen2"
 }
 
 type GateConfig struct {
-	OpenDuration int  `mapstructure:"open_duration"` // minutes (also used as cooldown)
-	LogActivity  bool `mapstructure:"log_activity"`  // whether to log device activity
+	OpenDuration     int  `mapstructure:"open_duration" json:"open_duration"`           // minutes (also used as cooldown)
+	ArrivingCooldown int  `mapstructure:"arriving_cooldown" json:"arriving_cooldown"`   // minutes before opening for an arrival again, 0 uses open_duration
+	LeavingCooldown  int  `mapstructure:"leaving_cooldown" json:"leaving_cooldown"`     // minutes before opening for a departure again, 0 uses open_duration
+	LogActivity      bool `mapstructure:"log_activity" json:"log_activity"`             // whether to log device activity
+	TriggerOnConnect bool `mapstructure:"trigger_on_connect" json:"trigger_on_connect"` // open when a device connects at the gate AP
+	TriggerOnRoam    bool `mapstructure:"trigger_on_roam" json:"trigger_on_roam"`       // open when a device roams to or from the gate AP
+	// Forget the cooldown once a device leaves the network, so it opens
+	// again right away when it comes back
+	ResetCooldownOnDeparture bool `mapstructure:"reset_cooldown_on_departure" json:"reset_cooldown_on_departure"`
+	// Open once more if the device is still at the gate AP when the gate closes
+	ReopenIfPresent bool `mapstructure:"reopen_if_present" json:"reopen_if_present"`
+	// Manual opens from the UI need a short-lived nonce from /api/test-gate/confirm
+	RequireOpenConfirmation bool `mapstructure:"require_open_confirmation" json:"require_open_confirmation"`
+	// Consecutive polls a device must be seen at the gate AP before opening,
+	// to ignore drive-bys. 1 opens on the first sighting.
+	ConfirmPolls int `mapstructure:"confirm_polls" json:"confirm_polls"`
+	// Seconds after a successful trigger during which further triggers are
+	// dropped, e.g. a manual and an automatic open at once. 0 disables it.
+	DebounceSeconds int `mapstructure:"debounce_seconds" json:"debounce_seconds"`
+	// Close the gate when a device drops off the network at the gate AP,
+	// i.e. it drove out and away. Needs shelly.close_url, and a close_url on
+	// every additional gate, see CheckCloseOnDeparture.
+	CloseOnDeparture bool `mapstructure:"close_on_departure" json:"close_on_departure"`
+	// Refuse manual opens while monitoring is stopped, e.g. when it was
+	// stopped to work on the gate. By default they always work.
+	ManualOpenRequiresMonitoring bool `mapstructure:"manual_open_requires_monitoring" json:"manual_open_requires_monitoring"`
+	// Seconds to wait after a device shows up at the gate AP before opening,
+	// for cars that reach it while still a way off. Moving away or dropping
+	// off cancels the open. 0 opens right away.
+	PreOpenDelay int `mapstructure:"pre_open_delay" json:"pre_open_delay"`
+	// Don't open for a device at the gate AP whose signal there is clearly
+	// falling, i.e. it's moving away. Needs a few readings at the gate AP,
+	// so raise confirm_polls or set a pre_open_delay along with it.
+	RequireApproaching bool `mapstructure:"require_approaching" json:"require_approaching"`
+	// Never open automatically, only log "would_open" with the reasons, to
+	// watch and tune a new install. Manual opens still work.
+	ObserveOnly bool `mapstructure:"observe_only" json:"observe_only"`
+	// Don't open when a device roams from one of unifi.interior_ap_macs to
+	// the gate AP, i.e. someone walking out to leave on foot. By default
+	// such roams open, for driving out.
+	IgnoreInteriorToGateRoams bool `mapstructure:"ignore_interior_to_gate_roams" json:"ignore_interior_to_gate_roams"`
+	// Let opens through /api/gate/trigger ignore the cooldown, by default
+	// they're refused within gate.open_duration of the previous one
+	ExternalTriggerBypassCooldown bool `mapstructure:"external_trigger_bypass_cooldown" json:"external_trigger_bypass_cooldown"`
+	// When automatic opens are allowed, around the clock unless set. Manual
+	// opens work at any time.
+	Schedule Schedule `mapstructure:"schedule" json:"schedule"`
+}
+
+type ServerConfig struct {
+	ReadTimeout  int  `mapstructure:"read_timeout"`  // seconds, 0 disables
+	WriteTimeout int  `mapstructure:"write_timeout"` // seconds, 0 disables (streams clear it per request)
+	IdleTimeout  int  `mapstructure:"idle_timeout"`  // seconds, 0 disables
+	Compression  bool `mapstructure:"compression"`   // gzip API responses for clients that accept it
+
+	SessionBackend     string `mapstructure:"session_backend"`      // "cookie" or "filesystem"
+	SessionDir         string `mapstructure:"session_dir"`          // directory for the filesystem backend
+	SessionIdleTimeout int    `mapstructure:"session_idle_timeout"` // minutes without activity before logout, 0 disables
+	SingleSession      bool   `mapstructure:"single_session"`       // a new login logs out all other sessions
+
+	FeedToken    string `mapstructure:"feed_token"`    // token for the calendar feed, empty disables it
+	TriggerToken string `mapstructure:"trigger_token"` // bearer token for /api/gate/trigger, empty disables it
+	InstanceName string `mapstructure:"instance_name"` // identifies this instance, empty uses the hostname
+
+	LoginRedirect string `mapstructure:"login_redirect"` // page after logging in, unless the login interrupted another one
+
+	// Log in whoever completes the setup wizard. Turn it off when setup
+	// happens over a network others can reach, so finishing setup still
+	// requires logging in with the password just chosen.
+	SetupAutoLogin bool `mapstructure:"setup_auto_login"`
+
+	// Requests handled at once before answering 503, so a flood can't
+	// exhaust a small device. Live update streams don't count. 0 disables it.
+	MaxConcurrentRequests int `mapstructure:"max_concurrent_requests"`
+
+	// Reverse proxies, as IPs or CIDRs, whose X-Forwarded-Host and
+	// X-Forwarded-Proto headers redirects are built from. Requests from
+	// anywhere else get relative redirects.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+// MQTTConfig publishes device and gate state to an MQTT broker while
+// monitoring runs, e.g. for Home Assistant
+type MQTTConfig struct {
+	BrokerURL   string `mapstructure:"broker_url"` // e.g. tcp://192.168.1.10:1883, empty disables it
+	Username    string `mapstructure:"username"`
+	Password    string `mapstructure:"password"`
+	TopicPrefix string `mapstructure:"topic_prefix"` // topics are <prefix>/device/<mac>/state and <prefix>/gate/last_trigger
+}
+
+// DatabaseConfig bounds the database size on top of the age-based log cleanup
+type DatabaseConfig struct {
+	MaxLogRows     int `mapstructure:"max_log_rows"`    // oldest logs are trimmed beyond this, 0 disables
+	MaxSizeMB      int `mapstructure:"max_size_mb"`     // oldest logs are trimmed while the data is larger, 0 disables
+	VacuumInterval int `mapstructure:"vacuum_interval"` // hours between VACUUMs reclaiming space, 0 disables
+
+	// Days activity logs are kept, and gate openings (gate_triggered) for
+	// the record, typically much longer. 0 uses the defaults.
+	LogRetentionDays      int `mapstructure:"log_retention_days"`
+	GateOpenRetentionDays int `mapstructure:"gate_open_retention_days"`
+
+	// Seconds within which repeating a device's last log event only bumps
+	// its count, against connect/disconnect churn. 0 logs every event.
+	LogDedupeWindow int `mapstructure:"log_dedupe_window"`
+
+	// Retries of activity log and device state writes failing on a locked
+	// database, with a short doubling backoff. 0 disables them.
+	WriteRetries int `mapstructure:"write_retries"`
+}
+
+// Retention returns the days activity logs and gate openings are kept
+func (d DatabaseConfig) Retention() (logDays, gateOpenDays int) {
+	logDays, gateOpenDays = d.LogRetentionDays, d.GateOpenRetentionDays
+	if logDays <= 0 {
+		logDays = DefaultLogRetentionDays
+	}
+	if gateOpenDays <= 0 {
+		gateOpenDays = DefaultGateOpenRetentionDays
+	}
+	return logDays, gateOpenDays
+}
+
+type NotifyConfig struct {
+	WebhookURL string         `mapstructure:"webhook_url"` // receives notifications as JSON, empty disables them
+	Events     []string       `mapstructure:"events"`      // events that notify, see NotificationEvents
+	Telegram   TelegramConfig `mapstructure:"telegram"`
+
+	// Providers per gate name, e.g. {"main": ["telegram"], "side":
+	// ["webhook"]}, for events at that gate. Gates not listed use all of
+	// them, and a device's own providers take precedence.
+	Gates map[string][]string `mapstructure:"gates"`
+
+	// Seconds arrivals are held back so devices arriving together, e.g.
+	// several phones in one car, notify once. 0 notifies right away.
+	BatchWindow int `mapstructure:"batch_window"`
+
+	// Receives every logged event as JSON, for home automation rather than
+	// people. Requests carry an HMAC-SHA256 signature of the body keyed with
+	// the secret, if set. Empty disables it.
+	EventWebhookURL    string `mapstructure:"event_webhook_url"`
+	EventWebhookSecret string `mapstructure:"event_webhook_secret"`
+
+	// Announces arrivals through a text-to-speech endpoint, e.g. Home Assistant
+	TTS TTSConfig `mapstructure:"tts"`
+}
+
+// TTSConfig posts an announcement to a text-to-speech webhook whenever the
+// gate opens for an arriving device
+type TTSConfig struct {
+	WebhookURL string `mapstructure:"webhook_url"` // receives announcements as JSON, empty disables them
+	// Announcement for devices without their own, with the log message
+	// placeholders {device}, {ap} and {direction}
+	Message string `mapstructure:"message"`
+}
+
+// TelegramConfig sends notifications to a chat through a Telegram bot, if
+// both are set
+type TelegramConfig struct {
+	BotToken string `mapstructure:"bot_token"` // from @BotFather
+	ChatID   string `mapstructure:"chat_id"`   // numeric chat ID or @channelname
+}
+
+// Enabled reports whether Telegram notifications are configured
+func (t TelegramConfig) Enabled() bool {
+	return t.BotToken != "" && t.ChatID != ""
+}
+
+// GateProviders returns the providers events at the named gate go to, nil
+// for all of them. Empty names the primary gate. Names are matched ignoring
+// case, the config file doesn't keep it for map keys.
+func (n NotifyConfig) GateProviders(gate string) []string {
+	if gate == "" {
+		gate = PrimaryGate
+	}
+	for name, providers := range n.Gates {
+		if strings.EqualFold(name, gate) {
+			return providers
+		}
+	}
+	return nil
+}
+
+// NotificationEvents are the events notifications can be sent for
+var NotificationEvents = []string{
+	"device_absent", // not seen by its expected_by time
+	"arrived",       // the gate opened for a device arriving
+	"left",          // the gate opened for a device leaving
+}
+
+// DeviceNotifyConfig overrides the global notification settings for one
+// device. Unset fields fall back to them.
+type DeviceNotifyConfig struct {
+	Enabled   *bool    `mapstructure:"enabled" json:"enabled,omitempty"`     // false mutes the device
+	Events    []string `mapstructure:"events" json:"events,omitempty"`       // replaces notifications.events
+	Providers []string `mapstructure:"providers" json:"providers,omitempty"` // e.g. ["webhook"], empty uses all
+}
+
+// Validate rejects unknown events
+func (n *DeviceNotifyConfig) Validate() error {
+	if n == nil {
+		return nil
+	}
+	for _, event := range n.Events {
+		if !slices.Contains(NotificationEvents, event) {
+			return fmt.Errorf("unknown notification event %q", event)
+		}
+	}
+	return nil
+}
+
+// Wants reports whether event should notify for this device, given the
+// globally enabled events
+func (n *DeviceNotifyConfig) Wants(event string, global []string) bool {
+	events := global
+	if n != nil {
+		if n.Enabled != nil && !*n.Enabled {
+			return false
+		}
+		if n.Events != nil {
+			events = n.Events
+		}
+	}
+	return slices.Contains(events, event)
 }
 
 type DeviceConfig struct {
-	MAC           string    `mapstructure:"mac" json:"mac"`
-	Name          string    `mapstructure:"name" json:"name"`
-	Enabled       bool      `mapstructure:"enabled" json:"enabled"`
-	LastSeen      time.Time `mapstructure:"last_seen" json:"last_seen"`
-	LastTriggered time.Time `mapstructure:"last_triggered" json:"last_triggered"`
+	MAC            string    `mapstructure:"mac" json:"mac"`
+	Name           string    `mapstructure:"name" json:"name"`
+	Enabled        bool      `mapstructure:"enabled" json:"enabled"`
+	SSID           string    `mapstructure:"ssid" json:"ssid,omitempty"`                       // only match while connected to this ESSID
+	BypassCooldown bool      `mapstructure:"bypass_cooldown" json:"bypass_cooldown,omitempty"` // always open right away, e.g. for a medical alert pendant
+	ExpectedBy     string    `mapstructure:"expected_by" json:"expected_by,omitempty"`         // "HH:MM", notify if the device hasn't shown up by then
+	AvatarURL      string    `mapstructure:"avatar_url" json:"avatar_url,omitempty"`           // picture shown in the dashboard and notifications
+	Gate           string    `mapstructure:"gate" json:"gate,omitempty"`                       // one of gates by name, empty for the primary gate
+	Announcement   string    `mapstructure:"announcement" json:"announcement,omitempty"`       // spoken on arrival, e.g. "Dad's home", instead of notifications.tts.message
+	LastSeen       time.Time `mapstructure:"last_seen" json:"last_seen"`
+	LastTriggered  time.Time `mapstructure:"last_triggered" json:"last_triggered"`
+
+	// Set for a visitor's temporary device, removed once this has passed
+	ExpiresAt *time.Time `mapstructure:"expires_at" json:"expires_at,omitempty"`
+
+	// Overrides the global notification settings for this device
+	Notifications *DeviceNotifyConfig `mapstructure:"notifications" json:"notifications,omitempty"`
 }
 
 func LoadOrInitialize(configPath string) (*Config, error) {
@@ -61,9 +428,74 @@ func LoadOrInitialize(configPath string) (*Config, error) {
 	viper.SetDefault("database_path", "gate_opener.db")
 	viper.SetDefault("unifi.poll_interval", 1)
 	viper.SetDefault("unifi.site_id", "default")
+	viper.SetDefault("unifi.login_timeout", 10)
+	viper.SetDefault("unifi.login_retries", 2)
+	viper.SetDefault("unifi.startup_delay", 0)
+	viper.SetDefault("unifi.clients_cache_ttl", 10)
+	viper.SetDefault("unifi.clients_min_interval", 2)
+	viper.SetDefault("unifi.min_signal", 0)
+	viper.SetDefault("unifi.stale_after", 0)
+	viper.SetDefault("unifi.unifi_os", false)
 	viper.SetDefault("gate.open_duration", 10)
+	viper.SetDefault("gate.arriving_cooldown", 0)
+	viper.SetDefault("gate.leaving_cooldown", 0)
 	viper.SetDefault("gate.log_activity", false)
+	viper.SetDefault("gate.trigger_on_connect", true)
+	viper.SetDefault("gate.trigger_on_roam", true)
+	viper.SetDefault("gate.reset_cooldown_on_departure", false)
+	viper.SetDefault("gate.reopen_if_present", false)
+	viper.SetDefault("gate.require_open_confirmation", false)
+	viper.SetDefault("gate.observe_only", false)
+	viper.SetDefault("gate.ignore_interior_to_gate_roams", false)
+	viper.SetDefault("gate.external_trigger_bypass_cooldown", false)
+	viper.SetDefault("gate.schedule.time_zone", "")
+	viper.SetDefault("gate.pre_open_delay", 0)
+	viper.SetDefault("gate.require_approaching", false)
+	viper.SetDefault("gate.confirm_polls", 1)
+	viper.SetDefault("gate.debounce_seconds", 0)
+	viper.SetDefault("gate.close_on_departure", false)
+	viper.SetDefault("gate.manual_open_requires_monitoring", false)
+	viper.SetDefault("shelly.method", "GET")
+	viper.SetDefault("shelly.api_version", "gen1")
+	viper.SetDefault("shelly.keep_alive", false)
+	viper.SetDefault("shelly.idle_timeout", 30)
 	viper.SetDefault("setup_complete", false)
+	viper.SetDefault("unique_device_names", false)
+	viper.SetDefault("admin.min_password_length", DefaultMinPasswordLength)
+	viper.SetDefault("admin.min_password_classes", DefaultMinPasswordClasses)
+	viper.SetDefault("server.read_timeout", 15)
+	viper.SetDefault("server.write_timeout", 15)
+	viper.SetDefault("server.idle_timeout", 60)
+	viper.SetDefault("server.compression", true)
+	viper.SetDefault("server.session_backend", "cookie")
+	viper.SetDefault("server.session_dir", "sessions")
+	viper.SetDefault("server.session_idle_timeout", 0)
+	viper.SetDefault("server.single_session", false)
+	viper.SetDefault("server.feed_token", "")
+	viper.SetDefault("server.trigger_token", "")
+	viper.SetDefault("server.instance_name", "")
+	viper.SetDefault("server.login_redirect", "/dashboard")
+	viper.SetDefault("server.setup_auto_login", true)
+	viper.SetDefault("server.max_concurrent_requests", 0)
+	viper.SetDefault("server.trusted_proxies", []string{})
+	viper.SetDefault("notifications.webhook_url", "")
+	viper.SetDefault("notifications.events", []string{"device_absent"})
+	viper.SetDefault("notifications.batch_window", 0)
+	viper.SetDefault("notifications.telegram.bot_token", "")
+	viper.SetDefault("notifications.telegram.chat_id", "")
+	viper.SetDefault("notifications.event_webhook_url", "")
+	viper.SetDefault("notifications.event_webhook_secret", "")
+	viper.SetDefault("notifications.tts.webhook_url", "")
+	viper.SetDefault("notifications.tts.message", "{device} is home")
+	viper.SetDefault("mqtt.broker_url", "")
+	viper.SetDefault("mqtt.topic_prefix", "gateopener")
+	viper.SetDefault("database.max_log_rows", 0)
+	viper.SetDefault("database.max_size_mb", 0)
+	viper.SetDefault("database.vacuum_interval", 168)
+	viper.SetDefault("database.log_retention_days", DefaultLogRetentionDays)
+	viper.SetDefault("database.gate_open_retention_days", DefaultGateOpenRetentionDays)
+	viper.SetDefault("database.log_dedupe_window", 0)
+	viper.SetDefault("database.write_retries", 3)
 
 	// Check if config file exists
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
@@ -71,12 +503,54 @@ func LoadOrInitialize(configPath string) (*Config, error) {
 		cfg := &Config{
 			DatabasePath:  viper.GetString("database_path"),
 			SessionSecret: generateSessionSecret(),
+			Admin: AdminConfig{
+				MinPasswordLength:  viper.GetInt("admin.min_password_length"),
+				MinPasswordClasses: viper.GetInt("admin.min_password_classes"),
+			},
 			UniFi: UniFiConfig{
-				PollInterval: viper.GetInt("unifi.poll_interval"),
-				SiteID:       viper.GetString("unifi.site_id"),
+				PollInterval:       viper.GetInt("unifi.poll_interval"),
+				SiteID:             viper.GetString("unifi.site_id"),
+				LoginTimeout:       viper.GetInt("unifi.login_timeout"),
+				LoginRetries:       viper.GetInt("unifi.login_retries"),
+				ClientsCacheTTL:    viper.GetInt("unifi.clients_cache_ttl"),
+				ClientsMinInterval: viper.GetInt("unifi.clients_min_interval"),
 			},
 			Gate: GateConfig{
-				OpenDuration: viper.GetInt("gate.open_duration"),
+				OpenDuration:     viper.GetInt("gate.open_duration"),
+				TriggerOnConnect: viper.GetBool("gate.trigger_on_connect"),
+				TriggerOnRoam:    viper.GetBool("gate.trigger_on_roam"),
+				ConfirmPolls:     viper.GetInt("gate.confirm_polls"),
+			},
+			Shelly: ShellyConfig{
+				Method:      viper.GetString("shelly.method"),
+				APIVersion:  viper.GetString("shelly.api_version"),
+				IdleTimeout: viper.GetInt("shelly.idle_timeout"),
+			},
+			Server: ServerConfig{
+				ReadTimeout:        viper.GetInt("server.read_timeout"),
+				WriteTimeout:       viper.GetInt("server.write_timeout"),
+				IdleTimeout:        viper.GetInt("server.idle_timeout"),
+				Compression:        viper.GetBool("server.compression"),
+				SessionBackend:     viper.GetString("server.session_backend"),
+				SessionDir:         viper.GetString("server.session_dir"),
+				SessionIdleTimeout: viper.GetInt("server.session_idle_timeout"),
+				LoginRedirect:      viper.GetString("server.login_redirect"),
+				SetupAutoLogin:     viper.GetBool("server.setup_auto_login"),
+			},
+			Notifications: NotifyConfig{
+				Events: viper.GetStringSlice("notifications.events"),
+				TTS: TTSConfig{
+					Message: viper.GetString("notifications.tts.message"),
+				},
+			},
+			MQTT: MQTTConfig{
+				TopicPrefix: viper.GetString("mqtt.topic_prefix"),
+			},
+			Database: DatabaseConfig{
+				VacuumInterval:        viper.GetInt("database.vacuum_interval"),
+				LogRetentionDays:      viper.GetInt("database.log_retention_days"),
+				GateOpenRetentionDays: viper.GetInt("database.gate_open_retention_days"),
+				WriteRetries:          viper.GetInt("database.write_retries"),
 			},
 			SetupComplete: false,
 		}
@@ -98,6 +572,12 @@ func LoadOrInitialize(configPath string) (*Config, error) {
 	if err := viper.Unmarshal(&cfg); err != nil {
 		return nil, err
 	}
+	cfg.NormalizeDeviceMACs()
+	// Written out in the new form with the next save
+	cfg.MigrateAdminUser()
+	if err := cfg.CheckCloseOnDeparture(); err != nil {
+		return nil, err
+	}
 
 	// Ensure session secret exists
 	if cfg.SessionSecret == "" {
@@ -113,6 +593,17 @@ func LoadOrInitialize(configPath string) (*Config, error) {
 func SaveConfig(configPath string, cfg *Config) error {
 	viper.Set("admin.username", cfg.Admin.Username)
 	viper.Set("admin.password_hash", cfg.Admin.PasswordHash)
+	users := make([]map[string]interface{}, len(cfg.Admin.Users))
+	for i, user := range cfg.Admin.Users {
+		users[i] = map[string]interface{}{
+			"username":      user.Username,
+			"password_hash": user.PasswordHash,
+		}
+	}
+	viper.Set("admin.users", users)
+	viper.Set("admin.legacy_user", cfg.Admin.LegacyUser)
+	viper.Set("admin.min_password_length", cfg.Admin.MinPasswordLength)
+	viper.Set("admin.min_password_classes", cfg.Admin.MinPasswordClasses)
 
 	viper.Set("unifi.controller_url", cfg.UniFi.ControllerURL)
 	viper.Set("unifi.username", cfg.UniFi.Username)
@@ -120,32 +611,296 @@ func SaveConfig(configPath string, cfg *Config) error {
 	viper.Set("unifi.site_id", cfg.UniFi.SiteID)
 	viper.Set("unifi.gate_ap_mac", cfg.UniFi.GateAPMAC)
 	viper.Set("unifi.poll_interval", cfg.UniFi.PollInterval)
+	viper.Set("unifi.login_timeout", cfg.UniFi.LoginTimeout)
+	viper.Set("unifi.login_retries", cfg.UniFi.LoginRetries)
+	viper.Set("unifi.startup_delay", cfg.UniFi.StartupDelay)
+	viper.Set("unifi.clients_cache_ttl", cfg.UniFi.ClientsCacheTTL)
+	viper.Set("unifi.clients_min_interval", cfg.UniFi.ClientsMinInterval)
+	viper.Set("unifi.min_signal", cfg.UniFi.MinSignal)
+	viper.Set("unifi.stale_after", cfg.UniFi.StaleAfter)
+	viper.Set("unifi.unifi_os", cfg.UniFi.UnifiOS)
+	viper.Set("unifi.interior_ap_macs", cfg.UniFi.InteriorAPMACs)
+	var windows []map[string]interface{}
+	for _, w := range cfg.UniFi.MaintenanceWindows {
+		windows = append(windows, map[string]interface{}{
+			"start": w.Start,
+			"end":   w.End,
+			"days":  w.Days,
+		})
+	}
+	viper.Set("unifi.maintenance_windows", windows)
 
 	viper.Set("shelly.trigger_url", cfg.Shelly.TriggerURL)
+	viper.Set("shelly.host", cfg.Shelly.Host)
+	viper.Set("shelly.channel", cfg.Shelly.Channel)
+	viper.Set("shelly.timer", cfg.Shelly.Timer)
+	viper.Set("shelly.close_url", cfg.Shelly.CloseURL)
+	viper.Set("shelly.method", cfg.Shelly.Method)
+	viper.Set("shelly.body", cfg.Shelly.Body)
+	viper.Set("shelly.username", cfg.Shelly.Username)
+	viper.Set("shelly.password", cfg.Shelly.Password)
+	viper.Set("shelly.bearer_token", cfg.Shelly.BearerToken)
+	viper.Set("shelly.success_key", cfg.Shelly.SuccessKey)
+	viper.Set("shelly.success_value", cfg.Shelly.SuccessValue)
+	viper.Set("shelly.api_version", cfg.Shelly.APIVersion)
+	viper.Set("shelly.dry_open_url", cfg.Shelly.DryOpenURL)
+	viper.Set("shelly.keep_alive", cfg.Shelly.KeepAlive)
+	viper.Set("shelly.idle_timeout", cfg.Shelly.IdleTimeout)
 	viper.Set("gate.open_duration", cfg.Gate.OpenDuration)
+	viper.Set("gate.arriving_cooldown", cfg.Gate.ArrivingCooldown)
+	viper.Set("gate.leaving_cooldown", cfg.Gate.LeavingCooldown)
 	viper.Set("gate.log_activity", cfg.Gate.LogActivity)
+	viper.Set("gate.trigger_on_connect", cfg.Gate.TriggerOnConnect)
+	viper.Set("gate.trigger_on_roam", cfg.Gate.TriggerOnRoam)
+	viper.Set("gate.reset_cooldown_on_departure", cfg.Gate.ResetCooldownOnDeparture)
+	viper.Set("gate.reopen_if_present", cfg.Gate.ReopenIfPresent)
+	viper.Set("gate.require_open_confirmation", cfg.Gate.RequireOpenConfirmation)
+	viper.Set("gate.confirm_polls", cfg.Gate.ConfirmPolls)
+	viper.Set("gate.debounce_seconds", cfg.Gate.DebounceSeconds)
+	viper.Set("gate.close_on_departure", cfg.Gate.CloseOnDeparture)
+	viper.Set("gate.manual_open_requires_monitoring", cfg.Gate.ManualOpenRequiresMonitoring)
+	viper.Set("gate.observe_only", cfg.Gate.ObserveOnly)
+	viper.Set("gate.ignore_interior_to_gate_roams", cfg.Gate.IgnoreInteriorToGateRoams)
+	viper.Set("gate.external_trigger_bypass_cooldown", cfg.Gate.ExternalTriggerBypassCooldown)
+	viper.Set("gate.schedule.time_zone", cfg.Gate.Schedule.TimeZone)
+	var scheduleWindows []map[string]interface{}
+	for _, w := range cfg.Gate.Schedule.Windows {
+		scheduleWindows = append(scheduleWindows, map[string]interface{}{
+			"start": w.Start,
+			"end":   w.End,
+			"days":  w.Days,
+		})
+	}
+	viper.Set("gate.schedule.windows", scheduleWindows)
+	viper.Set("gate.pre_open_delay", cfg.Gate.PreOpenDelay)
+	viper.Set("gate.require_approaching", cfg.Gate.RequireApproaching)
+	viper.Set("server.read_timeout", cfg.Server.ReadTimeout)
+	viper.Set("server.write_timeout", cfg.Server.WriteTimeout)
+	viper.Set("server.idle_timeout", cfg.Server.IdleTimeout)
+	viper.Set("server.compression", cfg.Server.Compression)
+	viper.Set("server.session_backend", cfg.Server.SessionBackend)
+	viper.Set("server.session_dir", cfg.Server.SessionDir)
+	viper.Set("server.session_idle_timeout", cfg.Server.SessionIdleTimeout)
+	viper.Set("server.single_session", cfg.Server.SingleSession)
+	viper.Set("server.feed_token", cfg.Server.FeedToken)
+	viper.Set("server.trigger_token", cfg.Server.TriggerToken)
+	viper.Set("server.instance_name", cfg.Server.InstanceName)
+	viper.Set("server.login_redirect", cfg.Server.LoginRedirect)
+	viper.Set("server.setup_auto_login", cfg.Server.SetupAutoLogin)
+	viper.Set("server.max_concurrent_requests", cfg.Server.MaxConcurrentRequests)
+	viper.Set("server.trusted_proxies", cfg.Server.TrustedProxies)
+	viper.Set("notifications.webhook_url", cfg.Notifications.WebhookURL)
+	viper.Set("notifications.events", cfg.Notifications.Events)
+	viper.Set("notifications.batch_window", cfg.Notifications.BatchWindow)
+	viper.Set("notifications.gates", cfg.Notifications.Gates)
+	viper.Set("notifications.telegram.bot_token", cfg.Notifications.Telegram.BotToken)
+	viper.Set("notifications.telegram.chat_id", cfg.Notifications.Telegram.ChatID)
+	viper.Set("notifications.event_webhook_url", cfg.Notifications.EventWebhookURL)
+	viper.Set("notifications.event_webhook_secret", cfg.Notifications.EventWebhookSecret)
+	viper.Set("notifications.tts.webhook_url", cfg.Notifications.TTS.WebhookURL)
+	viper.Set("notifications.tts.message", cfg.Notifications.TTS.Message)
+	viper.Set("mqtt.broker_url", cfg.MQTT.BrokerURL)
+	viper.Set("mqtt.username", cfg.MQTT.Username)
+	viper.Set("mqtt.password", cfg.MQTT.Password)
+	viper.Set("mqtt.topic_prefix", cfg.MQTT.TopicPrefix)
+	viper.Set("database.max_log_rows", cfg.Database.MaxLogRows)
+	viper.Set("database.max_size_mb", cfg.Database.MaxSizeMB)
+	viper.Set("database.vacuum_interval", cfg.Database.VacuumInterval)
+	viper.Set("database.log_retention_days", cfg.Database.LogRetentionDays)
+	viper.Set("database.gate_open_retention_days", cfg.Database.GateOpenRetentionDays)
+	viper.Set("database.log_dedupe_window", cfg.Database.LogDedupeWindow)
+	viper.Set("database.write_retries", cfg.Database.WriteRetries)
 	viper.Set("database_path", cfg.DatabasePath)
 	viper.Set("session_secret", cfg.SessionSecret)
 	viper.Set("setup_complete", cfg.SetupComplete)
+	viper.Set("unique_device_names", cfg.UniqueDeviceNames)
+	viper.Set("log_messages", cfg.LogMessages)
 
 	// Manually set devices to ensure correct field names
 	var devices []map[string]interface{}
 	for _, d := range cfg.Devices {
-		devices = append(devices, map[string]interface{}{
-			"mac":            d.MAC,
-			"name":           d.Name,
-			"enabled":        d.Enabled,
-			"last_seen":      d.LastSeen,
-			"last_triggered": d.LastTriggered,
-		})
+		device := map[string]interface{}{
+			"mac":             d.MAC,
+			"name":            d.Name,
+			"enabled":         d.Enabled,
+			"ssid":            d.SSID,
+			"bypass_cooldown": d.BypassCooldown,
+			"expected_by":     d.ExpectedBy,
+			"avatar_url":      d.AvatarURL,
+			"gate":            d.Gate,
+			"announcement":    d.Announcement,
+			"last_seen":       d.LastSeen,
+			"last_triggered":  d.LastTriggered,
+		}
+		if n := d.Notifications; n != nil {
+			prefs := map[string]interface{}{}
+			if n.Enabled != nil {
+				prefs["enabled"] = *n.Enabled
+			}
+			if n.Events != nil {
+				prefs["events"] = n.Events
+			}
+			if n.Providers != nil {
+				prefs["providers"] = n.Providers
+			}
+			device["notifications"] = prefs
+		}
+		if d.ExpiresAt != nil {
+			device["expires_at"] = *d.ExpiresAt
+		}
+		devices = append(devices, device)
 	}
 	viper.Set("devices", devices)
 
+	var gates []map[string]interface{}
+	for _, g := range cfg.Gates {
+		gates = append(gates, map[string]interface{}{
+			"name":          g.Name,
+			"trigger_url":   g.TriggerURL,
+			"close_url":     g.CloseURL,
+			"open_duration": g.OpenDuration,
+		})
+	}
+	viper.Set("gates", gates)
+
 	return viper.WriteConfigAs(configPath)
 }
 
+// Instance returns the configured instance name, falling back to the hostname
+// so several instances can be told apart without extra setup
+func (s ServerConfig) Instance() string {
+	if s.InstanceName != "" {
+		return s.InstanceName
+	}
+	if host, err := os.Hostname(); err == nil {
+		return host
+	}
+	return "unifi-gate-opener"
+}
+
+// LoginRedirectPath returns the page to land on after logging in. Anything
+// but a local path falls back to the dashboard.
+func (s ServerConfig) LoginRedirectPath() string {
+	if strings.HasPrefix(s.LoginRedirect, "/") && !strings.HasPrefix(s.LoginRedirect, "//") && !strings.HasPrefix(s.LoginRedirect, "/\\") {
+		return s.LoginRedirect
+	}
+	return "/dashboard"
+}
+
+// BuildTriggerURL returns the URL used to open the gate. A raw trigger URL
+// wins; otherwise a Shelly Gen1 relay URL is built from host, channel and
+// timer, or for Gen2 the host's RPC endpoint.
+func (s ShellyConfig) BuildTriggerURL() string {
+	if s.TriggerURL != "" {
+		return s.TriggerURL
+	}
+	if s.Host == "" {
+		return ""
+	}
+
+	base := strings.TrimRight(strings.TrimSpace(s.Host), "/")
+	if !strings.Contains(base, "://") {
+		// A bare IPv6 address needs brackets, and its zone escaping, in a URL
+		if addr, _, _ := strings.Cut(base, "%"); strings.Contains(addr, ":") && net.ParseIP(addr) != nil {
+			base = "[" + strings.Replace(base, "%", "%25", 1) + "]"
+		}
+		base = "http://" + base
+	}
+
+	if s.IsGen2() {
+		return base + "/rpc"
+	}
+
+	url := fmt.Sprintf("%s/relay/%d?turn=on", base, s.Channel)
+	if s.Timer > 0 {
+		url += fmt.Sprintf("&timer=%d", s.Timer)
+	}
+	return url
+}
+
 func (c *Config) IsConfigured() bool {
-	return c.SetupComplete && c.Admin.Username != "" && c.UniFi.ControllerURL != ""
+	return c.SetupComplete && len(c.AdminUsers()) > 0 && c.UniFi.ControllerURL != ""
+}
+
+// NormalizeMAC checks that mac is a 6-octet MAC address, with colons, dashes,
+// dots or no separators at all, and returns it the way UniFi reports MACs:
+// lowercase and colon separated, e.g. aa:bb:cc:dd:ee:ff
+func NormalizeMAC(mac string) (string, error) {
+	raw := strings.TrimSpace(mac)
+	if len(raw) == 12 && !strings.ContainsAny(raw, ":-.") {
+		pairs := make([]string, 6)
+		for i := range pairs {
+			pairs[i] = raw[i*2 : i*2+2]
+		}
+		raw = strings.Join(pairs, ":")
+	}
+
+	hw, err := net.ParseMAC(raw)
+	if err != nil || len(hw) != 6 {
+		return "", fmt.Errorf("%w %q, expected six octets like aa:bb:cc:dd:ee:ff", ErrInvalidMAC, mac)
+	}
+	return hw.String(), nil
+}
+
+// NormalizeDeviceMACs normalizes the MACs of all devices, see NormalizeMAC,
+// leaving ones that aren't valid as they are
+func (c *Config) NormalizeDeviceMACs() {
+	for i := range c.Devices {
+		if mac, err := NormalizeMAC(c.Devices[i].MAC); err == nil {
+			c.Devices[i].MAC = mac
+		}
+	}
+}
+
+// NormalizeAvatarURL checks that a device avatar is an absolute http or
+// https URL and returns it in canonical form. Empty stays empty.
+func NormalizeAvatarURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("avatar_url must be an absolute http or https URL")
+	}
+	return u.String(), nil
+}
+
+// CheckPasswordPolicy rejects admin passwords that are too short or don't mix
+// enough kinds of characters. SetAdminPassword doesn't check on its own, so
+// handlers must call this before accepting a new password.
+func (c *Config) CheckPasswordPolicy(password string) error {
+	minLength := c.Admin.MinPasswordLength
+	if minLength <= 0 {
+		minLength = DefaultMinPasswordLength
+	}
+	minClasses := c.Admin.MinPasswordClasses
+	if minClasses <= 0 {
+		minClasses = DefaultMinPasswordClasses
+	}
+
+	if utf8.RuneCountInString(password) < minLength {
+		return fmt.Errorf("password must be at least %d characters long", minLength)
+	}
+
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	if lower+upper+digit+symbol < minClasses {
+		return fmt.Errorf("password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", minClasses)
+	}
+	return nil
 }
 
 func (c *Config) SetAdminPassword(password string) error {
@@ -163,11 +918,19 @@ func (c *Config) VerifyAdminPassword(password string) bool {
 }
 
 func (c *Config) AddDevice(mac, name string) error {
+	mac, err := NormalizeMAC(mac)
+	if err != nil {
+		return err
+	}
+
 	// Check if device already exists
-	for _, d := range c.Devices {
-		if d.MAC == mac {
-			return errors.New("device already exists")
-		}
+	if c.GetDevice(mac) != nil {
+		return ErrDeviceExists
+	}
+
+	name = NormalizeDeviceName(name)
+	if err := c.checkDeviceName(mac, name); err != nil {
+		return err
 	}
 
 	c.Devices = append(c.Devices, DeviceConfig{
@@ -180,35 +943,144 @@ func (c *Config) AddDevice(mac, name string) error {
 }
 
 func (c *Config) UpdateDevice(mac, name string, enabled bool) error {
-	for i, d := range c.Devices {
-		if d.MAC == mac {
-			c.Devices[i].Name = name
-			c.Devices[i].Enabled = enabled
-			return nil
+	device := c.GetDevice(mac)
+	if device == nil {
+		if _, err := NormalizeMAC(mac); err != nil {
+			return err
+		}
+		return ErrDeviceNotFound
+	}
+
+	name = NormalizeDeviceName(name)
+	if err := c.checkDeviceName(device.MAC, name); err != nil {
+		return err
+	}
+	device.Name = name
+	device.Enabled = enabled
+	return nil
+}
+
+// NormalizeDeviceName trims a device name, collapses runs of whitespace into
+// single spaces and cuts it to MaxDeviceNameLength characters
+func NormalizeDeviceName(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	if utf8.RuneCountInString(name) > MaxDeviceNameLength {
+		name = strings.TrimSpace(string([]rune(name)[:MaxDeviceNameLength]))
+	}
+	return name
+}
+
+// checkDeviceName rejects a name already used by another device, ignoring
+// case, when unique names are required
+func (c *Config) checkDeviceName(mac, name string) error {
+	if !c.UniqueDeviceNames || name == "" {
+		return nil
+	}
+	for _, d := range c.Devices {
+		if !strings.EqualFold(d.MAC, mac) && strings.EqualFold(d.Name, name) {
+			return ErrDuplicateDeviceName
 		}
 	}
-	return errors.New("device not found")
+	return nil
 }
 
 func (c *Config) RemoveDevice(mac string) error {
+	mac, err := NormalizeMAC(mac)
+	if err != nil {
+		return err
+	}
 	for i, d := range c.Devices {
-		if d.MAC == mac {
+		if strings.EqualFold(d.MAC, mac) {
 			c.Devices = append(c.Devices[:i], c.Devices[i+1:]...)
 			return nil
 		}
 	}
-	return errors.New("device not found")
+	return ErrDeviceNotFound
 }
 
+// GetDevice finds a device by MAC in any of the forms NormalizeMAC accepts,
+// nil if there is none
 func (c *Config) GetDevice(mac string) *DeviceConfig {
+	mac, err := NormalizeMAC(mac)
+	if err != nil {
+		return nil
+	}
 	for i := range c.Devices {
-		if c.Devices[i].MAC == mac {
+		if strings.EqualFold(c.Devices[i].MAC, mac) {
 			return &c.Devices[i]
 		}
 	}
 	return nil
 }
 
+// GetGate returns the additional gate called name, nil for the primary gate
+// or a name that isn't configured
+func (c *Config) GetGate(name string) *RelayConfig {
+	for i := range c.Gates {
+		if strings.EqualFold(c.Gates[i].Name, name) {
+			return &c.Gates[i]
+		}
+	}
+	return nil
+}
+
+// CheckCloseOnDeparture fails if gate.close_on_departure is on while a gate
+// has no close URL to close it with
+func (c *Config) CheckCloseOnDeparture() error {
+	if !c.Gate.CloseOnDeparture {
+		return nil
+	}
+	if c.Shelly.CloseURL == "" {
+		return errors.New("gate.close_on_departure needs shelly.close_url")
+	}
+	for _, relay := range c.Gates {
+		if relay.CloseURL == "" {
+			return fmt.Errorf("gate.close_on_departure needs a close_url for gate %s", relay.Name)
+		}
+	}
+	return nil
+}
+
+// ResolveGate checks a device's gate assignment and returns it the way it's
+// stored, empty for the primary gate
+func (c *Config) ResolveGate(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.EqualFold(name, PrimaryGate) {
+		return "", nil
+	}
+	gate := c.GetGate(name)
+	if gate == nil {
+		return "", fmt.Errorf("unknown gate %q", name)
+	}
+	return gate.Name, nil
+}
+
+// GateNames lists the gates devices can be assigned to, the primary one first
+func (c *Config) GateNames() []string {
+	names := []string{PrimaryGate}
+	for _, gate := range c.Gates {
+		names = append(names, gate.Name)
+	}
+	return names
+}
+
+// GateOpenDuration is how many minutes the named gate stays open, which is
+// also the cooldown of devices opening it
+func (c *Config) GateOpenDuration(name string) int {
+	if gate := c.GetGate(name); gate != nil && gate.OpenDuration > 0 {
+		return gate.OpenDuration
+	}
+	return c.Gate.OpenDuration
+}
+
+// GateName is the gate the device opens
+func (d *DeviceConfig) GateName() string {
+	if d.Gate == "" {
+		return PrimaryGate
+	}
+	return d.Gate
+}
+
 func generateSessionSecret() string {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
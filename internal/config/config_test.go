@@ -1,8 +1,17 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
 )
 
 func TestLoadOrInitialize(t *testing.T) {
@@ -284,6 +293,91 @@ func TestDeviceManagement(t *testing.T) {
 	})
 }
 
+func TestDeviceNameNormalization(t *testing.T) {
+	t.Run("Whitespace is trimmed and collapsed", func(t *testing.T) {
+		tests := map[string]string{
+			"  Dad's iPhone  ":    "Dad's iPhone",
+			"Dad's \t  iPhone":    "Dad's iPhone",
+			"Kid's\nPhone":        "Kid's Phone",
+			"   ":                 "",
+			"Already Normal Name": "Already Normal Name",
+		}
+		for input, want := range tests {
+			if got := NormalizeDeviceName(input); got != want {
+				t.Errorf("NormalizeDeviceName(%q): expected %q, got %q", input, want, got)
+			}
+		}
+	})
+
+	t.Run("Long names are truncated", func(t *testing.T) {
+		cfg := &Config{}
+		long := strings.Repeat("ä", MaxDeviceNameLength+10)
+		if err := cfg.AddDevice("aa:bb:cc:dd:ee:01", long); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+
+		got := cfg.GetDevice("aa:bb:cc:dd:ee:01").Name
+		if n := utf8.RuneCountInString(got); n != MaxDeviceNameLength {
+			t.Errorf("Expected %d characters, got %d", MaxDeviceNameLength, n)
+		}
+		if !utf8.ValidString(got) {
+			t.Error("Truncation should not split characters")
+		}
+	})
+
+	t.Run("Add and update store normalized names", func(t *testing.T) {
+		cfg := &Config{}
+		if err := cfg.AddDevice("aa:bb:cc:dd:ee:01", "  Phone  "); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+		if got := cfg.GetDevice("aa:bb:cc:dd:ee:01").Name; got != "Phone" {
+			t.Errorf("Expected \"Phone\", got %q", got)
+		}
+
+		if err := cfg.UpdateDevice("aa:bb:cc:dd:ee:01", "My   Phone ", true); err != nil {
+			t.Fatalf("Failed to update device: %v", err)
+		}
+		if got := cfg.GetDevice("aa:bb:cc:dd:ee:01").Name; got != "My Phone" {
+			t.Errorf("Expected \"My Phone\", got %q", got)
+		}
+	})
+
+	t.Run("Duplicate names are allowed by default", func(t *testing.T) {
+		cfg := &Config{}
+		if err := cfg.AddDevice("aa:bb:cc:dd:ee:01", "Phone"); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+		if err := cfg.AddDevice("aa:bb:cc:dd:ee:02", "Phone"); err != nil {
+			t.Errorf("Expected duplicate name to be allowed, got %v", err)
+		}
+	})
+
+	t.Run("Duplicate names are rejected when unique", func(t *testing.T) {
+		cfg := &Config{UniqueDeviceNames: true}
+		if err := cfg.AddDevice("aa:bb:cc:dd:ee:01", "Phone"); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+		if err := cfg.AddDevice("aa:bb:cc:dd:ee:02", "Watch"); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+
+		if err := cfg.AddDevice("aa:bb:cc:dd:ee:03", " phone "); !errors.Is(err, ErrDuplicateDeviceName) {
+			t.Errorf("Add: expected ErrDuplicateDeviceName, got %v", err)
+		}
+		if err := cfg.UpdateDevice("aa:bb:cc:dd:ee:02", "PHONE", true); !errors.Is(err, ErrDuplicateDeviceName) {
+			t.Errorf("Update: expected ErrDuplicateDeviceName, got %v", err)
+		}
+		if got := cfg.GetDevice("aa:bb:cc:dd:ee:02").Name; got != "Watch" {
+			t.Errorf("Rejected update should keep the old name, got %q", got)
+		}
+
+		// A device keeping its own name isn't a duplicate
+		if err := cfg.UpdateDevice("aa:bb:cc:dd:ee:01", "Phone", false); err != nil {
+			t.Errorf("Expected update with the same name to succeed, got %v", err)
+		}
+	})
+}
+
 func TestConfigEdgeCases(t *testing.T) {
 	t.Run("LoadOrInitialize with invalid file path", func(t *testing.T) {
 		// Try to load from a directory that doesn't exist
@@ -330,9 +424,11 @@ func TestConfigEdgeCases(t *testing.T) {
 	t.Run("AddDevice with empty MAC", func(t *testing.T) {
 		cfg := &Config{}
 		err := cfg.AddDevice("", "Empty MAC Device")
-		// Current implementation allows empty MAC - test documents current behavior
-		if err != nil {
-			t.Errorf("AddDevice should not fail with empty MAC in current implementation: %v", err)
+		if !errors.Is(err, ErrInvalidMAC) {
+			t.Errorf("AddDevice should reject an empty MAC, got %v", err)
+		}
+		if len(cfg.Devices) != 0 {
+			t.Errorf("No device should be added, got %+v", cfg.Devices)
 		}
 	})
 	
@@ -353,4 +449,365 @@ func TestConfigEdgeCases(t *testing.T) {
 			t.Error("Should fail to remove device with empty MAC (not found)")
 		}
 	})
-}
\ No newline at end of file
+}
+func TestShellyBuildTriggerURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		shelly ShellyConfig
+		want   string
+	}{
+		{
+			name:   "Nothing configured",
+			shelly: ShellyConfig{},
+			want:   "",
+		},
+		{
+			name:   "Host with channel and timer",
+			shelly: ShellyConfig{Host: "192.168.1.100", Channel: 1, Timer: 10},
+			want:   "http://192.168.1.100/relay/1?turn=on&timer=10",
+		},
+		{
+			name:   "Host without timer",
+			shelly: ShellyConfig{Host: "192.168.1.100"},
+			want:   "http://192.168.1.100/relay/0?turn=on",
+		},
+		{
+			name:   "Host with scheme and trailing slash",
+			shelly: ShellyConfig{Host: "https://shelly.local/", Channel: 2, Timer: 5},
+			want:   "https://shelly.local/relay/2?turn=on&timer=5",
+		},
+		{
+			name:   "Bare IPv6 host",
+			shelly: ShellyConfig{Host: "fe80::1", Channel: 1},
+			want:   "http://[fe80::1]/relay/1?turn=on",
+		},
+		{
+			name:   "Bare IPv6 host with zone",
+			shelly: ShellyConfig{Host: "fe80::1%eth0"},
+			want:   "http://[fe80::1%25eth0]/relay/0?turn=on",
+		},
+		{
+			name:   "Bracketed IPv6 host with port",
+			shelly: ShellyConfig{Host: "[fd00::10]:8080"},
+			want:   "http://[fd00::10]:8080/relay/0?turn=on",
+		},
+		{
+			name:   "Gen2 host",
+			shelly: ShellyConfig{Host: "192.168.1.100", Channel: 1, Timer: 10, APIVersion: "gen2"},
+			want:   "http://192.168.1.100/rpc",
+		},
+		{
+			name:   "Raw URL overrides host",
+			shelly: ShellyConfig{TriggerURL: "http://relay.local/open", Host: "192.168.1.100", Channel: 1},
+			want:   "http://relay.local/open",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.shelly.BuildTriggerURL(); got != tt.want {
+				t.Errorf("BuildTriggerURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerTimeoutDefaults(t *testing.T) {
+	viper.Reset() // earlier tests leave values set on the global instance
+	testFile := t.TempDir() + "/test_config_server.yaml"
+
+	cfg, err := LoadOrInitialize(testFile)
+	if err != nil {
+		t.Fatalf("Failed to create new config: %v", err)
+	}
+
+	if cfg.Server.ReadTimeout != 15 || cfg.Server.WriteTimeout != 15 || cfg.Server.IdleTimeout != 60 {
+		t.Errorf("Unexpected default server timeouts: %+v", cfg.Server)
+	}
+}
+
+func TestBundleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		bundle  Bundle
+		wantErr bool
+	}{
+		{"Valid", Bundle{Version: BundleVersion, Devices: []DeviceConfig{{MAC: "aa:bb:cc:dd:ee:01"}}}, false},
+		{"Unknown version", Bundle{Version: BundleVersion + 1}, true},
+		{"Invalid MAC", Bundle{Version: BundleVersion, Devices: []DeviceConfig{{MAC: "phone"}}}, true},
+		{"Duplicate MAC", Bundle{Version: BundleVersion, Devices: []DeviceConfig{{MAC: "aa:bb:cc:dd:ee:01"}, {MAC: "AA:BB:CC:DD:EE:01"}}}, true},
+		{"Negative open duration", Bundle{Version: BundleVersion, Gate: GateConfig{OpenDuration: -1}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.bundle.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		admin    AdminConfig
+		password string
+		wantErr  bool
+	}{
+		{"Empty", AdminConfig{}, "", true},
+		{"Too short", AdminConfig{}, "Ab1!", true},
+		{"Letters only", AdminConfig{}, "abcdefghij", true},
+		{"Digits only", AdminConfig{}, "1234567890", true},
+		{"Letters and digits", AdminConfig{}, "testpassword123", false},
+		{"Mixed case", AdminConfig{}, "CorrectHorse", false},
+		{"Multibyte characters count once", AdminConfig{}, "äöüäöü1", true},
+		{"Longer configured minimum", AdminConfig{MinPasswordLength: 16}, "testpassword123", true},
+		{"More classes configured", AdminConfig{MinPasswordClasses: 3}, "testpassword123", true},
+		{"Strong password", AdminConfig{MinPasswordLength: 12, MinPasswordClasses: 4}, "Gate-Opener-2024", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Admin: tt.admin}
+			err := cfg.CheckPasswordPolicy(tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckPasswordPolicy(%q) error = %v, wantErr %v", tt.password, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMaintenanceWindow(t *testing.T) {
+	// 2024-06-02 is a Sunday
+	at := func(day int, clock string) time.Time {
+		t, _ := time.Parse("2006-01-02 15:04", fmt.Sprintf("2024-06-%02d %s", day, clock))
+		return t
+	}
+
+	tests := []struct {
+		name   string
+		window MaintenanceWindow
+		at     time.Time
+		want   bool
+	}{
+		{"Inside", MaintenanceWindow{Start: "03:00", End: "03:30"}, at(2, "03:10"), true},
+		{"At start", MaintenanceWindow{Start: "03:00", End: "03:30"}, at(2, "03:00"), true},
+		{"At end", MaintenanceWindow{Start: "03:00", End: "03:30"}, at(2, "03:30"), false},
+		{"Before", MaintenanceWindow{Start: "03:00", End: "03:30"}, at(2, "02:59"), false},
+		{"Across midnight, evening", MaintenanceWindow{Start: "23:30", End: "00:15"}, at(2, "23:45"), true},
+		{"Across midnight, morning", MaintenanceWindow{Start: "23:30", End: "00:15"}, at(3, "00:10"), true},
+		{"Across midnight, after", MaintenanceWindow{Start: "23:30", End: "00:15"}, at(3, "00:20"), false},
+		{"On a listed day", MaintenanceWindow{Start: "03:00", End: "04:00", Days: []string{"Sun"}}, at(2, "03:30"), true},
+		{"On another day", MaintenanceWindow{Start: "03:00", End: "04:00", Days: []string{"sun"}}, at(3, "03:30"), false},
+		{"Morning after a listed day", MaintenanceWindow{Start: "23:30", End: "00:15", Days: []string{"sun"}}, at(3, "00:10"), true},
+		{"Morning of a listed day", MaintenanceWindow{Start: "23:30", End: "00:15", Days: []string{"sun"}}, at(2, "00:10"), false},
+		{"Invalid time", MaintenanceWindow{Start: "3am", End: "04:00"}, at(2, "03:30"), false},
+		{"Empty window", MaintenanceWindow{Start: "03:00", End: "03:00"}, at(2, "03:00"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.window.Contains(tt.at); got != tt.want {
+				t.Errorf("Contains(%v) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Validate", func(t *testing.T) {
+		if err := (MaintenanceWindow{Start: "03:00", End: "04:00", Days: []string{"mon", "Fri"}}).Validate(); err != nil {
+			t.Errorf("Expected a valid window, got %v", err)
+		}
+		for _, w := range []MaintenanceWindow{
+			{Start: "25:00", End: "04:00"},
+			{Start: "03:00", End: ""},
+			{Start: "03:00", End: "04:00", Days: []string{"monday"}},
+		} {
+			if err := w.Validate(); err == nil {
+				t.Errorf("Expected %+v to be invalid", w)
+			}
+		}
+	})
+	t.Run("Saved and loaded", func(t *testing.T) {
+		viper.Reset()
+		testFile := t.TempDir() + "/test_config_maintenance.yaml"
+
+		cfg, err := LoadOrInitialize(testFile)
+		if err != nil {
+			t.Fatalf("Failed to create new config: %v", err)
+		}
+		cfg.UniFi.MaintenanceWindows = []MaintenanceWindow{{Start: "23:30", End: "00:15", Days: []string{"sun"}}}
+		if err := SaveConfig(testFile, cfg); err != nil {
+			t.Fatalf("Failed to save config: %v", err)
+		}
+
+		viper.Reset()
+		loaded, err := LoadOrInitialize(testFile)
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if len(loaded.UniFi.MaintenanceWindows) != 1 || loaded.UniFi.MaintenanceWindows[0].String() != "23:30-00:15 (sun)" {
+			t.Errorf("Unexpected maintenance windows after reload: %+v", loaded.UniFi.MaintenanceWindows)
+		}
+	})
+}
+
+func TestGates(t *testing.T) {
+	cfg := &Config{
+		Gate:  GateConfig{OpenDuration: 10},
+		Gates: []RelayConfig{{Name: "Garage", TriggerURL: "http://garage.test", OpenDuration: 2}, {Name: "Side"}},
+	}
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"main", "", false},
+		{" Main ", "", false},
+		{"garage", "Garage", false},
+		{"Shed", "", true},
+	}
+	for _, tt := range tests {
+		got, err := cfg.ResolveGate(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ResolveGate(%q) = %q, %v; want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	for name, want := range map[string]int{"": 10, "Garage": 2, "Side": 10, "Shed": 10} {
+		if got := cfg.GateOpenDuration(name); got != want {
+			t.Errorf("GateOpenDuration(%q) = %d, want %d", name, got, want)
+		}
+	}
+}
+
+func TestNormalizeMAC(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want string
+	}{
+		{"aa:bb:cc:dd:ee:ff", "aa:bb:cc:dd:ee:ff"},
+		{"AA:BB:CC:DD:EE:FF", "aa:bb:cc:dd:ee:ff"},
+		{" AA-BB-CC-DD-EE-0F ", "aa:bb:cc:dd:ee:0f"},
+		{"aabb.ccdd.eeff", "aa:bb:cc:dd:ee:ff"},
+		{"AABBCCDDEEFF", "aa:bb:cc:dd:ee:ff"},
+	} {
+		got, err := NormalizeMAC(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeMAC(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "phone", "aa:bb:cc:dd:ee", "aa:bb:cc:dd:ee:ff:00:11", "zz:bb:cc:dd:ee:ff", "aabbccddeeffgg"} {
+		if _, err := NormalizeMAC(in); !errors.Is(err, ErrInvalidMAC) {
+			t.Errorf("NormalizeMAC(%q): expected ErrInvalidMAC, got %v", in, err)
+		}
+	}
+}
+
+func TestDeviceMACsAreNormalized(t *testing.T) {
+	cfg := &Config{}
+	if err := cfg.AddDevice("AA-BB-CC-DD-EE-01", "Phone"); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+	if cfg.Devices[0].MAC != "aa:bb:cc:dd:ee:01" {
+		t.Errorf("Expected the MAC to be normalized, got %q", cfg.Devices[0].MAC)
+	}
+	if err := cfg.AddDevice("aa:bb:cc:dd:ee:01", "Again"); !errors.Is(err, ErrDeviceExists) {
+		t.Errorf("Expected ErrDeviceExists for another spelling, got %v", err)
+	}
+	if err := cfg.UpdateDevice("AA:BB:CC:DD:EE:01", "Renamed", false); err != nil || cfg.Devices[0].Name != "Renamed" {
+		t.Errorf("Expected the update to find the device, got %v", err)
+	}
+	if err := cfg.UpdateDevice("nope", "Renamed", false); !errors.Is(err, ErrInvalidMAC) {
+		t.Errorf("Expected ErrInvalidMAC updating, got %v", err)
+	}
+	if err := cfg.RemoveDevice("nope"); !errors.Is(err, ErrInvalidMAC) {
+		t.Errorf("Expected ErrInvalidMAC removing, got %v", err)
+	}
+	if err := cfg.RemoveDevice("aabbccddee01"); err != nil || len(cfg.Devices) != 0 {
+		t.Errorf("Expected the device to be removed, got %v", err)
+	}
+
+	t.Run("On load", func(t *testing.T) {
+		viper.Reset()
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte("session_secret: s\ndevices:\n  - mac: AA-BB-CC-DD-EE-02\n    name: Car\n"), 0600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		loaded, err := LoadOrInitialize(path)
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if len(loaded.Devices) != 1 || loaded.Devices[0].MAC != "aa:bb:cc:dd:ee:02" {
+			t.Errorf("Expected the MAC to be normalized on load, got %+v", loaded.Devices)
+		}
+	})
+}
+
+func TestGateProviders(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "config.yaml")
+	cfg, err := LoadOrInitialize(testFile)
+	if err != nil {
+		t.Fatalf("Failed to create config: %v", err)
+	}
+	cfg.Notifications.Gates = map[string][]string{"main": {"chat"}, "Side": {"webhook"}}
+	if err := SaveConfig(testFile, cfg); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	cfg, err = LoadOrInitialize(testFile)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	tests := map[string][]string{
+		"":       {"chat"},
+		"main":   {"chat"},
+		"Side":   {"webhook"},
+		"Garage": nil,
+	}
+	for gate, want := range tests {
+		if got := cfg.Notifications.GateProviders(gate); !slices.Equal(got, want) {
+			t.Errorf("GateProviders(%q) = %v, want %v", gate, got, want)
+		}
+	}
+}
+
+func TestCheckCloseOnDeparture(t *testing.T) {
+	cfg := &Config{}
+	cfg.Gate.CloseOnDeparture = true
+	if err := cfg.CheckCloseOnDeparture(); err == nil {
+		t.Error("Expected closing on departure without shelly.close_url to fail")
+	}
+	cfg.Shelly.CloseURL = "http://relay.test/close"
+	if err := cfg.CheckCloseOnDeparture(); err != nil {
+		t.Errorf("Expected a close URL to be enough, got %v", err)
+	}
+	cfg.Gates = []RelayConfig{{Name: "Garage", TriggerURL: "http://garage.test"}}
+	if err := cfg.CheckCloseOnDeparture(); err == nil {
+		t.Error("Expected an additional gate without close_url to fail")
+	}
+
+	t.Run("On load", func(t *testing.T) {
+		viper.Reset()
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte("session_secret: s\ngate:\n  close_on_departure: true\n"), 0600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		if _, err := LoadOrInitialize(path); err == nil || !strings.Contains(err.Error(), "close_url") {
+			t.Errorf("Expected the load to fail over the missing close_url, got %v", err)
+		}
+	})
+
+	t.Run("On import", func(t *testing.T) {
+		cfg := &Config{}
+		bundle := cfg.ExportBundle()
+		bundle.Gate.CloseOnDeparture = true
+		if err := cfg.ImportBundle(bundle); err == nil || cfg.Gate.CloseOnDeparture {
+			t.Errorf("Expected the import to be refused, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaintenanceWindow is a daily period, in local time, during which the
+// controller is expected to be down. An end before the start spans midnight.
+type MaintenanceWindow struct {
+	Start string   `mapstructure:"start" json:"start"`         // "HH:MM"
+	End   string   `mapstructure:"end" json:"end"`             // "HH:MM"
+	Days  []string `mapstructure:"days" json:"days,omitempty"` // days the window starts on ("mon".."sun"), empty for every day
+}
+
+// Validate checks the times and day names
+func (w MaintenanceWindow) Validate() error {
+	if _, err := ParseClock(w.Start); err != nil {
+		return fmt.Errorf("invalid start %q: %w", w.Start, err)
+	}
+	if _, err := ParseClock(w.End); err != nil {
+		return fmt.Errorf("invalid end %q: %w", w.End, err)
+	}
+	for _, day := range w.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("invalid day %q", day)
+		}
+	}
+	return nil
+}
+
+// Contains reports whether t falls inside the window. Invalid windows never
+// contain anything.
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	start, err := ParseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := ParseClock(w.End)
+	if err != nil {
+		return false
+	}
+
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	switch {
+	case start < end:
+		return now >= start && now < end && w.onDay(t.Weekday())
+	case start > end:
+		// Spans midnight, the morning part belongs to the previous day's window
+		if now >= start {
+			return w.onDay(t.Weekday())
+		}
+		return now < end && w.onDay((t.Weekday()+6)%7)
+	default:
+		return false
+	}
+}
+
+func (w MaintenanceWindow) String() string {
+	if len(w.Days) == 0 {
+		return w.Start + "-" + w.End
+	}
+	return fmt.Sprintf("%s-%s (%s)", w.Start, w.End, strings.Join(w.Days, ","))
+}
+
+func (w MaintenanceWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if wd, ok := weekdays[strings.ToLower(d)]; ok && wd == day {
+			return true
+		}
+	}
+	return false
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseClock parses a time of day as "HH:MM" into the offset from midnight
+func ParseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
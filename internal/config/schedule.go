@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ScheduleWindow is a daily period automatic opens are allowed in, written
+// like a maintenance window
+type ScheduleWindow = MaintenanceWindow
+
+// Schedule limits automatic opens to time windows, e.g. to keep the gate
+// shut overnight. Without windows the gate opens around the clock.
+type Schedule struct {
+	// IANA time zone the windows are in, e.g. "Europe/Berlin", empty for
+	// the server's local time
+	TimeZone string           `mapstructure:"time_zone" json:"time_zone,omitempty"`
+	Windows  []ScheduleWindow `mapstructure:"windows" json:"windows,omitempty"`
+}
+
+// Location returns the time zone the windows are in
+func (s Schedule) Location() (*time.Location, error) {
+	if s.TimeZone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", s.TimeZone, err)
+	}
+	return loc, nil
+}
+
+// Validate checks the time zone and windows
+func (s Schedule) Validate() error {
+	if _, err := s.Location(); err != nil {
+		return err
+	}
+	for _, window := range s.Windows {
+		if err := window.Validate(); err != nil {
+			return fmt.Errorf("window %s: %w", window, err)
+		}
+	}
+	return nil
+}
+
+// Allows reports whether t falls inside one of the windows, or there are
+// none. An invalid time zone falls back to the server's local time.
+func (s Schedule) Allows(t time.Time) bool {
+	if len(s.Windows) == 0 {
+		return true
+	}
+	loc, err := s.Location()
+	if err != nil {
+		loc = time.Local
+	}
+	t = t.In(loc)
+	for _, window := range s.Windows {
+		if window.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Schedule) String() string {
+	windows := make([]string, len(s.Windows))
+	for i, window := range s.Windows {
+		windows[i] = window.String()
+	}
+	if s.TimeZone == "" {
+		return strings.Join(windows, ", ")
+	}
+	return fmt.Sprintf("%s %s", strings.Join(windows, ", "), s.TimeZone)
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Time zone data not available: %v", err)
+	}
+
+	t.Run("No windows allows any time", func(t *testing.T) {
+		if !(Schedule{}).Allows(time.Date(2024, 3, 4, 3, 0, 0, 0, time.UTC)) {
+			t.Error("Expected an empty schedule to allow opening")
+		}
+	})
+
+	t.Run("Windows are evaluated in the time zone", func(t *testing.T) {
+		schedule := Schedule{
+			TimeZone: "Europe/Berlin",
+			Windows: []ScheduleWindow{
+				{Start: "06:00", End: "22:00", Days: []string{"mon", "tue", "wed", "thu", "fri"}},
+				{Start: "08:00", End: "20:00", Days: []string{"sat", "sun"}},
+			},
+		}
+		if err := schedule.Validate(); err != nil {
+			t.Fatalf("Expected a valid schedule, got %v", err)
+		}
+
+		tests := []struct {
+			name string
+			at   time.Time
+			want bool
+		}{
+			{"Monday morning", time.Date(2024, 3, 4, 6, 30, 0, 0, berlin), true},
+			{"Monday night", time.Date(2024, 3, 4, 23, 0, 0, 0, berlin), false},
+			{"Saturday early", time.Date(2024, 3, 9, 7, 0, 0, 0, berlin), false},
+			{"Saturday noon", time.Date(2024, 3, 9, 12, 0, 0, 0, berlin), true},
+			// 05:30 UTC is 06:30 in Berlin, inside the window only in local time
+			{"UTC before the local start", time.Date(2024, 3, 4, 5, 30, 0, 0, time.UTC), true},
+			{"UTC after the local end", time.Date(2024, 3, 4, 21, 30, 0, 0, time.UTC), false},
+		}
+		for _, tt := range tests {
+			if got := schedule.Allows(tt.at); got != tt.want {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+			}
+		}
+	})
+
+	t.Run("Invalid schedules", func(t *testing.T) {
+		for _, schedule := range []Schedule{
+			{TimeZone: "Mars/Olympus"},
+			{Windows: []ScheduleWindow{{Start: "25:00", End: "06:00"}}},
+			{Windows: []ScheduleWindow{{Start: "06:00", End: "22:00", Days: []string{"someday"}}}},
+		} {
+			if err := schedule.Validate(); err == nil {
+				t.Errorf("Expected %+v to be invalid", schedule)
+			}
+		}
+	})
+}
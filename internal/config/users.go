@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUserExists    = errors.New("user already exists")
+	ErrUserNotFound  = errors.New("user not found")
+	ErrLastUser      = errors.New("the last admin user can't be removed")
+	ErrEmptyUsername = errors.New("username is required")
+)
+
+// AdminUser is a login for the web interface
+type AdminUser struct {
+	Username     string `mapstructure:"username"`
+	PasswordHash string `mapstructure:"password_hash"`
+}
+
+// MigrateAdminUser moves the single admin of older versions into Users
+func (c *Config) MigrateAdminUser() {
+	if c.Admin.Username == "" {
+		return
+	}
+	if c.findAdminUser(c.Admin.Username) == nil {
+		c.Admin.Users = append(c.Admin.Users, AdminUser{
+			Username:     c.Admin.Username,
+			PasswordHash: c.Admin.PasswordHash,
+		})
+	}
+	c.Admin.LegacyUser = c.Admin.Username
+	c.Admin.Username, c.Admin.PasswordHash = "", ""
+}
+
+// SessionUser returns the user a session that logged in as username belongs
+// to. Sessions of versions with a single admin have no username and belong to
+// that admin, empty once it is gone.
+func (c *Config) SessionUser(username string) string {
+	if username != "" {
+		return username
+	}
+	if c.Admin.Username != "" {
+		// Not migrated yet
+		return c.Admin.Username
+	}
+	return c.Admin.LegacyUser
+}
+
+// AdminUsers returns the users that can log in, the single admin of older
+// versions if it hasn't been migrated yet
+func (c *Config) AdminUsers() []AdminUser {
+	if len(c.Admin.Users) == 0 && c.Admin.Username != "" {
+		return []AdminUser{{Username: c.Admin.Username, PasswordHash: c.Admin.PasswordHash}}
+	}
+	return c.Admin.Users
+}
+
+// HasAdminUser reports whether username can log in
+func (c *Config) HasAdminUser(username string) bool {
+	for _, user := range c.AdminUsers() {
+		if user.Username == username {
+			return true
+		}
+	}
+	return false
+}
+
+// AddAdminUser adds a user with the given password. Like SetAdminPassword,
+// it doesn't check the password policy.
+func (c *Config) AddAdminUser(username, password string) error {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return ErrEmptyUsername
+	}
+	c.MigrateAdminUser()
+	if c.findAdminUser(username) != nil {
+		return ErrUserExists
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	c.Admin.Users = append(c.Admin.Users, AdminUser{Username: username, PasswordHash: string(hash)})
+	return nil
+}
+
+// RemoveAdminUser removes a user, refusing to remove the last one
+func (c *Config) RemoveAdminUser(username string) error {
+	c.MigrateAdminUser()
+	for i, user := range c.Admin.Users {
+		if user.Username != username {
+			continue
+		}
+		if len(c.Admin.Users) == 1 {
+			return ErrLastUser
+		}
+		c.Admin.Users = append(c.Admin.Users[:i], c.Admin.Users[i+1:]...)
+		// A new user of the same name doesn't inherit the old sessions
+		if c.Admin.LegacyUser == username {
+			c.Admin.LegacyUser = ""
+		}
+		return nil
+	}
+	return ErrUserNotFound
+}
+
+// SetUserPassword changes a user's password. The single admin of older
+// versions is changed where it is, for configs that weren't migrated.
+func (c *Config) SetUserPassword(username, password string) error {
+	user := c.findAdminUser(username)
+	if user == nil {
+		if len(c.Admin.Users) == 0 && username == c.Admin.Username {
+			return c.SetAdminPassword(password)
+		}
+		return ErrUserNotFound
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = string(hash)
+	return nil
+}
+
+// VerifyUser checks a user's password
+func (c *Config) VerifyUser(username, password string) bool {
+	user := c.findAdminUser(username)
+	if user == nil {
+		if len(c.Admin.Users) == 0 && username == c.Admin.Username {
+			return c.VerifyAdminPassword(password)
+		}
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
+
+func (c *Config) findAdminUser(username string) *AdminUser {
+	for i := range c.Admin.Users {
+		if c.Admin.Users[i].Username == username {
+			return &c.Admin.Users[i]
+		}
+	}
+	return nil
+}
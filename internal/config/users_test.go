@@ -0,0 +1,141 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestAdminUsers(t *testing.T) {
+	t.Run("Single admin is migrated on load", func(t *testing.T) {
+		viper.Reset()
+		testFile := t.TempDir() + "/test_config_users.yaml"
+		legacy := &Config{Admin: AdminConfig{Username: "admin"}}
+		if err := legacy.SetAdminPassword("Old-Pass-1"); err != nil {
+			t.Fatalf("Failed to set password: %v", err)
+		}
+		yaml := "session_secret: secret\nadmin:\n  username: admin\n  password_hash: " + legacy.Admin.PasswordHash + "\n"
+		if err := os.WriteFile(testFile, []byte(yaml), 0600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		cfg, err := LoadOrInitialize(testFile)
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if len(cfg.Admin.Users) != 1 || cfg.Admin.Users[0].Username != "admin" || cfg.Admin.Username != "" {
+			t.Fatalf("Expected the admin among the users, got %+v", cfg.Admin)
+		}
+		if !cfg.VerifyUser("admin", "Old-Pass-1") {
+			t.Error("Expected the password to survive the migration")
+		}
+
+		// And stays migrated once saved
+		if err := SaveConfig(testFile, cfg); err != nil {
+			t.Fatalf("Failed to save config: %v", err)
+		}
+		viper.Reset()
+		loaded, err := LoadOrInitialize(testFile)
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if len(loaded.Admin.Users) != 1 || !loaded.VerifyUser("admin", "Old-Pass-1") {
+			t.Errorf("Expected one user after reloading, got %+v", loaded.Admin)
+		}
+		if user := loaded.SessionUser(""); user != "admin" {
+			t.Errorf("Expected sessions without a username to stay the admin's, got %q", user)
+		}
+	})
+
+	t.Run("Sessions without a username", func(t *testing.T) {
+		cfg := &Config{Admin: AdminConfig{Username: "admin", Users: []AdminUser{{Username: "alice"}}}}
+		if user := cfg.SessionUser(""); user != "admin" {
+			t.Errorf("Expected the unmigrated admin, got %q", user)
+		}
+		cfg.MigrateAdminUser()
+		if user := cfg.SessionUser(""); user != "admin" {
+			t.Errorf("Expected the migrated admin rather than the first user, got %q", user)
+		}
+		if user := cfg.SessionUser("alice"); user != "alice" {
+			t.Errorf("Expected alice, got %q", user)
+		}
+
+		if err := cfg.RemoveAdminUser("admin"); err != nil {
+			t.Fatalf("Failed to remove user: %v", err)
+		}
+		if err := cfg.AddAdminUser("admin", "New-Pass-1"); err != nil {
+			t.Fatalf("Failed to add user: %v", err)
+		}
+		if user := cfg.SessionUser(""); user != "" {
+			t.Errorf("Expected a new admin not to inherit the old sessions, got %q", user)
+		}
+	})
+
+	t.Run("Unmigrated admin still logs in", func(t *testing.T) {
+		cfg := &Config{Admin: AdminConfig{Username: "admin"}}
+		if err := cfg.SetAdminPassword("Old-Pass-1"); err != nil {
+			t.Fatalf("Failed to set password: %v", err)
+		}
+		if users := cfg.AdminUsers(); len(users) != 1 || users[0].Username != "admin" || !cfg.HasAdminUser("admin") {
+			t.Errorf("Expected the single admin, got %+v", users)
+		}
+		if !cfg.VerifyUser("admin", "Old-Pass-1") || cfg.VerifyUser("other", "Old-Pass-1") {
+			t.Error("Expected only the admin's credentials to verify")
+		}
+
+		// Adding a user keeps the admin
+		if err := cfg.AddAdminUser("alice", "Alice-Pass-1"); err != nil {
+			t.Fatalf("Failed to add user: %v", err)
+		}
+		if !cfg.VerifyUser("admin", "Old-Pass-1") || !cfg.VerifyUser("alice", "Alice-Pass-1") {
+			t.Errorf("Expected both users to log in, got %+v", cfg.Admin)
+		}
+	})
+
+	t.Run("Add, change and remove", func(t *testing.T) {
+		cfg := &Config{}
+		if err := cfg.AddAdminUser("  ", "Pass-1234"); !errors.Is(err, ErrEmptyUsername) {
+			t.Errorf("Expected ErrEmptyUsername, got %v", err)
+		}
+		if err := cfg.AddAdminUser("alice", "Alice-Pass-1"); err != nil {
+			t.Fatalf("Failed to add user: %v", err)
+		}
+		if err := cfg.AddAdminUser("bob", "Bob-Pass-1"); err != nil {
+			t.Fatalf("Failed to add user: %v", err)
+		}
+		if err := cfg.AddAdminUser("bob", "Other-Pass-1"); !errors.Is(err, ErrUserExists) {
+			t.Errorf("Expected ErrUserExists, got %v", err)
+		}
+		if cfg.Admin.Users[0].PasswordHash == "Alice-Pass-1" {
+			t.Error("Expected the password to be hashed")
+		}
+		if cfg.VerifyUser("alice", "Bob-Pass-1") {
+			t.Error("Expected passwords to be per user")
+		}
+
+		if err := cfg.SetUserPassword("bob", "Bob-Pass-2"); err != nil {
+			t.Fatalf("Failed to change password: %v", err)
+		}
+		if !cfg.VerifyUser("bob", "Bob-Pass-2") || cfg.VerifyUser("bob", "Bob-Pass-1") || !cfg.VerifyUser("alice", "Alice-Pass-1") {
+			t.Error("Expected only bob's password to change")
+		}
+		if err := cfg.SetUserPassword("carol", "Carol-Pass-1"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("Expected ErrUserNotFound, got %v", err)
+		}
+
+		if err := cfg.RemoveAdminUser("carol"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("Expected ErrUserNotFound, got %v", err)
+		}
+		if err := cfg.RemoveAdminUser("bob"); err != nil {
+			t.Fatalf("Failed to remove user: %v", err)
+		}
+		if cfg.HasAdminUser("bob") || cfg.VerifyUser("bob", "Bob-Pass-2") {
+			t.Error("Expected bob to be gone")
+		}
+		if err := cfg.RemoveAdminUser("alice"); !errors.Is(err, ErrLastUser) {
+			t.Errorf("Expected ErrLastUser, got %v", err)
+		}
+	})
+}
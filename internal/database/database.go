@@ -2,13 +2,30 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/fbettag/unifi-gate-opener/internal/config"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type DB struct {
 	*sql.DB
+
+	// Identical events within this window only bump the count of the first
+	dedupeWindow time.Duration
+
+	// Retries of writes failing on a busy database, see SetWriteRetries
+	writeRetries int
+	sleep        func(time.Duration) // waits between retries, replaced in tests
+
+	// Live subscribers notified of every logged event
+	subMu       sync.RWMutex
+	subscribers map[chan LogEntry]struct{}
 }
 
 type LogEntry struct {
@@ -16,12 +33,23 @@ type LogEntry struct {
 	Timestamp  time.Time `json:"timestamp"`
 	DeviceMAC  string    `json:"device_mac"`
 	DeviceName string    `json:"device_name"`
-	Event      string    `json:"event"`     // "connected", "disconnected", "gate_triggered", "gate_skipped"
+	Event      string    `json:"event"`     // "connected", "disconnected", "gate_triggered", "gate_skipped", "would_open"
 	Direction  string    `json:"direction"` // "arriving", "leaving", "unknown"
 	FromAP     string    `json:"from_ap,omitempty"`
 	ToAP       string    `json:"to_ap,omitempty"`
 	GateOpened bool      `json:"gate_opened"`
 	Message    string    `json:"message"`
+	Count      int       `json:"count"` // identical events folded into this one, see SetDedupeWindow
+}
+
+// SettingChange is one setting changed through the settings API. Secrets are
+// redacted before they get here.
+type SettingChange struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Setting   string    `json:"setting"` // e.g. "unifi.poll_interval"
+	OldValue  string    `json:"old_value"`
+	NewValue  string    `json:"new_value"`
 }
 
 func Initialize(dbPath string) (*DB, error) {
@@ -35,7 +63,11 @@ func Initialize(dbPath string) (*DB, error) {
 		return nil, err
 	}
 
-	return &DB{db}, nil
+	return &DB{
+		DB:           db,
+		writeRetries: defaultWriteRetries,
+		subscribers:  make(map[chan LogEntry]struct{}),
+	}, nil
 }
 
 func createTables(db *sql.DB) error {
@@ -50,12 +82,14 @@ func createTables(db *sql.DB) error {
 		from_ap TEXT,
 		to_ap TEXT,
 		gate_opened BOOLEAN DEFAULT FALSE,
-		message TEXT
+		message TEXT,
+		count INTEGER NOT NULL DEFAULT 1
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_logs_timestamp ON logs(timestamp);
 	CREATE INDEX IF NOT EXISTS idx_logs_device_mac ON logs(device_mac);
 	CREATE INDEX IF NOT EXISTS idx_logs_event ON logs(event);
+	CREATE INDEX IF NOT EXISTS idx_logs_event_timestamp ON logs(event, timestamp);
 
 	CREATE TABLE IF NOT EXISTS device_states (
 		mac TEXT PRIMARY KEY,
@@ -64,55 +98,517 @@ func createTables(db *sql.DB) error {
 		is_connected BOOLEAN DEFAULT FALSE,
 		last_gate_trigger DATETIME
 	);
+
+	CREATE TABLE IF NOT EXISTS settings_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		setting TEXT NOT NULL,
+		old_value TEXT,
+		new_value TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_settings_history_timestamp ON settings_history(timestamp);
 	`
 
-	_, err := db.Exec(schema)
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+	if err := addColumn(db, "logs", "count", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	return migrate(db)
+}
+
+// migration takes the schema up one version, within a transaction
+type migration func(tx *sql.Tx) error
+
+// sqlMigration is a migration running a single statement
+func sqlMigration(query string) migration {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+// migrations upgrade the schema one version at a time, migrations[i] takes
+// it from version i to i+1. Only ever append to it.
+var migrations = []migration{
+	// 1: devices move from config.yaml into the database
+	sqlMigration(`CREATE TABLE IF NOT EXISTS devices (
+		mac TEXT PRIMARY KEY COLLATE NOCASE,
+		name TEXT NOT NULL DEFAULT '',
+		enabled BOOLEAN NOT NULL DEFAULT TRUE,
+		gate TEXT NOT NULL DEFAULT '',
+		ssid TEXT NOT NULL DEFAULT '',
+		bypass_cooldown BOOLEAN NOT NULL DEFAULT FALSE,
+		expected_by TEXT NOT NULL DEFAULT '',
+		avatar_url TEXT NOT NULL DEFAULT '',
+		notifications TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`),
+	// 2: device MACs are kept lowercase, the way UniFi reports them
+	sqlMigration(`UPDATE devices SET mac = lower(mac)`),
+	// 3: devices can have their own arrival announcement
+	sqlMigration(`ALTER TABLE devices ADD COLUMN announcement TEXT NOT NULL DEFAULT ''`),
+	// 4: temporary devices of visitors expire
+	sqlMigration(`ALTER TABLE devices ADD COLUMN expires_at DATETIME`),
+	// 5: API tokens for scripts, stored as bcrypt hashes
+	sqlMigration(`CREATE TABLE IF NOT EXISTS api_tokens (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL DEFAULT '',
+		hash TEXT NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME
+	)`),
+	// 6: device MACs are normalized like everywhere else, 2 only lowercased
+	normalizeDeviceMACs,
+}
+
+// normalizeDeviceMACs rewrites the device MACs the way config.NormalizeMAC
+// does, e.g. aa-bb-cc-dd-ee-ff to aa:bb:cc:dd:ee:ff, so they match the ones
+// the app looks them up by. Of devices that turn out to be the same, the
+// most recently updated is kept. MACs that aren't valid are left as they are.
+func normalizeDeviceMACs(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT rowid, mac FROM devices ORDER BY updated_at DESC, rowid DESC`)
+	if err != nil {
+		return err
+	}
+	renames := make(map[int64]string)
+	var duplicates []int64
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var rowid int64
+		var mac string
+		if err := rows.Scan(&rowid, &mac); err != nil {
+			rows.Close()
+			return err
+		}
+		normalized, err := config.NormalizeMAC(mac)
+		if err != nil {
+			continue
+		}
+		if seen[normalized] {
+			duplicates = append(duplicates, rowid)
+			continue
+		}
+		seen[normalized] = true
+		if normalized != mac {
+			renames[rowid] = normalized
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Duplicates go first, the MAC is the primary key
+	for _, rowid := range duplicates {
+		if _, err := tx.Exec(`DELETE FROM devices WHERE rowid = ?`, rowid); err != nil {
+			return err
+		}
+	}
+	for rowid, mac := range renames {
+		if _, err := tx.Exec(`UPDATE devices SET mac = ? WHERE rowid = ?`, mac, rowid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrate applies the migrations the database hasn't seen yet, each in its
+// own transaction along with recording the new schema version
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := migrations[version](tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("schema migration %d: %w", version+1, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM schema_version`); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_version (version) VALUES (?)`, version+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func schemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	return version, err
+}
+
+// SchemaVersion returns the version of the schema, the number of
+// migrations applied
+func (db *DB) SchemaVersion() (int, error) {
+	return schemaVersion(db.DB)
+}
+
+// LatestSchemaVersion is the schema version Initialize migrates to
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
+
+// Inspect opens an existing database read-only and returns its schema
+// version, without creating, migrating or otherwise changing it. It fails if
+// the file is missing, isn't a database or has a schema newer than
+// LatestSchemaVersion.
+func Inspect(dbPath string) (int, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return 0, err
+	}
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	// Databases from before migrations have no schema_version table yet
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'`).Scan(&tables); err != nil {
+		return 0, err
+	}
+	if tables == 0 {
+		return 0, nil
+	}
+
+	version, err := schemaVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	if version > len(migrations) {
+		return version, fmt.Errorf("schema version %d is newer than this build supports (%d)", version, len(migrations))
+	}
+	return version, nil
+}
+
+// addColumn adds a column to a table created by an older version
+func addColumn(db *sql.DB, table, column, definition string) error {
+	var exists int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&exists)
+	if err != nil || exists > 0 {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
 	return err
 }
 
+// SetDedupeWindow makes LogEvent fold an event into the device's latest one
+// if that's identical (same event, direction and APs) and logged within
+// window, counting it instead of writing another row. Gate openings are always written. Zero disables it.
+func (db *DB) SetDedupeWindow(window time.Duration) {
+	db.dedupeWindow = window
+}
+
 func (db *DB) LogEvent(entry *LogEntry) error {
+	var suppressed bool
+	err := db.retryOnBusy(func() (err error) {
+		suppressed, err = db.foldDuplicate(entry)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if suppressed {
+		if entry.Timestamp.IsZero() {
+			entry.Timestamp = time.Now().UTC()
+		}
+		db.publish(*entry)
+		return nil
+	}
+
 	query := `
 		INSERT INTO logs (device_mac, device_name, event, direction, from_ap, to_ap, gate_opened, message)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := db.Exec(query, entry.DeviceMAC, entry.DeviceName, entry.Event, entry.Direction,
-		entry.FromAP, entry.ToAP, entry.GateOpened, entry.Message)
-	return err
+	var result sql.Result
+	err = db.retryOnBusy(func() (err error) {
+		result, err = db.Exec(query, entry.DeviceMAC, entry.DeviceName, entry.Event, entry.Direction,
+			entry.FromAP, entry.ToAP, entry.GateOpened, entry.Message)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if id, err := result.LastInsertId(); err == nil {
+		entry.ID = id
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now().UTC()
+	}
+	entry.Count = 1
+	db.publish(*entry)
+	return nil
 }
 
-func (db *DB) GetLogs(limit int, offset int) ([]LogEntry, error) {
+// foldDuplicate counts entry against the device's latest event if that's
+// identical and within the dedupe window, and reports whether it did, in
+// which case entry isn't written
+func (db *DB) foldDuplicate(entry *LogEntry) (bool, error) {
+	if db.dedupeWindow <= 0 || entry.GateOpened {
+		return false, nil
+	}
+
+	since := time.Now().Add(-db.dedupeWindow).UTC().Format(sqliteTimeFormat)
+	var id int64
+	var count int
+	err := db.QueryRow(`
+		UPDATE logs SET count = count + 1
+		WHERE id = (SELECT MAX(id) FROM logs WHERE device_mac = ?)
+		  AND event = ? AND COALESCE(direction, '') = ?
+		  AND COALESCE(from_ap, '') = ? AND COALESCE(to_ap, '') = ?
+		  AND gate_opened = FALSE AND timestamp >= ?
+		RETURNING id, count
+	`, entry.DeviceMAC, entry.Event, entry.Direction, entry.FromAP, entry.ToAP, since).Scan(&id, &count)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	entry.ID = id
+	entry.Count = count
+	return true, nil
+}
+
+// Subscribe registers a listener for newly logged events. An event folded
+// into an earlier row by the dedupe window is published too, with that row's
+// ID and its updated count. Events are dropped for subscribers that don't
+// keep up, so a slow reader never blocks logging.
+// The returned function unregisters the subscriber and closes the channel.
+func (db *DB) Subscribe(buffer int) (<-chan LogEntry, func()) {
+	ch := make(chan LogEntry, buffer)
+
+	db.subMu.Lock()
+	db.subscribers[ch] = struct{}{}
+	db.subMu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			db.subMu.Lock()
+			delete(db.subscribers, ch)
+			db.subMu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (db *DB) publish(entry LogEntry) {
+	db.subMu.RLock()
+	defer db.subMu.RUnlock()
+
+	for ch := range db.subscribers {
+		select {
+		case ch <- entry:
+		default:
+		}
+	}
+}
+
+// LogFilter narrows down log queries. Zero values match everything.
+type LogFilter struct {
+	DeviceMAC string
+	Event     string
+	Since     time.Time
+	Until     time.Time
+	Limit     int // 0 means no limit
+	Offset    int
+}
+
+// sqliteTimeFormat matches what CURRENT_TIMESTAMP stores
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+func (f LogFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if f.DeviceMAC != "" {
+		conditions = append(conditions, "device_mac = ? COLLATE NOCASE")
+		args = append(args, f.DeviceMAC)
+	}
+	if f.Event != "" {
+		conditions = append(conditions, "event = ?")
+		args = append(args, f.Event)
+	}
+	if !f.Since.IsZero() {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, f.Since.UTC().Format(sqliteTimeFormat))
+	}
+	if !f.Until.IsZero() {
+		conditions = append(conditions, "timestamp < ?")
+		args = append(args, f.Until.UTC().Format(sqliteTimeFormat))
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// EachLog calls fn for every log entry matching filter, newest first, without
+// loading the whole result into memory. Iteration stops at the first error.
+func (db *DB) EachLog(filter LogFilter, fn func(LogEntry) error) error {
+	where, args := filter.where()
 	query := `
 		SELECT id, timestamp, device_mac, device_name, event, direction, 
-		       COALESCE(from_ap, ''), COALESCE(to_ap, ''), gate_opened, message
+		       COALESCE(from_ap, ''), COALESCE(to_ap, ''), gate_opened, message, count
 		FROM logs
-		ORDER BY timestamp DESC
+		` + where + `
+		ORDER BY timestamp DESC, id DESC
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := db.Query(query, limit, offset)
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = -1 // SQLite for no limit
+	}
+	args = append(args, limit, filter.Offset)
+
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var logs []LogEntry
 	for rows.Next() {
 		var log LogEntry
 		err := rows.Scan(&log.ID, &log.Timestamp, &log.DeviceMAC, &log.DeviceName,
-			&log.Event, &log.Direction, &log.FromAP, &log.ToAP, &log.GateOpened, &log.Message)
+			&log.Event, &log.Direction, &log.FromAP, &log.ToAP, &log.GateOpened, &log.Message, &log.Count)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if err := fn(log); err != nil {
+			return err
 		}
+	}
+
+	return rows.Err()
+}
+
+func (db *DB) GetLogs(limit int, offset int) ([]LogEntry, error) {
+	logs, _, err := db.GetLogsFiltered(LogFilter{Limit: limit, Offset: offset})
+	return logs, err
+}
+
+// GetLogsFiltered returns the page of log entries matching filter, newest
+// first, and how many match in total regardless of its limit and offset
+func (db *DB) GetLogsFiltered(filter LogFilter) ([]LogEntry, int, error) {
+	var logs []LogEntry
+	err := db.EachLog(filter, func(log LogEntry) error {
 		logs = append(logs, log)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return logs, nil
+	total, err := db.CountLogs(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+// CountLogs counts the log entries matching filter, ignoring its limit and offset
+func (db *DB) CountLogs(filter LogFilter) (int, error) {
+	where, args := filter.where()
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM logs "+where, args...).Scan(&count)
+	return count, err
+}
+
+// GetLogByID returns a single log entry, nil if there is none with that ID
+func (db *DB) GetLogByID(id int64) (*LogEntry, error) {
+	query := `
+		SELECT id, timestamp, device_mac, device_name, event, direction, 
+		       COALESCE(from_ap, ''), COALESCE(to_ap, ''), gate_opened, message, count
+		FROM logs
+		WHERE id = ?
+	`
+
+	var log LogEntry
+	err := db.QueryRow(query, id).Scan(&log.ID, &log.Timestamp, &log.DeviceMAC, &log.DeviceName,
+		&log.Event, &log.Direction, &log.FromAP, &log.ToAP, &log.GateOpened, &log.Message, &log.Count)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &log, nil
+}
+
+// RecordSettingChanges stores changes made together, all or none
+func (db *DB) RecordSettingChanges(changes []SettingChange) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, change := range changes {
+		if _, err := tx.Exec(`INSERT INTO settings_history (setting, old_value, new_value) VALUES (?, ?, ?)`,
+			change.Setting, change.OldValue, change.NewValue); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetSettingsHistory returns setting changes, newest first
+func (db *DB) GetSettingsHistory(limit, offset int) ([]SettingChange, error) {
+	if limit <= 0 {
+		limit = -1 // SQLite for no limit
+	}
+
+	rows, err := db.Query(`
+		SELECT id, timestamp, setting, COALESCE(old_value, ''), COALESCE(new_value, '')
+		FROM settings_history
+		ORDER BY timestamp DESC, id DESC
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []SettingChange
+	for rows.Next() {
+		var change SettingChange
+		if err := rows.Scan(&change.ID, &change.Timestamp, &change.Setting, &change.OldValue, &change.NewValue); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
 }
 
 func (db *DB) GetLogsByDevice(mac string, limit int) ([]LogEntry, error) {
 	query := `
 		SELECT id, timestamp, device_mac, device_name, event, direction, 
-		       COALESCE(from_ap, ''), COALESCE(to_ap, ''), gate_opened, message
+		       COALESCE(from_ap, ''), COALESCE(to_ap, ''), gate_opened, message, count
 		FROM logs
 		WHERE device_mac = ?
 		ORDER BY timestamp DESC
@@ -129,7 +625,7 @@ func (db *DB) GetLogsByDevice(mac string, limit int) ([]LogEntry, error) {
 	for rows.Next() {
 		var log LogEntry
 		err := rows.Scan(&log.ID, &log.Timestamp, &log.DeviceMAC, &log.DeviceName,
-			&log.Event, &log.Direction, &log.FromAP, &log.ToAP, &log.GateOpened, &log.Message)
+			&log.Event, &log.Direction, &log.FromAP, &log.ToAP, &log.GateOpened, &log.Message, &log.Count)
 		if err != nil {
 			return nil, err
 		}
@@ -148,8 +644,10 @@ func (db *DB) UpdateDeviceState(mac, currentAP string, isConnected bool) error {
 			last_seen = excluded.last_seen,
 			is_connected = excluded.is_connected
 	`
-	_, err := db.Exec(query, mac, currentAP, isConnected)
-	return err
+	return db.retryOnBusy(func() error {
+		_, err := db.Exec(query, mac, currentAP, isConnected)
+		return err
+	})
 }
 
 func (db *DB) GetDeviceState(mac string) (currentAP string, lastSeen time.Time, isConnected bool, err error) {
@@ -162,12 +660,22 @@ func (db *DB) GetDeviceState(mac string) (currentAP string, lastSeen time.Time,
 }
 
 func (db *DB) UpdateLastGateTrigger(mac string) error {
+	// Upsert, the gate can open before the device's first state is stored
 	query := `
-		UPDATE device_states 
-		SET last_gate_trigger = CURRENT_TIMESTAMP 
-		WHERE mac = ?
+		INSERT INTO device_states (mac, last_gate_trigger)
+		VALUES (?, CURRENT_TIMESTAMP)
+		ON CONFLICT(mac) DO UPDATE SET
+			last_gate_trigger = excluded.last_gate_trigger
 	`
-	_, err := db.Exec(query, mac)
+	return db.retryOnBusy(func() error {
+		_, err := db.Exec(query, mac)
+		return err
+	})
+}
+
+// ClearLastGateTrigger forgets when the gate last opened for a device
+func (db *DB) ClearLastGateTrigger(mac string) error {
+	_, err := db.Exec(`UPDATE device_states SET last_gate_trigger = NULL WHERE mac = ? COLLATE NOCASE`, mac)
 	return err
 }
 
@@ -190,7 +698,7 @@ func (db *DB) GetLastGateTrigger(mac string) (time.Time, error) {
 func (db *DB) GetRecentActivity(hours int) ([]LogEntry, error) {
 	query := `
 		SELECT id, timestamp, device_mac, device_name, event, direction, 
-		       COALESCE(from_ap, ''), COALESCE(to_ap, ''), gate_opened, message
+		       COALESCE(from_ap, ''), COALESCE(to_ap, ''), gate_opened, message, count
 		FROM logs
 		WHERE timestamp > datetime('now', '-' || ? || ' hours')
 		ORDER BY timestamp DESC
@@ -206,7 +714,7 @@ func (db *DB) GetRecentActivity(hours int) ([]LogEntry, error) {
 	for rows.Next() {
 		var log LogEntry
 		err := rows.Scan(&log.ID, &log.Timestamp, &log.DeviceMAC, &log.DeviceName,
-			&log.Event, &log.Direction, &log.FromAP, &log.ToAP, &log.GateOpened, &log.Message)
+			&log.Event, &log.Direction, &log.FromAP, &log.ToAP, &log.GateOpened, &log.Message, &log.Count)
 		if err != nil {
 			return nil, err
 		}
@@ -236,12 +744,305 @@ func (db *DB) GetConnectedDevices() (map[string]bool, error) {
 	return connected, nil
 }
 
-// DeleteOldLogs deletes log entries older than the specified number of days
-func (db *DB) DeleteOldLogs(daysToKeep int) (int64, error) {
-	query := `DELETE FROM logs WHERE timestamp < datetime('now', '-' || ? || ' days')`
-	result, err := db.Exec(query, daysToKeep)
+// DevicePresence is whether a device was connected at some point in time, as
+// reconstructed from its connected, roamed and disconnected events
+type DevicePresence struct {
+	DeviceMAC  string    `json:"device_mac"`
+	DeviceName string    `json:"device_name"`
+	Connected  bool      `json:"connected"`
+	AP         string    `json:"ap_mac,omitempty"` // last AP while connected
+	Since      time.Time `json:"since"`            // when the device entered this state
+}
+
+// PresenceAt replays the connection events up to and including at and
+// returns the resulting state of every device that has any, by MAC
+func (db *DB) PresenceAt(at time.Time) (map[string]DevicePresence, error) {
+	query := `
+		SELECT device_mac, COALESCE(device_name, ''), event, COALESCE(to_ap, ''), timestamp
+		FROM logs
+		WHERE event IN ('connected', 'roamed', 'disconnected') AND timestamp <= ?
+		ORDER BY timestamp ASC, id ASC
+	`
+
+	rows, err := db.Query(query, at.UTC().Format(sqliteTimeFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	presence := make(map[string]DevicePresence)
+	for rows.Next() {
+		var mac, name, event, toAP string
+		var timestamp time.Time
+		if err := rows.Scan(&mac, &name, &event, &toAP, &timestamp); err != nil {
+			return nil, err
+		}
+
+		mac = strings.ToUpper(mac)
+		state := presence[mac]
+		state.DeviceMAC = mac
+		if name != "" {
+			state.DeviceName = name
+		}
+
+		switch event {
+		case "disconnected":
+			if state.Connected || state.Since.IsZero() {
+				state.Since = timestamp
+			}
+			state.Connected = false
+			state.AP = ""
+		default:
+			// A roam keeps the device connected since it first showed up
+			if !state.Connected {
+				state.Since = timestamp
+			}
+			state.Connected = true
+			if toAP != "" {
+				state.AP = toAP
+			}
+		}
+		presence[mac] = state
+	}
+
+	return presence, rows.Err()
+}
+
+// OpenBreakdown counts a device's gate opens by direction
+type OpenBreakdown struct {
+	Since    time.Time `json:"since"`
+	Arriving int       `json:"arriving"`
+	Leaving  int       `json:"leaving"`
+	Manual   int       `json:"manual"` // manual opens of the gate, no device makes those, so not in Total
+	Other    int       `json:"other"`  // unknown direction
+	Total    int       `json:"total"`
+}
+
+// GetDeviceOpenBreakdown counts the gate_triggered events of a device since
+// the given time by direction, including ones folded into another entry, and
+// the manual opens alongside them
+func (db *DB) GetDeviceOpenBreakdown(mac string, since time.Time) (*OpenBreakdown, error) {
+	query := `
+		SELECT COALESCE(direction, ''), SUM(count)
+		FROM logs
+		WHERE event = 'gate_triggered' AND device_mac = ? COLLATE NOCASE AND timestamp >= ?
+		GROUP BY direction
+	`
+
+	rows, err := db.Query(query, mac, since.UTC().Format(sqliteTimeFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breakdown := &OpenBreakdown{Since: since}
+	for rows.Next() {
+		var direction string
+		var opens int
+		if err := rows.Scan(&direction, &opens); err != nil {
+			return nil, err
+		}
+
+		switch direction {
+		case "arriving":
+			breakdown.Arriving += opens
+		case "leaving":
+			breakdown.Leaving += opens
+		default:
+			breakdown.Other += opens
+		}
+		breakdown.Total += opens
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Manual opens are logged for the gate, with direction manual, not a device
+	query = `
+		SELECT COALESCE(SUM(count), 0)
+		FROM logs
+		WHERE event = 'gate_triggered' AND direction = 'manual' AND timestamp >= ?
+	`
+	if err := db.QueryRow(query, since.UTC().Format(sqliteTimeFormat)).Scan(&breakdown.Manual); err != nil {
+		return nil, err
+	}
+
+	return breakdown, nil
+}
+
+// Stats summarizes gate opens since a point in time
+type Stats struct {
+	Since       time.Time     `json:"since"`
+	Opens       int           `json:"opens"`
+	ByDevice    []DeviceOpens `json:"by_device"`    // most opens first
+	ByHour      [24]int       `json:"by_hour"`      // opens per hour of the day, in the time zone of since
+	BusiestHour int           `json:"busiest_hour"` // hour with the most opens, -1 without any
+}
+
+// DeviceOpens counts the gate opens of one device
+type DeviceOpens struct {
+	MAC   string `json:"mac"`
+	Name  string `json:"name"`
+	Opens int    `json:"opens"`
+}
+
+// GetStats counts gate_triggered events since the given time, in total, per
+// device and per hour of the day, including ones folded into another entry.
+// Both queries are range scans of the event and timestamp index, so long
+// ranges don't read the rest of the table.
+func (db *DB) GetStats(since time.Time) (*Stats, error) {
+	stats := &Stats{Since: since, ByDevice: []DeviceOpens{}, BusiestHour: -1}
+	from := since.UTC().Format(sqliteTimeFormat)
+
+	rows, err := db.Query(`
+		SELECT device_mac, COALESCE(MAX(device_name), ''), SUM(count)
+		FROM logs
+		WHERE event = 'gate_triggered' AND timestamp >= ?
+		GROUP BY device_mac COLLATE NOCASE
+		ORDER BY 3 DESC, 1
+	`, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var device DeviceOpens
+		if err := rows.Scan(&device.MAC, &device.Name, &device.Opens); err != nil {
+			return nil, err
+		}
+		stats.ByDevice = append(stats.ByDevice, device)
+		stats.Opens += device.Opens
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Timestamps are stored in UTC, shift them into the caller's zone
+	_, offset := since.Zone()
+	hours, err := db.Query(`
+		SELECT CAST(strftime('%H', timestamp, ?) AS INTEGER), SUM(count)
+		FROM logs
+		WHERE event = 'gate_triggered' AND timestamp >= ?
+		GROUP BY 1
+	`, strconv.Itoa(offset)+" seconds", from)
+	if err != nil {
+		return nil, err
+	}
+	defer hours.Close()
+	for hours.Next() {
+		var hour, opens int
+		if err := hours.Scan(&hour, &opens); err != nil {
+			return nil, err
+		}
+		if hour < 0 || hour > 23 {
+			continue
+		}
+		stats.ByHour[hour] = opens
+		if stats.BusiestHour < 0 || opens > stats.ByHour[stats.BusiestHour] {
+			stats.BusiestHour = hour
+		}
+	}
+	return stats, hours.Err()
+}
+
+// DeleteOldLogs deletes log entries older than daysToKeep, except gate
+// openings, which are kept for gateOpenDaysToKeep instead
+func (db *DB) DeleteOldLogs(daysToKeep, gateOpenDaysToKeep int) (int64, error) {
+	query := `
+		DELETE FROM logs WHERE
+			(event != 'gate_triggered' AND timestamp < datetime('now', '-' || ? || ' days')) OR
+			(event = 'gate_triggered' AND timestamp < datetime('now', '-' || ? || ' days'))
+	`
+	result, err := db.Exec(query, daysToKeep, gateOpenDaysToKeep)
 	if err != nil {
 		return 0, err
 	}
 	return result.RowsAffected()
 }
+
+// TrimLogs deletes log entries until at most maxRows are left, oldest first.
+// Gate openings go last, only once no other entries are left to delete.
+func (db *DB) TrimLogs(maxRows int) (int64, error) {
+	query := `
+		DELETE FROM logs WHERE id NOT IN (
+			SELECT id FROM logs
+			ORDER BY event = 'gate_triggered' DESC, timestamp DESC, id DESC
+			LIMIT ?
+		)
+	`
+	result, err := db.Exec(query, maxRows)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Size returns the bytes in use by the database, not counting free pages a
+// VACUUM would give back
+func (db *DB) Size() (int64, error) {
+	var size int64
+	err := db.QueryRow(`
+		SELECT (page_count - freelist_count) * page_size
+		FROM pragma_page_count(), pragma_freelist_count(), pragma_page_size()
+	`).Scan(&size)
+	return size, err
+}
+
+// TrimLogsToSize deletes log entries like TrimLogs, a tenth at a time, until
+// the database uses at most maxBytes or no logs are left
+func (db *DB) TrimLogsToSize(maxBytes int64) (int64, error) {
+	var deleted int64
+	for {
+		size, err := db.Size()
+		if err != nil || size <= maxBytes {
+			return deleted, err
+		}
+
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM logs`).Scan(&count); err != nil {
+			return deleted, err
+		}
+		if count == 0 {
+			return deleted, nil
+		}
+
+		n, err := db.TrimLogs(count - (count+9)/10)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+}
+
+// Vacuum rebuilds the database file, returning space freed by deleted rows
+// to the filesystem
+func (db *DB) Vacuum() error {
+	_, err := db.Exec(`VACUUM`)
+	return err
+}
+
+// Analyze refreshes the statistics the query planner uses to pick indexes
+func (db *DB) Analyze() error {
+	_, err := db.Exec(`ANALYZE`)
+	return err
+}
+
+// IntegrityCheck runs SQLite's integrity check, returning the problems it
+// found or just "ok" for a healthy database
+func (db *DB) IntegrityCheck() ([]string, error) {
+	rows, err := db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
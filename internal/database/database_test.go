@@ -1,9 +1,12 @@
 package database
 
 import (
+	"database/sql"
+	"fmt"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestInitialize(t *testing.T) {
@@ -238,7 +241,7 @@ func TestLogCleanup(t *testing.T) {
 	}
 	
 	// Perform cleanup (delete logs older than 30 days)
-	deleted, err := db.DeleteOldLogs(30)
+	deleted, err := db.DeleteOldLogs(30, 30)
 	if err != nil {
 		t.Fatalf("Failed to cleanup old logs: %v", err)
 	}
@@ -271,6 +274,52 @@ func TestLogCleanup(t *testing.T) {
 	}
 }
 
+func TestLogRetentionByEvent(t *testing.T) {
+	db, err := Initialize(t.TempDir() + "/test_retention.db")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	for _, entry := range []struct {
+		event, message string
+		days           int
+	}{
+		{"connected", "Old connect", 40},
+		{"roamed", "Old roam", 40},
+		{"connected", "Recent connect", 10},
+		{"gate_triggered", "Old open", 200},
+		{"gate_triggered", "Ancient open", 400},
+	} {
+		if _, err := db.Exec(`
+			INSERT INTO logs (device_mac, device_name, event, direction, message, gate_opened, timestamp)
+			VALUES ('aa:bb:cc:dd:ee:01', 'Phone', ?, '', ?, ?, datetime('now', '-' || ? || ' days'))
+		`, entry.event, entry.message, entry.event == "gate_triggered", entry.days); err != nil {
+			t.Fatalf("Failed to insert log: %v", err)
+		}
+	}
+
+	deleted, err := db.DeleteOldLogs(30, 365)
+	if err != nil {
+		t.Fatalf("Failed to delete old logs: %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("Expected 3 entries deleted, got %d", deleted)
+	}
+
+	logs, err := db.GetLogs(10, 0)
+	if err != nil {
+		t.Fatalf("Failed to get logs: %v", err)
+	}
+	kept := map[string]bool{}
+	for _, entry := range logs {
+		kept[entry.Message] = true
+	}
+	if len(logs) != 2 || !kept["Recent connect"] || !kept["Old open"] {
+		t.Errorf("Expected the recent connect and the open within a year kept, got %+v", logs)
+	}
+}
+
 func TestConcurrentAccess(t *testing.T) {
 	dbFile := "test_concurrent.db"
 	defer os.Remove(dbFile)
@@ -533,4 +582,812 @@ func TestDatabaseAdvancedOperations(t *testing.T) {
 			t.Error("Last gate trigger should have a valid timestamp")
 		}
 	})
-}
\ No newline at end of file
+}
+func TestSubscribe(t *testing.T) {
+	db, err := Initialize(t.TempDir() + "/test_subscribe.db")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	events, unsubscribe := db.Subscribe(4)
+
+	t.Run("Receives logged events", func(t *testing.T) {
+		err := db.LogEvent(&LogEntry{
+			DeviceMAC: "aa:bb:cc:dd:ee:01",
+			Event:     "connected",
+			Message:   "Subscribed entry",
+		})
+		if err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+
+		entry := <-events
+		if entry.ID == 0 {
+			t.Error("Published entry should carry its database ID")
+		}
+		if entry.Message != "Subscribed entry" {
+			t.Errorf("Expected message 'Subscribed entry', got %s", entry.Message)
+		}
+	})
+
+	t.Run("Slow subscriber does not block logging", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			if err := db.LogEvent(&LogEntry{DeviceMAC: "aa:bb:cc:dd:ee:01", Event: "connected"}); err != nil {
+				t.Fatalf("Failed to log event %d: %v", i, err)
+			}
+		}
+	})
+
+	t.Run("Unsubscribe closes channel", func(t *testing.T) {
+		unsubscribe()
+		unsubscribe() // must be safe to call twice
+
+		for range events {
+		}
+	})
+}
+
+func TestGetLogByID(t *testing.T) {
+	db, err := Initialize(t.TempDir() + "/test_log_by_id.db")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	entry := &LogEntry{
+		DeviceMAC:  "aa:bb:cc:dd:ee:01",
+		DeviceName: "Phone",
+		Event:      "gate_triggered",
+		Direction:  "arriving",
+		ToAP:       "gate-ap",
+		GateOpened: true,
+		Message:    "Gate opened successfully",
+	}
+	if err := db.LogEvent(entry); err != nil {
+		t.Fatalf("Failed to log event: %v", err)
+	}
+
+	t.Run("Existing ID", func(t *testing.T) {
+		got, err := db.GetLogByID(entry.ID)
+		if err != nil {
+			t.Fatalf("Failed to get log: %v", err)
+		}
+		if got == nil {
+			t.Fatal("Expected a log entry")
+		}
+		if got.ID != entry.ID || got.DeviceName != "Phone" || got.ToAP != "gate-ap" || !got.GateOpened {
+			t.Errorf("Unexpected entry: %+v", got)
+		}
+	})
+
+	t.Run("Missing ID", func(t *testing.T) {
+		got, err := db.GetLogByID(entry.ID + 100)
+		if err != nil {
+			t.Fatalf("Missing entry should not be an error: %v", err)
+		}
+		if got != nil {
+			t.Errorf("Expected no entry, got %+v", got)
+		}
+	})
+}
+
+func TestClearLastGateTrigger(t *testing.T) {
+	db, err := Initialize(t.TempDir() + "/test_clear_trigger.db")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.UpdateLastGateTrigger("AA:BB:CC:DD:EE:01"); err != nil {
+		t.Fatalf("Failed to update last gate trigger: %v", err)
+	}
+
+	// MACs are stored in whatever case they were written with
+	if err := db.ClearLastGateTrigger("aa:bb:cc:dd:ee:01"); err != nil {
+		t.Fatalf("Failed to clear last gate trigger: %v", err)
+	}
+
+	lastTrigger, err := db.GetLastGateTrigger("AA:BB:CC:DD:EE:01")
+	if err != nil {
+		t.Fatalf("Failed to get last gate trigger: %v", err)
+	}
+	if !lastTrigger.IsZero() {
+		t.Errorf("Expected the trigger to be cleared, got %v", lastTrigger)
+	}
+}
+
+func TestSettingsHistory(t *testing.T) {
+	db, err := Initialize(t.TempDir() + "/test_settings_history.db")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RecordSettingChanges([]SettingChange{
+		{Setting: "unifi.poll_interval", OldValue: "1", NewValue: "5"},
+		{Setting: "gate.open_duration", OldValue: "10", NewValue: "15"},
+	}); err != nil {
+		t.Fatalf("Failed to record changes: %v", err)
+	}
+	if err := db.RecordSettingChanges([]SettingChange{
+		{Setting: "unifi.poll_interval", OldValue: "5", NewValue: "2"},
+	}); err != nil {
+		t.Fatalf("Failed to record changes: %v", err)
+	}
+
+	changes, err := db.GetSettingsHistory(0, 0)
+	if err != nil {
+		t.Fatalf("Failed to get settings history: %v", err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("Expected 3 changes, got %d", len(changes))
+	}
+	if latest := changes[0]; latest.Setting != "unifi.poll_interval" || latest.OldValue != "5" || latest.NewValue != "2" {
+		t.Errorf("Expected the latest change first, got %+v", latest)
+	}
+
+	page, err := db.GetSettingsHistory(1, 1)
+	if err != nil {
+		t.Fatalf("Failed to get settings history page: %v", err)
+	}
+	if len(page) != 1 || page[0].ID != changes[1].ID {
+		t.Errorf("Expected the second change, got %+v", page)
+	}
+}
+
+func TestPresenceAt(t *testing.T) {
+	db, err := Initialize(t.TempDir() + "/test_presence.db")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	seed := []struct {
+		at    time.Duration
+		mac   string
+		event string
+		toAP  string
+	}{
+		{8 * time.Hour, "aa:bb:cc:dd:ee:01", "connected", "ap-gate"},
+		{8*time.Hour + time.Minute, "aa:bb:cc:dd:ee:01", "roamed", "ap-house"},
+		{9 * time.Hour, "aa:bb:cc:dd:ee:02", "connected", "ap-house"},
+		{12 * time.Hour, "AA:BB:CC:DD:EE:02", "disconnected", ""},
+		{14 * time.Hour, "aa:bb:cc:dd:ee:02", "gate_triggered", ""},
+		{16 * time.Hour, "aa:bb:cc:dd:ee:01", "disconnected", ""},
+		{18 * time.Hour, "aa:bb:cc:dd:ee:02", "connected", "ap-gate"},
+	}
+	for _, event := range seed {
+		if _, err := db.Exec(`
+			INSERT INTO logs (device_mac, device_name, event, to_ap, timestamp)
+			VALUES (?, ?, ?, ?, ?)
+		`, event.mac, "Device "+event.mac[len(event.mac)-2:], event.event, event.toAP,
+			day.Add(event.at).Format(sqliteTimeFormat)); err != nil {
+			t.Fatalf("Failed to seed event: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		at        time.Duration
+		connected map[string]bool
+		ap        string // of the first device, while connected
+		since     time.Duration
+	}{
+		{"Before any events", 7 * time.Hour, map[string]bool{}, "", 0},
+		{"After a roam", 10 * time.Hour, map[string]bool{"AA:BB:CC:DD:EE:01": true, "AA:BB:CC:DD:EE:02": true}, "ap-house", 8 * time.Hour},
+		{"At the disconnect", 12 * time.Hour, map[string]bool{"AA:BB:CC:DD:EE:01": true, "AA:BB:CC:DD:EE:02": false}, "ap-house", 8 * time.Hour},
+		{"Everyone gone", 17 * time.Hour, map[string]bool{"AA:BB:CC:DD:EE:01": false, "AA:BB:CC:DD:EE:02": false}, "", 16 * time.Hour},
+		{"Back again", 20 * time.Hour, map[string]bool{"AA:BB:CC:DD:EE:01": false, "AA:BB:CC:DD:EE:02": true}, "", 16 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			presence, err := db.PresenceAt(day.Add(tt.at))
+			if err != nil {
+				t.Fatalf("Failed to get presence: %v", err)
+			}
+			if len(presence) != len(tt.connected) {
+				t.Fatalf("Expected %d devices, got %+v", len(tt.connected), presence)
+			}
+			for mac, connected := range tt.connected {
+				if presence[mac].Connected != connected {
+					t.Errorf("Expected %s connected=%v, got %+v", mac, connected, presence[mac])
+				}
+			}
+
+			if first, ok := presence["AA:BB:CC:DD:EE:01"]; ok {
+				if first.AP != tt.ap {
+					t.Errorf("Expected AP %q, got %q", tt.ap, first.AP)
+				}
+				if !first.Since.Equal(day.Add(tt.since)) {
+					t.Errorf("Expected since %v, got %v", day.Add(tt.since), first.Since)
+				}
+			}
+		})
+	}
+}
+
+func TestLogLimits(t *testing.T) {
+	newLimitsDB := func(t *testing.T, rows int, message string) *DB {
+		db, err := Initialize(t.TempDir() + "/test_limits.db")
+		if err != nil {
+			t.Fatalf("Failed to initialize database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		for i := 0; i < rows; i++ {
+			if _, err := db.Exec(`
+				INSERT INTO logs (device_mac, device_name, event, direction, message, timestamp)
+				VALUES (?, ?, 'connected', '', ?, ?)
+			`, "aa:bb:cc:dd:ee:01", fmt.Sprintf("Device %d", i), message,
+				start.Add(time.Duration(i)*time.Minute).Format(sqliteTimeFormat)); err != nil {
+				t.Fatalf("Failed to insert log: %v", err)
+			}
+		}
+		return db
+	}
+
+	t.Run("Row cap keeps the newest", func(t *testing.T) {
+		db := newLimitsDB(t, 50, "")
+
+		trimmed, err := db.TrimLogs(20)
+		if err != nil {
+			t.Fatalf("Failed to trim logs: %v", err)
+		}
+		if trimmed != 30 {
+			t.Errorf("Expected 30 trimmed logs, got %d", trimmed)
+		}
+
+		logs, err := db.GetLogs(100, 0)
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		if len(logs) != 20 {
+			t.Fatalf("Expected 20 logs, got %d", len(logs))
+		}
+		if logs[0].DeviceName != "Device 49" || logs[19].DeviceName != "Device 30" {
+			t.Errorf("Expected Device 49 to Device 30 to survive, got %s to %s", logs[0].DeviceName, logs[19].DeviceName)
+		}
+
+		// Under the cap nothing happens
+		if trimmed, err := db.TrimLogs(20); err != nil || trimmed != 0 {
+			t.Errorf("Expected nothing to trim, got %d (%v)", trimmed, err)
+		}
+	})
+
+	t.Run("Row cap trims gate openings last", func(t *testing.T) {
+		db := newLimitsDB(t, 10, "")
+		for i, at := range []string{"2024-04-01 08:00:00", "2024-04-02 08:00:00"} {
+			if _, err := db.Exec(`
+				INSERT INTO logs (device_mac, device_name, event, direction, gate_opened, message, timestamp)
+				VALUES ('aa:bb:cc:dd:ee:01', ?, 'gate_triggered', 'arriving', TRUE, '', ?)
+			`, fmt.Sprintf("Open %d", i), at); err != nil {
+				t.Fatalf("Failed to insert open: %v", err)
+			}
+		}
+
+		if _, err := db.TrimLogs(5); err != nil {
+			t.Fatalf("Failed to trim logs: %v", err)
+		}
+		logs, err := db.GetLogs(100, 0)
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		var names []string
+		for _, entry := range logs {
+			names = append(names, entry.DeviceName)
+		}
+		want := "Device 9, Device 8, Device 7, Open 1, Open 0"
+		if strings.Join(names, ", ") != want {
+			t.Errorf("Expected %s to survive, got %v", want, names)
+		}
+
+		// With nothing else left, the oldest opening goes too
+		if _, err := db.TrimLogs(1); err != nil {
+			t.Fatalf("Failed to trim logs: %v", err)
+		}
+		if logs, _ := db.GetLogs(100, 0); len(logs) != 1 || logs[0].DeviceName != "Open 1" {
+			t.Errorf("Expected only the newest opening to survive, got %+v", logs)
+		}
+	})
+
+	t.Run("Size cap trims until it fits", func(t *testing.T) {
+		db := newLimitsDB(t, 400, strings.Repeat("x", 1000))
+
+		before, err := db.Size()
+		if err != nil {
+			t.Fatalf("Failed to get size: %v", err)
+		}
+		limit := before / 2
+
+		trimmed, err := db.TrimLogsToSize(limit)
+		if err != nil {
+			t.Fatalf("Failed to trim logs: %v", err)
+		}
+		if trimmed == 0 {
+			t.Fatal("Expected logs to be trimmed")
+		}
+
+		if size, _ := db.Size(); size > limit {
+			t.Errorf("Expected at most %d bytes in use, got %d", limit, size)
+		}
+		logs, err := db.GetLogs(1, 0)
+		if err != nil || len(logs) != 1 || logs[0].DeviceName != "Device 399" {
+			t.Errorf("Expected the newest log to survive, got %+v (%v)", logs, err)
+		}
+	})
+
+	t.Run("Vacuum shrinks the file", func(t *testing.T) {
+		db, err := Initialize(t.TempDir() + "/test_vacuum.db")
+		if err != nil {
+			t.Fatalf("Failed to initialize database: %v", err)
+		}
+		defer db.Close()
+
+		for i := 0; i < 200; i++ {
+			if err := db.LogEvent(&LogEntry{DeviceMAC: "aa:bb:cc:dd:ee:01", Event: "connected", Message: strings.Repeat("x", 1000)}); err != nil {
+				t.Fatalf("Failed to insert log: %v", err)
+			}
+		}
+		if _, err := db.TrimLogs(0); err != nil {
+			t.Fatalf("Failed to trim logs: %v", err)
+		}
+
+		var before, after int64
+		db.QueryRow(`SELECT page_count FROM pragma_page_count()`).Scan(&before)
+		if err := db.Vacuum(); err != nil {
+			t.Fatalf("Failed to vacuum: %v", err)
+		}
+		db.QueryRow(`SELECT page_count FROM pragma_page_count()`).Scan(&after)
+		if after >= before {
+			t.Errorf("Expected fewer pages after VACUUM, got %d before and %d after", before, after)
+		}
+	})
+}
+
+func TestLogDedupe(t *testing.T) {
+	newDedupeDB := func(t *testing.T, window time.Duration) *DB {
+		db, err := Initialize(t.TempDir() + "/test_dedupe.db")
+		if err != nil {
+			t.Fatalf("Failed to initialize database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		db.SetDedupeWindow(window)
+		return db
+	}
+
+	connected := func() *LogEntry {
+		return &LogEntry{DeviceMAC: "aa:bb:cc:dd:ee:01", Event: "connected", Direction: "arriving", ToAP: "ap-gate", Message: "Device connected to network"}
+	}
+
+	t.Run("Rapid identical events are counted", func(t *testing.T) {
+		db := newDedupeDB(t, time.Minute)
+
+		first := connected()
+		for i := 0; i < 5; i++ {
+			entry := connected()
+			if i == 0 {
+				entry = first
+			}
+			if err := db.LogEvent(entry); err != nil {
+				t.Fatalf("Failed to log event: %v", err)
+			}
+			if entry.ID != first.ID || entry.Count != i+1 {
+				t.Errorf("Expected event %d folded into %d with count %d, got %d with count %d", i, first.ID, i+1, entry.ID, entry.Count)
+			}
+		}
+
+		logs, err := db.GetLogs(10, 0)
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		if len(logs) != 1 || logs[0].Count != 5 {
+			t.Errorf("Expected one row with count 5, got %+v", logs)
+		}
+	})
+
+	t.Run("Different events are kept", func(t *testing.T) {
+		db := newDedupeDB(t, time.Minute)
+
+		entries := []*LogEntry{
+			connected(),
+			{DeviceMAC: "aa:bb:cc:dd:ee:01", Event: "connected", Direction: "arriving", ToAP: "ap-house"},
+			{DeviceMAC: "aa:bb:cc:dd:ee:02", Event: "connected", Direction: "arriving", ToAP: "ap-gate"},
+			{DeviceMAC: "aa:bb:cc:dd:ee:01", Event: "disconnected", FromAP: "ap-gate"},
+			{DeviceMAC: "aa:bb:cc:dd:ee:01", Event: "gate_triggered", GateOpened: true},
+			{DeviceMAC: "aa:bb:cc:dd:ee:01", Event: "gate_triggered", GateOpened: true},
+		}
+		for _, entry := range entries {
+			if err := db.LogEvent(entry); err != nil {
+				t.Fatalf("Failed to log event: %v", err)
+			}
+		}
+
+		logs, err := db.GetLogs(10, 0)
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		if len(logs) != len(entries) {
+			t.Errorf("Expected %d rows, got %d", len(entries), len(logs))
+		}
+	})
+
+	t.Run("Folded events are published with their count", func(t *testing.T) {
+		db := newDedupeDB(t, time.Minute)
+		events, unsubscribe := db.Subscribe(4)
+		defer unsubscribe()
+
+		for i := 0; i < 2; i++ {
+			if err := db.LogEvent(connected()); err != nil {
+				t.Fatalf("Failed to log event: %v", err)
+			}
+		}
+		first, folded := <-events, <-events
+		if folded.ID != first.ID || first.Count != 1 || folded.Count != 2 || folded.Timestamp.IsZero() {
+			t.Errorf("Expected the repeat published with count 2, got %+v then %+v", first, folded)
+		}
+	})
+
+	t.Run("Only the device's latest event is folded into", func(t *testing.T) {
+		db := newDedupeDB(t, time.Minute)
+
+		entries := []*LogEntry{
+			connected(),
+			{DeviceMAC: "aa:bb:cc:dd:ee:01", Event: "disconnected", FromAP: "ap-gate"},
+			connected(),
+			{DeviceMAC: "aa:bb:cc:dd:ee:02", Event: "connected", Direction: "arriving", ToAP: "ap-gate"},
+			connected(),
+		}
+		for _, entry := range entries {
+			if err := db.LogEvent(entry); err != nil {
+				t.Fatalf("Failed to log event: %v", err)
+			}
+		}
+
+		logs, err := db.GetLogs(10, 0)
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		if len(logs) != 4 {
+			t.Fatalf("Expected 4 rows, got %+v", logs)
+		}
+		if entries[0].Count != 1 || entries[2].Count != 1 || entries[4].ID != entries[2].ID || entries[4].Count != 2 {
+			t.Errorf("Expected the reconnect written and the last event folded into it, got %+v", logs)
+		}
+	})
+
+	t.Run("Events outside the window are written", func(t *testing.T) {
+		db := newDedupeDB(t, time.Minute)
+
+		if _, err := db.Exec(`
+			INSERT INTO logs (device_mac, device_name, event, direction, to_ap, message, timestamp)
+			VALUES ('aa:bb:cc:dd:ee:01', '', 'connected', 'arriving', 'ap-gate', '', datetime('now', '-5 minutes'))
+		`); err != nil {
+			t.Fatalf("Failed to insert old log: %v", err)
+		}
+		if err := db.LogEvent(connected()); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+
+		logs, err := db.GetLogs(10, 0)
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		if len(logs) != 2 {
+			t.Errorf("Expected 2 rows, got %d", len(logs))
+		}
+	})
+
+	t.Run("Disabled by default", func(t *testing.T) {
+		db := newDedupeDB(t, 0)
+
+		for i := 0; i < 3; i++ {
+			if err := db.LogEvent(connected()); err != nil {
+				t.Fatalf("Failed to log event: %v", err)
+			}
+		}
+
+		logs, err := db.GetLogs(10, 0)
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		if len(logs) != 3 {
+			t.Errorf("Expected 3 rows, got %d", len(logs))
+		}
+	})
+
+	t.Run("Older databases get the count column", func(t *testing.T) {
+		path := t.TempDir() + "/test_old.db"
+		old, err := sql.Open("sqlite3", path)
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		if _, err := old.Exec(`
+			CREATE TABLE logs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+				device_mac TEXT NOT NULL,
+				device_name TEXT,
+				event TEXT NOT NULL,
+				direction TEXT,
+				from_ap TEXT,
+				to_ap TEXT,
+				gate_opened BOOLEAN DEFAULT FALSE,
+				message TEXT
+			);
+			INSERT INTO logs (device_mac, device_name, event, direction, message) VALUES ('aa:bb:cc:dd:ee:01', '', 'connected', '', '');
+		`); err != nil {
+			t.Fatalf("Failed to create old schema: %v", err)
+		}
+		old.Close()
+
+		db, err := Initialize(path)
+		if err != nil {
+			t.Fatalf("Failed to initialize database: %v", err)
+		}
+		defer db.Close()
+
+		logs, err := db.GetLogs(10, 0)
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		if len(logs) != 1 || logs[0].Count != 1 {
+			t.Errorf("Expected the old row with count 1, got %+v", logs)
+		}
+	})
+}
+
+func TestInspect(t *testing.T) {
+	path := t.TempDir() + "/test_inspect.db"
+
+	if _, err := Inspect(path); err == nil {
+		t.Error("Expected a missing database to fail")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Inspect shouldn't create the database")
+	}
+
+	db, err := Initialize(path)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+	if version, err := Inspect(path); err != nil || version != LatestSchemaVersion() {
+		t.Errorf("Expected version %d, got %d (%v)", LatestSchemaVersion(), version, err)
+	}
+
+	t.Run("Newer schema", func(t *testing.T) {
+		if _, err := db.Exec(`UPDATE schema_version SET version = ?`, LatestSchemaVersion()+1); err != nil {
+			t.Fatalf("Failed to bump schema version: %v", err)
+		}
+		if _, err := Inspect(path); err == nil || !strings.Contains(err.Error(), "newer") {
+			t.Errorf("Expected a newer schema to fail, got %v", err)
+		}
+	})
+}
+
+func TestGetDeviceOpenBreakdown(t *testing.T) {
+	db, err := Initialize(t.TempDir() + "/test_breakdown.db")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	seed := []struct {
+		at        time.Duration
+		mac       string
+		event     string
+		direction string
+		count     int
+	}{
+		{-48 * time.Hour, "AA:BB:CC:DD:EE:01", "gate_triggered", "arriving", 1}, // before the window
+		{8 * time.Hour, "AA:BB:CC:DD:EE:01", "gate_triggered", "leaving", 1},
+		{9 * time.Hour, "AA:BB:CC:DD:EE:01", "connected", "", 1},
+		{17 * time.Hour, "aa:bb:cc:dd:ee:01", "gate_triggered", "arriving", 1},
+		{18 * time.Hour, "AA:BB:CC:DD:EE:01", "gate_triggered", "arriving", 2}, // folded duplicate
+		{19 * time.Hour, "manual", "gate_triggered", "manual", 1},
+		{-24 * time.Hour, "manual", "gate_triggered", "manual", 1}, // before the window
+		{19 * time.Hour, "manual", "gate_closed", "manual", 1},
+		{20 * time.Hour, "AA:BB:CC:DD:EE:01", "gate_triggered", "unknown", 1},
+		{20 * time.Hour, "AA:BB:CC:DD:EE:01", "gate_skipped", "arriving", 1},
+		{21 * time.Hour, "AA:BB:CC:DD:EE:02", "gate_triggered", "arriving", 1},
+	}
+	for _, event := range seed {
+		if _, err := db.Exec(`
+			INSERT INTO logs (device_mac, device_name, event, direction, gate_opened, message, count, timestamp)
+			VALUES (?, 'Phone', ?, ?, ?, '', ?, ?)
+		`, event.mac, event.event, event.direction, event.event == "gate_triggered", event.count,
+			day.Add(event.at).Format(sqliteTimeFormat)); err != nil {
+			t.Fatalf("Failed to seed event: %v", err)
+		}
+	}
+
+	breakdown, err := db.GetDeviceOpenBreakdown("aa:bb:cc:dd:ee:01", day)
+	if err != nil {
+		t.Fatalf("Failed to get the breakdown: %v", err)
+	}
+	want := OpenBreakdown{Since: day, Arriving: 3, Leaving: 1, Manual: 1, Other: 1, Total: 5}
+	if *breakdown != want {
+		t.Errorf("Expected %+v, got %+v", want, *breakdown)
+	}
+
+	t.Run("No opens", func(t *testing.T) {
+		breakdown, err := db.GetDeviceOpenBreakdown("AA:BB:CC:DD:EE:03", day)
+		if err != nil {
+			t.Fatalf("Failed to get the breakdown: %v", err)
+		}
+		if breakdown.Total != 0 || breakdown.Arriving != 0 {
+			t.Errorf("Expected no opens, got %+v", breakdown)
+		}
+	})
+}
+
+func TestGetLogsFiltered(t *testing.T) {
+	db, err := Initialize(t.TempDir() + "/test_logs_filtered.db")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	for _, entry := range []LogEntry{
+		{DeviceMAC: "AA:BB:CC:DD:EE:01", Event: "gate_triggered", Message: "first"},
+		{DeviceMAC: "AA:BB:CC:DD:EE:01", Event: "connected", Message: "second"},
+		{DeviceMAC: "AA:BB:CC:DD:EE:02", Event: "gate_triggered", Message: "third"},
+	} {
+		entry := entry
+		if err := db.LogEvent(&entry); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+
+	t.Run("Page and total", func(t *testing.T) {
+		logs, total, err := db.GetLogsFiltered(LogFilter{Event: "gate_triggered", Limit: 1})
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		if total != 2 || len(logs) != 1 || logs[0].Message != "third" {
+			t.Errorf("Expected the newest of 2 opens, got %d of %d: %+v", len(logs), total, logs)
+		}
+	})
+
+	t.Run("Time window", func(t *testing.T) {
+		logs, total, err := db.GetLogsFiltered(LogFilter{Since: time.Now().Add(time.Hour)})
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		if total != 0 || len(logs) != 0 {
+			t.Errorf("Expected nothing in the future, got %d of %d", len(logs), total)
+		}
+	})
+
+	t.Run("Quotes in values are just values", func(t *testing.T) {
+		_, total, err := db.GetLogsFiltered(LogFilter{Event: "x' OR '1'='1"})
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		if total != 0 {
+			t.Errorf("Expected no match, got %d", total)
+		}
+	})
+}
+
+func TestGetStats(t *testing.T) {
+	db, err := Initialize(t.TempDir() + "/test_stats.db")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	seed := []struct {
+		at    time.Duration
+		mac   string
+		name  string
+		event string
+		count int
+	}{
+		{-48 * time.Hour, "AA:BB:CC:DD:EE:01", "Phone", "gate_triggered", 1}, // before the window
+		{8 * time.Hour, "AA:BB:CC:DD:EE:01", "Phone", "gate_triggered", 1},
+		{8*time.Hour + 30*time.Minute, "aa:bb:cc:dd:ee:01", "Phone", "gate_triggered", 2}, // folded duplicate
+		{9 * time.Hour, "AA:BB:CC:DD:EE:01", "Phone", "connected", 1},
+		{17 * time.Hour, "AA:BB:CC:DD:EE:02", "Car", "gate_triggered", 1},
+	}
+	for _, event := range seed {
+		if _, err := db.Exec(`
+			INSERT INTO logs (device_mac, device_name, event, message, count, timestamp)
+			VALUES (?, ?, ?, '', ?, ?)
+		`, event.mac, event.name, event.event, event.count, day.Add(event.at).Format(sqliteTimeFormat)); err != nil {
+			t.Fatalf("Failed to seed logs: %v", err)
+		}
+	}
+
+	t.Run("Totals, devices and hours", func(t *testing.T) {
+		stats, err := db.GetStats(day)
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		if stats.Opens != 4 {
+			t.Errorf("Expected 4 opens, got %d", stats.Opens)
+		}
+		if len(stats.ByDevice) != 2 || stats.ByDevice[0].Name != "Phone" || stats.ByDevice[0].Opens != 3 ||
+			stats.ByDevice[1].Name != "Car" || stats.ByDevice[1].Opens != 1 {
+			t.Errorf("Unexpected opens per device %+v", stats.ByDevice)
+		}
+		if stats.ByHour[8] != 3 || stats.ByHour[17] != 1 || stats.BusiestHour != 8 {
+			t.Errorf("Unexpected hours %v, busiest %d", stats.ByHour, stats.BusiestHour)
+		}
+	})
+
+	t.Run("Hours in the time zone of since", func(t *testing.T) {
+		stats, err := db.GetStats(day.In(time.FixedZone("CEST", 2*60*60)))
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		if stats.ByHour[10] != 3 || stats.ByHour[19] != 1 || stats.BusiestHour != 10 {
+			t.Errorf("Expected hours shifted by 2, got %v", stats.ByHour)
+		}
+	})
+
+	t.Run("Nothing to count", func(t *testing.T) {
+		stats, err := db.GetStats(day.Add(24 * time.Hour))
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		if stats.Opens != 0 || len(stats.ByDevice) != 0 || stats.BusiestHour != -1 {
+			t.Errorf("Expected empty stats, got %+v", stats)
+		}
+	})
+
+	t.Run("Queries use an index", func(t *testing.T) {
+		rows, err := db.Query(`EXPLAIN QUERY PLAN
+			SELECT SUM(count) FROM logs WHERE event = 'gate_triggered' AND timestamp >= ?`, day.Format(sqliteTimeFormat))
+		if err != nil {
+			t.Fatalf("Failed to explain: %v", err)
+		}
+		defer rows.Close()
+		var plan []string
+		for rows.Next() {
+			var id, parent, unused int
+			var detail string
+			if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+				t.Fatalf("Failed to read plan: %v", err)
+			}
+			plan = append(plan, detail)
+		}
+		if joined := strings.Join(plan, "; "); !strings.Contains(joined, "idx_logs_event_timestamp") {
+			t.Errorf("Expected a search of the event and timestamp index, got %s", joined)
+		}
+	})
+}
+
+func TestMaintenance(t *testing.T) {
+	db, err := Initialize(t.TempDir() + "/test_maintenance.db")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.LogEvent(&LogEntry{DeviceMAC: "aa:bb:cc:dd:ee:01", Event: "gate_triggered"}); err != nil {
+		t.Fatalf("Failed to log event: %v", err)
+	}
+
+	results, err := db.IntegrityCheck()
+	if err != nil {
+		t.Fatalf("Failed to check integrity: %v", err)
+	}
+	if len(results) != 1 || results[0] != "ok" {
+		t.Errorf("Expected a healthy database, got %v", results)
+	}
+
+	if err := db.Analyze(); err != nil {
+		t.Fatalf("Failed to analyze: %v", err)
+	}
+	var analyzed int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_stat1 WHERE tbl = 'logs'`).Scan(&analyzed); err != nil || analyzed == 0 {
+		t.Errorf("Expected planner statistics for logs, got %d (%v)", analyzed, err)
+	}
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDeviceExists   = errors.New("device already exists")
+	ErrDeviceNotFound = errors.New("device not found")
+)
+
+// Device is a tracked device as stored in the devices table
+type Device struct {
+	MAC            string
+	Name           string
+	Enabled        bool
+	Gate           string // additional gate the device opens, empty for the primary one
+	SSID           string
+	BypassCooldown bool
+	ExpectedBy     string
+	AvatarURL      string
+	Announcement   string
+	Notifications  string     // JSON of the per-device notification overrides, empty for none
+	ExpiresAt      *time.Time // when a temporary device is removed, nil for a permanent one
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+const deviceColumns = `mac, name, enabled, gate, ssid, bypass_cooldown, expected_by, avatar_url, announcement, notifications, expires_at, created_at, updated_at`
+
+// execer is what inserting a device needs, a DB or a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertDevice(db execer, device *Device) error {
+	_, err := db.Exec(`INSERT INTO devices (`+deviceColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		device.MAC, device.Name, device.Enabled, device.Gate, device.SSID, device.BypassCooldown,
+		device.ExpectedBy, device.AvatarURL, device.Announcement, device.Notifications,
+		device.ExpiresAt, device.CreatedAt, device.UpdatedAt)
+	return err
+}
+
+// AddDevice stores a new device, failing with ErrDeviceExists if its MAC,
+// ignoring case, already is
+func (db *DB) AddDevice(device *Device) error {
+	var exists int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM devices WHERE mac = ?`, device.MAC).Scan(&exists); err != nil {
+		return err
+	}
+	if exists > 0 {
+		return ErrDeviceExists
+	}
+
+	now := time.Now().UTC()
+	device.CreatedAt, device.UpdatedAt = now, now
+	return insertDevice(db, device)
+}
+
+// UpdateDevice stores the changed settings of a device, found by MAC
+func (db *DB) UpdateDevice(device *Device) error {
+	now := time.Now().UTC()
+	result, err := db.Exec(`
+		UPDATE devices SET name = ?, enabled = ?, gate = ?, ssid = ?, bypass_cooldown = ?,
+			expected_by = ?, avatar_url = ?, announcement = ?, notifications = ?, expires_at = ?, updated_at = ?
+		WHERE mac = ?
+	`, device.Name, device.Enabled, device.Gate, device.SSID, device.BypassCooldown,
+		device.ExpectedBy, device.AvatarURL, device.Announcement, device.Notifications, device.ExpiresAt, now, device.MAC)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrDeviceNotFound
+	}
+	device.UpdatedAt = now
+	return nil
+}
+
+// RemoveDevice deletes a device by MAC
+func (db *DB) RemoveDevice(mac string) error {
+	result, err := db.Exec(`DELETE FROM devices WHERE mac = ?`, mac)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+// ListDevices returns all devices in the order they were added
+func (db *DB) ListDevices() ([]Device, error) {
+	rows, err := db.Query(`SELECT ` + deviceColumns + ` FROM devices ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []Device{}
+	for rows.Next() {
+		var device Device
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&device.MAC, &device.Name, &device.Enabled, &device.Gate, &device.SSID,
+			&device.BypassCooldown, &device.ExpectedBy, &device.AvatarURL, &device.Announcement, &device.Notifications,
+			&expiresAt, &device.CreatedAt, &device.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			device.ExpiresAt = &expiresAt.Time
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+// ReplaceDevices replaces all devices at once, e.g. on an import. Devices
+// that were stored before keep their creation time.
+func (db *DB) ReplaceDevices(devices []Device) error {
+	existing, err := db.ListDevices()
+	if err != nil {
+		return err
+	}
+	created := make(map[string]time.Time, len(existing))
+	for _, device := range existing {
+		created[strings.ToUpper(device.MAC)] = device.CreatedAt
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM devices`); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for i := range devices {
+		device := devices[i]
+		device.CreatedAt, device.UpdatedAt = now, now
+		if at, ok := created[strings.ToUpper(device.MAC)]; ok {
+			device.CreatedAt = at
+		}
+		if err := insertDevice(tx, &device); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
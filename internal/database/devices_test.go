@@ -0,0 +1,186 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestDevices(t *testing.T) {
+	db, err := Initialize(t.TempDir() + "/test_devices.db")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	phone := &Device{MAC: "AA:BB:CC:DD:EE:01", Name: "Phone", Enabled: true, Gate: "Garage", Announcement: "Phone is home", Notifications: `{"muted":true}`}
+	if err := db.AddDevice(phone); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+	if phone.CreatedAt.IsZero() || !phone.UpdatedAt.Equal(phone.CreatedAt) {
+		t.Errorf("Expected the timestamps to be set, got %+v", phone)
+	}
+	if err := db.AddDevice(&Device{MAC: "aa:bb:cc:dd:ee:01", Name: "Again"}); !errors.Is(err, ErrDeviceExists) {
+		t.Errorf("Expected ErrDeviceExists ignoring case, got %v", err)
+	}
+	if err := db.AddDevice(&Device{MAC: "AA:BB:CC:DD:EE:02", Name: "Car"}); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+
+	t.Run("List", func(t *testing.T) {
+		devices, err := db.ListDevices()
+		if err != nil {
+			t.Fatalf("Failed to list devices: %v", err)
+		}
+		if len(devices) != 2 || devices[0].MAC != phone.MAC || devices[1].Name != "Car" {
+			t.Fatalf("Expected both devices in the order added, got %+v", devices)
+		}
+		if got := devices[0]; got.Gate != "Garage" || got.Announcement != "Phone is home" || !got.Enabled || got.Notifications != `{"muted":true}` || got.CreatedAt.IsZero() {
+			t.Errorf("Expected the phone's settings back, got %+v", got)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		update := &Device{MAC: "aa:bb:cc:dd:ee:01", Name: "Renamed", SSID: "Home"}
+		if err := db.UpdateDevice(update); err != nil {
+			t.Fatalf("Failed to update device: %v", err)
+		}
+		devices, _ := db.ListDevices()
+		if got := devices[0]; got.Name != "Renamed" || got.Enabled || got.SSID != "Home" || got.UpdatedAt.Before(got.CreatedAt) {
+			t.Errorf("Expected the update to be stored, got %+v", got)
+		}
+		if err := db.UpdateDevice(&Device{MAC: "AA:BB:CC:DD:EE:99"}); !errors.Is(err, ErrDeviceNotFound) {
+			t.Errorf("Expected ErrDeviceNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Replace keeps creation times", func(t *testing.T) {
+		before, _ := db.ListDevices()
+		if err := db.ReplaceDevices([]Device{{MAC: "AA:BB:CC:DD:EE:03", Name: "Bike"}, {MAC: "AA:BB:CC:DD:EE:02", Name: "Car"}}); err != nil {
+			t.Fatalf("Failed to replace devices: %v", err)
+		}
+		devices, _ := db.ListDevices()
+		if len(devices) != 2 || devices[0].Name != "Bike" || devices[1].Name != "Car" {
+			t.Fatalf("Expected the replacement in order, got %+v", devices)
+		}
+		if !devices[1].CreatedAt.Equal(before[1].CreatedAt) {
+			t.Errorf("Expected the car to keep its creation time, got %v, was %v", devices[1].CreatedAt, before[1].CreatedAt)
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		if err := db.RemoveDevice("aa:bb:cc:dd:ee:03"); err != nil {
+			t.Fatalf("Failed to remove device: %v", err)
+		}
+		if err := db.RemoveDevice("aa:bb:cc:dd:ee:03"); !errors.Is(err, ErrDeviceNotFound) {
+			t.Errorf("Expected ErrDeviceNotFound, got %v", err)
+		}
+		if devices, _ := db.ListDevices(); len(devices) != 1 {
+			t.Errorf("Expected one device left, got %+v", devices)
+		}
+	})
+}
+
+func TestMigrations(t *testing.T) {
+	path := t.TempDir() + "/test_migrations.db"
+
+	t.Run("Fresh database is at the latest version", func(t *testing.T) {
+		db, err := Initialize(path)
+		if err != nil {
+			t.Fatalf("Failed to initialize database: %v", err)
+		}
+		defer db.Close()
+
+		if version, err := db.SchemaVersion(); err != nil || version != len(migrations) {
+			t.Errorf("Expected schema version %d, got %d (%v)", len(migrations), version, err)
+		}
+	})
+
+	t.Run("Migrations only run once", func(t *testing.T) {
+		db, err := Initialize(path)
+		if err != nil {
+			t.Fatalf("Failed to reopen database: %v", err)
+		}
+		defer db.Close()
+
+		var rows int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM schema_version`).Scan(&rows); err != nil || rows != 1 {
+			t.Errorf("Expected a single version row, got %d (%v)", rows, err)
+		}
+	})
+
+	t.Run("Database from before versioning is upgraded", func(t *testing.T) {
+		old := t.TempDir() + "/test_unversioned.db"
+		raw, err := sql.Open("sqlite3", old)
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		if _, err := raw.Exec(`CREATE TABLE logs (id INTEGER PRIMARY KEY AUTOINCREMENT, timestamp DATETIME, device_mac TEXT NOT NULL, event TEXT NOT NULL)`); err != nil {
+			t.Fatalf("Failed to create old schema: %v", err)
+		}
+		raw.Close()
+
+		db, err := Initialize(old)
+		if err != nil {
+			t.Fatalf("Failed to upgrade database: %v", err)
+		}
+		defer db.Close()
+
+		if err := db.AddDevice(&Device{MAC: "AA:BB:CC:DD:EE:01", Name: "Phone"}); err != nil {
+			t.Errorf("Expected the devices table after upgrading, got %v", err)
+		}
+	})
+
+	t.Run("Device MACs are normalized and duplicates merged", func(t *testing.T) {
+		old := t.TempDir() + "/test_macs.db"
+		db, err := Initialize(old)
+		if err != nil {
+			t.Fatalf("Failed to initialize database: %v", err)
+		}
+		// As left by version 5, which only lowercased the MACs
+		for _, row := range []struct{ mac, name, updated string }{
+			{"aa-bb-cc-dd-ee-01", "Old Phone", "2024-01-01 00:00:00"},
+			{"aa:bb:cc:dd:ee:01", "Phone", "2024-02-01 00:00:00"},
+			{"aabbccddee02", "Car", "2024-01-01 00:00:00"},
+			{"not a mac", "Broken", "2024-01-01 00:00:00"},
+		} {
+			if _, err := db.Exec(`INSERT INTO devices (mac, name, updated_at) VALUES (?, ?, ?)`, row.mac, row.name, row.updated); err != nil {
+				t.Fatalf("Failed to insert device: %v", err)
+			}
+		}
+		if _, err := db.Exec(`UPDATE schema_version SET version = 5`); err != nil {
+			t.Fatalf("Failed to reset schema version: %v", err)
+		}
+		db.Close()
+
+		db, err = Initialize(old)
+		if err != nil {
+			t.Fatalf("Failed to upgrade database: %v", err)
+		}
+		defer db.Close()
+
+		devices, err := db.ListDevices()
+		if err != nil {
+			t.Fatalf("Failed to list devices: %v", err)
+		}
+		names := make(map[string]string)
+		for _, device := range devices {
+			names[device.MAC] = device.Name
+		}
+		want := map[string]string{"aa:bb:cc:dd:ee:01": "Phone", "aa:bb:cc:dd:ee:02": "Car", "not a mac": "Broken"}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("Expected devices %v, got %v", want, names)
+		}
+
+		// Found again by the MAC the app uses
+		if err := db.UpdateDevice(&Device{MAC: "aa:bb:cc:dd:ee:02", Name: "Truck"}); err != nil {
+			t.Errorf("Expected the migrated device to be updatable, got %v", err)
+		}
+		if err := db.RemoveDevice("aa:bb:cc:dd:ee:01"); err != nil {
+			t.Errorf("Expected the merged device to be removable, got %v", err)
+		}
+	})
+}
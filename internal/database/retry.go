@@ -0,0 +1,51 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// defaultWriteRetries is how often a write is retried on a locked
+	// database unless SetWriteRetries says otherwise
+	defaultWriteRetries = 3
+	// writeRetryBackoff is the wait before the first retry, doubling after
+	writeRetryBackoff = 10 * time.Millisecond
+)
+
+// SetWriteRetries sets how often LogEvent, UpdateDeviceState and
+// UpdateLastGateTrigger retry when SQLite reports the database as busy or
+// locked, so a transient lock doesn't lose a gate opening. Zero disables it.
+func (db *DB) SetWriteRetries(retries int) {
+	db.writeRetries = retries
+}
+
+// retryOnBusy runs write until it doesn't fail on a busy database, retrying
+// at most writeRetries times with a doubling backoff
+func (db *DB) retryOnBusy(write func() error) error {
+	sleep := db.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	backoff := writeRetryBackoff
+	err := write()
+	for attempt := 0; attempt < db.writeRetries && isBusy(err); attempt++ {
+		sleep(backoff)
+		backoff *= 2
+		err = write()
+	}
+	return err
+}
+
+// isBusy reports whether err is SQLite failing on a lock another connection
+// holds, which goes away by itself
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestRetryOnBusy(t *testing.T) {
+	busy := sqlite3.Error{Code: sqlite3.ErrBusy}
+
+	newDB := func(retries int) (*DB, *[]time.Duration) {
+		var waits []time.Duration
+		db := &DB{writeRetries: retries}
+		db.sleep = func(d time.Duration) { waits = append(waits, d) }
+		return db, &waits
+	}
+
+	t.Run("Succeeds on retry", func(t *testing.T) {
+		db, waits := newDB(3)
+		attempts := 0
+		err := db.retryOnBusy(func() error {
+			attempts++
+			if attempts == 1 {
+				return busy
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Expected the retry to succeed, got %v", err)
+		}
+		if attempts != 2 || len(*waits) != 1 {
+			t.Errorf("Expected 2 attempts and 1 wait, got %d and %v", attempts, *waits)
+		}
+	})
+
+	t.Run("Gives up after the retries", func(t *testing.T) {
+		db, waits := newDB(3)
+		attempts := 0
+		err := db.retryOnBusy(func() error {
+			attempts++
+			return busy
+		})
+		if !isBusy(err) {
+			t.Fatalf("Expected the busy error, got %v", err)
+		}
+		if attempts != 4 {
+			t.Errorf("Expected 4 attempts, got %d", attempts)
+		}
+		want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond}
+		for i, wait := range want {
+			if i >= len(*waits) || (*waits)[i] != wait {
+				t.Fatalf("Expected waits %v, got %v", want, *waits)
+			}
+		}
+	})
+
+	t.Run("Other errors aren't retried", func(t *testing.T) {
+		db, _ := newDB(3)
+		attempts := 0
+		failure := errors.New("no such table")
+		if err := db.retryOnBusy(func() error { attempts++; return failure }); err != failure {
+			t.Fatalf("Expected the original error, got %v", err)
+		}
+		if attempts != 1 {
+			t.Errorf("Expected a single attempt, got %d", attempts)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		db, _ := newDB(0)
+		attempts := 0
+		db.retryOnBusy(func() error { attempts++; return busy })
+		if attempts != 1 {
+			t.Errorf("Expected a single attempt, got %d", attempts)
+		}
+	})
+}
+
+func TestLogEventRetriesLockedDatabase(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "locked.db")
+
+	// Fail immediately on a lock rather than waiting in SQLite
+	db, err := Initialize("file:" + dbFile + "?_busy_timeout=0")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	other, err := sql.Open("sqlite3", "file:"+dbFile+"?_busy_timeout=0")
+	if err != nil {
+		t.Fatalf("Failed to open second connection: %v", err)
+	}
+	defer other.Close()
+
+	// Another writer holds the lock until the first retry waits
+	tx, err := other.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE device_states SET is_connected = 0"); err != nil {
+		t.Fatalf("Failed to take the write lock: %v", err)
+	}
+	waits := 0
+	db.sleep = func(time.Duration) {
+		waits++
+		tx.Rollback()
+	}
+
+	if err := db.LogEvent(&LogEntry{DeviceMAC: "AA:BB:CC:DD:EE:01", Event: "connected"}); err != nil {
+		t.Fatalf("Expected the write to succeed on retry, got %v", err)
+	}
+	if waits == 0 {
+		t.Error("Expected the write to hit the lock and retry")
+	}
+
+	logs, err := db.GetLogs(10, 0)
+	if err != nil {
+		t.Fatalf("Failed to get logs: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Errorf("Expected 1 log entry, got %d", len(logs))
+	}
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrTokenNotFound = errors.New("API token not found")
+
+// APIToken is an API token as stored in the api_tokens table. Only the
+// hash of the token is kept, the ID is the part of it in the clear.
+type APIToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Hash       string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+const tokenColumns = `id, name, hash, created_at, last_used_at`
+
+// AddAPIToken stores a new API token
+func (db *DB) AddAPIToken(token *APIToken) error {
+	token.CreatedAt = time.Now().UTC()
+	_, err := db.Exec(`INSERT INTO api_tokens (`+tokenColumns+`) VALUES (?, ?, ?, ?, ?)`,
+		token.ID, token.Name, token.Hash, token.CreatedAt, token.LastUsedAt)
+	return err
+}
+
+// GetAPIToken returns the API token with the given ID
+func (db *DB) GetAPIToken(id string) (*APIToken, error) {
+	token, err := scanAPIToken(db.QueryRow(`SELECT `+tokenColumns+` FROM api_tokens WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTokenNotFound
+	}
+	return token, err
+}
+
+// ListAPITokens returns all API tokens, oldest first
+func (db *DB) ListAPITokens() ([]APIToken, error) {
+	rows, err := db.Query(`SELECT ` + tokenColumns + ` FROM api_tokens ORDER BY created_at, rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+// TouchAPIToken records that a token was just used
+func (db *DB) TouchAPIToken(id string, at time.Time) error {
+	_, err := db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, at.UTC(), id)
+	return err
+}
+
+// RemoveAPIToken revokes an API token by ID
+func (db *DB) RemoveAPIToken(id string) error {
+	result, err := db.Exec(`DELETE FROM api_tokens WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// rowScanner is a single row or rows positioned on one
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIToken(row rowScanner) (*APIToken, error) {
+	var token APIToken
+	var lastUsed sql.NullTime
+	if err := row.Scan(&token.ID, &token.Name, &token.Hash, &token.CreatedAt, &lastUsed); err != nil {
+		return nil, err
+	}
+	if lastUsed.Valid {
+		token.LastUsedAt = &lastUsed.Time
+	}
+	return &token, nil
+}
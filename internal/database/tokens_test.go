@@ -0,0 +1,59 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAPITokens(t *testing.T) {
+	db, err := Initialize(t.TempDir() + "/test_tokens.db")
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	script := &APIToken{ID: "0a1b2c3d", Name: "Script", Hash: "hash"}
+	if err := db.AddAPIToken(script); err != nil {
+		t.Fatalf("Failed to add token: %v", err)
+	}
+	if script.CreatedAt.IsZero() {
+		t.Error("Expected the creation time to be set")
+	}
+	if err := db.AddAPIToken(&APIToken{ID: "0a1b2c3d", Name: "Again", Hash: "other"}); err == nil {
+		t.Error("Expected a duplicate ID to be rejected")
+	}
+	if err := db.AddAPIToken(&APIToken{ID: "4e5f6a7b", Name: "Home Assistant", Hash: "hash2"}); err != nil {
+		t.Fatalf("Failed to add token: %v", err)
+	}
+
+	got, err := db.GetAPIToken("0a1b2c3d")
+	if err != nil || got.Name != "Script" || got.Hash != "hash" || got.LastUsedAt != nil {
+		t.Fatalf("Expected the stored token, got %+v (%v)", got, err)
+	}
+	if _, err := db.GetAPIToken("ffffffff"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("Expected ErrTokenNotFound, got %v", err)
+	}
+
+	used := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	if err := db.TouchAPIToken("0a1b2c3d", used); err != nil {
+		t.Fatalf("Failed to touch token: %v", err)
+	}
+	tokens, err := db.ListAPITokens()
+	if err != nil || len(tokens) != 2 || tokens[0].ID != "0a1b2c3d" || tokens[1].Name != "Home Assistant" {
+		t.Fatalf("Expected both tokens oldest first, got %+v (%v)", tokens, err)
+	}
+	if tokens[0].LastUsedAt == nil || !tokens[0].LastUsedAt.Equal(used) {
+		t.Errorf("Expected the last use to be recorded, got %v", tokens[0].LastUsedAt)
+	}
+
+	if err := db.RemoveAPIToken("0a1b2c3d"); err != nil {
+		t.Fatalf("Failed to remove token: %v", err)
+	}
+	if err := db.RemoveAPIToken("0a1b2c3d"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("Expected ErrTokenNotFound removing again, got %v", err)
+	}
+	if tokens, _ := db.ListAPITokens(); len(tokens) != 1 {
+		t.Errorf("Expected one token left, got %+v", tokens)
+	}
+}
@@ -1,62 +1,265 @@
 package gate
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+// ErrDebounced is returned when a trigger arrives too soon after the previous
+// successful one for the same gate. The gate is already opening, so callers
+// should treat it as skipped rather than failed.
+var ErrDebounced = errors.New("gate trigger debounced")
+
 type Controller struct {
 	triggerURL string
+	closeURL   string // optional, empty when the gate can't be closed remotely
 	client     *http.Client
 	logger     *logrus.Logger
+
+	// Optional check of the open response body, for relays answering 200
+	// even when they didn't switch
+	successKey   string
+	successValue string
+
+	// Optional credentials sent with every request, see SetAuth
+	username    string
+	password    string
+	bearerToken string
+
+	// How opens are requested, see SetAPIVersion and SetMethod
+	apiVersion  string
+	switchID    int
+	toggleAfter int
+	method      string
+	body        string
+
+	mu         sync.Mutex
+	debounce   time.Duration
+	lastOpened map[string]time.Time // last successful trigger, per trigger URL
+	now        func() time.Time
 }
 
 func NewController(triggerURL string, logger *logrus.Logger) *Controller {
 	return &Controller{
 		triggerURL: triggerURL,
 		client: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout:   10 * time.Second,
+			Transport: newTransport(false, 0),
 		},
-		logger: logger,
+		logger:     logger,
+		apiVersion: APIGen1,
+		method:     http.MethodGet,
+		lastOpened: make(map[string]time.Time),
+		now:        time.Now,
 	}
 }
 
+// SetDebounce drops triggers arriving within window of the previous successful
+// one for the same gate, e.g. a manual and an automatic open in the same
+// instant. Zero disables it.
+func (c *Controller) SetDebounce(window time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.debounce = window
+}
+
 func (c *Controller) OpenGate() error {
-	if c.triggerURL == "" {
+	c.mu.Lock()
+	triggerURL := c.triggerURL
+	if triggerURL == "" {
+		c.mu.Unlock()
 		return fmt.Errorf("gate trigger URL not configured")
 	}
 
-	c.logger.Infof("Triggering gate open via: %s", c.triggerURL)
+	last, opened := c.lastOpened[triggerURL]
+	if opened && c.debounce > 0 {
+		if since := c.now().Sub(last); since < c.debounce {
+			c.mu.Unlock()
+			c.logger.Infof("Dropping gate trigger, previous one was %v ago", since.Round(time.Millisecond))
+			return fmt.Errorf("%w: previous trigger %v ago", ErrDebounced, since.Round(time.Millisecond))
+		}
+	}
 
-	resp, err := c.client.Get(c.triggerURL)
+	req, err := c.openRequest(triggerURL)
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	check := responseCheck{rpc: c.apiVersion == APIGen2, key: c.successKey, value: c.successValue}
+
+	// Claim the trigger before sending it, so a concurrent one is debounced
+	// without holding mu across the request
+	triggeredAt := c.now()
+	c.lastOpened[triggerURL] = triggeredAt
+	c.mu.Unlock()
+
+	c.logger.Infof("Triggering gate open via: %s", triggerURL)
+	if err := c.trigger(req, check); err != nil {
+		// A failed trigger doesn't start the window
+		c.mu.Lock()
+		if c.lastOpened[triggerURL] == triggeredAt {
+			if opened {
+				c.lastOpened[triggerURL] = last
+			} else {
+				delete(c.lastOpened, triggerURL)
+			}
+		}
+		c.mu.Unlock()
+		return err
+	}
+
+	c.logger.Info("Gate opened successfully")
+	return nil
+}
+
+// CloseGate fires the close URL, for relays with a separate close action
+func (c *Controller) CloseGate() error {
+	c.mu.Lock()
+	closeURL := c.closeURL
+	if closeURL == "" {
+		c.mu.Unlock()
+		return fmt.Errorf("gate close URL not configured")
+	}
+	req, err := http.NewRequest(http.MethodGet, closeURL, nil)
+	if err == nil {
+		c.authorize(req)
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	c.logger.Infof("Triggering gate close via: %s", closeURL)
+	if err := c.trigger(req, responseCheck{}); err != nil {
+		return err
+	}
+
+	c.logger.Info("Gate closed successfully")
+	return nil
+}
+
+// openRequest builds the request opening the gate for the API version.
+// Callers must hold mu.
+func (c *Controller) openRequest(triggerURL string) (*http.Request, error) {
+	var req *http.Request
+	var err error
+	switch {
+	case c.apiVersion == APIGen2:
+		req, err = newSwitchSetRequest(triggerURL, c.switchID, c.toggleAfter)
+	case c.body != "" && c.method != http.MethodGet:
+		req, err = http.NewRequest(c.method, triggerURL, strings.NewReader(c.body))
+		if err == nil {
+			req.Header.Set("Content-Type", bodyContentType(c.body))
+		}
+	default:
+		req, err = http.NewRequest(c.method, triggerURL, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(req)
+	return req, nil
+}
+
+// bodyContentType guesses the content type of a configured body: JSON if it
+// parses as such, form data otherwise, e.g. "turn=on"
+func bodyContentType(body string) string {
+	if json.Valid([]byte(body)) {
+		return "application/json"
+	}
+	return "application/x-www-form-urlencoded"
+}
+
+// authorize adds the configured credentials to req. Callers must hold mu.
+func (c *Controller) authorize(req *http.Request) {
+	switch {
+	case c.bearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	case c.username != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+}
+
+// responseCheck is what a relay's response must satisfy beyond its status
+type responseCheck struct {
+	rpc   bool   // a Gen2 RPC response, failing with an error object
+	key   string // optional JSON path that must hold value
+	value string
+}
+
+// trigger sends a relay request and checks that the relay accepted it
+func (c *Controller) trigger(req *http.Request, check responseCheck) error {
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("failed to trigger gate: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	if check.rpc {
+		// Gen2 explains failures in an error object, often with a non-2xx status
+		doc, err := decodeResponse(resp.Body)
+		if err == nil {
+			if rpcErr := checkRPCError(doc); rpcErr != nil {
+				return rpcErr
+			}
+		}
+		if !successStatus(resp.StatusCode) {
+			return fmt.Errorf("gate trigger returned status %d", resp.StatusCode)
+		}
+		if err != nil {
+			return err
+		}
+		if check.key != "" {
+			return checkSuccessValue(doc, check.key, check.value)
+		}
+		return nil
+	}
+
+	if !successStatus(resp.StatusCode) {
 		return fmt.Errorf("gate trigger returned status %d", resp.StatusCode)
 	}
 
-	c.logger.Info("Gate opened successfully")
+	if check.key != "" {
+		doc, err := decodeResponse(resp.Body)
+		if err != nil {
+			return err
+		}
+		return checkSuccessValue(doc, check.key, check.value)
+	}
 	return nil
 }
 
+// successStatus reports whether a relay accepted a request, any 2xx status
+func successStatus(code int) bool {
+	return code >= 200 && code < 300
+}
+
 func (c *Controller) TestConnection() error {
-	if c.triggerURL == "" {
+	c.mu.Lock()
+	triggerURL := c.triggerURL
+	if triggerURL == "" {
+		c.mu.Unlock()
 		return fmt.Errorf("gate trigger URL not configured")
 	}
 
 	// Try to reach the endpoint with a HEAD request
-	req, err := http.NewRequest("HEAD", c.triggerURL, nil)
+	req, err := http.NewRequest("HEAD", triggerURL, nil)
+	if err == nil {
+		c.authorize(req)
+	}
+	c.mu.Unlock()
 	if err != nil {
 		return err
 	}
 
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("failed to connect to gate controller: %w", err)
 	}
@@ -71,5 +274,81 @@ func (c *Controller) TestConnection() error {
 }
 
 func (c *Controller) UpdateURL(newURL string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.triggerURL = newURL
 }
+
+// SetSuccessCheck makes opens succeed only if the relay's JSON response has
+// value at key, a dot-separated path such as "ison" or "relays.0.ison".
+// An empty key only checks the status code.
+func (c *Controller) SetSuccessCheck(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.successKey = key
+	c.successValue = value
+}
+
+// SetAuth sends credentials with every request, for relays behind an
+// authenticating proxy: a bearer token if set, otherwise basic auth if
+// username is set. All empty sends none.
+func (c *Controller) SetAuth(username, password, bearerToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.username = username
+	c.password = password
+	c.bearerToken = bearerToken
+}
+
+// SetAPIVersion picks how opens are requested: APIGen1 GETs the trigger URL,
+// APIGen2 posts a Switch.Set call for switchID to it, switching back after
+// toggleAfter seconds unless zero. Empty means APIGen1.
+func (c *Controller) SetAPIVersion(version string, switchID, toggleAfter int) error {
+	if version == "" {
+		version = APIGen1
+	}
+	if version != APIGen1 && version != APIGen2 {
+		return fmt.Errorf("unknown Shelly API version %q", version)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.apiVersion = version
+	c.switchID = switchID
+	c.toggleAfter = toggleAfter
+	return nil
+}
+
+// ValidMethod reports whether opens can use method, empty meaning GET
+func ValidMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case "", http.MethodGet, http.MethodPost, http.MethodPut:
+		return true
+	}
+	return false
+}
+
+// SetMethod sets the HTTP method of Gen1 opens, GET unless changed, and a
+// body sent with methods other than GET. An empty method means GET.
+func (c *Controller) SetMethod(method, body string) error {
+	if !ValidMethod(method) {
+		return fmt.Errorf("unsupported gate trigger method %q", method)
+	}
+	method = strings.ToUpper(method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.method = method
+	c.body = body
+	return nil
+}
+
+// UpdateCloseURL changes the close URL, empty disables closing
+func (c *Controller) UpdateCloseURL(newURL string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeURL = newURL
+}
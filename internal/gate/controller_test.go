@@ -1,9 +1,18 @@
 package gate
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -101,7 +110,9 @@ func TestOpenGate(t *testing.T) {
 			shouldFail bool
 		}{
 			{http.StatusOK, false},
-			{http.StatusCreated, true}, // Only 200 OK is accepted
+			{http.StatusCreated, false},
+			{http.StatusNoContent, false}, // Any 2xx is accepted
+			{http.StatusMultipleChoices, true},
 			{http.StatusNotFound, true},
 			{http.StatusUnauthorized, true},
 			{http.StatusForbidden, true},
@@ -333,4 +344,506 @@ func TestControllerEdgeCases(t *testing.T) {
 			t.Error("Should fail after updating to empty URL")
 		}
 	})
-}
\ No newline at end of file
+}
+func TestOpenGateIPv6(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel) // Suppress log output in tests
+
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback not available: %v", err)
+	}
+
+	var gotPath string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.RequestURI()
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	controller := NewController(server.URL+"/relay/0?turn=on", logger)
+	if err := controller.OpenGate(); err != nil {
+		t.Fatalf("Failed to open gate over IPv6: %v", err)
+	}
+	if gotPath != "/relay/0?turn=on" {
+		t.Errorf("Expected request for /relay/0?turn=on, got %q", gotPath)
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	newRelay := func(t *testing.T) (string, *int32) {
+		var hits int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			w.WriteHeader(http.StatusOK)
+		}))
+		t.Cleanup(server.Close)
+		return server.URL, &hits
+	}
+
+	newDebounced := func(url string, window time.Duration) (*Controller, *time.Time) {
+		controller := NewController(url, logger)
+		controller.SetDebounce(window)
+		now := time.Date(2024, 5, 1, 17, 0, 0, 0, time.UTC)
+		controller.now = func() time.Time { return now }
+		return controller, &now
+	}
+
+	t.Run("Second open within the window is dropped", func(t *testing.T) {
+		url, hits := newRelay(t)
+		controller, now := newDebounced(url, 5*time.Second)
+
+		if err := controller.OpenGate(); err != nil {
+			t.Fatalf("First open should succeed: %v", err)
+		}
+		*now = now.Add(time.Second)
+		if err := controller.OpenGate(); !errors.Is(err, ErrDebounced) {
+			t.Errorf("Expected ErrDebounced, got %v", err)
+		}
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected 1 trigger at the relay, got %d", got)
+		}
+
+		*now = now.Add(5 * time.Second)
+		if err := controller.OpenGate(); err != nil {
+			t.Errorf("Open after the window should succeed: %v", err)
+		}
+		if got := atomic.LoadInt32(hits); got != 2 {
+			t.Errorf("Expected 2 triggers at the relay, got %d", got)
+		}
+	})
+
+	t.Run("Concurrent opens reach the relay once", func(t *testing.T) {
+		url, hits := newRelay(t)
+		controller, _ := newDebounced(url, 5*time.Second)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				controller.OpenGate()
+			}()
+		}
+		wg.Wait()
+
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected 1 trigger at the relay, got %d", got)
+		}
+	})
+
+	t.Run("Disabled without a window", func(t *testing.T) {
+		url, hits := newRelay(t)
+		controller, _ := newDebounced(url, 0)
+
+		for i := 0; i < 2; i++ {
+			if err := controller.OpenGate(); err != nil {
+				t.Fatalf("Open should succeed: %v", err)
+			}
+		}
+		if got := atomic.LoadInt32(hits); got != 2 {
+			t.Errorf("Expected 2 triggers at the relay, got %d", got)
+		}
+	})
+
+	t.Run("Failed triggers don't start the window", func(t *testing.T) {
+		var hits int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&hits, 1) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		controller, _ := newDebounced(server.URL, 5*time.Second)
+
+		if err := controller.OpenGate(); err == nil || errors.Is(err, ErrDebounced) {
+			t.Fatalf("Expected the relay error, got %v", err)
+		}
+		if err := controller.OpenGate(); err != nil {
+			t.Errorf("Retry should reach the relay: %v", err)
+		}
+	})
+
+	t.Run("A slow relay doesn't block the controller", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		controller, _ := newDebounced(server.URL, 5*time.Second)
+
+		opened := make(chan error, 1)
+		go func() { opened <- controller.OpenGate() }()
+		time.Sleep(50 * time.Millisecond)
+
+		updated := make(chan struct{})
+		go func() {
+			controller.UpdateCloseURL(server.URL + "/close")
+			close(updated)
+		}()
+		select {
+		case <-updated:
+		case <-time.After(2 * time.Second):
+			t.Error("Expected UpdateCloseURL not to wait for the open")
+		}
+		if err := controller.OpenGate(); !errors.Is(err, ErrDebounced) {
+			t.Errorf("Expected an open while one is in flight to be debounced, got %v", err)
+		}
+
+		close(release)
+		if err := <-opened; err != nil {
+			t.Errorf("Expected the open to succeed, got %v", err)
+		}
+	})
+
+	t.Run("Each gate has its own window", func(t *testing.T) {
+		first, firstHits := newRelay(t)
+		second, secondHits := newRelay(t)
+		controller, _ := newDebounced(first, 5*time.Second)
+
+		if err := controller.OpenGate(); err != nil {
+			t.Fatalf("Open should succeed: %v", err)
+		}
+		controller.UpdateURL(second)
+		if err := controller.OpenGate(); err != nil {
+			t.Errorf("Open of another gate should succeed: %v", err)
+		}
+		if atomic.LoadInt32(firstHits) != 1 || atomic.LoadInt32(secondHits) != 1 {
+			t.Errorf("Expected one trigger per gate, got %d and %d", atomic.LoadInt32(firstHits), atomic.LoadInt32(secondHits))
+		}
+	})
+}
+
+func TestCloseGate(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	t.Run("Hits the close URL", func(t *testing.T) {
+		var path string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		controller := NewController(server.URL+"/open", logger)
+		controller.UpdateCloseURL(server.URL + "/close")
+
+		if err := controller.CloseGate(); err != nil {
+			t.Fatalf("CloseGate should succeed: %v", err)
+		}
+		if path != "/close" {
+			t.Errorf("Expected a request to /close, got %s", path)
+		}
+	})
+
+	t.Run("Not configured", func(t *testing.T) {
+		controller := NewController("http://test.com/trigger", logger)
+
+		err := controller.CloseGate()
+		if err == nil || err.Error() != "gate close URL not configured" {
+			t.Errorf("Expected error 'gate close URL not configured', got %v", err)
+		}
+	})
+
+	t.Run("Server Error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		controller := NewController(server.URL, logger)
+		controller.UpdateCloseURL(server.URL)
+
+		if err := controller.CloseGate(); err == nil {
+			t.Error("CloseGate should fail with 500 status")
+		}
+	})
+}
+
+func TestSuccessBodyCheck(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	tests := []struct {
+		name    string
+		body    string
+		key     string
+		value   string
+		wantErr bool
+	}{
+		{"Relay switched", `{"ison": true, "has_timer": true}`, "ison", "true", false},
+		{"Relay didn't switch", `{"ison": false, "has_timer": false}`, "ison", "true", true},
+		{"Nested path", `{"relays": [{"ison": true}]}`, "relays.0.ison", "true", false},
+		{"String value", `{"state": "on"}`, "state", "on", false},
+		{"Missing key", `{"output": true}`, "ison", "true", true},
+		{"Not JSON", `OK`, "ison", "true", true},
+		{"No check configured", `OK`, "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			controller := NewController(server.URL, logger)
+			controller.SetSuccessCheck(tt.key, tt.value)
+
+			err := controller.OpenGate()
+			if tt.wantErr && err == nil {
+				t.Error("OpenGate should fail")
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("OpenGate should succeed: %v", err)
+			}
+		})
+	}
+
+	t.Run("Failed check doesn't debounce the retry", func(t *testing.T) {
+		var hits int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ison := atomic.AddInt32(&hits, 1) > 1
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"ison": ` + strconv.FormatBool(ison) + `}`))
+		}))
+		defer server.Close()
+
+		controller := NewController(server.URL, logger)
+		controller.SetSuccessCheck("ison", "true")
+		controller.SetDebounce(time.Minute)
+
+		if err := controller.OpenGate(); err == nil {
+			t.Fatal("First open should fail, the relay didn't switch")
+		}
+		if err := controller.OpenGate(); err != nil {
+			t.Errorf("Retry should succeed: %v", err)
+		}
+	})
+}
+
+func TestGen2RPC(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	t.Run("Posts a Switch.Set call", func(t *testing.T) {
+		var call struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				ID          int  `json:"id"`
+				On          bool `json:"on"`
+				ToggleAfter int  `json:"toggle_after"`
+			} `json:"params"`
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" || r.URL.Path != "/rpc" {
+				t.Errorf("Expected POST /rpc, got %s %s", r.Method, r.URL.Path)
+			}
+			if err := json.NewDecoder(r.Body).Decode(&call); err != nil {
+				t.Errorf("Failed to decode RPC call: %v", err)
+			}
+			w.Write([]byte(`{"id":1,"src":"shellyplus1-a8032ab12345","result":{"was_on":false}}`))
+		}))
+		defer server.Close()
+
+		controller := NewController(server.URL+"/rpc", logger)
+		if err := controller.SetAPIVersion(APIGen2, 1, 10); err != nil {
+			t.Fatalf("Failed to set API version: %v", err)
+		}
+		if err := controller.OpenGate(); err != nil {
+			t.Fatalf("OpenGate should succeed: %v", err)
+		}
+
+		if call.Method != "Switch.Set" || call.Params.ID != 1 || !call.Params.On || call.Params.ToggleAfter != 10 {
+			t.Errorf("Unexpected RPC call: %+v", call)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"Error object with 200", http.StatusOK, `{"id":1,"error":{"code":-103,"message":"No such component"}}`, "No such component (code -103)"},
+		{"Error object with 500", http.StatusInternalServerError, `{"id":1,"error":{"code":-114,"message":"Resource unavailable"}}`, "Resource unavailable"},
+		{"Error status without JSON", http.StatusNotFound, `Not Found`, "status 404"},
+		{"Not JSON", http.StatusOK, `OK`, "invalid JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			controller := NewController(server.URL+"/rpc", logger)
+			controller.SetAPIVersion(APIGen2, 0, 0)
+
+			err := controller.OpenGate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("Gen1 is the default", func(t *testing.T) {
+		var method string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		controller := NewController(server.URL, logger)
+		if err := controller.SetAPIVersion("", 0, 0); err != nil {
+			t.Fatalf("Empty API version should mean gen1: %v", err)
+		}
+		if err := controller.OpenGate(); err != nil {
+			t.Fatalf("OpenGate should succeed: %v", err)
+		}
+		if method != "GET" {
+			t.Errorf("Expected GET, got %s", method)
+		}
+
+		if err := controller.SetAPIVersion("gen3", 0, 0); err == nil {
+			t.Error("Expected an error for an unknown API version")
+		}
+	})
+}
+
+func TestAuth(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	var mu sync.Mutex
+	var authorization []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		username    string
+		password    string
+		bearerToken string
+		want        string
+	}{
+		{"No credentials", "", "", "", ""},
+		{"Basic auth", "admin", "secret", "", "Basic YWRtaW46c2VjcmV0"},
+		{"Bearer token", "", "", "abc123", "Bearer abc123"},
+		{"Bearer token wins", "admin", "secret", "abc123", "Bearer abc123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authorization = nil
+			controller := NewController(server.URL, logger)
+			controller.UpdateCloseURL(server.URL + "/close")
+			controller.SetAuth(tt.username, tt.password, tt.bearerToken)
+
+			if err := controller.OpenGate(); err != nil {
+				t.Fatalf("OpenGate failed: %v", err)
+			}
+			if err := controller.TestConnection(); err != nil {
+				t.Fatalf("TestConnection failed: %v", err)
+			}
+			if err := controller.CloseGate(); err != nil {
+				t.Fatalf("CloseGate failed: %v", err)
+			}
+
+			if len(authorization) != 3 {
+				t.Fatalf("Expected 3 requests, got %d", len(authorization))
+			}
+			for i, got := range authorization {
+				if got != tt.want {
+					t.Errorf("Request %d: expected Authorization %q, got %q", i, tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMethod(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	type request struct {
+		method      string
+		contentType string
+		body        string
+	}
+	var got request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = request{r.Method, r.Header.Get("Content-Type"), string(body)}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   request
+	}{
+		{"Default GET", "", "", request{"GET", "", ""}},
+		{"GET ignores the body", "GET", "turn=on", request{"GET", "", ""}},
+		{"POST without a body", "POST", "", request{"POST", "", ""}},
+		{"POST with form data", "post", "turn=on&timer=10", request{"POST", "application/x-www-form-urlencoded", "turn=on&timer=10"}},
+		{"PUT with JSON", "PUT", `{"state":"open"}`, request{"PUT", "application/json", `{"state":"open"}`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = request{}
+			controller := NewController(server.URL, logger)
+			if err := controller.SetMethod(tt.method, tt.body); err != nil {
+				t.Fatalf("Failed to set method: %v", err)
+			}
+			if err := controller.OpenGate(); err != nil {
+				t.Fatalf("OpenGate failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("Non-2xx still fails", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}))
+		defer server.Close()
+
+		controller := NewController(server.URL, logger)
+		controller.SetMethod("POST", "turn=on")
+		if err := controller.OpenGate(); err == nil {
+			t.Error("OpenGate should fail on status 405")
+		}
+	})
+
+	t.Run("Unsupported method", func(t *testing.T) {
+		controller := NewController(server.URL, logger)
+		if err := controller.SetMethod("DELETE", ""); err == nil {
+			t.Error("Expected an error for DELETE")
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package gate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// redacted replaces credentials in what DryOpen reports
+const redacted = "[redacted]"
+
+// ErrNoDryOpenURL is returned by DryOpen without an endpoint to send to.
+// The relay itself is never tried, some firmwares switch on any method.
+var ErrNoDryOpenURL = errors.New("dry open URL not configured")
+
+// DryOpenResult describes the request an open would send, and how the
+// endpoint it was sent to instead answered
+type DryOpenResult struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`     // credentials redacted, see RedactURL
+	Headers map[string]string `json:"headers"` // credentials redacted
+	Body    string            `json:"body,omitempty"`
+
+	SentMethod string `json:"sent_method"`
+	SentTo     string `json:"sent_to"`
+	Status     int    `json:"status"`
+}
+
+// DryOpen builds the request OpenGate would send, including credentials and
+// body, and sends it to echoURL as it is instead of the relay. Debouncing is
+// neither applied nor updated.
+func (c *Controller) DryOpen(echoURL string) (*DryOpenResult, error) {
+	if echoURL == "" {
+		return nil, ErrNoDryOpenURL
+	}
+
+	c.mu.Lock()
+	triggerURL := c.triggerURL
+	if triggerURL == "" {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("gate trigger URL not configured")
+	}
+	open, err := c.openRequest(triggerURL)
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	if open.Body != nil {
+		if body, err = io.ReadAll(open.Body); err != nil {
+			return nil, err
+		}
+	}
+	result := &DryOpenResult{
+		Method:  open.Method,
+		URL:     RedactURL(triggerURL),
+		Headers: redactedHeaders(open.Header),
+		Body:    string(body),
+	}
+
+	req, err := http.NewRequest(open.Method, echoURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = open.Header.Clone()
+	result.SentMethod = req.Method
+	result.SentTo = req.URL.String()
+
+	c.logger.Infof("Dry gate open, sending %s %s", result.SentMethod, result.SentTo)
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send dry open: %w", err)
+	}
+	resp.Body.Close()
+	result.Status = resp.StatusCode
+
+	if resp.StatusCode >= 300 {
+		return result, fmt.Errorf("dry open endpoint returned status %d", resp.StatusCode)
+	}
+	return result, nil
+}
+
+// RedactURL hides the credentials a relay URL may carry: the password of its
+// user info and query parameters that look like secrets, e.g. auth_key or
+// token. URLs that don't parse are returned as they are.
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		changed := false
+		for name := range query {
+			if secretParam(name) {
+				query.Set(name, redacted)
+				changed = true
+			}
+		}
+		if changed {
+			u.RawQuery = query.Encode()
+		}
+	}
+	return u.String()
+}
+
+// secretParam reports whether a query parameter name looks like it holds a
+// credential
+func secretParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range []string{"token", "key", "pass", "secret", "auth"} {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactedHeaders flattens headers for display, keeping only the scheme of
+// credentials
+func redactedHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name := range header {
+		value := header.Get(name)
+		if name == "Authorization" {
+			scheme, _, _ := strings.Cut(value, " ")
+			value = scheme + " " + redacted
+		}
+		headers[name] = value
+	}
+	return headers
+}
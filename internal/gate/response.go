@@ -0,0 +1,70 @@
+package gate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxResponseBody bounds how much of a relay response is read for the check
+const maxResponseBody = 64 << 10
+
+// decodeResponse reads a relay's JSON response
+func decodeResponse(body io.Reader) (interface{}, error) {
+	var doc interface{}
+	if err := json.NewDecoder(io.LimitReader(body, maxResponseBody)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("gate trigger returned invalid JSON: %w", err)
+	}
+	return doc, nil
+}
+
+// checkSuccessValue verifies that the decoded response has want at key, a
+// dot-separated path where numbers index into arrays
+func checkSuccessValue(doc interface{}, key, want string) error {
+	got, ok := lookupJSON(doc, key)
+	if !ok {
+		return fmt.Errorf("gate trigger response has no %q", key)
+	}
+	if value := jsonValueString(got); value != want {
+		return fmt.Errorf("gate trigger response has %s=%s, expected %s", key, value, want)
+	}
+	return nil
+}
+
+// lookupJSON follows a dot-separated path through decoded JSON
+func lookupJSON(doc interface{}, path string) (interface{}, bool) {
+	for _, part := range strings.Split(path, ".") {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			doc = value
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			doc = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// jsonValueString renders a value the way it would be written in the config:
+// strings as they are, everything else as JSON, e.g. true or 1
+func jsonValueString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
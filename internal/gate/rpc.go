@@ -0,0 +1,56 @@
+package gate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Shelly API generations, picking how the trigger URL is requested
+const (
+	APIGen1 = "gen1" // GET the trigger URL, e.g. http://host/relay/0?turn=on
+	APIGen2 = "gen2" // POST a Switch.Set call to the RPC endpoint, e.g. http://host/rpc
+)
+
+// rpcRequest is a Gen2 JSON-RPC call
+type rpcRequest struct {
+	ID     int         `json:"id"`
+	Method string      `json:"method"`
+	Params interface{} `json:"params"`
+}
+
+type switchSetParams struct {
+	ID          int  `json:"id"`
+	On          bool `json:"on"`
+	ToggleAfter int  `json:"toggle_after,omitempty"` // seconds until the switch flips back
+}
+
+// newSwitchSetRequest builds the Gen2 call switching a relay on
+func newSwitchSetRequest(url string, switchID, toggleAfter int) (*http.Request, error) {
+	body, err := json.Marshal(rpcRequest{
+		ID:     1,
+		Method: "Switch.Set",
+		Params: switchSetParams{ID: switchID, On: true, ToggleAfter: toggleAfter},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// checkRPCError fails if a decoded Gen2 response carries an error object
+// instead of a result
+func checkRPCError(doc interface{}) error {
+	response, _ := doc.(map[string]interface{})
+	if rpcErr, ok := response["error"].(map[string]interface{}); ok {
+		return fmt.Errorf("gate trigger failed: %v (code %s)", rpcErr["message"], jsonValueString(rpcErr["code"]))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package gate
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+)
+
+// newTransport returns a transport for relay requests. Relays on flaky links
+// or behind NAT silently drop idle connections, so unless keepAlive is set
+// every request uses a fresh connection. With keepAlive, idle connections are
+// closed after idleTimeout, zero keeping them until the relay closes them.
+func newTransport(keepAlive bool, idleTimeout time.Duration) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = !keepAlive
+	transport.IdleConnTimeout = idleTimeout
+	return transport
+}
+
+// SetKeepAlive controls whether connections to the relay are reused, see
+// newTransport. Call it before the controller is in use.
+func (c *Controller) SetKeepAlive(keepAlive bool, idleTimeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.client.CloseIdleConnections()
+	c.client.Transport = newTransport(keepAlive, idleTimeout)
+}
+
+// do sends req, retrying once on a fresh connection if writing it to a
+// reused one failed, i.e. the relay dropped the idle connection without us
+// noticing. A request written in full may have reached the relay and isn't
+// retried, that could open the gate twice; net/http itself still replays
+// GETs without a body on a dropped connection. Timeouts aren't retried, the
+// relay may just be slow.
+func (c *Controller) do(req *http.Request) (*http.Response, error) {
+	var reused, written atomic.Bool
+	trace := &httptrace.ClientTrace{
+		GotConn:      func(info httptrace.GotConnInfo) { reused.Store(info.Reused) },
+		WroteRequest: func(info httptrace.WroteRequestInfo) { written.Store(info.Err == nil) },
+	}
+	resp, err := c.client.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err == nil || !reused.Load() || written.Load() {
+		return resp, err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return resp, err
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	c.logger.Warnf("Relay dropped a kept-alive connection, retrying on a new one: %v", err)
+	c.client.CloseIdleConnections()
+	return c.client.Do(retry)
+}
@@ -0,0 +1,121 @@
+package gate
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestKeepAlive(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	t.Run("Fresh connection per request by default", func(t *testing.T) {
+		var kept int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !r.Close {
+				atomic.AddInt32(&kept, 1)
+			}
+		}))
+		defer server.Close()
+
+		controller := NewController(server.URL, logger)
+		for i := 0; i < 2; i++ {
+			if err := controller.OpenGate(); err != nil {
+				t.Fatalf("OpenGate failed: %v", err)
+			}
+		}
+		if kept := atomic.LoadInt32(&kept); kept != 0 {
+			t.Errorf("Expected every connection to be closed after its request, %d were kept", kept)
+		}
+	})
+
+	// droppingRelay answers the first request on each connection and drops
+	// the connection after reading any later one, like a relay whose NAT
+	// entry expired
+	droppingRelay := func(t *testing.T) (*httptest.Server, *int32) {
+		var mu sync.Mutex
+		served := make(map[string]bool)
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.ReadAll(r.Body)
+			atomic.AddInt32(&requests, 1)
+			mu.Lock()
+			seen := served[r.RemoteAddr]
+			served[r.RemoteAddr] = true
+			mu.Unlock()
+			if seen {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err == nil {
+					conn.Close()
+				}
+			}
+		}))
+		t.Cleanup(server.Close)
+		return server, &requests
+	}
+
+	t.Run("Dropped idle connection is retried for GET", func(t *testing.T) {
+		server, requests := droppingRelay(t)
+		controller := NewController(server.URL, logger)
+		controller.SetKeepAlive(true, time.Minute)
+
+		for i := 0; i < 2; i++ {
+			if err := controller.OpenGate(); err != nil {
+				t.Fatalf("Open %d failed: %v", i+1, err)
+			}
+		}
+		if got := atomic.LoadInt32(requests); got != 3 {
+			t.Errorf("Expected the second open to be replayed on a new connection, got %d requests", got)
+		}
+	})
+
+	t.Run("Request the relay got isn't sent twice", func(t *testing.T) {
+		server, requests := droppingRelay(t)
+		controller := NewController(server.URL, logger)
+		controller.SetKeepAlive(true, time.Minute)
+		if err := controller.SetMethod(http.MethodPost, `{"turn":"on"}`); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := controller.OpenGate(); err != nil {
+			t.Fatalf("First open failed: %v", err)
+		}
+		if err := controller.OpenGate(); err == nil {
+			t.Error("Expected the open on the dropped connection to fail")
+		}
+		if got := atomic.LoadInt32(requests); got != 2 {
+			t.Errorf("Expected the relay to get each open once, got %d requests", got)
+		}
+	})
+
+	t.Run("Fresh connection failures aren't retried", func(t *testing.T) {
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+		}))
+		defer server.Close()
+
+		controller := NewController(server.URL, logger)
+		controller.SetKeepAlive(true, time.Minute)
+		if err := controller.SetMethod(http.MethodPost, "turn=on"); err != nil {
+			t.Fatal(err)
+		}
+		if err := controller.OpenGate(); err == nil {
+			t.Error("Expected the open to fail")
+		}
+		if got := atomic.LoadInt32(&requests); got != 1 {
+			t.Errorf("Expected a single attempt, got %d", got)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+	"github.com/fbettag/unifi-gate-opener/internal/notify"
+)
+
+// announceArrival has the text-to-speech webhook announce a device the gate
+// opened for on arrival, with the device's own announcement if it has one.
+// The announcement is spoken, so unlike notifications it isn't prefixed with
+// the instance name.
+func (app *App) announceArrival(state *DeviceState) {
+	if app.Announcer == nil {
+		return
+	}
+
+	template := app.Config.Notifications.TTS.Message
+	if device := app.findDevice(state.MAC); device != nil && device.Announcement != "" {
+		template = device.Announcement
+	}
+	if template == "" {
+		return
+	}
+
+	msg := notify.Message{
+		Event: "announcement",
+		Text: renderLogMessage(template, &database.LogEntry{
+			DeviceMAC:  state.MAC,
+			DeviceName: state.Name,
+			Direction:  directionArriving,
+			ToAP:       state.CurrentAP,
+		}),
+		Instance:   app.Config.Server.Instance(),
+		DeviceMAC:  state.MAC,
+		DeviceName: state.Name,
+		Time:       state.LastGateTrigger,
+	}
+
+	app.notifying.Add(1)
+	go func() {
+		defer app.notifying.Done()
+		if err := app.Announcer.Notify(msg); err != nil {
+			app.Logger.Errorf("Failed to send arrival announcement for %s: %v", msg.DeviceName, err)
+		}
+	}()
+}
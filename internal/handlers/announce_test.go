@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+	"github.com/fbettag/unifi-gate-opener/internal/notify"
+)
+
+func TestArrivalAnnouncements(t *testing.T) {
+	const otherMAC = "AA:BB:CC:DD:EE:02"
+
+	var mu sync.Mutex
+	var spoken []notify.Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg notify.Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("Failed to decode announcement: %v", err)
+		}
+		mu.Lock()
+		spoken = append(spoken, msg)
+		mu.Unlock()
+	}))
+	defer server.Close()
+	received := func() []notify.Message {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]notify.Message(nil), spoken...)
+	}
+
+	app := newTestApp(t)
+	newTestRelay(t, app)
+	app.Announcer = notify.NewWebhook(server.URL)
+	app.Config.Notifications.TTS.Message = "{device} is home"
+	app.Config.Devices = []config.DeviceConfig{
+		{MAC: testDeviceMAC, Name: "Dad's Phone", Enabled: true, Announcement: "Dad's home, via {ap}"},
+		{MAC: otherMAC, Name: "Kid's Phone", Enabled: true},
+	}
+
+	state := trackDevice(app, testDeviceMAC, "Dad's Phone")
+	state.CurrentAP = "Gate AP"
+	if !app.checkAndOpenGate(state, directionArriving) {
+		t.Fatal("Expected the gate to open")
+	}
+	app.checkAndOpenGate(trackDevice(app, otherMAC, "Kid's Phone"), directionArriving)
+	app.notifying.Wait()
+
+	got := received()
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 announcements, got %+v", got)
+	}
+	if got[0].Event != "announcement" || got[0].Text != "Dad's home, via Gate AP" || got[0].DeviceMAC != testDeviceMAC {
+		t.Errorf("Expected the device's own announcement, got %+v", got[0])
+	}
+	if got[1].Text != "Kid's Phone is home" {
+		t.Errorf("Expected the default announcement, got %+v", got[1])
+	}
+
+	t.Run("Leaving isn't announced", func(t *testing.T) {
+		state.clearTriggers() // past the cooldown
+		if !app.checkAndOpenGate(state, directionLeaving) {
+			t.Fatal("Expected the gate to open")
+		}
+		app.notifying.Wait()
+		if got := received(); len(got) != 2 {
+			t.Errorf("Expected no announcement leaving, got %+v", got[2:])
+		}
+	})
+}
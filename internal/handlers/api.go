@@ -4,7 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+	"github.com/fbettag/unifi-gate-opener/internal/gate"
+	"github.com/fbettag/unifi-gate-opener/internal/notify"
 	"github.com/fbettag/unifi-gate-opener/internal/unifi"
 )
 
@@ -27,6 +33,7 @@ func (app *App) TestUniFiHandler(w http.ResponseWriter, r *http.Request) {
 		Username      string `json:"username"`
 		Password      string `json:"password"`
 		SiteID        string `json:"site_id"`
+		UnifiOS       bool   `json:"unifi_os"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -38,17 +45,19 @@ func (app *App) TestUniFiHandler(w http.ResponseWriter, r *http.Request) {
 	app.Logger.Debugf("TestUniFi request: URL=%s, User=%s, Site=%s", req.ControllerURL, req.Username, req.SiteID)
 
 	// Create a temporary UniFi client
-	unifiLogger := unifi.NewLogrusAdapter(app.Logger)
-	testClient := unifi.NewClient(req.ControllerURL, req.Username, req.Password, unifiLogger)
+	testClient := app.newUniFiClient(req.ControllerURL, req.Username, req.Password)
+	testClient.SetUnifiOS(req.UnifiOS)
 
 	// Try to login
-	if err := testClient.Login(); err != nil {
+	if err := testClient.LoginOnce(); err != nil {
 		app.Logger.Errorf("UniFi login test failed: %v", err)
+		diagnosis := unifi.DiagnoseError(err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to connect to UniFi Controller. Please check your credentials and URL.",
+			"success":  false,
+			"error":    diagnosis.Message,
+			"category": diagnosis.Category,
 		}); err != nil {
 			app.Logger.Errorf("Failed to encode error response: %v", err)
 		}
@@ -59,11 +68,29 @@ func (app *App) TestUniFiHandler(w http.ResponseWriter, r *http.Request) {
 	aps, err := testClient.GetAccessPoints(req.SiteID)
 	if err != nil {
 		app.Logger.Errorf("Failed to get access points: %v", err)
+		diagnosis := unifi.DiagnoseSiteError(err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Connected to UniFi but failed to access site. Please check the Site ID.",
+			"success":  false,
+			"error":    diagnosis.Message,
+			"category": diagnosis.Category,
+		}); err != nil {
+			app.Logger.Errorf("Failed to encode error response: %v", err)
+		}
+		return
+	}
+
+	// Monitoring needs to list clients, which a restricted role may not allow
+	clients, err := testClient.GetActiveClients(req.SiteID)
+	if err != nil {
+		app.Logger.Errorf("Failed to get clients: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":       false,
+			"error":         "Connected to UniFi but failed to list clients. Please make sure the account is allowed to view clients.",
+			"access_points": aps,
 		}); err != nil {
 			app.Logger.Errorf("Failed to encode error response: %v", err)
 		}
@@ -75,6 +102,7 @@ func (app *App) TestUniFiHandler(w http.ResponseWriter, r *http.Request) {
 	if err := json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":       true,
 		"access_points": aps,
+		"client_count":  len(clients),
 	}); err != nil {
 		app.Logger.Errorf("Failed to encode success response: %v", err)
 	}
@@ -86,6 +114,7 @@ func (app *App) TestUniFiSitesHandler(w http.ResponseWriter, r *http.Request) {
 		ControllerURL string `json:"controller_url"`
 		Username      string `json:"username"`
 		Password      string `json:"password"`
+		UnifiOS       bool   `json:"unifi_os"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -94,17 +123,19 @@ func (app *App) TestUniFiSitesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create a temporary UniFi client
-	unifiLogger := unifi.NewLogrusAdapter(app.Logger)
-	testClient := unifi.NewClient(req.ControllerURL, req.Username, req.Password, unifiLogger)
+	testClient := app.newUniFiClient(req.ControllerURL, req.Username, req.Password)
+	testClient.SetUnifiOS(req.UnifiOS)
 
 	// Try to login
-	if err := testClient.Login(); err != nil {
+	if err := testClient.LoginOnce(); err != nil {
 		app.Logger.Errorf("UniFi login test failed: %v", err)
+		diagnosis := unifi.DiagnoseError(err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		if err := json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to connect to UniFi Controller. Please check your credentials and URL.",
+			"success":  false,
+			"error":    diagnosis.Message,
+			"category": diagnosis.Category,
 		}); err != nil {
 			app.Logger.Errorf("Failed to encode error response: %v", err)
 		}
@@ -128,3 +159,124 @@ func (app *App) TestUniFiSitesHandler(w http.ResponseWriter, r *http.Request) {
 		app.Logger.Errorf("Failed to encode success response: %v", err)
 	}
 }
+
+// Find out which API paths the controller uses. UniFi OS consoles, like the
+// UDM Pro or Cloud Key Gen2, log in and serve the API elsewhere than a
+// standalone controller; both are tried and reported.
+func (app *App) TestUniFiPathsHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ControllerURL string `json:"controller_url"`
+		Username      string `json:"username"`
+		Password      string `json:"password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.sendJSONError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	probe := unifi.ProbeAPIPaths(req.ControllerURL, req.Username, req.Password,
+		time.Duration(app.Config.UniFi.LoginTimeout)*time.Second, unifi.NewLogrusAdapter(app.Logger))
+
+	w.Header().Set("Content-Type", "application/json")
+	if !probe.OK() {
+		// The classic login tells more, UniFi OS paths 404 on other controllers
+		diagnosis := unifi.DiagnoseError(probe.ClassicError)
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":  false,
+			"error":    diagnosis.Message,
+			"category": diagnosis.Category,
+			"unifi_os": false,
+			"classic":  false,
+		}); err != nil {
+			app.Logger.Errorf("Failed to encode error response: %v", err)
+		}
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"unifi_os": probe.UnifiOS,
+		"classic":  probe.Classic,
+	}); err != nil {
+		app.Logger.Errorf("Failed to encode success response: %v", err)
+	}
+}
+
+// Test a candidate gate trigger URL without touching the stored settings
+func (app *App) TestGateURLHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL         string `json:"url"`
+		Username    string `json:"username"`
+		Password    string `json:"password"`
+		BearerToken string `json:"bearer_token"`
+		Trigger     bool   `json:"trigger"` // actually open the gate instead of only probing
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.sendJSONError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	triggerURL, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (triggerURL.Scheme != "http" && triggerURL.Scheme != "https") || triggerURL.Host == "" {
+		app.sendJSONError(w, "URL must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+
+	// Use a temporary controller so the configured one is left alone
+	testController := gate.NewController(triggerURL.String(), app.Logger)
+	testController.SetAuth(req.Username, req.Password, req.BearerToken)
+	testController.SetSuccessCheck(app.Config.Shelly.SuccessKey, app.Config.Shelly.SuccessValue)
+	app.setGateRequest(testController)
+
+	if !req.Trigger {
+		if err := testController.TestConnection(); err != nil {
+			app.Logger.Errorf("Gate URL test failed: %v", err)
+			app.sendJSONError(w, fmt.Sprintf("Gate endpoint not reachable: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":   true,
+			"reachable": true,
+			"triggered": false,
+			"message":   "Gate endpoint is reachable. The gate was not triggered.",
+		}); err != nil {
+			app.Logger.Errorf("Failed to encode success response: %v", err)
+		}
+		return
+	}
+
+	if err := testController.OpenGate(); err != nil {
+		app.Logger.Errorf("Gate URL trigger failed: %v", err)
+		app.sendJSONError(w, fmt.Sprintf("Failed to trigger gate: %v", err), http.StatusBadRequest)
+		return
+	}
+	app.notifyGateOpened(notify.Message{Event: "gate_triggered", Text: "Gate opened via URL test"})
+
+	if app.Config.Gate.LogActivity {
+		if err := app.logEvent(&database.LogEntry{
+			DeviceMAC:  "manual",
+			DeviceName: "Manual Test",
+			Event:      "gate_triggered",
+			Direction:  "manual",
+			GateOpened: true,
+			Message:    "Gate opened via URL test",
+		}); err != nil {
+			app.Logger.Errorf("Failed to log test event: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"reachable": true,
+		"triggered": true,
+		"message":   "Gate was triggered.",
+	}); err != nil {
+		app.Logger.Errorf("Failed to encode success response: %v", err)
+	}
+}
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/unifi"
+)
+
+// mockController is a minimal UniFi controller for exercising handlers
+type mockController struct {
+	Server *httptest.Server
+
+	// Clients returned from stat/sta, as raw UniFi JSON objects
+	Clients []map[string]interface{}
+	// KnownClients returned from rest/user, as raw UniFi JSON objects
+	KnownClients []map[string]interface{}
+	// FailClients makes stat/sta return an error status
+	FailClients bool
+	// FailLogin rejects the credentials
+	FailLogin bool
+	// FailSite answers device requests as if the site did not exist
+	FailSite bool
+	// ClientRequests counts stat/sta requests, read it atomically
+	ClientRequests int32
+}
+
+func newMockController(t *testing.T) *mockController {
+	t.Helper()
+
+	m := &mockController{}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/login", func(w http.ResponseWriter, r *http.Request) {
+		if m.FailLogin {
+			http.Error(w, `{"meta":{"rc":"error","msg":"api.err.Invalid"}}`, http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "unifises", Value: "mock-session-token", Path: "/"})
+		writeMockData(w, nil)
+	})
+
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		writeMockData(w, nil)
+	})
+
+	mux.HandleFunc("/api/s/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/stat/device"):
+			if m.FailSite {
+				http.Error(w, `{"meta":{"rc":"error","msg":"api.err.NoSiteContext"}}`, http.StatusBadRequest)
+				return
+			}
+			writeMockData(w, []interface{}{})
+		case strings.HasSuffix(r.URL.Path, "/stat/sta"):
+			atomic.AddInt32(&m.ClientRequests, 1)
+			if m.FailClients {
+				http.Error(w, `{"meta":{"rc":"error","msg":"api.err.NoPermission"}}`, http.StatusForbidden)
+				return
+			}
+			writeMockData(w, m.Clients)
+		case strings.HasSuffix(r.URL.Path, "/rest/user"):
+			writeMockData(w, m.KnownClients)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	m.Server = httptest.NewTLSServer(mux)
+	t.Cleanup(m.Server.Close)
+
+	return m
+}
+
+func writeMockData(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"meta": map[string]interface{}{"rc": "ok"},
+		"data": data,
+	})
+}
+
+// mockClient builds a wireless client entry as UniFi reports it
+func mockClient(mac, apMAC string) map[string]interface{} {
+	return map[string]interface{}{
+		"mac":       mac,
+		"ap_mac":    apMAC,
+		"essid":     "Home",
+		"is_wired":  false,
+		"last_seen": time.Now().Unix(),
+		"uptime":    120,
+		"signal":    -55,
+	}
+}
+
+func postJSON(t *testing.T, handler http.HandlerFunc, path string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response %q: %v", w.Body.String(), err)
+	}
+	return w, resp
+}
+
+func TestTestUniFiHandler(t *testing.T) {
+	t.Run("Clients can be listed", func(t *testing.T) {
+		app := newTestApp(t)
+		mock := newMockController(t)
+		mock.Clients = []map[string]interface{}{mockClient("aa:bb:cc:dd:ee:01", testGateAP)}
+
+		w, resp := postJSON(t, app.TestUniFiHandler, "/api/test-unifi", map[string]string{
+			"controller_url": mock.Server.URL,
+			"username":       "user",
+			"password":       "pass",
+			"site_id":        "default",
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if resp["success"] != true {
+			t.Errorf("Expected success, got %v", resp)
+		}
+		if resp["client_count"] != float64(1) {
+			t.Errorf("Expected client_count 1, got %v", resp["client_count"])
+		}
+	})
+
+	t.Run("Access points succeed but clients fail", func(t *testing.T) {
+		app := newTestApp(t)
+		mock := newMockController(t)
+		mock.FailClients = true
+
+		w, resp := postJSON(t, app.TestUniFiHandler, "/api/test-unifi", map[string]string{
+			"controller_url": mock.Server.URL,
+			"username":       "user",
+			"password":       "pass",
+			"site_id":        "default",
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status 400, got %d", w.Code)
+		}
+		if resp["success"] != false {
+			t.Error("Expected success to be false")
+		}
+		if msg, _ := resp["error"].(string); !strings.Contains(msg, "list clients") {
+			t.Errorf("Expected client listing error, got %q", msg)
+		}
+	})
+}
+
+func TestTestUniFiPathsHandler(t *testing.T) {
+	t.Run("Standalone controller", func(t *testing.T) {
+		app := newTestApp(t)
+		mock := newMockController(t)
+
+		w, resp := postJSON(t, app.TestUniFiPathsHandler, "/api/test-unifi-paths", map[string]string{
+			"controller_url": mock.Server.URL,
+			"username":       "user",
+			"password":       "pass",
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if resp["success"] != true || resp["classic"] != true || resp["unifi_os"] != false {
+			t.Errorf("Expected only the classic paths to work, got %v", resp)
+		}
+	})
+
+	t.Run("Neither works", func(t *testing.T) {
+		app := newTestApp(t)
+		mock := newMockController(t)
+		mock.FailLogin = true
+
+		w, resp := postJSON(t, app.TestUniFiPathsHandler, "/api/test-unifi-paths", map[string]string{
+			"controller_url": mock.Server.URL,
+			"username":       "user",
+			"password":       "wrong",
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status 400, got %d", w.Code)
+		}
+		if resp["success"] != false || resp["category"] != "bad_credentials" {
+			t.Errorf("Expected an auth failure, got %v", resp)
+		}
+	})
+}
+
+func TestTestGateURLHandler(t *testing.T) {
+	t.Run("Reachable URL is probed without triggering", func(t *testing.T) {
+		app := newTestApp(t)
+		var methods []string
+		relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			methods = append(methods, r.Method)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer relay.Close()
+
+		w, resp := postJSON(t, app.TestGateURLHandler, "/api/test-gate-url", map[string]interface{}{
+			"url": relay.URL + "/relay/0?turn=on",
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if resp["reachable"] != true || resp["triggered"] != false {
+			t.Errorf("Expected reachable but not triggered, got %v", resp)
+		}
+		if len(methods) != 1 || methods[0] != "HEAD" {
+			t.Errorf("Expected a single HEAD request, got %v", methods)
+		}
+		if app.GateController != nil || app.Config.Shelly.TriggerURL != "" {
+			t.Error("Stored gate settings should not change")
+		}
+	})
+
+	t.Run("Trigger opens with credentials", func(t *testing.T) {
+		app := newTestApp(t)
+		var user, pass, method string
+		relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			user, pass, _ = r.BasicAuth()
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer relay.Close()
+
+		w, resp := postJSON(t, app.TestGateURLHandler, "/api/test-gate-url", map[string]interface{}{
+			"url":      relay.URL,
+			"username": "admin",
+			"password": "secret",
+			"trigger":  true,
+		})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if resp["triggered"] != true {
+			t.Errorf("Expected triggered, got %v", resp)
+		}
+		if method != "GET" || user != "admin" || pass != "secret" {
+			t.Errorf("Expected authenticated GET, got %s as %s/%s", method, user, pass)
+		}
+	})
+
+	t.Run("Unreachable URL", func(t *testing.T) {
+		app := newTestApp(t)
+		relay := httptest.NewServer(http.NotFoundHandler())
+		unreachable := relay.URL
+		relay.Close()
+
+		w, resp := postJSON(t, app.TestGateURLHandler, "/api/test-gate-url", map[string]interface{}{
+			"url": unreachable,
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status 400, got %d", w.Code)
+		}
+		if resp["success"] != false {
+			t.Error("Expected success to be false")
+		}
+	})
+
+	t.Run("Invalid URL", func(t *testing.T) {
+		app := newTestApp(t)
+
+		w, _ := postJSON(t, app.TestGateURLHandler, "/api/test-gate-url", map[string]interface{}{
+			"url": "relay/0?turn=on",
+		})
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestTestUniFiHandlerDiagnostics(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	refusedURL := "https://" + closed.Listener.Addr().String()
+	closed.Close()
+
+	plainHTTP := httptest.NewServer(http.NotFoundHandler())
+	defer plainHTTP.Close()
+
+	badCredentials := newMockController(t)
+	badCredentials.FailLogin = true
+
+	unknownSite := newMockController(t)
+	unknownSite.FailSite = true
+
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"DNS failure", "https://unifi.invalid", unifi.DiagnosisDNS},
+		{"Connection refused", refusedURL, unifi.DiagnosisConnectionRefused},
+		{"TLS error", "https://" + plainHTTP.Listener.Addr().String(), unifi.DiagnosisTLS},
+		{"Bad credentials", badCredentials.Server.URL, unifi.DiagnosisBadCredentials},
+		{"Site not found", unknownSite.Server.URL, unifi.DiagnosisSiteNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+
+			w, resp := postJSON(t, app.TestUniFiHandler, "/api/test-unifi", map[string]string{
+				"controller_url": tt.url,
+				"username":       "user",
+				"password":       "pass",
+				"site_id":        "default",
+			})
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status 400, got %d", w.Code)
+			}
+			if resp["category"] != tt.expected {
+				t.Errorf("Expected category %s, got %v (%v)", tt.expected, resp["category"], resp["error"])
+			}
+			if msg, _ := resp["error"].(string); msg == "" {
+				t.Error("Expected an error message")
+			}
+		})
+	}
+}
@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"bytes"
 	"embed"
+	"errors"
 	"fmt"
 	"html/template"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
@@ -13,6 +16,7 @@ import (
 	"github.com/fbettag/unifi-gate-opener/internal/config"
 	"github.com/fbettag/unifi-gate-opener/internal/database"
 	"github.com/fbettag/unifi-gate-opener/internal/gate"
+	"github.com/fbettag/unifi-gate-opener/internal/notify"
 	"github.com/fbettag/unifi-gate-opener/internal/unifi"
 	"github.com/sirupsen/logrus"
 )
@@ -23,20 +27,84 @@ const (
 	directionUnknown  = "unknown"
 )
 
+// Monitoring states reported by /api/status
+const (
+	monitoringRunning          = "running"
+	monitoringNotConfigured    = "not_configured"
+	monitoringUniFiUnreachable = "unifi_unreachable"
+	monitoringStopped          = "stopped"
+	monitoringMaintenance      = "maintenance"
+	monitoringNoGateAP         = "no_gate_ap"
+	monitoringStaleData        = "stale_data"
+)
+
 type App struct {
 	Config         *config.Config
+	ConfigPath     string
 	DB             *database.DB
 	Logger         *logrus.Logger
 	WebFS          embed.FS
 	SessionStore   *auth.SessionStore
 	UniFiClient    *unifi.Client
-	GateController *gate.Controller
+	GateController *gate.Controller // created on demand, see gateController
+	Notifier       notify.Notifier  // nil when notifications are off
+	Announcer      notify.Notifier  // text-to-speech webhook, nil when arrival announcements are off
+	GateNotifier   notify.Group     // told about every gate open whatever notifications.events says, i.e. Telegram
+	notifying      sync.WaitGroup   // notifications sent in the background
+
+	// Set by --require-setup-login, overrides server.setup_auto_login
+	// without ending up in the saved config
+	RequireSetupLogin bool
+
+	mqttMu      sync.RWMutex
+	mqtt        *mqttLink                                              // nil unless publishing to a broker, see startMQTT
+	connectMQTT func(config.MQTTConfig, string) (mqttPublisher, error) // nil uses the configured broker, replaced in tests
+
+	gateMu sync.Mutex                  // guards creating GateController and relays
+	relays map[string]*gate.Controller // controllers of the additional gates by name, see gateControllerFor
+
+	// Held while changing Config.Devices, by the device handlers and the
+	// expiry of temporary devices, which runs in the background
+	devicesMu sync.Mutex
+	saveMu    sync.Mutex // serializes saveConfig, viper is global
 
 	// Monitoring state
 	monitoringMu   sync.RWMutex
 	isMonitoring   bool
 	stopMonitoring chan bool
 	deviceStates   map[string]*DeviceState
+	lastClients    []unifi.WirelessClient // clients seen in the latest poll
+	lastPollAt     time.Time
+	lastPollErr    error
+	stoppedByUser  bool
+	maintenance    *config.MaintenanceWindow // active maintenance window, nil outside of one
+	gateAPErr      error                     // why monitoring refused to start, if it did
+	learnOnly      bool                      // polling only for learning mode, there's no gate AP to open at
+	learning       *learningState            // gate AP learning mode, nil until started
+	lastSeenMax    int64                     // newest last_seen the controller reported, see checkStaleness
+	lastSeenMoved  time.Time                 // when lastSeenMax last changed
+	staleSince     time.Time                 // when the controller data went stale, zero while fresh
+
+	now       func() time.Time                               // clock, replaced in tests
+	afterFunc func(time.Duration, func()) (stop func() bool) // timers for delayed opens, replaced in tests
+
+	lastVacuum time.Time // only touched by the cleanup job
+
+	// Dashboards following live updates on /api/ws
+	live liveHub
+
+	// Client list served to the dashboard, see cachedActiveClients
+	clientsCacheMu  sync.Mutex
+	clientsCache    []unifi.WirelessClient
+	clientsCachedAt time.Time
+
+	// Pending manual open confirmations and their expiry
+	openNonces   map[string]time.Time
+	openNoncesMu sync.Mutex
+
+	// Last open through /api/gate/trigger, for its cooldown
+	lastExternalTrigger   time.Time
+	lastExternalTriggerMu sync.Mutex
 
 	// Authentication retry state
 	authRetryCount   int
@@ -48,11 +116,57 @@ type App struct {
 type DeviceState struct {
 	MAC             string
 	Name            string
+	SSID            string
 	CurrentAP       string
 	PreviousAP      string
 	LastSeen        time.Time
 	IsConnected     bool
-	LastGateTrigger time.Time
+	LastGateTrigger time.Time // last open in either direction
+	ReopenAt        time.Time // when to check for a re-open, zero if none is pending
+	BypassCooldown  bool
+	ExpectedBy      string               // "HH:MM" the device should show up by, empty for none
+	Gate            string               // additional gate the device opens, empty for the primary one
+	absentCheckedOn string               // day ("2006-01-02") the absence check last ran
+	lastTriggers    map[string]time.Time // last open per direction, see lastTrigger
+	gatePolls       int                  // consecutive polls seen at the gate AP
+	pendingOpen     string               // direction of an open waiting for more polls at the gate
+	weakSignal      bool                 // pendingOpen waits for the signal to clear unifi.min_signal
+	preOpen         *delayedOpen         // open waiting out gate.pre_open_delay, nil if none
+	signalAP        string               // AP the signal readings are from
+	signals         []int                // latest signal readings in dBm, oldest first, see signalTrend
+}
+
+// lastTrigger returns when the gate last opened for the device in direction.
+// Until it opens again, the stored LastGateTrigger counts for both directions,
+// which one it was isn't kept across restarts.
+func (s *DeviceState) lastTrigger(direction string) time.Time {
+	if s.lastTriggers == nil {
+		return s.LastGateTrigger
+	}
+	return s.lastTriggers[direction]
+}
+
+// recordTrigger remembers an open in direction at t
+func (s *DeviceState) recordTrigger(direction string, t time.Time) {
+	if s.lastTriggers == nil {
+		s.lastTriggers = map[string]time.Time{
+			directionArriving: s.LastGateTrigger,
+			directionLeaving:  s.LastGateTrigger,
+		}
+	}
+	s.lastTriggers[direction] = t
+	s.LastGateTrigger = t
+}
+
+// clearTriggers forgets the device's opens, ending its cooldowns
+func (s *DeviceState) clearTriggers() {
+	s.LastGateTrigger = time.Time{}
+	s.lastTriggers = nil
+}
+
+// delayedOpen is an open scheduled after gate.pre_open_delay
+type delayedOpen struct {
+	stop func() bool
 }
 
 func (app *App) StartMonitoring() {
@@ -62,21 +176,61 @@ func (app *App) StartMonitoring() {
 		return
 	}
 
+	// Without a gate AP nothing can ever open, or worse, clients UniFi reports
+	// without an AP would match. Learning mode is how the gate AP is found,
+	// so it still gets its polls, but nothing opens.
+	app.learnOnly = false
+	if err := validateGateAP(app.Config.UniFi.GateAPMAC); err != nil {
+		app.gateAPErr = err
+		if !app.learningActive(app.clock()) {
+			app.monitoringMu.Unlock()
+			app.Logger.Errorf("Not starting monitoring: %v", err)
+			return
+		}
+		app.learnOnly = true
+		app.Logger.Warnf("Polling for learning mode only: %v", err)
+	} else {
+		app.gateAPErr = nil
+	}
+
 	app.isMonitoring = true
+	app.stoppedByUser = false
 	app.stopMonitoring = make(chan bool)
+	stop := app.stopMonitoring
 	app.deviceStates = make(map[string]*DeviceState)
 	app.monitoringMu.Unlock()
 
 	// Initialize gate controller
-	app.GateController = gate.NewController(app.Config.Shelly.TriggerURL, app.Logger)
+	app.gateMu.Lock()
+	app.GateController = app.newGateController()
+	app.gateMu.Unlock()
 
 	// Load initial device states from database
 	app.loadDeviceStates()
 
 	app.Logger.Info("Starting device monitoring")
+	for _, window := range app.Config.UniFi.MaintenanceWindows {
+		if err := window.Validate(); err != nil {
+			app.Logger.Warnf("Ignoring maintenance window %s: %v", window, err)
+		}
+	}
+	if err := app.Config.Gate.Schedule.Validate(); err != nil {
+		app.Logger.Warnf("Gate schedule: %v", err)
+	}
 
 	// Start the cleanup job
 	go app.startCleanupJob()
+	go app.startExpiryJob(stop)
+
+	// Publish state to MQTT until monitoring stops
+	defer app.stopMQTT(app.startMQTT())
+
+	// Log in before the first poll, so startup doesn't race a login that
+	// hasn't finished yet
+	if !app.warmUp(stop) {
+		app.Logger.Info("Stopping device monitoring")
+		return
+	}
 
 	ticker := time.NewTicker(time.Duration(app.Config.UniFi.PollInterval) * time.Second)
 	defer ticker.Stop()
@@ -95,6 +249,41 @@ func (app *App) StartMonitoring() {
 	}
 }
 
+// warmUp waits out the configured startup delay, then keeps trying to log in
+// once per poll interval until it succeeds. Returns false if monitoring was
+// stopped meanwhile.
+func (app *App) warmUp(stop <-chan bool) bool {
+	if delay := time.Duration(app.Config.UniFi.StartupDelay) * time.Second; delay > 0 {
+		app.Logger.Infof("Waiting %s before the first poll", delay)
+		select {
+		case <-time.After(delay):
+		case <-stop:
+			return false
+		}
+	}
+
+	// Without a client the first poll reports the problem
+	if app.UniFiClient == nil {
+		return true
+	}
+
+	retry := time.Duration(app.Config.UniFi.PollInterval) * time.Second
+	for {
+		err := app.UniFiClient.EnsureLoggedIn()
+		if err == nil {
+			return true
+		}
+		app.Logger.Errorf("Failed to login before the first poll, retrying in %s: %v", retry, err)
+		app.recordPoll(err)
+
+		select {
+		case <-time.After(retry):
+		case <-stop:
+			return false
+		}
+	}
+}
+
 func (app *App) StopMonitoring() {
 	app.monitoringMu.Lock()
 	defer app.monitoringMu.Unlock()
@@ -102,7 +291,59 @@ func (app *App) StopMonitoring() {
 	if app.isMonitoring {
 		close(app.stopMonitoring)
 		app.isMonitoring = false
+		app.stoppedByUser = true
+	}
+	for _, state := range app.deviceStates {
+		app.cancelPreOpen(state, "monitoring stopped")
+	}
+}
+
+// monitoringState explains whether monitoring is running and, if not, why
+func (app *App) monitoringState() (state string, reason string) {
+	app.monitoringMu.RLock()
+	defer app.monitoringMu.RUnlock()
+
+	switch {
+	case !app.Config.IsConfigured():
+		return monitoringNotConfigured, "Setup has not been completed"
+	case !app.isMonitoring && app.gateAPErr != nil:
+		return monitoringNoGateAP, fmt.Sprintf("Monitoring refused to start: %v", app.gateAPErr)
+	case app.isMonitoring && app.learnOnly:
+		return monitoringNoGateAP, fmt.Sprintf("Polling for learning mode only, not opening the gate: %v", app.gateAPErr)
+	case app.isMonitoring && app.maintenance != nil:
+		return monitoringMaintenance, fmt.Sprintf("Paused for maintenance window %s", app.maintenance)
+	case app.isMonitoring && app.lastPollErr != nil:
+		return monitoringUniFiUnreachable, fmt.Sprintf("Last poll failed: %v", app.lastPollErr)
+	case app.isMonitoring && !app.staleSince.IsZero():
+		return monitoringStaleData, fmt.Sprintf("UniFi controller data is stale since %s, not opening the gate", app.staleSince.Format(time.RFC3339))
+	case app.isMonitoring:
+		return monitoringRunning, "Monitoring devices"
+	case app.stoppedByUser:
+		return monitoringStopped, "Monitoring was stopped"
+	case app.UniFiClient == nil:
+		return monitoringUniFiUnreachable, "UniFi client is not initialized"
+	default:
+		return monitoringStopped, "Monitoring is not running"
+	}
+}
+
+// validateGateAP checks that the configured gate AP is a usable MAC address
+func validateGateAP(mac string) error {
+	if strings.TrimSpace(mac) == "" {
+		return errors.New("no gate access point is configured")
+	}
+	if _, err := net.ParseMAC(mac); err != nil {
+		return fmt.Errorf("gate access point %q is not a valid MAC address", mac)
 	}
+	return nil
+}
+
+// recordPoll remembers the outcome of the latest poll for status reporting
+func (app *App) recordPoll(err error) {
+	app.monitoringMu.Lock()
+	app.lastPollAt = time.Now()
+	app.lastPollErr = err
+	app.monitoringMu.Unlock()
 }
 
 func (app *App) loadDeviceStates() {
@@ -123,19 +364,31 @@ func (app *App) loadDeviceStates() {
 		app.deviceStates[normalizedMAC] = &DeviceState{
 			MAC:             normalizedMAC,
 			Name:            device.Name,
+			SSID:            device.SSID,
 			CurrentAP:       currentAP,
 			LastSeen:        lastSeen,
 			IsConnected:     isConnected,
 			LastGateTrigger: lastTrigger,
+			BypassCooldown:  device.BypassCooldown,
+			ExpectedBy:      device.ExpectedBy,
+			Gate:            device.Gate,
+		}
+		if _, err := config.ParseClock(device.ExpectedBy); device.ExpectedBy != "" && err != nil {
+			app.Logger.Warnf("Ignoring expected_by %q for device %s: %v", device.ExpectedBy, device.MAC, err)
 		}
 	}
 }
 
 func (app *App) pollUniFi() {
+	// The controller is expected to be down, don't poll or open
+	if app.pauseForMaintenance() {
+		return
+	}
 
 	// Ensure we're logged in
 	if app.UniFiClient == nil {
 		app.Logger.Error("UniFi client not initialized")
+		app.recordPoll(fmt.Errorf("UniFi client not initialized"))
 		return
 	}
 
@@ -148,6 +401,7 @@ func (app *App) pollUniFi() {
 			// Attempt re-authentication with backoff
 			if reauthErr := app.reauthenticateWithBackoff(); reauthErr != nil {
 				// Re-authentication failed or backoff in effect
+				app.recordPoll(reauthErr)
 				return
 			}
 			
@@ -155,31 +409,92 @@ func (app *App) pollUniFi() {
 			clients, err = app.UniFiClient.GetActiveClients(app.Config.UniFi.SiteID)
 			if err != nil {
 				app.Logger.Errorf("Failed to get active clients after re-authentication: %v", err)
+				app.recordPoll(err)
 				return
 			}
 		} else {
 			// Non-authentication error, just return
+			app.recordPoll(err)
 			return
 		}
 	}
 
-	// Create a map of currently connected devices (normalize MAC addresses to uppercase)
-	currentlyConnected := make(map[string]*unifi.WirelessClient)
-	for i := range clients {
-		normalizedMAC := strings.ToUpper(clients[i].MAC)
-		currentlyConnected[normalizedMAC] = &clients[i]
+	app.recordPoll(nil)
+	if app.learnOnlyPoll(clients) {
+		return
+	}
+	app.checkStaleness(clients)
+	app.processClients(clients)
+	app.checkAbsentDevices()
+}
+
+// pauseForMaintenance reports whether a maintenance window is active and
+// logs entering and leaving one
+func (app *App) pauseForMaintenance() bool {
+	now := app.clock()
+	var active *config.MaintenanceWindow
+	for _, window := range app.Config.UniFi.MaintenanceWindows {
+		if window.Contains(now) {
+			active = &window
+			break
+		}
 	}
 
+	app.monitoringMu.Lock()
+	previous := app.maintenance
+	app.maintenance = active
+	app.monitoringMu.Unlock()
+
+	switch {
+	case active != nil && previous == nil:
+		app.Logger.Infof("Maintenance window %s started, pausing polls", active)
+	case active == nil && previous != nil:
+		app.Logger.Infof("Maintenance window %s ended, resuming polls", previous)
+	}
+	return active != nil
+}
+
+// processClients compares the latest client list against the tracked device
+// states and fires connect, roam and disconnect handling as needed
+func (app *App) processClients(clients []unifi.WirelessClient) {
 	app.monitoringMu.Lock()
 	defer app.monitoringMu.Unlock()
 
+	app.learnAssociations(clients)
+	app.lastClients = clients
+
+	// Large sites report hundreds of clients while only a handful are tracked,
+	// so only remember the tracked ones instead of indexing every client
+	present := make(map[*DeviceState]*unifi.WirelessClient, len(app.deviceStates))
+	var buf [32]byte
+	for i := range clients {
+		key := appendUpperMAC(buf[:0], clients[i].MAC)
+		if state, ok := app.deviceStates[string(key)]; ok {
+			present[state] = &clients[i]
+		}
+	}
+
 	// Check each tracked device
 	for mac, state := range app.deviceStates {
-		client, isNowConnected := currentlyConnected[mac]
+		wasConnected, previousAP := state.IsConnected, state.CurrentAP
+		client, isNowConnected := present[state]
+		if isNowConnected && !state.matchesClient(client) {
+			// Same MAC seen on another SSID, treat it as not present
+			isNowConnected = false
+		}
 
 		if isNowConnected {
 			// Device is connected
 			newAP := client.AP_MAC
+			state.recordSignal(newAP, client.Signal)
+			if newAP == app.Config.UniFi.GateAPMAC {
+				state.gatePolls++
+			} else {
+				state.gatePolls = 0
+				state.pendingOpen = ""
+				state.weakSignal = false
+				app.cancelPreOpen(state, "moved away from the gate")
+			}
 
 			if !state.IsConnected {
 				// Device just connected
@@ -197,12 +512,34 @@ func (app *App) pollUniFi() {
 			} else if state.CurrentAP != newAP {
 				// Device roamed to different AP
 				app.handleDeviceRoamed(state, state.CurrentAP, newAP)
+			} else if state.pendingOpen != "" && state.gatePolls >= app.Config.Gate.ConfirmPolls {
+				// Still at the gate after enough polls, open as decided on arrival
+				direction := state.pendingOpen
+				state.pendingOpen = ""
+				if state.weakSignal {
+					// Held back by a weak signal, check it again
+					app.openApproaching(state, direction)
+				} else {
+					app.Logger.Infof("Device %s confirmed at gate after %d polls", state.Name, state.gatePolls)
+					app.openAtGate(state, direction)
+				}
 			}
 
-			// Update state
+			// Update state. This runs whether or not the gate opened above;
+			// skipped opens must return from the handlers, never bail out
+			// here, or the device would look stale.
 			state.CurrentAP = newAP
 			state.IsConnected = true
-			state.LastSeen = time.Now()
+			state.LastSeen = app.clock()
+			app.checkReopen(state)
+
+			if !wasConnected {
+				app.broadcastDevice("connected", state)
+				app.publishDeviceState(state)
+			} else if previousAP != newAP {
+				app.broadcastDevice("roamed", state)
+				app.publishDeviceState(state)
+			}
 
 			// Update database
 			if err := app.DB.UpdateDeviceState(mac, newAP, true); err != nil {
@@ -211,12 +548,20 @@ func (app *App) pollUniFi() {
 
 		} else if state.IsConnected {
 			// Device disconnected
+			app.cancelPreOpen(state, "disconnected")
 			app.handleDeviceDisconnected(state)
 
 			// Update state
 			state.PreviousAP = state.CurrentAP
 			state.CurrentAP = ""
 			state.IsConnected = false
+			state.ReopenAt = time.Time{}
+			state.gatePolls = 0
+			state.pendingOpen = ""
+			state.weakSignal = false
+			state.clearSignals()
+			app.broadcastDevice("disconnected", state)
+			app.publishDeviceState(state)
 
 			// Update database
 			if err := app.DB.UpdateDeviceState(mac, "", false); err != nil {
@@ -226,6 +571,16 @@ func (app *App) pollUniFi() {
 	}
 }
 
+// matchesClient reports whether a client reported by UniFi counts as this
+// device. Devices pinned to an SSID only match while connected to that ESSID,
+// which disambiguates phones that use a different randomized MAC per network.
+func (s *DeviceState) matchesClient(client *unifi.WirelessClient) bool {
+	if s.SSID == "" {
+		return true
+	}
+	return strings.EqualFold(client.ESSID, s.SSID)
+}
+
 // reauthenticateWithBackoff attempts to re-authenticate with the UniFi controller
 // using exponential backoff to avoid overwhelming the server
 func (app *App) reauthenticateWithBackoff() error {
@@ -287,7 +642,7 @@ func (app *App) handleDeviceConnected(state *DeviceState, toAP, fromAP string) {
 
 	// Log event if activity logging is enabled
 	if app.Config.Gate.LogActivity {
-		if err := app.DB.LogEvent(&database.LogEntry{
+		if err := app.logEvent(&database.LogEntry{
 			DeviceMAC:  state.MAC,
 			DeviceName: state.Name,
 			Event:      "connected",
@@ -302,7 +657,14 @@ func (app *App) handleDeviceConnected(state *DeviceState, toAP, fromAP string) {
 
 	// Check if we should open gate
 	if toAP == app.Config.UniFi.GateAPMAC {
-		app.checkAndOpenGate(state, direction)
+		if !app.Config.Gate.TriggerOnConnect {
+			app.Logger.Debugf("Connect-based opens disabled, not opening for %s", state.Name)
+			return
+		}
+		if !app.confirmedAtGate(state, direction) {
+			return
+		}
+		app.openAtGate(state, direction)
 	}
 }
 
@@ -325,7 +687,7 @@ func (app *App) handleDeviceRoamed(state *DeviceState, fromAP, toAP string) {
 
 	// Log event
 	if app.Config.Gate.LogActivity {
-		if err := app.DB.LogEvent(&database.LogEntry{
+		if err := app.logEvent(&database.LogEntry{
 			DeviceMAC:  state.MAC,
 			DeviceName: state.Name,
 			Event:      "roamed",
@@ -340,57 +702,322 @@ func (app *App) handleDeviceRoamed(state *DeviceState, fromAP, toAP string) {
 
 	// Check if we should open gate
 	if toAP == app.Config.UniFi.GateAPMAC || fromAP == app.Config.UniFi.GateAPMAC {
-		app.checkAndOpenGate(state, direction)
+		if !app.Config.Gate.TriggerOnRoam {
+			app.Logger.Debugf("Roam-based opens disabled, not opening for %s", state.Name)
+			return
+		}
+		if toAP != app.Config.UniFi.GateAPMAC {
+			app.checkAndOpenGate(state, direction)
+			return
+		}
+		if app.Config.Gate.IgnoreInteriorToGateRoams && app.isInteriorAP(fromAP) {
+			app.Logger.Infof("Not opening for %s, roams from inside to the gate are ignored", state.Name)
+			return
+		}
+		if !app.confirmedAtGate(state, direction) {
+			return
+		}
+		app.openAtGate(state, direction)
 	}
 }
 
+// openAtGate opens the gate for a device that showed up at the gate AP, after
+// gate.pre_open_delay if one is set. The delay runs on a timer so the poll
+// loop goes on, and moving away or disconnecting before it fires cancels the
+// open. Callers must hold monitoringMu.
+func (app *App) openAtGate(state *DeviceState, direction string) {
+	delay := time.Duration(app.Config.Gate.PreOpenDelay) * time.Second
+	if delay <= 0 {
+		app.openApproaching(state, direction)
+		return
+	}
+
+	if state.preOpen != nil {
+		// Already waiting, the first arrival's timer stands
+		return
+	}
+	pending := &delayedOpen{}
+	pending.stop = app.after(delay, func() {
+		app.monitoringMu.Lock()
+		defer app.monitoringMu.Unlock()
+
+		// Cancelled, or the device is no longer tracked
+		if state.preOpen != pending || app.deviceStates[state.MAC] != state {
+			return
+		}
+		state.preOpen = nil
+		app.Logger.Infof("Pre-open delay for %s passed, opening", state.Name)
+		app.openApproaching(state, direction)
+	})
+	state.preOpen = pending
+	app.Logger.Infof("Opening gate for %s in %v (pre-open delay)", state.Name, delay)
+}
+
+// openApproaching opens for a device at the gate AP unless its signal there
+// is weaker than unifi.min_signal, or gate.require_approaching is set and the
+// signal is clearly falling, i.e. it's moving away from the gate. A weak
+// signal keeps the open pending, it's checked again on every poll until the
+// signal is strong enough or the device leaves the gate. Callers must hold
+// monitoringMu.
+func (app *App) openApproaching(state *DeviceState, direction string) {
+	weak, falling := app.signalHold(state)
+	if weak {
+		min := app.Config.UniFi.MinSignal
+		state.pendingOpen = direction
+		if state.weakSignal {
+			return
+		}
+		state.weakSignal = true
+		app.Logger.Infof("Not opening gate for %s: signal %d dBm is weaker than %d dBm", state.Name, state.signal(), min)
+		if app.Config.Gate.LogActivity {
+			if err := app.logEvent(&database.LogEntry{
+				DeviceMAC:  state.MAC,
+				DeviceName: state.Name,
+				Event:      "ignored_weak_signal",
+				Direction:  direction,
+				ToAP:       state.signalAP,
+				GateOpened: false,
+				Message:    fmt.Sprintf("Signal %d dBm is weaker than the minimum of %d dBm", state.signal(), min),
+			}); err != nil {
+				app.Logger.Errorf("Failed to log event for %s: %v", state.MAC, err)
+			}
+		}
+		return
+	}
+	state.weakSignal = false
+	if falling {
+		app.Logger.Infof("Not opening gate for %s: signal falling %v, moving away from the gate", state.Name, state.signals)
+		app.logSkipped(state, direction, "Signal at the gate AP is falling, device is moving away")
+		return
+	}
+	if app.checkAndOpenGate(state, direction) {
+		app.scheduleReopen(state)
+	}
+}
+
+// signalHold reports whether the device's signal at the gate AP holds back
+// its open: weak when it's below unifi.min_signal, falling when
+// gate.require_approaching is set and the device is moving away
+func (app *App) signalHold(state *DeviceState) (weak, falling bool) {
+	if min := app.Config.UniFi.MinSignal; min != 0 && state.signal() != 0 && state.signal() < min {
+		return true, false
+	}
+	return false, app.Config.Gate.RequireApproaching && state.signalTrend() == directionLeaving
+}
+
+// cancelPreOpen drops a device's delayed open, if it has one. Callers must
+// hold monitoringMu.
+func (app *App) cancelPreOpen(state *DeviceState, reason string) {
+	if state.preOpen == nil {
+		return
+	}
+	state.preOpen.stop()
+	state.preOpen = nil
+	app.Logger.Infof("Cancelled delayed open for %s: %s", state.Name, reason)
+	app.logSkipped(state, "", "Delayed open cancelled, device "+reason)
+}
+
+// logEvent stores an activity log entry, with its message replaced by the
+// event's template from log_messages if there is one
+func (app *App) logEvent(entry *database.LogEntry) error {
+	if template, ok := app.Config.LogMessages[entry.Event]; ok {
+		entry.Message = renderLogMessage(template, entry)
+	}
+	return app.DB.LogEvent(entry)
+}
+
+// renderLogMessage fills in a log message template's placeholders: {device},
+// {ap}, the AP the device moved to or else came from, {direction} and
+// {message}, the default message
+func renderLogMessage(template string, entry *database.LogEntry) string {
+	device := entry.DeviceName
+	if device == "" {
+		device = entry.DeviceMAC
+	}
+	ap := entry.ToAP
+	if ap == "" {
+		ap = entry.FromAP
+	}
+	return strings.NewReplacer(
+		"{device}", device,
+		"{ap}", ap,
+		"{direction}", entry.Direction,
+		"{message}", entry.Message,
+	).Replace(template)
+}
+
+// logSkipped records an open that didn't happen, if activity logging is on
+func (app *App) logSkipped(state *DeviceState, direction, reason string) {
+	if !app.Config.Gate.LogActivity {
+		return
+	}
+	if err := app.logEvent(&database.LogEntry{
+		DeviceMAC:  state.MAC,
+		DeviceName: state.Name,
+		Event:      "gate_skipped",
+		Direction:  direction,
+		GateOpened: false,
+		Message:    reason,
+	}); err != nil {
+		app.Logger.Errorf("Failed to log event for %s: %v", state.MAC, err)
+	}
+}
+
+// after runs f once d has passed and returns a function cancelling it,
+// overridable in tests
+func (app *App) after(d time.Duration, f func()) func() bool {
+	if app.afterFunc != nil {
+		return app.afterFunc(d, f)
+	}
+	return time.AfterFunc(d, f).Stop
+}
+
+// confirmedAtGate reports whether a device has been at the gate AP for enough
+// consecutive polls to open. If not, the open is kept pending and happens on a
+// later poll once the device is still there.
+func (app *App) confirmedAtGate(state *DeviceState, direction string) bool {
+	if state.gatePolls >= app.Config.Gate.ConfirmPolls {
+		return true
+	}
+	state.pendingOpen = direction
+	app.Logger.Infof("Device %s at gate for %d of %d polls, waiting before opening",
+		state.Name, state.gatePolls, app.Config.Gate.ConfirmPolls)
+	return false
+}
+
 func (app *App) handleDeviceDisconnected(state *DeviceState) {
 	app.Logger.Infof("Device %s (%s) disconnected from AP %s", state.Name, state.MAC, state.CurrentAP)
 
+	// Dropping off the network from inside the property means leaving
+	direction := ""
+	if app.isInteriorAP(state.CurrentAP) {
+		direction = directionLeaving
+	}
+
 	// Log event
 	if app.Config.Gate.LogActivity {
-		if err := app.DB.LogEvent(&database.LogEntry{
+		if err := app.logEvent(&database.LogEntry{
 			DeviceMAC:  state.MAC,
 			DeviceName: state.Name,
 			Event:      "disconnected",
+			Direction:  direction,
 			FromAP:     state.CurrentAP,
 			Message:    "Device disconnected from network",
 		}); err != nil {
 			app.Logger.Errorf("Failed to log event for %s: %v", state.MAC, err)
 		}
 	}
+
+	if direction == directionLeaving {
+		app.checkAndOpenGate(state, direction)
+	}
+
+	// Dropping off at the gate means the device drove out and away
+	if app.Config.Gate.CloseOnDeparture && state.CurrentAP == app.Config.UniFi.GateAPMAC {
+		app.closeGate(state)
+	}
+
+	if app.Config.Gate.ResetCooldownOnDeparture && !state.LastGateTrigger.IsZero() {
+		app.Logger.Debugf("Resetting cooldown for %s after departure", state.Name)
+		state.clearTriggers()
+		if err := app.DB.ClearLastGateTrigger(state.MAC); err != nil {
+			app.Logger.Errorf("Failed to clear last gate trigger for %s: %v", state.MAC, err)
+		}
+	}
 }
 
-func (app *App) checkAndOpenGate(state *DeviceState, direction string) {
-	// Check cooldown period (using open duration)
-	cooldownDuration := time.Duration(app.Config.Gate.OpenDuration) * time.Minute
-	if time.Since(state.LastGateTrigger) < cooldownDuration {
-		app.Logger.Infof("Gate recently opened for %s, skipping (cooldown: %v remaining)",
-			state.Name, cooldownDuration-time.Since(state.LastGateTrigger))
+// isInteriorAP reports whether mac is one of the configured interior APs
+func (app *App) isInteriorAP(mac string) bool {
+	if mac == "" {
+		return false
+	}
+	for _, interior := range app.Config.UniFi.InteriorAPMACs {
+		if strings.EqualFold(interior, mac) {
+			return true
+		}
+	}
+	return false
+}
 
-		if app.Config.Gate.LogActivity {
-			if err := app.DB.LogEvent(&database.LogEntry{
-				DeviceMAC:  state.MAC,
-				DeviceName: state.Name,
-				Event:      "gate_skipped",
-				Direction:  direction,
-				GateOpened: false,
-				Message:    "Gate recently opened, cooldown active",
-			}); err != nil {
-				app.Logger.Errorf("Failed to log event for %s: %v", state.MAC, err)
-			}
+// checkAndOpenGate opens the gate for a device unless its cooldown is active
+// and reports whether the gate was opened
+func (app *App) checkAndOpenGate(state *DeviceState, direction string) bool {
+	open, code, reason := app.openDecision(state, direction)
+	if !open {
+		app.skipOpen(state, direction, code, reason)
+		return false
+	}
+	return app.openGate(state, direction, reason).opened()
+}
+
+// skipOpen records an open decided against. Opens the schedule held back
+// are logged even with activity logging off, so an arrival at night doesn't
+// leave people wondering why the gate stayed shut.
+func (app *App) skipOpen(state *DeviceState, direction, code, reason string) {
+	app.Logger.Infof("Not opening gate for %s: %s", state.Name, reason)
+
+	event := "gate_skipped"
+	if code == reasonOutsideSchedule {
+		event = "gate_skipped_schedule"
+	}
+	if app.Config.Gate.LogActivity || event == "gate_skipped_schedule" {
+		if err := app.logEvent(&database.LogEntry{
+			DeviceMAC:  state.MAC,
+			DeviceName: state.Name,
+			Event:      event,
+			Direction:  direction,
+			GateOpened: false,
+			Message:    reason,
+		}); err != nil {
+			app.Logger.Errorf("Failed to log event for %s: %v", state.MAC, err)
 		}
-		return
+	}
+}
+
+// openOutcome is what became of an open the decision allowed
+type openOutcome int
+
+const (
+	openFailed    openOutcome = iota // the relay couldn't be triggered
+	openTriggered                    // the relay was triggered
+	openDebounced                    // the gate was just triggered, counted as opened
+	openObserved                     // observe-only mode held it back
+)
+
+// opened reports whether the gate opened for the device
+func (o openOutcome) opened() bool {
+	return o == openTriggered || o == openDebounced
+}
+
+// openGate opens the gate for a device the decision allowed to, reason being
+// why
+func (app *App) openGate(state *DeviceState, direction, reason string) openOutcome {
+	if app.Config.Gate.ObserveOnly {
+		app.observeOpen(state, direction, reason)
+		return openObserved
+	}
+	outcome := openTriggered
+
+	message := "Gate opened successfully"
+	if state.BypassCooldown && app.cooldownRemaining(state, direction) > 0 {
+		app.Logger.Infof("Cooldown bypassed for %s", state.Name)
+		message = "Gate opened successfully, cooldown bypassed"
 	}
 
 	// Open gate
 	app.Logger.Infof("Opening gate for %s (%s)", state.Name, direction)
 
-	if err := app.GateController.OpenGate(); err != nil {
+	if err := app.gateControllerFor(state.Gate).OpenGate(); errors.Is(err, gate.ErrDebounced) {
+		// Another device or path triggered the gate a moment ago, it's
+		// opening anyway, so this device counts as let through too
+		app.Logger.Infof("Gate for %s already opening: %v", state.Name, err)
+		message = "Gate was just triggered, counted as opened for this device"
+		outcome = openDebounced
+	} else if err != nil {
 		app.Logger.Errorf("Failed to open gate: %v", err)
 
 		if app.Config.Gate.LogActivity {
-			if logErr := app.DB.LogEvent(&database.LogEntry{
+			if logErr := app.logEvent(&database.LogEntry{
 				DeviceMAC:  state.MAC,
 				DeviceName: state.Name,
 				Event:      "gate_error",
@@ -401,28 +1028,331 @@ func (app *App) checkAndOpenGate(state *DeviceState, direction string) {
 				app.Logger.Errorf("Failed to log event for %s: %v", state.MAC, logErr)
 			}
 		}
-		return
+		return openFailed
 	}
 
 	// Update last trigger time
-	state.LastGateTrigger = time.Now()
+	state.recordTrigger(direction, app.clock())
 	if err := app.DB.UpdateLastGateTrigger(state.MAC); err != nil {
 		app.Logger.Errorf("Failed to update last gate trigger for %s: %v", state.MAC, err)
 	}
 
+	app.broadcastDevice("gate_triggered", state)
+	app.publishGateTrigger(mqttGateTrigger{
+		Time:       state.LastGateTrigger,
+		DeviceMAC:  state.MAC,
+		DeviceName: state.Name,
+		Direction:  direction,
+		Gate:       state.Gate,
+	})
+
 	// Log successful gate opening
 	if app.Config.Gate.LogActivity {
-		if err := app.DB.LogEvent(&database.LogEntry{
+		if err := app.logEvent(&database.LogEntry{
 			DeviceMAC:  state.MAC,
 			DeviceName: state.Name,
 			Event:      "gate_triggered",
 			Direction:  direction,
 			GateOpened: true,
-			Message:    "Gate opened successfully",
+			Message:    message,
 		}); err != nil {
 			app.Logger.Errorf("Failed to log event for %s: %v", state.MAC, err)
 		}
 	}
+
+	event := "arrived"
+	if direction == directionLeaving {
+		event = "left"
+	}
+	msg := notify.Message{
+		Event:      event,
+		Text:       fmt.Sprintf("%s %s, gate opened", state.Name, event),
+		DeviceMAC:  state.MAC,
+		DeviceName: state.Name,
+		Gate:       state.Gate,
+		Time:       state.LastGateTrigger,
+	}
+	app.notifyInBackground(msg)
+	app.notifyGateOpened(msg)
+	if direction == directionArriving {
+		app.announceArrival(state)
+	}
+
+	return outcome
+}
+
+// observeOpen records an open held back by observe-only mode. It's logged
+// even with activity logging off, that's what the mode is for. The cooldown
+// starts in memory as if the gate had opened, so later decisions look like
+// they would have, but isn't stored.
+func (app *App) observeOpen(state *DeviceState, direction, reason string) {
+	app.Logger.Infof("Observe-only, not opening gate for %s (%s): %s", state.Name, direction, reason)
+
+	message := fmt.Sprintf("Observe-only, would have opened (%s): %s", direction, reason)
+	if state.Gate != "" {
+		message = fmt.Sprintf("Observe-only, would have opened %s (%s): %s", state.Gate, direction, reason)
+	}
+	if err := app.logEvent(&database.LogEntry{
+		DeviceMAC:  state.MAC,
+		DeviceName: state.Name,
+		Event:      "would_open",
+		Direction:  direction,
+		GateOpened: false,
+		Message:    message,
+	}); err != nil {
+		app.Logger.Errorf("Failed to log event for %s: %v", state.MAC, err)
+	}
+
+	state.recordTrigger(direction, app.clock())
+}
+
+// closeGate closes the gate behind a departed device
+func (app *App) closeGate(state *DeviceState) {
+	app.Logger.Infof("Closing gate behind %s", state.Name)
+
+	event, message := "gate_closed", "Gate closed after departure"
+	if err := app.gateControllerFor(state.Gate).CloseGate(); err != nil {
+		app.Logger.Errorf("Failed to close gate: %v", err)
+		event, message = "gate_error", err.Error()
+	}
+
+	if app.Config.Gate.LogActivity {
+		if err := app.logEvent(&database.LogEntry{
+			DeviceMAC:  state.MAC,
+			DeviceName: state.Name,
+			Event:      event,
+			Direction:  directionLeaving,
+			FromAP:     state.CurrentAP,
+			Message:    message,
+		}); err != nil {
+			app.Logger.Errorf("Failed to log event for %s: %v", state.MAC, err)
+		}
+	}
+}
+
+// Reason codes of open decisions, for automations to match on
+const (
+	reasonNoCooldown       = "no_cooldown"
+	reasonCooldownBypassed = "cooldown_bypassed"
+	reasonCooldown         = "cooldown"
+	reasonStaleData        = "stale_data"
+	reasonOutsideSchedule  = "outside_schedule"
+)
+
+// openDecision decides whether the gate may open for state in direction right
+// now without any side effects. The code and reason explain the decision
+// either way. Manual opens don't come through here, so the schedule never
+// stops them.
+func (app *App) openDecision(state *DeviceState, direction string) (open bool, code, reason string) {
+	remaining := app.cooldownRemaining(state, direction)
+	switch {
+	case !app.Config.Gate.Schedule.Allows(app.clock()):
+		return false, reasonOutsideSchedule, fmt.Sprintf("Outside the gate schedule (%s)", app.Config.Gate.Schedule)
+	case !app.staleSince.IsZero():
+		return false, reasonStaleData, fmt.Sprintf("UniFi controller data is stale, last_seen unchanged since %s", app.lastSeenMoved.Format(time.RFC3339))
+	case remaining <= 0:
+		return true, reasonNoCooldown, "No cooldown active"
+	case state.BypassCooldown:
+		return true, reasonCooldownBypassed, "Cooldown active but bypassed for this device"
+	default:
+		return false, reasonCooldown, fmt.Sprintf("Gate recently opened, cooldown active (%v remaining)", remaining.Round(time.Second))
+	}
+}
+
+// cooldownRemaining is how long the device's cooldown for opening in direction
+// still runs, counting from its last open in that direction
+func (app *App) cooldownRemaining(state *DeviceState, direction string) time.Duration {
+	return app.cooldown(state, direction) - app.clock().Sub(state.lastTrigger(direction))
+}
+
+// cooldown is how long after an open the device can't open again in
+// direction. The open duration of its gate doubles as the cooldown, unless
+// the direction has its own.
+func (app *App) cooldown(state *DeviceState, direction string) time.Duration {
+	minutes := app.Config.GateOpenDuration(state.Gate)
+	switch {
+	case direction == directionArriving && app.Config.Gate.ArrivingCooldown > 0:
+		minutes = app.Config.Gate.ArrivingCooldown
+	case direction == directionLeaving && app.Config.Gate.LeavingCooldown > 0:
+		minutes = app.Config.Gate.LeavingCooldown
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// scheduleReopen arranges a check after the gate has closed again, if
+// re-opening for devices still waiting at the gate is enabled
+func (app *App) scheduleReopen(state *DeviceState) {
+	openDuration := app.Config.GateOpenDuration(state.Gate)
+	if !app.Config.Gate.ReopenIfPresent || openDuration <= 0 {
+		return
+	}
+	state.ReopenAt = app.clock().Add(time.Duration(openDuration) * time.Minute)
+}
+
+// checkReopen re-opens the gate once if a device is still at the gate AP when
+// the gate has closed. The re-open never schedules another one, so a device
+// parked at the gate can't keep it open, and the cooldown the device's own
+// open started doesn't hold it back.
+func (app *App) checkReopen(state *DeviceState) {
+	if state.ReopenAt.IsZero() || app.clock().Before(state.ReopenAt) {
+		return
+	}
+	state.ReopenAt = time.Time{}
+
+	if state.CurrentAP != app.Config.UniFi.GateAPMAC {
+		app.Logger.Debugf("Device %s moved on from the gate, no re-open needed", state.Name)
+		return
+	}
+
+	app.Logger.Infof("Device %s still at gate after it closed, re-opening", state.Name)
+	open, code, reason := app.openDecision(state, directionArriving)
+	if !open && code == reasonCooldown {
+		open, reason = true, "Still at the gate after it closed"
+	}
+	if !open {
+		app.skipOpen(state, directionArriving, code, reason)
+		return
+	}
+	app.openGate(state, directionArriving, reason)
+}
+
+// clock returns the current time, overridable in tests
+func (app *App) clock() time.Time {
+	if app.now != nil {
+		return app.now()
+	}
+	return time.Now()
+}
+
+// saveConfig persists the current configuration to the file it was loaded from
+func (app *App) saveConfig() error {
+	app.saveMu.Lock()
+	defer app.saveMu.Unlock()
+	path := app.ConfigPath
+	if path == "" {
+		path = "config.yaml"
+	}
+	return config.SaveConfig(path, app.Config)
+}
+
+// gateController returns the gate controller, creating it if monitoring
+// hasn't, so manual opens don't depend on the monitoring loop
+func (app *App) gateController() *gate.Controller {
+	app.gateMu.Lock()
+	defer app.gateMu.Unlock()
+	if app.GateController == nil {
+		app.GateController = app.newGateController()
+	}
+	return app.GateController
+}
+
+// gateControllerFor returns the controller of the named gate, the primary
+// one for an empty or unknown name
+func (app *App) gateControllerFor(name string) *gate.Controller {
+	if name == "" {
+		return app.gateController()
+	}
+	relay := app.Config.GetGate(name)
+	if relay == nil {
+		app.Logger.Warnf("Unknown gate %q, using the %s gate", name, config.PrimaryGate)
+		return app.gateController()
+	}
+
+	app.gateMu.Lock()
+	defer app.gateMu.Unlock()
+	controller, ok := app.relays[relay.Name]
+	if !ok {
+		if app.relays == nil {
+			app.relays = make(map[string]*gate.Controller)
+		}
+		controller = app.newRelayController(relay.TriggerURL, relay.CloseURL)
+		app.relays[relay.Name] = controller
+	}
+	return controller
+}
+
+// resetRelays drops the additional gates' controllers so they pick up
+// changed settings when next used
+func (app *App) resetRelays() {
+	app.gateMu.Lock()
+	app.relays = nil
+	app.gateMu.Unlock()
+}
+
+// newGateController creates a gate controller for the configured relay
+func (app *App) newGateController() *gate.Controller {
+	return app.newRelayController(app.Config.Shelly.BuildTriggerURL(), app.Config.Shelly.CloseURL)
+}
+
+// newRelayController creates a gate controller for the given URLs with the
+// shelly settings every gate shares
+func (app *App) newRelayController(triggerURL, closeURL string) *gate.Controller {
+	controller := gate.NewController(triggerURL, app.Logger)
+	controller.SetDebounce(time.Duration(app.Config.Gate.DebounceSeconds) * time.Second)
+	controller.UpdateCloseURL(closeURL)
+	controller.SetAuth(app.Config.Shelly.Username, app.Config.Shelly.Password, app.Config.Shelly.BearerToken)
+	controller.SetSuccessCheck(app.Config.Shelly.SuccessKey, app.Config.Shelly.SuccessValue)
+	controller.SetKeepAlive(app.Config.Shelly.KeepAlive, time.Duration(app.Config.Shelly.IdleTimeout)*time.Second)
+	app.setGateRequest(controller)
+	return controller
+}
+
+// setGateRequest makes controller request opens the configured way
+func (app *App) setGateRequest(controller *gate.Controller) {
+	shelly := app.Config.Shelly
+	if err := controller.SetAPIVersion(shelly.APIVersion, shelly.Channel, shelly.Timer); err != nil {
+		app.Logger.Warnf("%v, using %s", err, gate.APIGen1)
+	}
+	if err := controller.SetMethod(shelly.Method, shelly.Body); err != nil {
+		app.Logger.Warnf("%v, using GET", err)
+	}
+}
+
+// newUniFiClient creates a UniFi client with the configured login options and
+// API paths
+func (app *App) newUniFiClient(controllerURL, username, password string) *unifi.Client {
+	client := unifi.NewClient(controllerURL, username, password, unifi.NewLogrusAdapter(app.Logger))
+	client.SetLoginOptions(time.Duration(app.Config.UniFi.LoginTimeout)*time.Second, app.Config.UniFi.LoginRetries)
+	client.SetUnifiOS(app.Config.UniFi.UnifiOS)
+	return client
+}
+
+// discoveredName returns a display name for a client seen in the latest poll,
+// preferring the UniFi alias over the hostname and falling back to the MAC
+func (app *App) discoveredName(mac string) string {
+	var client *unifi.WirelessClient
+	app.monitoringMu.RLock()
+	for i := range app.lastClients {
+		if strings.EqualFold(app.lastClients[i].MAC, mac) {
+			client = &app.lastClients[i]
+			break
+		}
+	}
+	app.monitoringMu.RUnlock()
+
+	if client != nil {
+		if name := strings.TrimSpace(client.Name); name != "" {
+			return name
+		}
+		if hostname := strings.TrimSpace(client.Hostname); hostname != "" {
+			return hostname
+		}
+	}
+	return mac
+}
+
+// appendUpperMAC appends mac to dst with ASCII letters uppercased. Device
+// states are keyed by uppercase MAC, and looking them up through a reused
+// buffer avoids allocating a new string for every client on every poll.
+func appendUpperMAC(dst []byte, mac string) []byte {
+	for i := 0; i < len(mac); i++ {
+		c := mac[i]
+		if 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		dst = append(dst, c)
+	}
+	return dst
 }
 
 // Template helper functions
@@ -430,17 +1360,27 @@ func (app *App) loadTemplate(name string) (*template.Template, error) {
 	return template.ParseFS(app.WebFS, "web/templates/base.html", "web/templates/"+name)
 }
 
+// renderTemplate renders a page, or the error page if that fails. Pages are
+// rendered in full before anything is written, so a failure halfway through
+// doesn't leave half a page.
 func (app *App) renderTemplate(w http.ResponseWriter, name string, data interface{}) {
 	tmpl, err := app.loadTemplate(name)
 	if err != nil {
-		app.Logger.Errorf("Failed to load template %s: %v", name, err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		requestID := newRequestID()
+		app.Logger.Errorf("Failed to load template %s (request %s): %v", name, requestID, err)
+		app.renderErrorPage(w, requestID)
 		return
 	}
 
-	if err := tmpl.Execute(w, data); err != nil {
-		app.Logger.Errorf("Failed to execute template %s: %v", name, err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	var page bytes.Buffer
+	if err := tmpl.Execute(&page, data); err != nil {
+		requestID := newRequestID()
+		app.Logger.Errorf("Failed to execute template %s (request %s): %v", name, requestID, err)
+		app.renderErrorPage(w, requestID)
+		return
+	}
+	if _, err := page.WriteTo(w); err != nil {
+		app.Logger.Debugf("Failed to write template %s: %v", name, err)
 	}
 }
 
@@ -452,7 +1392,8 @@ func (app *App) startCleanupJob() {
 	ticker := time.NewTicker(1 * time.Hour)
 	defer ticker.Stop()
 
-	// Run initial cleanup
+	// Run initial cleanup, the first VACUUM waits a full interval
+	app.lastVacuum = app.clock()
 	app.cleanupOldLogs()
 
 	for {
@@ -467,14 +1408,51 @@ func (app *App) startCleanupJob() {
 }
 
 func (app *App) cleanupOldLogs() {
-	// Delete logs older than 30 days
-	deletedCount, err := app.DB.DeleteOldLogs(30)
+	logDays, gateOpenDays := app.Config.Database.Retention()
+	deletedCount, err := app.DB.DeleteOldLogs(logDays, gateOpenDays)
 	if err != nil {
 		app.Logger.Errorf("Failed to delete old logs: %v", err)
 		return
 	}
 
 	if deletedCount > 0 {
-		app.Logger.Infof("Deleted %d old log entries (>30 days)", deletedCount)
+		app.Logger.Infof("Deleted %d old log entries (>%d days, gate openings >%d days)", deletedCount, logDays, gateOpenDays)
+	}
+
+	app.enforceDatabaseLimits()
+}
+
+// enforceDatabaseLimits trims the oldest logs beyond the configured row and
+// size caps and vacuums once the interval has passed
+func (app *App) enforceDatabaseLimits() {
+	limits := app.Config.Database
+
+	if limits.MaxLogRows > 0 {
+		trimmed, err := app.DB.TrimLogs(limits.MaxLogRows)
+		if err != nil {
+			app.Logger.Errorf("Failed to trim logs to %d rows: %v", limits.MaxLogRows, err)
+		} else if trimmed > 0 {
+			app.Logger.Infof("Trimmed %d log entries beyond the %d row limit", trimmed, limits.MaxLogRows)
+		}
+	}
+
+	if limits.MaxSizeMB > 0 {
+		trimmed, err := app.DB.TrimLogsToSize(int64(limits.MaxSizeMB) << 20)
+		if err != nil {
+			app.Logger.Errorf("Failed to trim logs to %d MB: %v", limits.MaxSizeMB, err)
+		} else if trimmed > 0 {
+			app.Logger.Infof("Trimmed %d log entries to stay under %d MB", trimmed, limits.MaxSizeMB)
+		}
+	}
+
+	interval := time.Duration(limits.VacuumInterval) * time.Hour
+	if interval <= 0 || app.clock().Sub(app.lastVacuum) < interval {
+		return
+	}
+	if err := app.DB.Vacuum(); err != nil {
+		app.Logger.Errorf("Failed to vacuum database: %v", err)
+		return
 	}
+	app.lastVacuum = app.clock()
+	app.Logger.Info("Vacuumed database")
 }
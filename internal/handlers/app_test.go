@@ -0,0 +1,1406 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/auth"
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+	"github.com/fbettag/unifi-gate-opener/internal/gate"
+	"github.com/fbettag/unifi-gate-opener/internal/unifi"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	testGateAP     = "aa:bb:cc:dd:ee:ff"
+	testInteriorAP = "11:22:33:44:55:66"
+	testDeviceMAC  = "AA:BB:CC:DD:EE:01"
+)
+
+// newTestApp creates an App backed by a temporary database with monitoring
+// state initialized, suitable for driving processClients directly
+func newTestApp(t testing.TB) *App {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel) // Suppress log output in tests
+
+	db, err := database.Initialize(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &config.Config{
+		SessionSecret: "test-session-secret-32-characters!",
+		UniFi: config.UniFiConfig{
+			SiteID:       "default",
+			GateAPMAC:    testGateAP,
+			PollInterval: 1,
+		},
+		Gate: config.GateConfig{
+			OpenDuration:     10,
+			TriggerOnConnect: true,
+			TriggerOnRoam:    true,
+		},
+		Notifications: config.NotifyConfig{
+			Events: []string{"device_absent"},
+		},
+	}
+
+	return &App{
+		Config:       cfg,
+		ConfigPath:   filepath.Join(t.TempDir(), "config.yaml"),
+		DB:           db,
+		Logger:       logger,
+		SessionStore: auth.NewSessionStore(cfg.SessionSecret),
+		deviceStates: make(map[string]*DeviceState),
+	}
+}
+
+// newTestRelay points the app's gate controller at a local relay and returns
+// a counter of how many times the gate was triggered
+func newTestRelay(t *testing.T, app *App) *int32 {
+	t.Helper()
+
+	var hits int32
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(relay.Close)
+
+	app.Config.Shelly.TriggerURL = relay.URL
+	app.GateController = gate.NewController(relay.URL, app.Logger)
+	return &hits
+}
+
+// markConfigured fills in the fields IsConfigured requires
+func markConfigured(app *App) {
+	app.Config.SetupComplete = true
+	app.Config.Admin.Username = "admin"
+	app.Config.UniFi.ControllerURL = "https://unifi.test"
+}
+
+// trackDevice adds a device to the in-memory monitoring state
+func trackDevice(app *App, mac, name string) *DeviceState {
+	state := &DeviceState{MAC: mac, Name: name}
+	app.deviceStates[mac] = state
+	return state
+}
+
+func TestProcessClientsSSIDMatch(t *testing.T) {
+	t.Run("Device without SSID matches any network", func(t *testing.T) {
+		app := newTestApp(t)
+		state := trackDevice(app, testDeviceMAC, "Phone")
+
+		app.processClients([]unifi.WirelessClient{
+			{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testInteriorAP, ESSID: "Guest", Uptime: 100},
+		})
+
+		if !state.IsConnected {
+			t.Error("Device should be connected")
+		}
+	})
+
+	t.Run("Device matches on its SSID", func(t *testing.T) {
+		app := newTestApp(t)
+		state := trackDevice(app, testDeviceMAC, "Phone")
+		state.SSID = "Home"
+
+		app.processClients([]unifi.WirelessClient{
+			{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testInteriorAP, ESSID: "home", Uptime: 100},
+		})
+
+		if !state.IsConnected {
+			t.Error("Device should be connected when ESSID matches (case-insensitive)")
+		}
+		if state.CurrentAP != testInteriorAP {
+			t.Errorf("Expected current AP %s, got %s", testInteriorAP, state.CurrentAP)
+		}
+	})
+
+	t.Run("Device does not match on other SSID", func(t *testing.T) {
+		app := newTestApp(t)
+		state := trackDevice(app, testDeviceMAC, "Phone")
+		state.SSID = "Home"
+
+		app.processClients([]unifi.WirelessClient{
+			{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testInteriorAP, ESSID: "Guest", Uptime: 100},
+		})
+
+		if state.IsConnected {
+			t.Error("Device should not be connected when ESSID differs")
+		}
+	})
+
+	t.Run("Device on other SSID counts as disconnected", func(t *testing.T) {
+		app := newTestApp(t)
+		state := trackDevice(app, testDeviceMAC, "Phone")
+		state.SSID = "Home"
+		state.IsConnected = true
+		state.CurrentAP = testInteriorAP
+
+		app.processClients([]unifi.WirelessClient{
+			{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testInteriorAP, ESSID: "Guest", Uptime: 100},
+		})
+
+		if state.IsConnected {
+			t.Error("Device should be marked disconnected after moving to another SSID")
+		}
+		if state.PreviousAP != testInteriorAP {
+			t.Errorf("Expected previous AP %s, got %s", testInteriorAP, state.PreviousAP)
+		}
+	})
+}
+
+func TestTriggerToggles(t *testing.T) {
+	arriveAtGate := []unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 5}}
+	roamToGate := func(app *App, state *DeviceState) {
+		state.IsConnected = true
+		state.CurrentAP = testInteriorAP
+		app.processClients([]unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 500}})
+	}
+
+	t.Run("Connect opens by default", func(t *testing.T) {
+		app := newTestApp(t)
+		hits := newTestRelay(t, app)
+		trackDevice(app, testDeviceMAC, "Phone")
+
+		app.processClients(arriveAtGate)
+
+		if atomic.LoadInt32(hits) != 1 {
+			t.Errorf("Expected gate to open once, got %d", *hits)
+		}
+	})
+
+	t.Run("Connect disabled", func(t *testing.T) {
+		app := newTestApp(t)
+		app.Config.Gate.TriggerOnConnect = false
+		hits := newTestRelay(t, app)
+		trackDevice(app, testDeviceMAC, "Phone")
+
+		app.processClients(arriveAtGate)
+
+		if atomic.LoadInt32(hits) != 0 {
+			t.Errorf("Expected no gate open with connect triggers disabled, got %d", *hits)
+		}
+	})
+
+	t.Run("Roam opens by default", func(t *testing.T) {
+		app := newTestApp(t)
+		hits := newTestRelay(t, app)
+		state := trackDevice(app, testDeviceMAC, "Phone")
+
+		roamToGate(app, state)
+
+		if atomic.LoadInt32(hits) != 1 {
+			t.Errorf("Expected gate to open once, got %d", *hits)
+		}
+	})
+
+	t.Run("Roam disabled", func(t *testing.T) {
+		app := newTestApp(t)
+		app.Config.Gate.TriggerOnRoam = false
+		hits := newTestRelay(t, app)
+		state := trackDevice(app, testDeviceMAC, "Phone")
+
+		roamToGate(app, state)
+
+		if atomic.LoadInt32(hits) != 0 {
+			t.Errorf("Expected no gate open with roam triggers disabled, got %d", *hits)
+		}
+		if state.CurrentAP != testGateAP {
+			t.Errorf("State should still follow the roam, got AP %s", state.CurrentAP)
+		}
+	})
+
+	t.Run("Roam from an interior AP opens by default", func(t *testing.T) {
+		app := newTestApp(t)
+		app.Config.UniFi.InteriorAPMACs = []string{testInteriorAP}
+		hits := newTestRelay(t, app)
+		state := trackDevice(app, testDeviceMAC, "Phone")
+
+		roamToGate(app, state)
+
+		if atomic.LoadInt32(hits) != 1 {
+			t.Errorf("Expected gate to open once for a vehicle exit, got %d", *hits)
+		}
+	})
+
+	t.Run("Roam from an interior AP ignored", func(t *testing.T) {
+		app := newTestApp(t)
+		app.Config.UniFi.InteriorAPMACs = []string{testInteriorAP}
+		app.Config.Gate.IgnoreInteriorToGateRoams = true
+		hits := newTestRelay(t, app)
+		state := trackDevice(app, testDeviceMAC, "Phone")
+
+		roamToGate(app, state)
+
+		if atomic.LoadInt32(hits) != 0 {
+			t.Errorf("Expected no gate open for a pedestrian exit, got %d", *hits)
+		}
+		if state.CurrentAP != testGateAP {
+			t.Errorf("State should still follow the roam, got AP %s", state.CurrentAP)
+		}
+
+		// Other roams onto the gate AP still open
+		other := trackDevice(app, "AA:BB:CC:DD:EE:02", "Tablet")
+		other.IsConnected = true
+		other.CurrentAP = "77:77:77:77:77:77"
+		app.processClients([]unifi.WirelessClient{
+			{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 500},
+			{MAC: "aa:bb:cc:dd:ee:02", AP_MAC: testGateAP, Uptime: 500},
+		})
+		if atomic.LoadInt32(hits) != 1 {
+			t.Errorf("Expected the gate to open for a roam from a non-interior AP, got %d", *hits)
+		}
+	})
+}
+
+func TestAppendUpperMAC(t *testing.T) {
+	if got := string(appendUpperMAC(nil, "aa:bb:cc:dd:ee:0f")); got != "AA:BB:CC:DD:EE:0F" {
+		t.Errorf("Expected AA:BB:CC:DD:EE:0F, got %s", got)
+	}
+}
+
+func BenchmarkProcessClients(b *testing.B) {
+	app := newTestApp(b)
+
+	// Tracked devices are away, so this measures matching rather than
+	// database writes for connected devices
+	for i := 0; i < 5; i++ {
+		trackDevice(app, fmt.Sprintf("AA:BB:CC:00:00:%02X", i), fmt.Sprintf("Phone %d", i))
+	}
+
+	clients := make([]unifi.WirelessClient, 2000)
+	for i := range clients {
+		clients[i] = unifi.WirelessClient{
+			MAC:    fmt.Sprintf("de:ad:be:ef:%02x:%02x", i/256, i%256),
+			AP_MAC: testInteriorAP,
+			Uptime: 3600,
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		app.processClients(clients)
+	}
+}
+
+func TestInteriorAPs(t *testing.T) {
+	const otherInteriorAP = "11:22:33:44:55:77"
+	const outsideAP = "99:88:77:66:55:44"
+
+	newInteriorApp := func(t *testing.T) (*App, *int32) {
+		app := newTestApp(t)
+		app.Config.UniFi.InteriorAPMACs = []string{testInteriorAP, strings.ToUpper(otherInteriorAP)}
+		app.Config.Gate.LogActivity = true
+		return app, newTestRelay(t, app)
+	}
+
+	t.Run("Disconnect from interior AP opens as leaving", func(t *testing.T) {
+		app, hits := newInteriorApp(t)
+		state := trackDevice(app, testDeviceMAC, "Phone")
+		state.IsConnected = true
+		state.CurrentAP = otherInteriorAP
+
+		app.processClients(nil)
+
+		if atomic.LoadInt32(hits) != 1 {
+			t.Fatalf("Expected gate to open once, got %d", *hits)
+		}
+		logs, err := app.DB.GetLogs(10, 0)
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		for _, entry := range logs {
+			if entry.Event == "disconnected" && entry.Direction != directionLeaving {
+				t.Errorf("Expected disconnect direction %s, got %s", directionLeaving, entry.Direction)
+			}
+		}
+	})
+
+	t.Run("Disconnect from other AP does not open", func(t *testing.T) {
+		app, hits := newInteriorApp(t)
+		state := trackDevice(app, testDeviceMAC, "Phone")
+		state.IsConnected = true
+		state.CurrentAP = outsideAP
+
+		app.processClients(nil)
+
+		if atomic.LoadInt32(hits) != 0 {
+			t.Errorf("Expected no gate open, got %d", *hits)
+		}
+	})
+
+	t.Run("Roam from any interior AP to gate is leaving", func(t *testing.T) {
+		for _, fromAP := range []string{testInteriorAP, otherInteriorAP} {
+			app, hits := newInteriorApp(t)
+			state := trackDevice(app, testDeviceMAC, "Phone")
+			state.IsConnected = true
+			state.CurrentAP = fromAP
+
+			app.processClients([]unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 500}})
+
+			if atomic.LoadInt32(hits) != 1 {
+				t.Errorf("Expected gate to open once from %s, got %d", fromAP, *hits)
+			}
+			logs, err := app.DB.GetLogs(10, 0)
+			if err != nil {
+				t.Fatalf("Failed to get logs: %v", err)
+			}
+			for _, entry := range logs {
+				if entry.Event == "roamed" && entry.Direction != directionLeaving {
+					t.Errorf("Expected roam direction %s from %s, got %s", directionLeaving, fromAP, entry.Direction)
+				}
+			}
+		}
+	})
+}
+
+func TestSkippedOpenStillUpdatesState(t *testing.T) {
+	tests := []struct {
+		name   string
+		skip   func(app *App, state *DeviceState)
+		fromAP string
+		uptime int64
+	}{
+		{
+			name:   "Cooldown on roam",
+			skip:   func(app *App, state *DeviceState) { state.LastGateTrigger = time.Now() },
+			fromAP: testInteriorAP,
+			uptime: 500,
+		},
+		{
+			name:   "Cooldown on connect",
+			skip:   func(app *App, state *DeviceState) { state.LastGateTrigger = time.Now() },
+			uptime: 5,
+		},
+		{
+			name:   "Roam triggers disabled",
+			skip:   func(app *App, state *DeviceState) { app.Config.Gate.TriggerOnRoam = false },
+			fromAP: testInteriorAP,
+			uptime: 500,
+		},
+		{
+			name:   "Connect triggers disabled",
+			skip:   func(app *App, state *DeviceState) { app.Config.Gate.TriggerOnConnect = false },
+			uptime: 5,
+		},
+		{
+			name:   "Already at gate",
+			skip:   func(app *App, state *DeviceState) {},
+			uptime: 500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t)
+			hits := newTestRelay(t, app)
+			state := trackDevice(app, testDeviceMAC, "Phone")
+			if tt.fromAP != "" {
+				state.IsConnected = true
+				state.CurrentAP = tt.fromAP
+			}
+			tt.skip(app, state)
+
+			before := time.Now()
+			app.processClients([]unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: tt.uptime}})
+
+			if atomic.LoadInt32(hits) != 0 {
+				t.Fatalf("Expected open to be skipped, got %d opens", *hits)
+			}
+			if !state.IsConnected || state.CurrentAP != testGateAP {
+				t.Errorf("Expected device connected at gate, got connected=%v AP=%s", state.IsConnected, state.CurrentAP)
+			}
+			if state.LastSeen.Before(before) {
+				t.Errorf("Expected last seen to be refreshed, got %v", state.LastSeen)
+			}
+
+			currentAP, _, isConnected, err := app.DB.GetDeviceState(testDeviceMAC)
+			if err != nil {
+				t.Fatalf("Failed to get device state: %v", err)
+			}
+			if !isConnected || currentAP != testGateAP {
+				t.Errorf("Expected stored state connected at gate, got connected=%v AP=%s", isConnected, currentAP)
+			}
+		})
+	}
+}
+
+func TestResetCooldownOnDeparture(t *testing.T) {
+	arriveAtGate := []unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 5}}
+
+	for _, reset := range []bool{true, false} {
+		t.Run(fmt.Sprintf("reset=%v", reset), func(t *testing.T) {
+			app := newTestApp(t)
+			app.Config.Gate.ResetCooldownOnDeparture = reset
+			hits := newTestRelay(t, app)
+			trackDevice(app, testDeviceMAC, "Phone")
+
+			app.processClients(arriveAtGate) // opens
+			app.processClients(nil)          // leaves
+			app.processClients(arriveAtGate) // returns within the cooldown
+
+			expected := int32(1)
+			if reset {
+				expected = 2
+			}
+			if got := atomic.LoadInt32(hits); got != expected {
+				t.Errorf("Expected %d gate opens, got %d", expected, got)
+			}
+
+			lastTrigger, err := app.DB.GetLastGateTrigger(testDeviceMAC)
+			if err != nil {
+				t.Fatalf("Failed to get last gate trigger: %v", err)
+			}
+			if lastTrigger.IsZero() {
+				t.Error("Expected the latest open to be recorded")
+			}
+		})
+	}
+}
+
+func TestReopenIfPresent(t *testing.T) {
+	atGate := []unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 5}}
+	inside := []unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testInteriorAP, Uptime: 500}}
+
+	newReopenApp := func(t *testing.T) (*App, *int32, *time.Time) {
+		app := newTestApp(t)
+		app.Config.Gate.ReopenIfPresent = true
+		clock := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		app.now = func() time.Time { return clock }
+		trackDevice(app, testDeviceMAC, "Phone")
+		return app, newTestRelay(t, app), &clock
+	}
+	openDuration := 10 * time.Minute
+
+	t.Run("Still at gate re-opens once", func(t *testing.T) {
+		app, hits, clock := newReopenApp(t)
+
+		app.processClients(atGate)
+		*clock = clock.Add(openDuration - time.Second)
+		app.processClients(atGate)
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Fatalf("Expected no re-open before the gate closes, got %d opens", got)
+		}
+
+		*clock = clock.Add(time.Second)
+		app.processClients(atGate)
+		if got := atomic.LoadInt32(hits); got != 2 {
+			t.Fatalf("Expected a re-open after the gate closed, got %d opens", got)
+		}
+
+		// Waiting at the gate doesn't keep re-opening it
+		*clock = clock.Add(2 * openDuration)
+		app.processClients(atGate)
+		if got := atomic.LoadInt32(hits); got != 2 {
+			t.Errorf("Expected only one re-open, got %d opens", got)
+		}
+	})
+
+	t.Run("Moved inside does not re-open", func(t *testing.T) {
+		app, hits, clock := newReopenApp(t)
+		app.Config.Gate.TriggerOnRoam = false // only look at the re-open
+
+		app.processClients(atGate)
+		*clock = clock.Add(time.Minute)
+		app.processClients(inside)
+		*clock = clock.Add(openDuration)
+		app.processClients(inside)
+
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected a single open, got %d", got)
+		}
+		if !app.deviceStates[testDeviceMAC].ReopenAt.IsZero() {
+			t.Error("Pending re-open should be cleared")
+		}
+	})
+
+	t.Run("Arriving cooldown longer than the gate stays open", func(t *testing.T) {
+		app, hits, clock := newReopenApp(t)
+		app.Config.Gate.ArrivingCooldown = 30
+
+		app.processClients(atGate)
+		*clock = clock.Add(openDuration)
+		app.processClients(atGate)
+
+		if got := atomic.LoadInt32(hits); got != 2 {
+			t.Errorf("Expected the re-open despite the cooldown, got %d opens", got)
+		}
+	})
+
+	t.Run("Disabled by default", func(t *testing.T) {
+		app, hits, clock := newReopenApp(t)
+		app.Config.Gate.ReopenIfPresent = false
+
+		app.processClients(atGate)
+		*clock = clock.Add(openDuration)
+		app.processClients(atGate)
+
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected a single open, got %d", got)
+		}
+	})
+}
+
+func TestBypassCooldown(t *testing.T) {
+	arrive := []unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 5}}
+
+	// Arrive, drop off and arrive again, all well within the cooldown
+	cycle := func(app *App, times int) {
+		for i := 0; i < times; i++ {
+			app.processClients(arrive)
+			app.processClients(nil)
+		}
+	}
+
+	t.Run("Bypass device opens every time", func(t *testing.T) {
+		app := newTestApp(t)
+		app.Config.Gate.LogActivity = true
+		hits := newTestRelay(t, app)
+		state := trackDevice(app, testDeviceMAC, "Pendant")
+		state.BypassCooldown = true
+
+		cycle(app, 3)
+
+		if got := atomic.LoadInt32(hits); got != 3 {
+			t.Errorf("Expected the gate to open 3 times, got %d", got)
+		}
+
+		logs, err := app.DB.GetLogs(10, 0)
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		var bypassed int
+		for _, entry := range logs {
+			if entry.Event == "gate_skipped" {
+				t.Errorf("Bypass device should never be skipped: %+v", entry)
+			}
+			if entry.Event == "gate_triggered" && strings.Contains(entry.Message, "cooldown bypassed") {
+				bypassed++
+			}
+		}
+		if bypassed != 2 {
+			t.Errorf("Expected 2 opens logged as bypassing the cooldown, got %d", bypassed)
+		}
+	})
+
+	t.Run("Other devices still wait for the cooldown", func(t *testing.T) {
+		app := newTestApp(t)
+		hits := newTestRelay(t, app)
+		trackDevice(app, testDeviceMAC, "Phone")
+
+		cycle(app, 3)
+
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected the gate to open once, got %d", got)
+		}
+	})
+
+	t.Run("Loaded from the device config", func(t *testing.T) {
+		app := newTestApp(t)
+		app.Config.Devices = []config.DeviceConfig{{MAC: testDeviceMAC, Name: "Pendant", Enabled: true, BypassCooldown: true}}
+		app.loadDeviceStates()
+
+		if state := app.deviceStates[testDeviceMAC]; state == nil || !state.BypassCooldown {
+			t.Errorf("Expected bypass flag on the loaded state, got %+v", state)
+		}
+	})
+}
+
+func TestCooldownPerDirection(t *testing.T) {
+	newApp := func(t *testing.T) (*App, *DeviceState, *time.Time) {
+		app := newTestApp(t)
+		newTestRelay(t, app)
+		app.Config.Gate.OpenDuration = 10
+		app.Config.Gate.ArrivingCooldown = 1
+		app.Config.Gate.LeavingCooldown = 30
+		now := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+		app.now = func() time.Time { return now }
+		return app, trackDevice(app, testDeviceMAC, "Car"), &now
+	}
+
+	t.Run("Arriving again opens after the arriving cooldown", func(t *testing.T) {
+		app, state, now := newApp(t)
+		if !app.checkAndOpenGate(state, directionArriving) {
+			t.Fatal("Expected the first arrival to open")
+		}
+
+		*now = now.Add(30 * time.Second)
+		if app.checkAndOpenGate(state, directionArriving) {
+			t.Error("Expected the arriving cooldown to hold within a minute")
+		}
+		*now = now.Add(time.Minute)
+		if !app.checkAndOpenGate(state, directionArriving) {
+			t.Error("Expected an arrival past the arriving cooldown to open, although open_duration hasn't passed")
+		}
+	})
+
+	t.Run("Leaving waits for the leaving cooldown", func(t *testing.T) {
+		app, state, now := newApp(t)
+		if !app.checkAndOpenGate(state, directionLeaving) {
+			t.Fatal("Expected the first departure to open")
+		}
+
+		*now = now.Add(15 * time.Minute)
+		if app.checkAndOpenGate(state, directionLeaving) {
+			t.Error("Expected the leaving cooldown to hold past open_duration")
+		}
+		if !app.checkAndOpenGate(state, directionArriving) {
+			t.Error("Expected an arrival to only wait for the arriving cooldown")
+		}
+	})
+
+	t.Run("Each direction counts from its own last open", func(t *testing.T) {
+		app, state, now := newApp(t)
+		app.Config.Gate.ArrivingCooldown = 5
+		app.Config.Gate.LeavingCooldown = 5
+		if !app.checkAndOpenGate(state, directionArriving) {
+			t.Fatal("Expected the arrival to open")
+		}
+
+		// Driving back out right away isn't held up by the arrival
+		*now = now.Add(time.Minute)
+		if !app.checkAndOpenGate(state, directionLeaving) {
+			t.Error("Expected a departure after an arrival to open")
+		}
+		*now = now.Add(time.Minute)
+		if app.checkAndOpenGate(state, directionArriving) {
+			t.Error("Expected the arriving cooldown to still hold")
+		}
+		if remaining := app.cooldownRemaining(state, directionLeaving); remaining != 4*time.Minute {
+			t.Errorf("Expected the leaving cooldown to count from the departure, %v remaining", remaining)
+		}
+	})
+
+	t.Run("Unset cooldowns use the open duration", func(t *testing.T) {
+		app, state, now := newApp(t)
+		app.Config.Gate.ArrivingCooldown = 0
+		if !app.checkAndOpenGate(state, directionArriving) {
+			t.Fatal("Expected the first arrival to open")
+		}
+
+		*now = now.Add(5 * time.Minute)
+		if app.checkAndOpenGate(state, directionArriving) {
+			t.Error("Expected open_duration to be the arriving cooldown")
+		}
+		*now = now.Add(5 * time.Minute)
+		if !app.checkAndOpenGate(state, directionArriving) {
+			t.Error("Expected an arrival after open_duration to open")
+		}
+	})
+}
+
+func TestMaintenanceWindowPausesPolling(t *testing.T) {
+	app := newTestApp(t)
+	markConfigured(app)
+	app.isMonitoring = true
+	app.Config.UniFi.MaintenanceWindows = []config.MaintenanceWindow{{Start: "03:00", End: "03:30"}}
+
+	mock := newMockController(t)
+	mock.Clients = []map[string]interface{}{mockClient("aa:bb:cc:dd:ee:01", testInteriorAP)}
+	app.UniFiClient = app.newUniFiClient(mock.Server.URL, "user", "pass")
+	if err := app.UniFiClient.Login(); err != nil {
+		t.Fatalf("Failed to login to mock controller: %v", err)
+	}
+
+	now := time.Date(2024, 6, 2, 3, 10, 0, 0, time.Local)
+	app.now = func() time.Time { return now }
+
+	// Inside the window the controller isn't asked, even though it would fail
+	mock.FailClients = true
+	app.pollUniFi()
+
+	if state, _ := app.monitoringState(); state != monitoringMaintenance {
+		t.Errorf("Expected state %s inside the window, got %s", monitoringMaintenance, state)
+	}
+	if app.lastPollErr != nil || app.lastClients != nil {
+		t.Errorf("No poll should happen inside the window, got clients %v, error %v", app.lastClients, app.lastPollErr)
+	}
+
+	// After the window polling resumes
+	mock.FailClients = false
+	now = now.Add(30 * time.Minute)
+	app.pollUniFi()
+
+	if state, _ := app.monitoringState(); state != monitoringRunning {
+		t.Errorf("Expected state %s after the window, got %s", monitoringRunning, state)
+	}
+	if len(app.lastClients) != 1 {
+		t.Errorf("Expected a poll after the window, got %d clients", len(app.lastClients))
+	}
+}
+
+func TestMonitoringRequiresGateAP(t *testing.T) {
+	for _, gateAP := range []string{"", "  ", "not-a-mac"} {
+		t.Run(fmt.Sprintf("Gate AP %q", gateAP), func(t *testing.T) {
+			app := newTestApp(t)
+			markConfigured(app)
+			app.Config.UniFi.GateAPMAC = gateAP
+
+			// Returns right away instead of entering the polling loop
+			app.StartMonitoring()
+
+			if app.isMonitoring {
+				t.Error("Monitoring should not have started")
+			}
+			if state, _ := app.monitoringState(); state != monitoringNoGateAP {
+				t.Errorf("Expected state %s, got %s", monitoringNoGateAP, state)
+			}
+		})
+	}
+
+	t.Run("Valid gate AP", func(t *testing.T) {
+		for _, gateAP := range []string{testGateAP, "AA-BB-CC-DD-EE-FF"} {
+			if err := validateGateAP(gateAP); err != nil {
+				t.Errorf("Expected %q to be valid, got %v", gateAP, err)
+			}
+		}
+	})
+}
+
+func TestStartMonitoringLogsInFirst(t *testing.T) {
+	// start runs monitoring against the mock and returns a function that
+	// stops it and waits for it to return
+	start := func(t *testing.T, mock *mockController) (*App, func()) {
+		app := newTestApp(t)
+		markConfigured(app)
+		app.UniFiClient = app.newUniFiClient(mock.Server.URL, "user", "pass")
+
+		done := make(chan struct{})
+		go func() {
+			app.StartMonitoring()
+			close(done)
+		}()
+
+		return app, func() {
+			app.StopMonitoring()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Monitoring did not stop")
+			}
+		}
+	}
+
+	t.Run("No poll while login fails", func(t *testing.T) {
+		mock := newMockController(t)
+		mock.FailLogin = true
+		app, stop := start(t, mock)
+
+		time.Sleep(1500 * time.Millisecond) // past the first retry
+		stop()
+
+		if got := atomic.LoadInt32(&mock.ClientRequests); got != 0 {
+			t.Errorf("Expected no client requests before login, got %d", got)
+		}
+		if app.lastPollErr == nil {
+			t.Error("Expected the failed login to be reported")
+		}
+	})
+
+	t.Run("Polls once logged in", func(t *testing.T) {
+		mock := newMockController(t)
+		_, stop := start(t, mock)
+		defer stop()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadInt32(&mock.ClientRequests) == 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("Expected a poll after logging in")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+func TestConfirmPolls(t *testing.T) {
+	atGate := []unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 5}}
+	inside := []unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testInteriorAP, Uptime: 500}}
+
+	newConfirmApp := func(t *testing.T, polls int) (*App, *int32) {
+		app := newTestApp(t)
+		app.Config.Gate.ConfirmPolls = polls
+		trackDevice(app, testDeviceMAC, "Phone")
+		return app, newTestRelay(t, app)
+	}
+
+	tests := []struct {
+		name  string
+		polls int
+		seen  [][]unifi.WirelessClient
+		want  int32
+	}{
+		{"One poll opens by default", 1, [][]unifi.WirelessClient{atGate}, 1},
+		{"Zero behaves like one", 0, [][]unifi.WirelessClient{atGate}, 1},
+		{"Drive-by doesn't open", 2, [][]unifi.WirelessClient{atGate, nil}, 0},
+		{"Two polls at the gate open", 2, [][]unifi.WirelessClient{atGate, atGate}, 1},
+		// The pending open is dropped, the roam from the gate opens on its own
+		{"Moving inside opens once", 2, [][]unifi.WirelessClient{atGate, inside, inside}, 1},
+		{"Counter restarts after leaving", 3, [][]unifi.WirelessClient{atGate, atGate, nil, atGate, atGate}, 0},
+		{"Three polls open once", 3, [][]unifi.WirelessClient{atGate, atGate, atGate, atGate}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, hits := newConfirmApp(t, tt.polls)
+
+			for _, clients := range tt.seen {
+				app.processClients(clients)
+			}
+
+			if got := atomic.LoadInt32(hits); got != tt.want {
+				t.Errorf("Expected %d opens, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGateDebounce(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Gate.LogActivity = true
+	hits := newTestRelay(t, app)
+	app.GateController.SetDebounce(time.Minute)
+	state := trackDevice(app, testDeviceMAC, "Phone")
+
+	// A manual open and an arrival in the same instant
+	w, resp := postJSON(t, app.TestGateHandler, "/api/test-gate", nil)
+	if w.Code != http.StatusOK || resp["debounced"] != nil {
+		t.Fatalf("Expected a plain manual open, got %d: %v", w.Code, resp)
+	}
+	if !app.checkAndOpenGate(state, directionArriving) {
+		t.Error("Expected the debounced automatic open to count as opened")
+	}
+
+	if got := atomic.LoadInt32(hits); got != 1 {
+		t.Errorf("Expected 1 trigger at the relay, got %d", got)
+	}
+	if state.LastGateTrigger.IsZero() {
+		t.Error("A debounced open should start the device's cooldown")
+	}
+
+	logs, err := app.DB.GetLogs(10, 0)
+	if err != nil {
+		t.Fatalf("Failed to get logs: %v", err)
+	}
+	if len(logs) == 0 || logs[0].Event != "gate_triggered" || logs[0].DeviceMAC != testDeviceMAC || !logs[0].GateOpened {
+		t.Errorf("Expected the debounced open to be logged as the device's open, got %+v", logs)
+	}
+
+	// Clicking again is reported, not treated as an error
+	w, resp = postJSON(t, app.TestGateHandler, "/api/test-gate", nil)
+	if w.Code != http.StatusOK || resp["debounced"] != true {
+		t.Errorf("Expected a debounced manual open, got %d: %v", w.Code, resp)
+	}
+}
+
+func TestDebouncedCarload(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Gate.LogActivity = true
+	hits := newTestRelay(t, app)
+	app.GateController.SetDebounce(time.Minute)
+	notifier := &recordingNotifier{}
+	app.Notifier = notifier
+	app.Config.Notifications.Events = []string{"arrived"}
+	driver := trackDevice(app, testDeviceMAC, "Dad")
+	passenger := trackDevice(app, "AA:BB:CC:DD:EE:02", "Kid")
+
+	// Both phones in the car reach the gate in the same poll
+	app.processClients([]unifi.WirelessClient{
+		{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 5},
+		{MAC: "aa:bb:cc:dd:ee:02", AP_MAC: testGateAP, Uptime: 5},
+	})
+	app.notifying.Wait()
+
+	if got := atomic.LoadInt32(hits); got != 1 {
+		t.Errorf("Expected 1 trigger at the relay, got %d", got)
+	}
+	if driver.LastGateTrigger.IsZero() || passenger.LastGateTrigger.IsZero() {
+		t.Error("Expected both devices to be recorded as let through")
+	}
+	opens, _, err := app.DB.GetLogsFiltered(database.LogFilter{Event: "gate_triggered"})
+	if err != nil {
+		t.Fatalf("Failed to get logs: %v", err)
+	}
+	if len(opens) != 2 {
+		t.Errorf("Expected an open logged per device, got %+v", opens)
+	}
+	if got := len(notifier.sent()); got != 2 {
+		t.Errorf("Expected both arrivals to be notified, got %d", got)
+	}
+}
+
+func TestDryOpenGate(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Gate.LogActivity = true
+	hits := newTestRelay(t, app)
+	app.Config.Shelly.Method = "POST"
+	app.Config.Shelly.Body = "turn=on"
+	app.Config.Shelly.BearerToken = "abc123"
+	app.GateController = app.newGateController()
+
+	var echoed *http.Request
+	var echoedBody string
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		echoed, echoedBody = r, string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(echo.Close)
+	app.Config.Shelly.DryOpenURL = echo.URL
+
+	w, resp := postJSON(t, app.TestGateHandler, "/api/test-gate?dry=true", nil)
+	if w.Code != http.StatusOK || resp["success"] != true || resp["dry"] != true {
+		t.Fatalf("Expected a successful dry open, got %d: %v", w.Code, resp)
+	}
+	if echoed == nil || echoed.Method != "POST" || echoed.Header.Get("Authorization") != "Bearer abc123" ||
+		echoed.Header.Get("Content-Type") != "application/x-www-form-urlencoded" || echoedBody != "turn=on" {
+		t.Errorf("Expected the open request at the echo endpoint, got %v %q", echoed, echoedBody)
+	}
+	request, _ := resp["request"].(map[string]interface{})
+	if headers, _ := request["headers"].(map[string]interface{}); headers["Authorization"] != "Bearer [redacted]" {
+		t.Errorf("Expected the token to be redacted, got %v", request["headers"])
+	}
+
+	if got := atomic.LoadInt32(hits); got != 0 {
+		t.Errorf("Expected the relay not to be triggered, got %d requests", got)
+	}
+	if logs, _ := app.DB.GetLogs(10, 0); len(logs) != 0 {
+		t.Errorf("Expected nothing logged for a dry open, got %+v", logs)
+	}
+
+	t.Run("In the body", func(t *testing.T) {
+		echoed = nil
+		w, _ := postJSON(t, app.TestGateHandler, "/api/test-gate", map[string]bool{"dry": true})
+		if w.Code != http.StatusOK || echoed == nil {
+			t.Errorf("Expected a dry open, got %d", w.Code)
+		}
+	})
+
+	t.Run("Not for closes", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		app.TestGateHandler(w, httptest.NewRequest("POST", "/api/test-gate?dry=true", strings.NewReader(`{"action":"close"}`)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("Refused without a dry open URL", func(t *testing.T) {
+		app.Config.Shelly.DryOpenURL = ""
+		w := httptest.NewRecorder()
+		app.TestGateHandler(w, httptest.NewRequest("POST", "/api/test-gate?dry=true", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+		if got := atomic.LoadInt32(hits); got != 0 {
+			t.Errorf("Expected the relay not to be sent anything, got %d requests", got)
+		}
+	})
+}
+
+func TestEnforceDatabaseLimits(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Database.MaxLogRows = 3
+	for i := 0; i < 5; i++ {
+		if err := app.DB.LogEvent(&database.LogEntry{DeviceMAC: testDeviceMAC, Event: "connected", Message: fmt.Sprintf("Entry %d", i)}); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+
+	app.cleanupOldLogs()
+
+	logs, err := app.DB.GetLogs(10, 0)
+	if err != nil {
+		t.Fatalf("Failed to get logs: %v", err)
+	}
+	if len(logs) != 3 || logs[0].Message != "Entry 4" {
+		t.Errorf("Expected the 3 newest logs, got %+v", logs)
+	}
+}
+
+func TestLogRetention(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Database.LogRetentionDays = 7
+	app.Config.Database.GateOpenRetentionDays = 90
+	for _, entry := range []struct {
+		event string
+		days  int
+	}{{"connected", 10}, {"gate_triggered", 10}, {"gate_triggered", 100}} {
+		if _, err := app.DB.Exec(`
+			INSERT INTO logs (device_mac, device_name, event, direction, message, timestamp)
+			VALUES (?, 'Phone', ?, '', '', datetime('now', '-' || ? || ' days'))
+		`, testDeviceMAC, entry.event, entry.days); err != nil {
+			t.Fatalf("Failed to insert log: %v", err)
+		}
+	}
+
+	app.cleanupOldLogs()
+
+	logs, err := app.DB.GetLogs(10, 0)
+	if err != nil {
+		t.Fatalf("Failed to get logs: %v", err)
+	}
+	if len(logs) != 1 || logs[0].Event != "gate_triggered" {
+		t.Errorf("Expected only the gate opening within 90 days kept, got %+v", logs)
+	}
+}
+
+func TestCloseGate(t *testing.T) {
+	newCloseApp := func(t *testing.T) (*App, *[]string) {
+		app := newTestApp(t)
+		var mu sync.Mutex
+		var paths []string
+		relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			paths = append(paths, r.URL.Path)
+			mu.Unlock()
+			w.WriteHeader(http.StatusOK)
+		}))
+		t.Cleanup(relay.Close)
+
+		app.Config.Shelly.TriggerURL = relay.URL + "/open"
+		app.Config.Shelly.CloseURL = relay.URL + "/close"
+		app.GateController = app.newGateController()
+		return app, &paths
+	}
+
+	t.Run("Manual close", func(t *testing.T) {
+		app, paths := newCloseApp(t)
+
+		w, resp := postJSON(t, app.TestGateHandler, "/api/test-gate", map[string]string{"action": "close"})
+		if w.Code != http.StatusOK || resp["success"] != true {
+			t.Fatalf("Expected a successful close, got %d: %v", w.Code, resp)
+		}
+		if len(*paths) != 1 || (*paths)[0] != "/close" {
+			t.Errorf("Expected one request to /close, got %v", *paths)
+		}
+	})
+
+	t.Run("Manual close without a close URL", func(t *testing.T) {
+		app, paths := newCloseApp(t)
+		app.GateController.UpdateCloseURL("")
+
+		w := httptest.NewRecorder()
+		app.TestGateHandler(w, httptest.NewRequest("POST", "/api/test-gate", strings.NewReader(`{"action":"close"}`)))
+		if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "not configured") {
+			t.Errorf("Expected a not configured error, got %d: %s", w.Code, w.Body.String())
+		}
+		if len(*paths) != 0 {
+			t.Errorf("Expected no requests, got %v", *paths)
+		}
+	})
+
+	t.Run("Unknown action", func(t *testing.T) {
+		app, _ := newCloseApp(t)
+
+		w := httptest.NewRecorder()
+		app.TestGateHandler(w, httptest.NewRequest("POST", "/api/test-gate", strings.NewReader(`{"action":"toggle"}`)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("Closes behind a device leaving at the gate", func(t *testing.T) {
+		app, paths := newCloseApp(t)
+		app.Config.Gate.CloseOnDeparture = true
+		state := trackDevice(app, testDeviceMAC, "Phone")
+		state.IsConnected = true
+		state.CurrentAP = testGateAP
+
+		app.processClients(nil)
+
+		if len(*paths) != 1 || (*paths)[0] != "/close" {
+			t.Errorf("Expected one request to /close, got %v", *paths)
+		}
+	})
+
+	t.Run("Stays open when disabled", func(t *testing.T) {
+		app, paths := newCloseApp(t)
+		state := trackDevice(app, testDeviceMAC, "Phone")
+		state.IsConnected = true
+		state.CurrentAP = testGateAP
+
+		app.processClients(nil)
+
+		if len(*paths) != 0 {
+			t.Errorf("Expected no requests, got %v", *paths)
+		}
+	})
+}
+
+func TestMultipleGates(t *testing.T) {
+	app := newTestApp(t)
+	now := time.Date(2024, 5, 1, 17, 0, 0, 0, time.Local)
+	app.now = func() time.Time { return now }
+	app.Config.Gate.OpenDuration = 10
+
+	mainHits := newTestRelay(t, app)
+	var garageHits int32
+	garage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&garageHits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(garage.Close)
+	app.Config.Gates = []config.RelayConfig{{Name: "Garage", TriggerURL: garage.URL, OpenDuration: 2}}
+
+	phone := trackDevice(app, testDeviceMAC, "Phone")
+	car := trackDevice(app, "AA:BB:CC:DD:EE:02", "Car")
+	car.Gate = "Garage"
+
+	if !app.checkAndOpenGate(phone, directionArriving) || !app.checkAndOpenGate(car, directionArriving) {
+		t.Fatal("Expected both gates to open")
+	}
+	if atomic.LoadInt32(mainHits) != 1 || atomic.LoadInt32(&garageHits) != 1 {
+		t.Fatalf("Expected one trigger per gate, got main %d, garage %d", atomic.LoadInt32(mainHits), atomic.LoadInt32(&garageHits))
+	}
+
+	// Each gate's open duration is its devices' cooldown
+	now = now.Add(3 * time.Minute)
+	if app.checkAndOpenGate(phone, directionArriving) {
+		t.Error("Expected the main gate's cooldown to still be running")
+	}
+	if !app.checkAndOpenGate(car, directionArriving) {
+		t.Error("Expected the garage's shorter cooldown to have passed")
+	}
+	if got := atomic.LoadInt32(&garageHits); got != 2 {
+		t.Errorf("Expected 2 garage triggers, got %d", got)
+	}
+
+	t.Run("Unknown gate falls back to the primary one", func(t *testing.T) {
+		ghost := trackDevice(app, "AA:BB:CC:DD:EE:03", "Ghost")
+		ghost.Gate = "Removed"
+
+		if !app.checkAndOpenGate(ghost, directionArriving) {
+			t.Fatal("Expected the gate to open")
+		}
+		if got := atomic.LoadInt32(mainHits); got != 2 {
+			t.Errorf("Expected the main gate to open, got %d triggers", got)
+		}
+	})
+}
+
+func TestObserveOnly(t *testing.T) {
+	app := newTestApp(t)
+	now := time.Date(2024, 5, 1, 17, 0, 0, 0, time.Local)
+	app.now = func() time.Time { return now }
+	app.Config.Gate.ObserveOnly = true
+	app.Config.Gate.OpenDuration = 10
+	hits := newTestRelay(t, app)
+	notifier := &recordingNotifier{}
+	app.Notifier = notifier
+	app.Config.Notifications.Events = []string{"arrived"}
+	state := trackDevice(app, testDeviceMAC, "Phone")
+
+	arrive := func() {
+		app.processClients([]unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 5}})
+		app.processClients(nil)
+	}
+
+	arrive()
+	now = now.Add(time.Minute)
+	arrive()
+	app.notifying.Wait()
+
+	if got := atomic.LoadInt32(hits); got != 0 {
+		t.Errorf("Expected the relay to never be triggered, got %d", got)
+	}
+	if len(notifier.sent()) != 0 {
+		t.Errorf("Expected no notifications, got %+v", notifier.sent())
+	}
+
+	// Logged without activity logging, and the second arrival falls into
+	// the cooldown the first would have started
+	logs, err := app.DB.GetLogs(10, 0)
+	if err != nil {
+		t.Fatalf("Failed to get logs: %v", err)
+	}
+	var observed []database.LogEntry
+	for _, entry := range logs {
+		if entry.Event == "would_open" {
+			observed = append(observed, entry)
+		}
+	}
+	if len(observed) != 1 {
+		t.Fatalf("Expected 1 would-open event, got %+v", logs)
+	}
+	if entry := observed[0]; entry.GateOpened || entry.Direction != directionArriving || !strings.Contains(entry.Message, "No cooldown active") {
+		t.Errorf("Expected an arrival with its reason, got %+v", entry)
+	}
+	if lastTrigger, err := app.DB.GetLastGateTrigger(testDeviceMAC); err != nil || !lastTrigger.IsZero() {
+		t.Errorf("Expected no stored cooldown, got %v (%v)", lastTrigger, err)
+	}
+
+	t.Run("Opens again once turned off", func(t *testing.T) {
+		app.Config.Gate.ObserveOnly = false
+		state.clearTriggers()
+
+		if !app.checkAndOpenGate(state, directionArriving) {
+			t.Fatal("Expected the gate to open")
+		}
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected 1 trigger, got %d", got)
+		}
+	})
+}
+
+func TestPreOpenDelay(t *testing.T) {
+	type timer struct {
+		delay   time.Duration
+		fire    func()
+		stopped bool
+	}
+
+	newDelayedApp := func(t *testing.T) (*App, *int32, *[]*timer) {
+		app := newTestApp(t)
+		app.Config.Gate.LogActivity = true
+		app.Config.Gate.PreOpenDelay = 5
+		hits := newTestRelay(t, app)
+
+		var timers []*timer
+		app.afterFunc = func(d time.Duration, f func()) func() bool {
+			tm := &timer{delay: d, fire: f}
+			timers = append(timers, tm)
+			return func() bool {
+				tm.stopped = true
+				return true
+			}
+		}
+		trackDevice(app, testDeviceMAC, "Car")
+		return app, hits, &timers
+	}
+	at := func(ap string) []unifi.WirelessClient {
+		return []unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: ap, Uptime: 5}}
+	}
+
+	t.Run("Opens once the delay passes", func(t *testing.T) {
+		app, hits, timers := newDelayedApp(t)
+
+		app.processClients(at(testGateAP))
+		if got := atomic.LoadInt32(hits); got != 0 {
+			t.Fatalf("Expected no open before the delay, got %d", got)
+		}
+		if len(*timers) != 1 || (*timers)[0].delay != 5*time.Second {
+			t.Fatalf("Expected a 5s timer, got %+v", *timers)
+		}
+
+		// Still at the gate on the next poll, the timer isn't restarted
+		app.processClients(at(testGateAP))
+		if len(*timers) != 1 {
+			t.Errorf("Expected the first timer to stand, got %d timers", len(*timers))
+		}
+
+		(*timers)[0].fire()
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected the gate to open after the delay, got %d", got)
+		}
+		if app.deviceStates[testDeviceMAC].LastGateTrigger.IsZero() {
+			t.Error("Expected the cooldown to start")
+		}
+	})
+
+	for _, tt := range []struct {
+		name    string
+		next    []unifi.WirelessClient
+		message string
+	}{
+		{"Roaming away cancels", at(testInteriorAP), "Delayed open cancelled, device moved away from the gate"},
+		{"Disconnecting cancels", nil, "Delayed open cancelled, device disconnected"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			app, hits, timers := newDelayedApp(t)
+
+			app.processClients(at(testGateAP))
+			app.processClients(tt.next)
+			if len(*timers) != 1 || !(*timers)[0].stopped {
+				t.Fatalf("Expected the timer to be stopped, got %+v", *timers)
+			}
+
+			// A timer that fired anyway, racing the cancel, does nothing. Going
+			// on inside from the gate opens by itself, that's not the timer.
+			before := atomic.LoadInt32(hits)
+			(*timers)[0].fire()
+			if got := atomic.LoadInt32(hits); got != before {
+				t.Errorf("Expected no open from the timer, got %d more", got-before)
+			}
+
+			logs, err := app.DB.GetLogs(10, 0)
+			if err != nil {
+				t.Fatalf("Failed to get logs: %v", err)
+			}
+			var cancelled bool
+			for _, entry := range logs {
+				cancelled = cancelled || (entry.Event == "gate_skipped" && entry.Message == tt.message)
+			}
+			if !cancelled {
+				t.Errorf("Expected the cancellation to be logged, got %+v", logs)
+			}
+		})
+	}
+
+	t.Run("No delay opens right away", func(t *testing.T) {
+		app, hits, timers := newDelayedApp(t)
+		app.Config.Gate.PreOpenDelay = 0
+
+		app.processClients(at(testGateAP))
+		if got := atomic.LoadInt32(hits); got != 1 || len(*timers) != 0 {
+			t.Errorf("Expected an immediate open without timers, got %d opens, %d timers", got, len(*timers))
+		}
+	})
+}
+
+func TestLogMessageTemplates(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Gate.LogActivity = true
+	app.Config.LogMessages = map[string]string{
+		"gate_triggered": "Tor geöffnet für {device} ({direction})",
+		"connected":      "{device} an {ap}: {message}",
+	}
+	newTestRelay(t, app)
+	trackDevice(app, testDeviceMAC, "Auto")
+
+	app.processClients([]unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 5}})
+
+	logs, err := app.DB.GetLogs(10, 0)
+	if err != nil {
+		t.Fatalf("Failed to get logs: %v", err)
+	}
+	messages := map[string]string{}
+	for _, entry := range logs {
+		messages[entry.Event] = entry.Message
+	}
+
+	if got := messages["gate_triggered"]; got != "Tor geöffnet für Auto (arriving)" {
+		t.Errorf("Expected the rendered gate_triggered template, got %q", got)
+	}
+	if got, want := messages["connected"], "Auto an "+testGateAP+": Device connected to network"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	t.Run("Events without a template keep the default", func(t *testing.T) {
+		delete(app.Config.LogMessages, "gate_triggered")
+		state := app.deviceStates[testDeviceMAC]
+		state.clearTriggers()
+		app.checkAndOpenGate(state, directionArriving)
+
+		logs, err := app.DB.GetLogs(1, 0)
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		if len(logs) != 1 || logs[0].Message != "Gate opened successfully" {
+			t.Errorf("Expected the default message, got %+v", logs)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/fbettag/unifi-gate-opener/internal/unifi"
+)
+
+// apStats summarizes the clients associated with one access point
+type apStats struct {
+	APMAC          string   `json:"ap_mac"`
+	IsGate         bool     `json:"is_gate"`
+	Clients        int      `json:"clients"`
+	TrackedDevices int      `json:"tracked_devices"`
+	AvgSignal      *float64 `json:"avg_signal"` // dBm over tracked devices, null without any
+}
+
+// Per-AP client counts and signal, from a single clients fetch
+func (app *App) GetAccessPointStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if app.UniFiClient == nil {
+		http.Error(w, "UniFi not configured", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.UniFiClient.EnsureLoggedIn(); err != nil {
+		http.Error(w, "Failed to connect to UniFi", http.StatusInternalServerError)
+		return
+	}
+
+	clients, err := app.UniFiClient.GetActiveClients(app.Config.UniFi.SiteID)
+	if err != nil {
+		http.Error(w, "Failed to get clients", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(app.accessPointStats(clients)); err != nil {
+		app.Logger.Errorf("Failed to encode AP stats: %v", err)
+	}
+}
+
+// accessPointStats groups clients by AP, busiest first
+func (app *App) accessPointStats(clients []unifi.WirelessClient) []apStats {
+	tracked := make(map[string]bool, len(app.Config.Devices))
+	for _, device := range app.Config.Devices {
+		if device.Enabled {
+			tracked[strings.ToUpper(device.MAC)] = true
+		}
+	}
+
+	byAP := make(map[string]*apStats)
+	signalSums := make(map[string]int)
+	for _, client := range clients {
+		apMAC := strings.ToLower(client.AP_MAC)
+		stats, ok := byAP[apMAC]
+		if !ok {
+			stats = &apStats{
+				APMAC:  apMAC,
+				IsGate: strings.EqualFold(apMAC, app.Config.UniFi.GateAPMAC),
+			}
+			byAP[apMAC] = stats
+		}
+
+		stats.Clients++
+		if tracked[strings.ToUpper(client.MAC)] {
+			stats.TrackedDevices++
+			signalSums[apMAC] += client.Signal
+		}
+	}
+
+	result := make([]apStats, 0, len(byAP))
+	for apMAC, stats := range byAP {
+		if stats.TrackedDevices > 0 {
+			avg := float64(signalSums[apMAC]) / float64(stats.TrackedDevices)
+			stats.AvgSignal = &avg
+		}
+		result = append(result, *stats)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Clients != result[j].Clients {
+			return result[i].Clients > result[j].Clients
+		}
+		return result[i].APMAC < result[j].APMAC
+	})
+	return result
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+)
+
+func TestGetAccessPointStatsHandler(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Devices = []config.DeviceConfig{
+		{MAC: "AA:BB:CC:DD:EE:01", Name: "Phone", Enabled: true},
+		{MAC: "AA:BB:CC:DD:EE:02", Name: "Watch", Enabled: true},
+		{MAC: "AA:BB:CC:DD:EE:03", Name: "Old Phone", Enabled: false},
+	}
+
+	client := func(mac, ap string, signal int) map[string]interface{} {
+		c := mockClient(mac, ap)
+		c["signal"] = signal
+		return c
+	}
+
+	mock := newMockController(t)
+	mock.Clients = []map[string]interface{}{
+		client("aa:bb:cc:dd:ee:01", testGateAP, -60),
+		client("aa:bb:cc:dd:ee:02", testGateAP, -70),
+		client("aa:bb:cc:dd:ee:03", testGateAP, -40), // disabled, not tracked
+		client("aa:bb:cc:dd:ee:04", testInteriorAP, -50),
+	}
+	app.UniFiClient = app.newUniFiClient(mock.Server.URL, "user", "pass")
+
+	w := httptest.NewRecorder()
+	app.GetAccessPointStatsHandler(w, httptest.NewRequest("GET", "/api/unifi/aps/stats", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var stats []apStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("Expected 2 access points, got %d: %+v", len(stats), stats)
+	}
+
+	gate := stats[0]
+	if gate.APMAC != testGateAP || !gate.IsGate {
+		t.Errorf("Expected the gate AP first, got %+v", gate)
+	}
+	if gate.Clients != 3 || gate.TrackedDevices != 2 {
+		t.Errorf("Expected 3 clients and 2 tracked devices, got %d and %d", gate.Clients, gate.TrackedDevices)
+	}
+	if gate.AvgSignal == nil || *gate.AvgSignal != -65 {
+		t.Errorf("Expected an average signal of -65, got %v", gate.AvgSignal)
+	}
+
+	interior := stats[1]
+	if interior.APMAC != testInteriorAP || interior.IsGate {
+		t.Errorf("Expected the interior AP second, got %+v", interior)
+	}
+	if interior.Clients != 1 || interior.TrackedDevices != 0 || interior.AvgSignal != nil {
+		t.Errorf("Expected 1 untracked client without a signal average, got %+v", interior)
+	}
+}
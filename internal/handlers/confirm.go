@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// How long a manual open confirmation stays valid
+const openConfirmationTTL = 30 * time.Second
+
+var (
+	errNonceMissing = errors.New("confirmation required")
+	errNonceUnknown = errors.New("confirmation is unknown or was already used")
+	errNonceExpired = errors.New("confirmation expired")
+)
+
+// Issue a manual open confirmation API
+func (app *App) OpenConfirmationHandler(w http.ResponseWriter, r *http.Request) {
+	nonce, expiresAt, err := app.issueOpenNonce()
+	if err != nil {
+		app.Logger.Errorf("Failed to create open confirmation: %v", err)
+		http.Error(w, "Failed to create confirmation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"nonce":      nonce,
+		"expires_at": expiresAt,
+	}); err != nil {
+		app.Logger.Errorf("Failed to encode response: %v", err)
+	}
+}
+
+// issueOpenNonce creates a single-use nonce for one manual open
+func (app *App) issueOpenNonce() (string, time.Time, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	nonce := hex.EncodeToString(b)
+
+	now := app.clock()
+	expiresAt := now.Add(openConfirmationTTL)
+
+	app.openNoncesMu.Lock()
+	defer app.openNoncesMu.Unlock()
+
+	if app.openNonces == nil {
+		app.openNonces = make(map[string]time.Time)
+	}
+	// Drop nonces that were never used
+	for n, expiry := range app.openNonces {
+		if now.After(expiry) {
+			delete(app.openNonces, n)
+		}
+	}
+	app.openNonces[nonce] = expiresAt
+
+	return nonce, expiresAt, nil
+}
+
+// consumeOpenNonce accepts a nonce once, so a replayed request can't open
+// the gate again
+func (app *App) consumeOpenNonce(nonce string) error {
+	if nonce == "" {
+		return errNonceMissing
+	}
+
+	app.openNoncesMu.Lock()
+	defer app.openNoncesMu.Unlock()
+
+	expiresAt, ok := app.openNonces[nonce]
+	if !ok {
+		return errNonceUnknown
+	}
+	delete(app.openNonces, nonce)
+
+	if app.clock().After(expiresAt) {
+		return errNonceExpired
+	}
+	return nil
+}
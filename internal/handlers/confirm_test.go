@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOpenConfirmation(t *testing.T) {
+	// newApp returns an app that requires confirmations, with a clock the
+	// test can move
+	newApp := func(t *testing.T) (*App, *int32, *time.Time) {
+		app := newTestApp(t)
+		app.Config.Gate.RequireOpenConfirmation = true
+		hits := newTestRelay(t, app)
+		now := time.Now()
+		app.now = func() time.Time { return now }
+		return app, hits, &now
+	}
+
+	issue := func(t *testing.T, app *App) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.OpenConfirmationHandler(w, httptest.NewRequest("POST", "/api/test-gate/confirm", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		var resp struct {
+			Nonce string `json:"nonce"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Nonce == "" {
+			t.Fatalf("Expected a nonce, got %q (%v)", w.Body.String(), err)
+		}
+		return resp.Nonce
+	}
+
+	open := func(app *App, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		app.TestGateHandler(w, httptest.NewRequest("POST", "/api/test-gate", strings.NewReader(body)))
+		return w
+	}
+
+	t.Run("Valid nonce opens the gate", func(t *testing.T) {
+		app, hits, _ := newApp(t)
+
+		if w := open(app, `{"nonce":"`+issue(t, app)+`"}`); w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected 1 trigger, got %d", got)
+		}
+	})
+
+	t.Run("Expired nonce is rejected", func(t *testing.T) {
+		app, hits, now := newApp(t)
+		nonce := issue(t, app)
+
+		*now = now.Add(openConfirmationTTL + time.Second)
+		if w := open(app, `{"nonce":"`+nonce+`"}`); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+		if got := atomic.LoadInt32(hits); got != 0 {
+			t.Errorf("Expected no trigger, got %d", got)
+		}
+	})
+
+	t.Run("Replayed nonce is rejected", func(t *testing.T) {
+		app, hits, _ := newApp(t)
+		body := `{"nonce":"` + issue(t, app) + `"}`
+
+		if w := open(app, body); w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		if w := open(app, body); w.Code != http.StatusForbidden {
+			t.Errorf("Replay: expected status 403, got %d", w.Code)
+		}
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected 1 trigger, got %d", got)
+		}
+	})
+
+	t.Run("Missing or unknown nonce is rejected", func(t *testing.T) {
+		app, hits, _ := newApp(t)
+
+		for _, body := range []string{"", `{}`, `{"nonce":"made-up"}`} {
+			if w := open(app, body); w.Code != http.StatusForbidden {
+				t.Errorf("%q: expected status 403, got %d", body, w.Code)
+			}
+		}
+		if got := atomic.LoadInt32(hits); got != 0 {
+			t.Errorf("Expected no trigger, got %d", got)
+		}
+	})
+
+	t.Run("Not required by default", func(t *testing.T) {
+		app, hits, _ := newApp(t)
+		app.Config.Gate.RequireOpenConfirmation = false
+
+		if w := open(app, ""); w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected 1 trigger, got %d", got)
+		}
+	})
+
+	t.Run("Expired nonces are pruned", func(t *testing.T) {
+		app, _, now := newApp(t)
+		issue(t, app)
+		issue(t, app)
+
+		*now = now.Add(openConfirmationTTL + time.Second)
+		issue(t, app)
+		if len(app.openNonces) != 1 {
+			t.Errorf("Expected only the fresh nonce to remain, got %d", len(app.openNonces))
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+)
+
+// LoadDevices reads the tracked devices from the database into the config.
+// Devices from config.yaml are copied into an empty database first, so
+// upgrading from a version that only kept them in config.yaml loses none.
+func (app *App) LoadDevices() error {
+	stored, err := app.DB.ListDevices()
+	if err != nil {
+		return fmt.Errorf("failed to load devices: %w", err)
+	}
+
+	if len(stored) == 0 && len(app.Config.Devices) > 0 {
+		records := make([]database.Device, len(app.Config.Devices))
+		for i, device := range app.Config.Devices {
+			records[i] = deviceRecord(device)
+		}
+		if err := app.DB.ReplaceDevices(records); err != nil {
+			return fmt.Errorf("failed to migrate devices from the config: %w", err)
+		}
+		app.Logger.Infof("Migrated %d devices from the config into the database", len(records))
+		return nil
+	}
+
+	devices := make([]config.DeviceConfig, len(stored))
+	for i, record := range stored {
+		devices[i] = deviceFromRecord(record)
+	}
+	app.Config.Devices = devices
+	app.Config.NormalizeDeviceMACs()
+	return nil
+}
+
+// storeDevice writes a device's settings to the database, adding it if the
+// database doesn't have it yet
+func (app *App) storeDevice(device config.DeviceConfig) error {
+	record := deviceRecord(device)
+	err := app.DB.UpdateDevice(&record)
+	if errors.Is(err, database.ErrDeviceNotFound) {
+		err = app.DB.AddDevice(&record)
+	}
+	return err
+}
+
+// deviceRecord converts a device to how the database stores it
+func deviceRecord(device config.DeviceConfig) database.Device {
+	record := database.Device{
+		MAC:            device.MAC,
+		Name:           device.Name,
+		Enabled:        device.Enabled,
+		Gate:           device.Gate,
+		SSID:           device.SSID,
+		BypassCooldown: device.BypassCooldown,
+		ExpectedBy:     device.ExpectedBy,
+		AvatarURL:      device.AvatarURL,
+		Announcement:   device.Announcement,
+		ExpiresAt:      device.ExpiresAt,
+	}
+	if device.Notifications != nil {
+		if prefs, err := json.Marshal(device.Notifications); err == nil {
+			record.Notifications = string(prefs)
+		}
+	}
+	return record
+}
+
+// deviceFromRecord converts a device read from the database
+func deviceFromRecord(record database.Device) config.DeviceConfig {
+	device := config.DeviceConfig{
+		MAC:            record.MAC,
+		Name:           record.Name,
+		Enabled:        record.Enabled,
+		Gate:           record.Gate,
+		SSID:           record.SSID,
+		BypassCooldown: record.BypassCooldown,
+		ExpectedBy:     record.ExpectedBy,
+		Announcement:   record.Announcement,
+		ExpiresAt:      record.ExpiresAt,
+	}
+	// Rows from before avatars were checked on save may hold anything, and
+	// the dashboard loads whatever URL it is given
+	if avatarURL, err := config.NormalizeAvatarURL(record.AvatarURL); err == nil {
+		device.AvatarURL = avatarURL
+	}
+	if record.Notifications != "" {
+		var prefs config.DeviceNotifyConfig
+		if err := json.Unmarshal([]byte(record.Notifications), &prefs); err == nil {
+			device.Notifications = &prefs
+		}
+	}
+	return device
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+)
+
+func TestLoadDevices(t *testing.T) {
+	muted := false
+
+	t.Run("Config devices are migrated into an empty database", func(t *testing.T) {
+		app := newTestApp(t)
+		app.Config.Devices = []config.DeviceConfig{
+			{MAC: testDeviceMAC, Name: "Phone", Enabled: true, Gate: "Garage", Notifications: &config.DeviceNotifyConfig{Enabled: &muted}},
+			{MAC: "AA:BB:CC:DD:EE:02", Name: "Car"},
+		}
+
+		if err := app.LoadDevices(); err != nil {
+			t.Fatalf("Failed to load devices: %v", err)
+		}
+		stored, err := app.DB.ListDevices()
+		if err != nil || len(stored) != 2 {
+			t.Fatalf("Expected both devices in the database, got %+v (%v)", stored, err)
+		}
+		phone := deviceFromRecord(stored[0])
+		if phone.Name != "Phone" || !phone.Enabled || phone.Gate != "Garage" ||
+			phone.Notifications == nil || phone.Notifications.Enabled == nil || *phone.Notifications.Enabled {
+			t.Errorf("Expected the phone's settings to survive, got %+v", phone)
+		}
+	})
+
+	t.Run("The database wins over the config", func(t *testing.T) {
+		app := newTestApp(t)
+		if err := app.DB.AddDevice(&database.Device{MAC: testDeviceMAC, Name: "Stored Phone", Enabled: true}); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+		app.Config.Devices = []config.DeviceConfig{{MAC: "AA:BB:CC:DD:EE:02", Name: "Stale Car"}}
+
+		if err := app.LoadDevices(); err != nil {
+			t.Fatalf("Failed to load devices: %v", err)
+		}
+		if len(app.Config.Devices) != 1 || app.Config.Devices[0].Name != "Stored Phone" {
+			t.Errorf("Expected the stored devices, got %+v", app.Config.Devices)
+		}
+	})
+
+	t.Run("Stored avatars that aren't http URLs are dropped", func(t *testing.T) {
+		app := newTestApp(t)
+		app.DB.AddDevice(&database.Device{MAC: testDeviceMAC, Name: "Phone", AvatarURL: `x" onerror="alert(1)`})
+		app.DB.AddDevice(&database.Device{MAC: "AA:BB:CC:DD:EE:02", Name: "Car", AvatarURL: "https://example.com/car.png"})
+
+		if err := app.LoadDevices(); err != nil {
+			t.Fatalf("Failed to load devices: %v", err)
+		}
+		if avatar := app.findDevice(testDeviceMAC).AvatarURL; avatar != "" {
+			t.Errorf("Expected the bad avatar to be dropped, got %q", avatar)
+		}
+		if avatar := app.findDevice("AA:BB:CC:DD:EE:02").AvatarURL; avatar != "https://example.com/car.png" {
+			t.Errorf("Expected the good avatar to stay, got %q", avatar)
+		}
+	})
+}
+
+func TestDeviceHandlersStoreDevices(t *testing.T) {
+	app := newTestApp(t)
+	markConfigured(app)
+	router := app.Routes()
+	cookie := loginCookie(t, app)
+	send := func(method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	stored := func() []database.Device {
+		devices, err := app.DB.ListDevices()
+		if err != nil {
+			t.Fatalf("Failed to list devices: %v", err)
+		}
+		return devices
+	}
+
+	if code := send("POST", "/api/devices", `{"mac":"AA:BB:CC:DD:EE:01","name":"Phone","ssid":"Home"}`); code != http.StatusOK {
+		t.Fatalf("Expected status 200 adding, got %d", code)
+	}
+	if devices := stored(); len(devices) != 1 || devices[0].Name != "Phone" || devices[0].SSID != "Home" || !devices[0].Enabled {
+		t.Fatalf("Expected the device to be stored, got %+v", devices)
+	}
+
+	if code := send("PUT", "/api/devices/AA:BB:CC:DD:EE:01", `{"name":"Car","enabled":false}`); code != http.StatusOK {
+		t.Fatalf("Expected status 200 updating, got %d", code)
+	}
+	if devices := stored(); devices[0].Name != "Car" || devices[0].Enabled || devices[0].SSID != "" {
+		t.Errorf("Expected the update to be stored, got %+v", devices[0])
+	}
+
+	if code := send("DELETE", "/api/devices/AA:BB:CC:DD:EE:01", ""); code != http.StatusOK {
+		t.Fatalf("Expected status 200 deleting, got %d", code)
+	}
+	if devices := stored(); len(devices) != 0 {
+		t.Errorf("Expected the device to be removed, got %+v", devices)
+	}
+}
+
+func TestDeviceHandlersNormalizeMACs(t *testing.T) {
+	app := newTestApp(t)
+	markConfigured(app)
+	router := app.Routes()
+	cookie := loginCookie(t, app)
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, mac := range []string{"", "phone", "aa:bb:cc:dd:ee"} {
+		w := send("POST", "/api/devices", `{"mac":"`+mac+`","name":"Phone"}`)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid MAC address") {
+			t.Errorf("%q: expected status 400 naming the MAC, got %d: %s", mac, w.Code, w.Body.String())
+		}
+	}
+	if len(app.Config.Devices) != 0 {
+		t.Fatalf("Expected no devices, got %+v", app.Config.Devices)
+	}
+
+	if w := send("POST", "/api/devices", `{"mac":"AA-BB-CC-DD-EE-01","name":"Phone"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if mac := app.Config.Devices[0].MAC; mac != "aa:bb:cc:dd:ee:01" {
+		t.Errorf("Expected the MAC to be normalized, got %q", mac)
+	}
+	if w := send("POST", "/api/devices", `{"mac":"AA:BB:CC:DD:EE:01","name":"Phone"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected another spelling of the MAC to be a duplicate, got %d", w.Code)
+	}
+
+	if w := send("PUT", "/api/devices/not-a-mac", `{"name":"Car","enabled":true}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 updating an invalid MAC, got %d", w.Code)
+	}
+	if w := send("PUT", "/api/devices/AABBCCDDEE01", `{"name":"Car","enabled":true}`); w.Code != http.StatusOK {
+		t.Errorf("Expected the update to find the device, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := send("DELETE", "/api/devices/not-a-mac", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 deleting an invalid MAC, got %d", w.Code)
+	}
+	if w := send("DELETE", "/api/devices/AA:BB:CC:DD:EE:01", ""); w.Code != http.StatusOK || len(app.Config.Devices) != 0 {
+		t.Errorf("Expected the device to be deleted, got %d", w.Code)
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+)
+
+// The error page is embedded here rather than with the web templates, so it
+// still works when those are what failed
+//
+//go:embed templates/error.html
+var errorPageFiles embed.FS
+
+// errorPageFS holds templates/error.html, replaceable in tests
+var errorPageFS fs.FS = errorPageFiles
+
+// newRequestID returns a short random ID tying an error page to its log line
+func newRequestID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// renderErrorPage answers a UI request that failed with a friendly page
+// showing requestID, falling back to plain text if that fails too
+func (app *App) renderErrorPage(w http.ResponseWriter, requestID string) {
+	w.Header().Set("X-Request-ID", requestID)
+
+	var page bytes.Buffer
+	tmpl, err := template.ParseFS(errorPageFS, "templates/error.html")
+	if err == nil {
+		err = tmpl.Execute(&page, map[string]string{"RequestID": requestID})
+	}
+	if err != nil {
+		app.Logger.Errorf("Failed to render the error page (request %s): %v", requestID, err)
+		http.Error(w, fmt.Sprintf("Internal server error (request %s)", requestID), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusInternalServerError)
+	if _, err := page.WriteTo(w); err != nil {
+		app.Logger.Debugf("Failed to write the error page: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRenderErrorPage(t *testing.T) {
+	app := newTestApp(t)
+	var logged strings.Builder
+	app.Logger.SetOutput(&logged)
+	app.Logger.SetLevel(logrus.ErrorLevel)
+
+	t.Run("Friendly page with a request ID", func(t *testing.T) {
+		logged.Reset()
+		// The test app has no web templates, so loading any fails
+		w := httptest.NewRecorder()
+		app.renderTemplate(w, "dashboard.html", nil)
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status 500, got %d", w.Code)
+		}
+		if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/html") {
+			t.Errorf("Expected an HTML page, got %q", got)
+		}
+		requestID := w.Header().Get("X-Request-ID")
+		if len(requestID) != 12 {
+			t.Fatalf("Expected a request ID, got %q", requestID)
+		}
+		if body := w.Body.String(); !strings.Contains(body, "Something went wrong") ||
+			!strings.Contains(body, `<code id="request-id" class="font-mono text-gray-900 dark:text-white">`+requestID+"</code>") {
+			t.Errorf("Expected the friendly page with the request ID, got %s", body)
+		}
+		if !strings.Contains(logged.String(), "dashboard.html (request "+requestID+")") {
+			t.Errorf("Expected the failure to be logged with the request ID, got %s", logged.String())
+		}
+	})
+
+	t.Run("Request IDs differ", func(t *testing.T) {
+		first, second := httptest.NewRecorder(), httptest.NewRecorder()
+		app.renderTemplate(first, "login.html", nil)
+		app.renderTemplate(second, "login.html", nil)
+		if first.Header().Get("X-Request-ID") == second.Header().Get("X-Request-ID") {
+			t.Error("Expected a new request ID per failure")
+		}
+	})
+
+	t.Run("Plain text if the error page fails", func(t *testing.T) {
+		saved := errorPageFS
+		defer func() { errorPageFS = saved }()
+		errorPageFS = fstest.MapFS{"templates/error.html": {Data: []byte("{{.RequestID.Missing}}")}}
+
+		w := httptest.NewRecorder()
+		app.renderTemplate(w, "dashboard.html", nil)
+		requestID := w.Header().Get("X-Request-ID")
+		if w.Code != http.StatusInternalServerError || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") ||
+			strings.TrimSpace(w.Body.String()) != "Internal server error (request "+requestID+")" {
+			t.Errorf("Expected a plain text error, got %d %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	})
+}
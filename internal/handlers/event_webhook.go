@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/notify"
+)
+
+// eventWebhookQueue is how many events may wait for a slow event webhook
+// before newer ones are dropped
+const eventWebhookQueue = 100
+
+// gateEvent is what the event webhook receives for every logged event
+type gateEvent struct {
+	DeviceMAC  string    `json:"device_mac"`
+	DeviceName string    `json:"device_name"`
+	Event      string    `json:"event"`
+	Direction  string    `json:"direction"`
+	GateOpened bool      `json:"gate_opened"`
+	Count      int       `json:"count"` // above 1 for repeats folded by log_dedupe_window
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// StartEventWebhook posts every logged event to notifications.event_webhook_url
+// from a single worker with a bounded queue, so a slow endpoint loses events
+// rather than holding up monitoring. The returned function stops it, dropping
+// whatever is still queued.
+func (app *App) StartEventWebhook() func() {
+	url := app.Config.Notifications.EventWebhookURL
+	if url == "" {
+		return func() {}
+	}
+	webhook := notify.NewEventWebhook(url, app.Config.Notifications.EventWebhookSecret)
+
+	events, unsubscribe := app.DB.Subscribe(eventWebhookQueue)
+	stopped := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for entry := range events {
+			select {
+			case <-stopped:
+				return
+			default:
+			}
+
+			if err := webhook.Send(gateEvent{
+				DeviceMAC:  entry.DeviceMAC,
+				DeviceName: entry.DeviceName,
+				Event:      entry.Event,
+				Direction:  entry.Direction,
+				GateOpened: entry.GateOpened,
+				Count:      entry.Count,
+				Timestamp:  entry.Timestamp,
+			}); err != nil {
+				app.Logger.Warnf("Failed to send %s event to the event webhook: %v", entry.Event, err)
+			}
+		}
+	}()
+
+	app.Logger.Info("Sending events to the event webhook")
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopped)
+			unsubscribe()
+			<-done
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+	"github.com/fbettag/unifi-gate-opener/internal/notify"
+)
+
+func TestEventWebhook(t *testing.T) {
+	t.Run("Logged events are posted signed", func(t *testing.T) {
+		app := newTestApp(t)
+		newTestRelay(t, app)
+		received := make(chan *http.Request, 10)
+		bodies := make(chan []byte, 10)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			received <- r
+			bodies <- body
+		}))
+		t.Cleanup(server.Close)
+		app.Config.Gate.LogActivity = true
+		app.Config.Notifications.EventWebhookURL = server.URL
+		app.Config.Notifications.EventWebhookSecret = "s3cret"
+
+		stop := app.StartEventWebhook()
+		defer stop()
+		app.checkAndOpenGate(trackDevice(app, testDeviceMAC, "Phone"), directionArriving)
+
+		select {
+		case r := <-received:
+			body := <-bodies
+			if got := r.Header.Get(notify.SignatureHeader); got != notify.Sign(body, "s3cret") {
+				t.Errorf("Expected the body to be signed, got %q", got)
+			}
+			var event gateEvent
+			if err := json.Unmarshal(body, &event); err != nil {
+				t.Fatalf("Failed to decode event: %v", err)
+			}
+			if event.DeviceMAC != testDeviceMAC || event.DeviceName != "Phone" || event.Event != "gate_triggered" ||
+				event.Direction != directionArriving || !event.GateOpened || event.Timestamp.IsZero() {
+				t.Errorf("Unexpected event %+v", event)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected the open to be posted")
+		}
+	})
+
+	t.Run("A stuck endpoint doesn't hold up logging", func(t *testing.T) {
+		app := newTestApp(t)
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		t.Cleanup(server.Close)
+		t.Cleanup(func() { close(release) })
+		app.Config.Notifications.EventWebhookURL = server.URL
+
+		stop := app.StartEventWebhook()
+		logged := make(chan struct{})
+		go func() {
+			defer close(logged)
+			for i := 0; i < eventWebhookQueue*2; i++ {
+				if err := app.logEvent(&database.LogEntry{DeviceMAC: testDeviceMAC, Event: "connected"}); err != nil {
+					t.Errorf("Failed to log event: %v", err)
+				}
+			}
+		}()
+		select {
+		case <-logged:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Logging was held up by the event webhook")
+		}
+
+		release <- struct{}{}
+		stop()
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		app := newTestApp(t)
+		app.StartEventWebhook()()
+	})
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+)
+
+// How far back the calendar feed reaches unless since is given
+const feedDefaultRange = 30 * 24 * time.Hour
+
+// Calendar feed of gate openings (iCalendar). Calendar apps can't log in, so
+// the feed is protected by the configured feed token instead of a session.
+func (app *App) LogFeedHandler(w http.ResponseWriter, r *http.Request) {
+	token := app.Config.Server.FeedToken
+	if token == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(token)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := logFilterFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Event = "gate_triggered"
+	if filter.Since.IsZero() {
+		filter.Since = time.Now().Add(-feedDefaultRange)
+	}
+
+	// Events last as long as the gate stays open
+	length := time.Duration(app.Config.Gate.OpenDuration) * time.Minute
+	if length <= 0 {
+		length = time.Minute
+	}
+
+	// Render into a buffer so a database error can still become a 500
+	var out bytes.Buffer
+	writeICSLine(&out, "BEGIN:VCALENDAR")
+	writeICSLine(&out, "VERSION:2.0")
+	writeICSLine(&out, "PRODID:-//unifi-gate-opener//Gate openings//EN")
+	writeICSLine(&out, "CALSCALE:GREGORIAN")
+	writeICSLine(&out, "X-WR-CALNAME:Gate openings")
+
+	stamp := icsTime(time.Now())
+	err = app.DB.EachLog(filter, func(entry database.LogEntry) error {
+		name := entry.DeviceName
+		if name == "" {
+			name = entry.DeviceMAC
+		}
+
+		writeICSLine(&out, "BEGIN:VEVENT")
+		writeICSLine(&out, fmt.Sprintf("UID:gate-log-%d@unifi-gate-opener", entry.ID))
+		writeICSLine(&out, "DTSTAMP:"+stamp)
+		writeICSLine(&out, "DTSTART:"+icsTime(entry.Timestamp))
+		writeICSLine(&out, "DTEND:"+icsTime(entry.Timestamp.Add(length)))
+		writeICSLine(&out, "SUMMARY:"+icsEscape(name))
+		writeICSLine(&out, "DESCRIPTION:"+icsEscape(feedDescription(entry)))
+		writeICSLine(&out, "END:VEVENT")
+		return nil
+	})
+	if err != nil {
+		app.Logger.Errorf("Failed to render calendar feed: %v", err)
+		http.Error(w, "Failed to get logs", http.StatusInternalServerError)
+		return
+	}
+	writeICSLine(&out, "END:VCALENDAR")
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="gate-openings.ics"`)
+	if _, err := out.WriteTo(w); err != nil {
+		app.Logger.Debugf("Failed to write calendar feed: %v", err)
+	}
+}
+
+func feedDescription(entry database.LogEntry) string {
+	if entry.Direction == "" {
+		return entry.Message
+	}
+	return fmt.Sprintf("%s (%s)", entry.Message, entry.Direction)
+}
+
+func icsTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// icsEscape escapes text values as RFC 5545 requires
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// writeICSLine writes a content line, folded to 75 octets without splitting
+// UTF-8 sequences
+func writeICSLine(w io.StringWriter, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74 // continuation lines start with a space
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
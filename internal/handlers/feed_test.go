@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+)
+
+func TestLogFeedHandler(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Server.FeedToken = "feed-secret"
+
+	for _, entry := range []database.LogEntry{
+		{DeviceMAC: testDeviceMAC, DeviceName: "Phone, work", Event: "gate_triggered", Direction: "arriving", GateOpened: true, Message: "Gate opened successfully"},
+		{DeviceMAC: testDeviceMAC, DeviceName: "Phone, work", Event: "connected"},
+		{DeviceMAC: "AA:BB:CC:DD:EE:02", DeviceName: "Tablet", Event: "gate_triggered", GateOpened: true},
+	} {
+		entry := entry
+		if err := app.DB.LogEvent(&entry); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+
+	// An opening from long ago, outside the default range
+	if _, err := app.DB.Exec(`INSERT INTO logs (timestamp, device_mac, device_name, event, direction, from_ap, to_ap, gate_opened, message)
+		VALUES (?, ?, 'Old Phone', 'gate_triggered', 'arriving', '', '', 1, 'Gate opened successfully')`,
+		time.Now().AddDate(0, -6, 0).UTC().Format("2006-01-02 15:04:05"), testDeviceMAC); err != nil {
+		t.Fatalf("Failed to insert old event: %v", err)
+	}
+
+	feed := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		app.LogFeedHandler(w, httptest.NewRequest("GET", "/api/logs.ics?"+query, nil))
+		return w
+	}
+
+	t.Run("Valid calendar with gate openings", func(t *testing.T) {
+		w := feed("token=feed-secret")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+			t.Errorf("Expected calendar content type, got %s", ct)
+		}
+
+		body := w.Body.String()
+		if !strings.HasPrefix(body, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n") || !strings.HasSuffix(body, "END:VCALENDAR\r\n") {
+			t.Errorf("Feed is not wrapped in a VCALENDAR:\n%s", body)
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(body, "\r\n"), "\r\n") {
+			if len(line) > 75 {
+				t.Errorf("Line longer than 75 octets: %q", line)
+			}
+			if strings.Contains(line, "\n") {
+				t.Errorf("Line must end in CRLF: %q", line)
+			}
+		}
+
+		if got := strings.Count(body, "BEGIN:VEVENT"); got != 2 {
+			t.Errorf("Expected 2 events, got %d", got)
+		}
+		if got := strings.Count(body, "END:VEVENT"); got != 2 {
+			t.Errorf("Expected 2 closed events, got %d", got)
+		}
+		for _, want := range []string{`SUMMARY:Phone\, work`, "SUMMARY:Tablet", "DTSTART:", "DTEND:", "UID:gate-log-"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("Expected feed to contain %q", want)
+			}
+		}
+		if strings.Contains(body, "Old Phone") {
+			t.Error("Old openings should be outside the default range")
+		}
+	})
+
+	t.Run("Time range", func(t *testing.T) {
+		since := time.Now().AddDate(-1, 0, 0).UTC().Format(time.RFC3339)
+		until := time.Now().AddDate(0, -1, 0).UTC().Format(time.RFC3339)
+
+		body := feed("token=feed-secret&since=" + since + "&until=" + until).Body.String()
+		if got := strings.Count(body, "BEGIN:VEVENT"); got != 1 || !strings.Contains(body, "SUMMARY:Old Phone") {
+			t.Errorf("Expected only the old opening, got:\n%s", body)
+		}
+	})
+
+	t.Run("Invalid time range", func(t *testing.T) {
+		if w := feed("token=feed-secret&since=yesterday"); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("Wrong token", func(t *testing.T) {
+		for _, query := range []string{"", "token=wrong"} {
+			if w := feed(query); w.Code != http.StatusUnauthorized {
+				t.Errorf("%q: expected status 401, got %d", query, w.Code)
+			}
+		}
+	})
+
+	t.Run("Disabled without a token", func(t *testing.T) {
+		app.Config.Server.FeedToken = ""
+		defer func() { app.Config.Server.FeedToken = "feed-secret" }()
+
+		if w := feed("token="); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+	})
+}
+
+func TestWriteICSLineFolding(t *testing.T) {
+	var b strings.Builder
+	writeICSLine(&b, "SUMMARY:"+strings.Repeat("ä", 60))
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n")
+	if len(lines) < 2 {
+		t.Fatalf("Expected the line to be folded, got %q", b.String())
+	}
+	var unfolded string
+	for i, line := range lines {
+		if len(line) > 75 {
+			t.Errorf("Line %d longer than 75 octets: %d", i, len(line))
+		}
+		if i > 0 {
+			if !strings.HasPrefix(line, " ") {
+				t.Errorf("Continuation line %d should start with a space", i)
+			}
+			line = line[1:]
+		}
+		unfolded += line
+	}
+	if unfolded != "SUMMARY:"+strings.Repeat("ä", 60) {
+		t.Errorf("Unfolding should restore the line, got %q", unfolded)
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+)
+
+func TestCompressionMiddleware(t *testing.T) {
+	request := func(router http.Handler, path, acceptEncoding string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("API responses are gzipped", func(t *testing.T) {
+		app := newTestApp(t)
+		app.Config.Server.Compression = true
+		markConfigured(app)
+		app.Config.Devices = []config.DeviceConfig{{MAC: testDeviceMAC, Name: "Phone", Enabled: true}}
+		router := app.Routes()
+
+		w := request(router, "/api/devices", "br, gzip;q=0.8", loginCookie(t, app))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("Expected Content-Encoding gzip, got %q", got)
+		}
+		if got := w.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("Expected Content-Type application/json, got %q", got)
+		}
+
+		gz, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("Failed to open gzip body: %v", err)
+		}
+		body, err := io.ReadAll(gz)
+		if err != nil {
+			t.Fatalf("Failed to decompress body: %v", err)
+		}
+
+		var devices []map[string]interface{}
+		if err := json.Unmarshal(body, &devices); err != nil {
+			t.Fatalf("Failed to decode devices %q: %v", body, err)
+		}
+		if len(devices) != 1 || devices[0]["name"] != "Phone" {
+			t.Errorf("Expected the tracked device, got %v", devices)
+		}
+	})
+
+	t.Run("Left alone when not wanted", func(t *testing.T) {
+		app := newTestApp(t)
+		markConfigured(app)
+		cookie := loginCookie(t, app)
+
+		tests := []struct {
+			name           string
+			compression    bool
+			path           string
+			acceptEncoding string
+		}{
+			{"Client doesn't accept gzip", true, "/api/devices", ""},
+			{"Client refuses gzip", true, "/api/devices", "gzip;q=0"},
+			{"Compression disabled", false, "/api/devices", "gzip"},
+			{"Static assets", true, "/static/app.js", "gzip"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				app.Config.Server.Compression = tt.compression
+				w := request(app.Routes(), tt.path, tt.acceptEncoding, cookie)
+				if got := w.Header().Get("Content-Encoding"); got != "" {
+					t.Errorf("Expected no Content-Encoding, got %q", got)
+				}
+			})
+		}
+	})
+
+	t.Run("Event streams aren't compressed", func(t *testing.T) {
+		app := newTestApp(t)
+		app.Config.Server.Compression = true
+
+		stream := app.CompressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.(http.Flusher).Flush()
+			w.Write([]byte("data: hello\n\n"))
+		}))
+
+		req := httptest.NewRequest("GET", "/api/logs/stream", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		stream.ServeHTTP(w, req)
+
+		if got := w.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Expected no Content-Encoding, got %q", got)
+		}
+		if got := w.Body.String(); got != "data: hello\n\n" {
+			t.Errorf("Expected the plain event, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// readyTimeout bounds the database ping of a readiness probe
+const readyTimeout = 2 * time.Second
+
+// Subsystem states reported by /readyz
+const (
+	checkOK            = "ok"
+	checkFailed        = "failed"
+	checkNotLoggedIn   = "not_logged_in"
+	checkNotConfigured = "not_configured"
+)
+
+// subsystemCheck is one subsystem's state in a readiness probe
+type subsystemCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Liveness probe, answers as long as the HTTP server does
+func (app *App) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeProbe(w, http.StatusOK, map[string]interface{}{
+		"status":   checkOK,
+		"instance": app.Config.Server.Instance(),
+	})
+}
+
+// Readiness probe, ready when the database answers and, once set up, the
+// UniFi client holds a session
+func (app *App) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	ready := true
+	checks := map[string]subsystemCheck{}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+	if err := app.DB.PingContext(ctx); err != nil {
+		ready = false
+		checks["database"] = subsystemCheck{Status: checkFailed, Error: err.Error()}
+	} else {
+		checks["database"] = subsystemCheck{Status: checkOK}
+	}
+
+	switch {
+	case !app.Config.IsConfigured() || app.UniFiClient == nil:
+		// Nothing to log in to before setup
+		checks["unifi"] = subsystemCheck{Status: checkNotConfigured}
+	case !app.UniFiClient.LoggedIn():
+		ready = false
+		checks["unifi"] = subsystemCheck{Status: checkNotLoggedIn}
+	default:
+		checks["unifi"] = subsystemCheck{Status: checkOK}
+	}
+
+	status, code := checkOK, http.StatusOK
+	if !ready {
+		status, code = checkFailed, http.StatusServiceUnavailable
+	}
+	app.writeProbe(w, code, map[string]interface{}{
+		"status":   status,
+		"instance": app.Config.Server.Instance(),
+		"checks":   checks,
+	})
+}
+
+func (app *App) writeProbe(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		app.Logger.Errorf("Failed to encode probe response: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestHealthProbes(t *testing.T) {
+	probe := func(t *testing.T, app *App, path string) (int, map[string]interface{}) {
+		t.Helper()
+		w := serve(app.Routes(), "GET", path, nil)
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode %s response %q: %v", path, w.Body.String(), err)
+		}
+		return w.Code, body
+	}
+	unifiStatus := func(body map[string]interface{}) interface{} {
+		checks, _ := body["checks"].(map[string]interface{})
+		unifi, _ := checks["unifi"].(map[string]interface{})
+		return unifi["status"]
+	}
+
+	t.Run("Before setup", func(t *testing.T) {
+		app := newTestApp(t)
+
+		if code, body := probe(t, app, "/healthz"); code != http.StatusOK || body["status"] != "ok" {
+			t.Errorf("Expected healthy, got %d %v", code, body)
+		}
+		code, body := probe(t, app, "/readyz")
+		if code != http.StatusOK || unifiStatus(body) != "not_configured" {
+			t.Errorf("Expected ready without UniFi, got %d %v", code, body)
+		}
+	})
+
+	t.Run("Without a UniFi session", func(t *testing.T) {
+		app := newTestApp(t)
+		markConfigured(app)
+		mock := newMockController(t)
+		app.UniFiClient = app.newUniFiClient(mock.Server.URL, "user", "pass")
+
+		// No login needed for probes
+		if code, _ := probe(t, app, "/healthz"); code != http.StatusOK {
+			t.Errorf("Expected healthy, got %d", code)
+		}
+		code, body := probe(t, app, "/readyz")
+		if code != http.StatusServiceUnavailable || unifiStatus(body) != "not_logged_in" {
+			t.Errorf("Expected not ready, got %d %v", code, body)
+		}
+
+		if err := app.UniFiClient.Login(); err != nil {
+			t.Fatalf("Failed to login: %v", err)
+		}
+		code, body = probe(t, app, "/readyz")
+		if code != http.StatusOK || body["status"] != "ok" || unifiStatus(body) != "ok" {
+			t.Errorf("Expected ready, got %d %v", code, body)
+		}
+	})
+
+	t.Run("Names the instance", func(t *testing.T) {
+		app := newTestApp(t)
+		app.Config.Server.InstanceName = "side-gate"
+
+		for _, path := range []string{"/healthz", "/readyz"} {
+			if _, body := probe(t, app, path); body["instance"] != "side-gate" {
+				t.Errorf("%s: expected instance side-gate, got %v", path, body["instance"])
+			}
+		}
+	})
+
+	t.Run("Database unreachable", func(t *testing.T) {
+		app := newTestApp(t)
+		app.DB.Close()
+
+		code, body := probe(t, app, "/readyz")
+		checks, _ := body["checks"].(map[string]interface{})
+		database, _ := checks["database"].(map[string]interface{})
+		if code != http.StatusServiceUnavailable || database["status"] != "failed" || database["error"] == "" {
+			t.Errorf("Expected the database to fail the probe, got %d %v", code, body)
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+)
+
+// knownClient is a client named in the controller, offered for tracking
+type knownClient struct {
+	MAC      string     `json:"mac"`
+	Name     string     `json:"name"`
+	Hostname string     `json:"hostname,omitempty"`
+	Note     string     `json:"note,omitempty"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+	Tracked  bool       `json:"tracked"` // already one of the devices
+}
+
+// Get the clients named in the UniFi controller API, for picking several
+// devices to track at once instead of waiting for each to connect
+func (app *App) GetKnownClientsHandler(w http.ResponseWriter, r *http.Request) {
+	if app.UniFiClient == nil {
+		http.Error(w, "UniFi not configured", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.UniFiClient.EnsureLoggedIn(); err != nil {
+		app.Logger.Errorf("Failed to get known UniFi clients: %v", err)
+		http.Error(w, "Failed to get known clients", http.StatusInternalServerError)
+		return
+	}
+	clients, err := app.UniFiClient.GetKnownClients(app.Config.UniFi.SiteID)
+	if err != nil {
+		app.Logger.Errorf("Failed to get known UniFi clients: %v", err)
+		http.Error(w, "Failed to get known clients", http.StatusInternalServerError)
+		return
+	}
+
+	known := make([]knownClient, 0, len(clients))
+	for _, client := range clients {
+		// Only wireless clients ever show up at the gate AP
+		if client.IsWired {
+			continue
+		}
+		entry := knownClient{
+			MAC:      client.MAC,
+			Name:     client.Name,
+			Hostname: client.Hostname,
+			Note:     client.Note,
+			Tracked:  app.findDevice(client.MAC) != nil,
+		}
+		if client.LastSeen > 0 {
+			lastSeen := time.Unix(client.LastSeen, 0)
+			entry.LastSeen = &lastSeen
+		}
+		known = append(known, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(known); err != nil {
+		app.Logger.Errorf("Failed to encode known clients: %v", err)
+	}
+}
+
+// bulkSkipped is a device a bulk add left out, and why
+type bulkSkipped struct {
+	MAC   string `json:"mac"`
+	Error string `json:"error"`
+}
+
+// Add several devices at once API, e.g. picked from the known clients.
+// Devices that can't be added, like ones already tracked, are reported back
+// instead of failing the others.
+func (app *App) BulkAddDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Devices []struct {
+			MAC  string `json:"mac"`
+			Name string `json:"name"`
+			Gate string `json:"gate"` // empty for the primary gate
+		} `json:"devices"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if len(req.Devices) == 0 {
+		http.Error(w, "No devices to add", http.StatusBadRequest)
+		return
+	}
+
+	app.devicesMu.Lock()
+	defer app.devicesMu.Unlock()
+	added := []string{}
+	skipped := []bulkSkipped{}
+	var devices []config.DeviceConfig
+	for _, entry := range req.Devices {
+		if strings.TrimSpace(entry.MAC) == "" {
+			skipped = append(skipped, bulkSkipped{MAC: entry.MAC, Error: "missing MAC address"})
+			continue
+		}
+		mac, err := config.NormalizeMAC(entry.MAC)
+		if err != nil {
+			skipped = append(skipped, bulkSkipped{MAC: entry.MAC, Error: err.Error()})
+			continue
+		}
+		gateName, err := app.Config.ResolveGate(entry.Gate)
+		if err != nil {
+			skipped = append(skipped, bulkSkipped{MAC: mac, Error: err.Error()})
+			continue
+		}
+		if app.findDevice(mac) != nil {
+			skipped = append(skipped, bulkSkipped{MAC: mac, Error: config.ErrDeviceExists.Error()})
+			continue
+		}
+
+		name := entry.Name
+		if strings.TrimSpace(name) == "" {
+			name = app.discoveredName(mac)
+		}
+		if err := app.Config.AddDevice(mac, name); err != nil {
+			skipped = append(skipped, bulkSkipped{MAC: mac, Error: err.Error()})
+			continue
+		}
+		device := app.Config.GetDevice(mac)
+		device.Gate = gateName
+		record := deviceRecord(*device)
+		if err := app.DB.AddDevice(&record); err != nil {
+			app.Config.RemoveDevice(mac)
+			skipped = append(skipped, bulkSkipped{MAC: mac, Error: err.Error()})
+			continue
+		}
+
+		added = append(added, mac)
+		devices = append(devices, *device)
+	}
+
+	if len(added) > 0 {
+		if err := app.saveConfig(); err != nil {
+			http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
+			return
+		}
+
+		// Add to monitoring if active
+		app.monitoringMu.Lock()
+		if app.isMonitoring {
+			for _, device := range devices {
+				normalizedMAC := strings.ToUpper(device.MAC)
+				app.deviceStates[normalizedMAC] = &DeviceState{
+					MAC:  normalizedMAC,
+					Name: device.Name,
+					Gate: device.Gate,
+				}
+			}
+		}
+		app.monitoringMu.Unlock()
+
+		app.Logger.Infof("Added %d devices in bulk, skipped %d", len(added), len(skipped))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": len(added) > 0,
+		"added":   added,
+		"skipped": skipped,
+	}); err != nil {
+		app.Logger.Errorf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+)
+
+func TestKnownClients(t *testing.T) {
+	app := newTestApp(t)
+	markConfigured(app)
+	router := app.Routes()
+	cookie := loginCookie(t, app)
+	app.Config.Devices = []config.DeviceConfig{{MAC: testDeviceMAC, Name: "Phone", Enabled: true}}
+
+	mock := newMockController(t)
+	mock.KnownClients = []map[string]interface{}{
+		{"_id": "u1", "mac": "aa:bb:cc:dd:ee:01", "name": "Phone", "last_seen": 1714560000},
+		{"_id": "u2", "mac": "aa:bb:cc:dd:ee:02", "name": "Car", "note": "Model 3"},
+		{"_id": "u3", "mac": "aa:bb:cc:dd:ee:03", "hostname": "android-1234"},
+		{"_id": "u4", "mac": "aa:bb:cc:dd:ee:04", "name": "Printer", "is_wired": true},
+	}
+	app.UniFiClient = app.newUniFiClient(mock.Server.URL, "user", "pass")
+
+	w := serve(router, "GET", "/api/unifi/known-clients", cookie)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var known []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &known); err != nil {
+		t.Fatalf("Failed to decode known clients: %v", err)
+	}
+	// Only named wireless clients are offered
+	if len(known) != 2 {
+		t.Fatalf("Expected 2 known clients, got %v", known)
+	}
+	if known[0]["tracked"] != true || known[0]["last_seen"] == nil {
+		t.Errorf("Expected the phone to be tracked already, got %v", known[0])
+	}
+	if known[1]["name"] != "Car" || known[1]["note"] != "Model 3" || known[1]["tracked"] != false {
+		t.Errorf("Expected the untracked car, got %v", known[1])
+	}
+}
+
+func TestBulkAddDevices(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Devices = []config.DeviceConfig{{MAC: testDeviceMAC, Name: "Phone", Enabled: true}}
+
+	w, resp := postJSON(t, app.BulkAddDevicesHandler, "/api/devices/bulk", map[string]interface{}{
+		"devices": []map[string]string{
+			{"mac": "aa:bb:cc:dd:ee:02", "name": "Car"},
+			{"mac": "aa:bb:cc:dd:ee:03", "name": "Watch"},
+			{"mac": "aa:bb:cc:dd:ee:01", "name": "Phone again"},
+			{"mac": "aa:bb:cc:dd:ee:04", "name": "Bike", "gate": "garage"},
+		},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	added, _ := resp["added"].([]interface{})
+	if len(added) != 2 || added[0] != "aa:bb:cc:dd:ee:02" || added[1] != "aa:bb:cc:dd:ee:03" {
+		t.Errorf("Expected the car and watch to be added, got %v", resp["added"])
+	}
+	skipped, _ := resp["skipped"].([]interface{})
+	if len(skipped) != 2 {
+		t.Fatalf("Expected the tracked phone and the unknown gate to be skipped, got %v", resp["skipped"])
+	}
+
+	if len(app.Config.Devices) != 3 {
+		t.Fatalf("Expected 3 devices, got %+v", app.Config.Devices)
+	}
+	car := app.Config.GetDevice("AA:BB:CC:DD:EE:02")
+	if car == nil || car.Name != "Car" || !car.Enabled {
+		t.Errorf("Expected the car to be tracked, got %+v", car)
+	}
+
+	// Saved along the way
+	saved, err := config.LoadOrInitialize(app.ConfigPath)
+	if err != nil {
+		t.Fatalf("Failed to reload the config: %v", err)
+	}
+	if len(saved.Devices) != 3 {
+		t.Errorf("Expected 3 saved devices, got %+v", saved.Devices)
+	}
+
+	t.Run("Nothing to add", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		app.BulkAddDevicesHandler(w, httptest.NewRequest("POST", "/api/devices/bulk", strings.NewReader(`{"devices":[]}`)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+}
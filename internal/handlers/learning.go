@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/unifi"
+)
+
+const (
+	// defaultLearningPeriod is how long learning mode runs unless told otherwise
+	defaultLearningPeriod = 30 * time.Minute
+	// learningLookback is how long before a manual open an association still
+	// counts towards it, roughly from reaching the gate to pressing the button
+	learningLookback = 2 * time.Minute
+)
+
+// learningState collects evidence for which AP is the gate AP: the AP that
+// keeps seeing new associations shortly before manual opens. Guarded by
+// monitoringMu.
+type learningState struct {
+	started time.Time
+	until   time.Time
+	opens   int
+
+	associations []learnedAssociation // recent ones, within learningLookback
+	scores       map[string]int       // associations preceding an open, per AP
+}
+
+type learnedAssociation struct {
+	at    time.Time
+	apMAC string
+}
+
+// apCandidate is an AP and how many associations preceded manual opens on it
+type apCandidate struct {
+	APMAC        string `json:"ap_mac"`
+	Associations int    `json:"associations"`
+}
+
+// learningActive reports whether learning mode is running. Callers must hold
+// monitoringMu.
+func (app *App) learningActive(now time.Time) bool {
+	return app.learning != nil && now.Before(app.learning.until)
+}
+
+// learnAssociations records clients that showed up on an AP since the
+// previous poll. Callers must hold monitoringMu and call this before
+// lastClients is replaced.
+func (app *App) learnAssociations(clients []unifi.WirelessClient) {
+	now := app.clock()
+	// Without a previous poll every client would look new
+	if !app.learningActive(now) || app.lastClients == nil {
+		return
+	}
+
+	previous := make(map[string]string, len(app.lastClients))
+	for _, client := range app.lastClients {
+		previous[strings.ToUpper(client.MAC)] = strings.ToLower(client.AP_MAC)
+	}
+
+	learning := app.learning
+	for _, client := range clients {
+		apMAC := strings.ToLower(client.AP_MAC)
+		if apMAC == "" || previous[strings.ToUpper(client.MAC)] == apMAC {
+			continue
+		}
+		learning.associations = append(learning.associations, learnedAssociation{at: now, apMAC: apMAC})
+	}
+
+	// Forget associations too old to precede any future open
+	cutoff := now.Add(-learningLookback)
+	kept := learning.associations[:0]
+	for _, assoc := range learning.associations {
+		if !assoc.at.Before(cutoff) {
+			kept = append(kept, assoc)
+		}
+	}
+	learning.associations = kept
+}
+
+// learnOnlyPoll hands a poll to learning mode alone when monitoring runs
+// without a gate AP, and reports whether it did
+func (app *App) learnOnlyPoll(clients []unifi.WirelessClient) bool {
+	app.monitoringMu.Lock()
+	defer app.monitoringMu.Unlock()
+
+	if !app.learnOnly {
+		return false
+	}
+	app.learnAssociations(clients)
+	app.lastClients = clients
+	return true
+}
+
+// learnManualOpen credits the APs that saw associations shortly before a
+// manual open
+func (app *App) learnManualOpen() {
+	app.monitoringMu.Lock()
+	defer app.monitoringMu.Unlock()
+
+	now := app.clock()
+	if !app.learningActive(now) {
+		return
+	}
+
+	learning := app.learning
+	learning.opens++
+	cutoff := now.Add(-learningLookback)
+	for _, assoc := range learning.associations {
+		if !assoc.at.Before(cutoff) {
+			learning.scores[assoc.apMAC]++
+		}
+	}
+	// Each association counts towards one open only
+	learning.associations = nil
+}
+
+// learningCandidates ranks APs by associations preceding manual opens.
+// Callers must hold monitoringMu.
+func (app *App) learningCandidates() []apCandidate {
+	candidates := []apCandidate{}
+	if app.learning == nil {
+		return candidates
+	}
+
+	for apMAC, score := range app.learning.scores {
+		candidates = append(candidates, apCandidate{APMAC: apMAC, Associations: score})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Associations != candidates[j].Associations {
+			return candidates[i].Associations > candidates[j].Associations
+		}
+		return candidates[i].APMAC < candidates[j].APMAC
+	})
+	return candidates
+}
+
+// Start learning mode to find the gate AP
+func (app *App) StartLearningHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Minutes int `json:"minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.Minutes < 0 {
+		http.Error(w, "minutes must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	period := defaultLearningPeriod
+	if req.Minutes > 0 {
+		period = time.Duration(req.Minutes) * time.Minute
+	}
+
+	now := app.clock()
+	app.monitoringMu.Lock()
+	app.learning = &learningState{
+		started: now,
+		until:   now.Add(period),
+		scores:  make(map[string]int),
+	}
+	// Monitoring that refused to start for want of a gate AP polls for
+	// learning mode now
+	start := !app.isMonitoring && app.gateAPErr != nil
+	app.monitoringMu.Unlock()
+
+	app.Logger.Infof("Learning mode started for %s, open the gate manually when arriving", period)
+	if start {
+		go app.StartMonitoring()
+	}
+	app.GetLearningHandler(w, r)
+}
+
+// Learning mode status and the suggested gate AP
+func (app *App) GetLearningHandler(w http.ResponseWriter, r *http.Request) {
+	now := app.clock()
+
+	app.monitoringMu.RLock()
+	status := map[string]interface{}{
+		"active":     app.learningActive(now),
+		"candidates": app.learningCandidates(),
+	}
+	if learning := app.learning; learning != nil {
+		status["started_at"] = learning.started
+		status["ends_at"] = learning.until
+		status["manual_opens"] = learning.opens
+	}
+	app.monitoringMu.RUnlock()
+
+	// The best candidate, once there is one
+	if candidates := status["candidates"].([]apCandidate); len(candidates) > 0 {
+		status["suggested_ap_mac"] = candidates[0].APMAC
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		app.Logger.Errorf("Failed to encode learning status: %v", err)
+	}
+}
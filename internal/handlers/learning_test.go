@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/unifi"
+)
+
+func TestLearningMode(t *testing.T) {
+	newLearningApp := func(t *testing.T) (*App, *time.Time) {
+		app := newTestApp(t)
+		now := time.Date(2024, 5, 1, 17, 0, 0, 0, time.Local)
+		app.now = func() time.Time { return now }
+		return app, &now
+	}
+
+	resident := unifi.WirelessClient{MAC: "aa:bb:cc:dd:ee:10", AP_MAC: testInteriorAP}
+	arrival := func(mac, ap string) unifi.WirelessClient {
+		return unifi.WirelessClient{MAC: mac, AP_MAC: ap}
+	}
+
+	t.Run("Suggests the AP preceding manual opens", func(t *testing.T) {
+		app, now := newLearningApp(t)
+
+		w, resp := postJSON(t, app.StartLearningHandler, "/api/learning", map[string]int{"minutes": 60})
+		if w.Code != 200 {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if resp["active"] != true {
+			t.Fatalf("Expected learning to be active, got %v", resp["active"])
+		}
+
+		clients := []unifi.WirelessClient{resident}
+		app.processClients(clients)
+
+		// Someone joins inside, long before anyone opens the gate
+		*now = now.Add(5 * time.Minute)
+		clients = append(clients, arrival("aa:bb:cc:dd:ee:11", testInteriorAP))
+		app.processClients(clients)
+
+		// Arrivals at the gate, each followed by a manual open
+		for i, mac := range []string{"aa:bb:cc:dd:ee:12", "aa:bb:cc:dd:ee:13"} {
+			*now = now.Add(10 * time.Minute)
+			clients = append(clients, arrival(mac, testGateAP))
+			if i == 1 {
+				// Noise right before the open counts, but only once
+				clients = append(clients, arrival("aa:bb:cc:dd:ee:14", testInteriorAP))
+			}
+			app.processClients(clients)
+
+			*now = now.Add(30 * time.Second)
+			app.learnManualOpen()
+		}
+
+		_, resp = getJSON(t, app.GetLearningHandler, "/api/learning")
+		if resp["suggested_ap_mac"] != testGateAP {
+			t.Errorf("Expected suggested AP %s, got %v", testGateAP, resp["suggested_ap_mac"])
+		}
+		if resp["manual_opens"] != float64(2) {
+			t.Errorf("Expected 2 manual opens, got %v", resp["manual_opens"])
+		}
+		candidates, ok := resp["candidates"].([]interface{})
+		if !ok || len(candidates) != 2 {
+			t.Fatalf("Expected 2 candidates, got %v", resp["candidates"])
+		}
+		first := candidates[0].(map[string]interface{})
+		if first["associations"] != float64(2) {
+			t.Errorf("Expected 2 associations for the gate AP, got %v", first["associations"])
+		}
+	})
+
+	t.Run("Nothing is learned when inactive", func(t *testing.T) {
+		app, now := newLearningApp(t)
+
+		clients := []unifi.WirelessClient{resident}
+		app.processClients(clients)
+		app.processClients(append(clients, arrival("aa:bb:cc:dd:ee:12", testGateAP)))
+		app.learnManualOpen()
+
+		_, resp := getJSON(t, app.GetLearningHandler, "/api/learning")
+		if resp["active"] != false {
+			t.Errorf("Expected learning to be inactive, got %v", resp["active"])
+		}
+		if _, ok := resp["suggested_ap_mac"]; ok {
+			t.Errorf("Expected no suggestion, got %v", resp["suggested_ap_mac"])
+		}
+
+		// Learning ends on its own
+		postJSON(t, app.StartLearningHandler, "/api/learning", map[string]int{"minutes": 1})
+		*now = now.Add(2 * time.Minute)
+		app.processClients(append(clients, arrival("aa:bb:cc:dd:ee:13", testGateAP)))
+		app.learnManualOpen()
+
+		_, resp = getJSON(t, app.GetLearningHandler, "/api/learning")
+		if resp["active"] != false {
+			t.Errorf("Expected learning to have ended, got %v", resp["active"])
+		}
+		if candidates := resp["candidates"].([]interface{}); len(candidates) != 0 {
+			t.Errorf("Expected no candidates, got %v", candidates)
+		}
+	})
+
+	t.Run("Negative period is rejected", func(t *testing.T) {
+		app, _ := newLearningApp(t)
+
+		w := httptest.NewRecorder()
+		app.StartLearningHandler(w, httptest.NewRequest("POST", "/api/learning", strings.NewReader(`{"minutes":-5}`)))
+		if w.Code != 400 {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("Polls without a gate AP, but never opens", func(t *testing.T) {
+		app := newTestApp(t)
+		markConfigured(app)
+		app.Config.UniFi.GateAPMAC = ""
+		hits := newTestRelay(t, app)
+		if err := app.Config.AddDevice(testDeviceMAC, "Phone"); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+		mock := newMockController(t)
+		mock.Clients = []map[string]interface{}{mockClient(testDeviceMAC, testGateAP)}
+		app.UniFiClient = app.newUniFiClient(mock.Server.URL, "user", "pass")
+
+		postJSON(t, app.StartLearningHandler, "/api/learning", map[string]int{"minutes": 60})
+		done := make(chan struct{})
+		go func() {
+			app.StartMonitoring()
+			close(done)
+		}()
+		defer func() {
+			app.StopMonitoring()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Monitoring did not stop")
+			}
+		}()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			app.monitoringMu.RLock()
+			polled := app.lastClients != nil
+			app.monitoringMu.RUnlock()
+			if polled {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Expected a poll for learning mode")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if state, reason := app.monitoringState(); state != monitoringNoGateAP || !strings.Contains(reason, "learning mode only") {
+			t.Errorf("Expected state %s for learning only, got %s: %s", monitoringNoGateAP, state, reason)
+		}
+		if got := atomic.LoadInt32(hits); got != 0 {
+			t.Errorf("Expected no opens without a gate AP, got %d", got)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// unlimitedPaths are the live update streams, which stay open for as long
+// as a dashboard does and would otherwise hold slots indefinitely
+var unlimitedPaths = map[string]bool{
+	"/api/logs/stream": true,
+	"/api/ws":          true,
+}
+
+// Middleware answering 503 while server.max_concurrent_requests requests are
+// already being handled, instead of queueing them on a small device
+func (app *App) ConcurrencyLimitMiddleware(next http.Handler) http.Handler {
+	limit := app.Config.Server.MaxConcurrentRequests
+	if limit <= 0 {
+		return next
+	}
+
+	slots := make(chan struct{}, limit)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unlimitedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			next.ServeHTTP(w, r)
+		default:
+			app.Logger.Debugf("Rejecting %s %s, %d requests in flight", r.Method, r.URL.Path, limit)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Server busy, try again shortly", http.StatusServiceUnavailable)
+		}
+	})
+}
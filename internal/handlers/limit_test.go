@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimitMiddleware(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Server.MaxConcurrentRequests = 2
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := app.ConcurrencyLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("block") == "true" {
+			started <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	// Fill both slots
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request("/api/status?block=true")
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Blocking requests never started")
+		}
+	}
+
+	w := request("/api/status")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 while saturated, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+
+	// Live update streams don't count against the limit
+	for _, path := range []string{"/api/logs/stream", "/api/ws"} {
+		if w := request(path); w.Code != http.StatusOK {
+			t.Errorf("Expected %s to be let through, got %d", path, w.Code)
+		}
+	}
+
+	close(release)
+	wg.Wait()
+	if w := request("/api/status"); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 once the slots are free, got %d", w.Code)
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		app := newTestApp(t)
+		app.Config.Server.MaxConcurrentRequests = 0
+
+		var inFlight sync.WaitGroup
+		inFlight.Add(3)
+		handler := app.ConcurrencyLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inFlight.Done()
+			inFlight.Wait()
+		}))
+
+		codes := make(chan int, 3)
+		for i := 0; i < 3; i++ {
+			go func() {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/status", nil))
+				codes <- w.Code
+			}()
+		}
+		for i := 0; i < 3; i++ {
+			select {
+			case code := <-codes:
+				if code != http.StatusOK {
+					t.Errorf("Expected status 200 without a limit, got %d", code)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("Expected all requests to be handled at once")
+			}
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Database integrity check API. Reports "ok": false with SQLite's findings
+// when the database is damaged, e.g. by a failing SD card.
+func (app *App) IntegrityCheckHandler(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	results, err := app.DB.IntegrityCheck()
+	if err != nil {
+		app.Logger.Errorf("Failed to check database integrity: %v", err)
+		app.sendJSONError(w, "Failed to check database integrity: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	healthy := len(results) == 1 && results[0] == "ok"
+	if !healthy {
+		app.Logger.Warnf("Database integrity check found problems: %v", results)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":          healthy,
+		"results":     results,
+		"duration_ms": time.Since(started).Milliseconds(),
+	}); err != nil {
+		app.Logger.Errorf("Failed to encode integrity check: %v", err)
+	}
+}
+
+// Database optimize API, runs VACUUM to give back space freed by deleted
+// logs and ANALYZE to refresh the query planner's statistics
+func (app *App) OptimizeDatabaseHandler(w http.ResponseWriter, r *http.Request) {
+	sizeBefore, err := app.DB.Size()
+	if err != nil {
+		app.Logger.Errorf("Failed to get database size: %v", err)
+		app.sendJSONError(w, "Failed to get database size: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.DB.Vacuum(); err != nil {
+		app.Logger.Errorf("Failed to vacuum database: %v", err)
+		app.sendJSONError(w, "Failed to vacuum database: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := app.DB.Analyze(); err != nil {
+		app.Logger.Errorf("Failed to analyze database: %v", err)
+		app.sendJSONError(w, "Failed to analyze database: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sizeAfter, err := app.DB.Size()
+	if err != nil {
+		app.Logger.Errorf("Failed to get database size: %v", err)
+		app.sendJSONError(w, "Failed to get database size: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	app.Logger.Info("Vacuumed and analyzed database")
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"size_before": sizeBefore,
+		"size_after":  sizeAfter,
+	}); err != nil {
+		app.Logger.Errorf("Failed to encode optimize response: %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIntegrityCheckHandler(t *testing.T) {
+	app := newTestApp(t)
+
+	w, resp := getJSON(t, app.IntegrityCheckHandler, "/api/database/integrity")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if resp["ok"] != true {
+		t.Errorf("Expected a healthy database, got %v", resp)
+	}
+	results, _ := resp["results"].([]interface{})
+	if len(results) != 1 || results[0] != "ok" {
+		t.Errorf("Expected SQLite to report ok, got %v", resp["results"])
+	}
+}
+
+func TestOptimizeDatabaseHandler(t *testing.T) {
+	app := newTestApp(t)
+
+	w := serve(http.HandlerFunc(app.OptimizeDatabaseHandler), "POST", "/api/database/optimize", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	results, err := app.DB.IntegrityCheck()
+	if err != nil || len(results) != 1 || results[0] != "ok" {
+		t.Errorf("Expected the database to stay healthy, got %v (%v)", results, err)
+	}
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+	"github.com/fbettag/unifi-gate-opener/internal/mqtt"
+)
+
+const (
+	// mqttQueue is how many messages may wait for the broker before newer
+	// ones are dropped
+	mqttQueue = 100
+	// mqttRetryInterval is how long to wait before connecting again after
+	// the broker couldn't be reached
+	mqttRetryInterval = 30 * time.Second
+)
+
+// mqttPublisher is what publishing state needs of an MQTT client
+type mqttPublisher interface {
+	Publish(topic string, payload []byte) error
+	Close()
+}
+
+// connectMQTT connects to the configured broker
+func connectMQTT(cfg config.MQTTConfig, clientID string) (mqttPublisher, error) {
+	return mqtt.Connect(cfg.BrokerURL, cfg.Username, cfg.Password, clientID)
+}
+
+type mqttMessage struct {
+	topic   string
+	payload []byte
+}
+
+// mqttLink is the running publisher, see startMQTT
+type mqttLink struct {
+	queue    chan mqttMessage
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// mqttDeviceState is retained at <prefix>/device/<mac>/state
+type mqttDeviceState struct {
+	State string    `json:"state"` // connected or disconnected
+	Name  string    `json:"name"`
+	AP    string    `json:"ap,omitempty"`
+	Gate  string    `json:"gate,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// mqttGateTrigger is retained at <prefix>/gate/last_trigger
+type mqttGateTrigger struct {
+	Time       time.Time `json:"time"`
+	DeviceMAC  string    `json:"device_mac"`
+	DeviceName string    `json:"device_name"`
+	Direction  string    `json:"direction"`
+	Gate       string    `json:"gate,omitempty"`
+}
+
+// startMQTT connects to the MQTT broker in the background, if one is
+// configured, and publishes state until stopMQTT is called with the returned
+// link. A broker that can't be reached is retried, meanwhile messages queue
+// up to mqttQueue. Returns nil without a broker.
+func (app *App) startMQTT() *mqttLink {
+	cfg := app.Config.MQTT
+	if cfg.BrokerURL == "" {
+		return nil
+	}
+
+	link := &mqttLink{
+		queue: make(chan mqttMessage, mqttQueue),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	app.mqttMu.Lock()
+	app.mqtt = link
+	app.mqttMu.Unlock()
+
+	connect := app.connectMQTT
+	if connect == nil {
+		connect = connectMQTT
+	}
+	clientID := "unifi-gate-opener-" + app.Config.Server.Instance()
+
+	go func() {
+		defer close(link.done)
+
+		var publisher mqttPublisher
+		for publisher == nil {
+			var err error
+			if publisher, err = connect(cfg, clientID); err != nil {
+				app.Logger.Errorf("MQTT unavailable, retrying in %s: %v", mqttRetryInterval, err)
+				select {
+				case <-time.After(mqttRetryInterval):
+				case <-link.stop:
+					return
+				}
+			}
+		}
+		defer publisher.Close()
+		app.Logger.Infof("Publishing state to MQTT broker %s", cfg.BrokerURL)
+
+		for {
+			select {
+			case msg := <-link.queue:
+				if err := publisher.Publish(msg.topic, msg.payload); err != nil {
+					app.Logger.Warnf("Failed to publish to MQTT: %v", err)
+				}
+			case <-link.stop:
+				return
+			}
+		}
+	}()
+	return link
+}
+
+// stopMQTT disconnects link from the MQTT broker. Publishing only stops if
+// link is still the running one; monitoring restarts without waiting for the
+// old loop, so its link may already have been replaced.
+func (app *App) stopMQTT(link *mqttLink) {
+	if link == nil {
+		return
+	}
+
+	app.mqttMu.Lock()
+	if app.mqtt == link {
+		app.mqtt = nil
+	}
+	app.mqttMu.Unlock()
+
+	link.stopOnce.Do(func() { close(link.stop) })
+	<-link.done
+}
+
+// publishMQTT queues a message for the broker without waiting for it,
+// dropping it if the queue is full or MQTT isn't running
+func (app *App) publishMQTT(topic string, payload interface{}) {
+	app.mqttMu.RLock()
+	link := app.mqtt
+	app.mqttMu.RUnlock()
+	if link == nil {
+		return
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		app.Logger.Errorf("Failed to encode MQTT message for %s: %v", topic, err)
+		return
+	}
+
+	prefix := strings.TrimSuffix(app.Config.MQTT.TopicPrefix, "/")
+	if prefix == "" {
+		prefix = "gateopener"
+	}
+	select {
+	case link.queue <- mqttMessage{topic: prefix + "/" + topic, payload: body}:
+	default:
+		app.Logger.Warnf("MQTT queue full, dropping message for %s", topic)
+	}
+}
+
+// publishDeviceState publishes whether a device is connected and where
+func (app *App) publishDeviceState(state *DeviceState) {
+	status := "disconnected"
+	if state.IsConnected {
+		status = "connected"
+	}
+	app.publishMQTT("device/"+strings.ToLower(state.MAC)+"/state", mqttDeviceState{
+		State: status,
+		Name:  state.Name,
+		AP:    state.CurrentAP,
+		Gate:  state.Gate,
+		Time:  app.clock(),
+	})
+}
+
+// publishGateTrigger publishes the latest gate open
+func (app *App) publishGateTrigger(trigger mqttGateTrigger) {
+	app.publishMQTT("gate/last_trigger", trigger)
+}
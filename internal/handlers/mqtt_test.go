@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+	"github.com/fbettag/unifi-gate-opener/internal/unifi"
+)
+
+// fakeBroker records what would have been published
+type fakeBroker struct {
+	messages chan mqttMessage
+	fail     bool
+	closed   int32
+}
+
+func (b *fakeBroker) Publish(topic string, payload []byte) error {
+	select {
+	case b.messages <- mqttMessage{topic: topic, payload: payload}:
+	default:
+	}
+	if b.fail {
+		return errors.New("broker went away")
+	}
+	return nil
+}
+
+func (b *fakeBroker) Close() { atomic.AddInt32(&b.closed, 1) }
+
+// withFakeBroker starts MQTT against a fake broker, stopped at the end of the test
+func withFakeBroker(t *testing.T, app *App) *fakeBroker {
+	t.Helper()
+	broker := &fakeBroker{messages: make(chan mqttMessage, mqttQueue)}
+	app.Config.MQTT.BrokerURL = "tcp://broker:1883"
+	app.connectMQTT = func(config.MQTTConfig, string) (mqttPublisher, error) { return broker, nil }
+	link := app.startMQTT()
+	t.Cleanup(func() { app.stopMQTT(link) })
+	return broker
+}
+
+func nextMessage(t *testing.T, broker *fakeBroker, v interface{}) string {
+	t.Helper()
+	select {
+	case msg := <-broker.messages:
+		if err := json.Unmarshal(msg.payload, v); err != nil {
+			t.Fatalf("Failed to decode %s: %v", msg.topic, err)
+		}
+		return msg.topic
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a message to be published")
+		return ""
+	}
+}
+
+func TestMQTT(t *testing.T) {
+	t.Run("Device connect and disconnect", func(t *testing.T) {
+		app := newTestApp(t)
+		app.Config.Gate.TriggerOnConnect = false
+		broker := withFakeBroker(t, app)
+		trackDevice(app, testDeviceMAC, "Phone")
+
+		app.processClients([]unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testInteriorAP, Uptime: 100}})
+		var state mqttDeviceState
+		if topic := nextMessage(t, broker, &state); topic != "gateopener/device/aa:bb:cc:dd:ee:01/state" {
+			t.Errorf("Unexpected topic %s", topic)
+		}
+		if state.State != "connected" || state.Name != "Phone" || state.AP != testInteriorAP {
+			t.Errorf("Unexpected state %+v", state)
+		}
+
+		app.processClients(nil)
+		nextMessage(t, broker, &state)
+		if state.State != "disconnected" {
+			t.Errorf("Expected disconnected, got %+v", state)
+		}
+	})
+
+	t.Run("Gate opens", func(t *testing.T) {
+		app := newTestApp(t)
+		newTestRelay(t, app)
+		app.Config.MQTT.TopicPrefix = "home/gate/"
+		broker := withFakeBroker(t, app)
+
+		app.checkAndOpenGate(trackDevice(app, testDeviceMAC, "Phone"), directionArriving)
+
+		var trigger mqttGateTrigger
+		if topic := nextMessage(t, broker, &trigger); topic != "home/gate/gate/last_trigger" {
+			t.Errorf("Unexpected topic %s", topic)
+		}
+		if trigger.DeviceMAC != testDeviceMAC || trigger.Direction != directionArriving || trigger.Time.IsZero() {
+			t.Errorf("Unexpected trigger %+v", trigger)
+		}
+	})
+
+	t.Run("Failing publishes don't stop polling", func(t *testing.T) {
+		app := newTestApp(t)
+		app.Config.Gate.TriggerOnConnect = false
+		broker := withFakeBroker(t, app)
+		broker.fail = true
+		state := trackDevice(app, testDeviceMAC, "Phone")
+
+		for i := 0; i < mqttQueue*2; i++ {
+			app.processClients([]unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testInteriorAP, Uptime: 100}})
+			app.processClients(nil)
+		}
+		if state.IsConnected {
+			t.Error("Expected polling to carry on")
+		}
+	})
+
+	t.Run("Stopping closes the connection", func(t *testing.T) {
+		app := newTestApp(t)
+		broker := withFakeBroker(t, app)
+		app.publishDeviceState(trackDevice(app, testDeviceMAC, "Phone"))
+		nextMessage(t, broker, &mqttDeviceState{})
+
+		app.stopMQTT(app.mqtt)
+		if atomic.LoadInt32(&broker.closed) != 1 {
+			t.Error("Expected the connection to be closed")
+		}
+		app.publishDeviceState(app.deviceStates[testDeviceMAC]) // dropped, not blocked
+	})
+
+	t.Run("Unreachable broker is retried until stopped", func(t *testing.T) {
+		app := newTestApp(t)
+		app.Config.MQTT.BrokerURL = "tcp://broker:1883"
+		attempted := make(chan struct{}, 1)
+		app.connectMQTT = func(config.MQTTConfig, string) (mqttPublisher, error) {
+			attempted <- struct{}{}
+			return nil, errors.New("connection refused")
+		}
+		link := app.startMQTT()
+		<-attempted
+		app.publishDeviceState(trackDevice(app, testDeviceMAC, "Phone"))
+		app.stopMQTT(link)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		app := newTestApp(t)
+		link := app.startMQTT()
+		app.publishDeviceState(trackDevice(app, testDeviceMAC, "Phone"))
+		app.stopMQTT(link)
+	})
+
+	t.Run("Restart keeps publishing", func(t *testing.T) {
+		app := newTestApp(t)
+		old := withFakeBroker(t, app)
+		oldLink := app.mqtt
+
+		// The new loop starts before the old one has wound down
+		broker := &fakeBroker{messages: make(chan mqttMessage, mqttQueue)}
+		app.connectMQTT = func(config.MQTTConfig, string) (mqttPublisher, error) { return broker, nil }
+		link := app.startMQTT()
+		t.Cleanup(func() { app.stopMQTT(link) })
+		app.stopMQTT(oldLink)
+
+		if atomic.LoadInt32(&old.closed) != 1 {
+			t.Error("Expected the old connection to be closed")
+		}
+		app.publishDeviceState(trackDevice(app, testDeviceMAC, "Phone"))
+		nextMessage(t, broker, &mqttDeviceState{})
+	})
+}
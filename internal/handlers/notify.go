@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+	"github.com/fbettag/unifi-gate-opener/internal/notify"
+)
+
+// sendNotification delivers msg, prefixed with the instance name, if
+// notifications are configured and wanted for the event and device
+func (app *App) sendNotification(msg notify.Message) {
+	notifier := app.notifierFor(msg)
+	if notifier == nil {
+		return
+	}
+
+	if err := notifier.Notify(app.completeMessage(msg)); err != nil {
+		app.Logger.Errorf("Failed to send %s notification: %v", msg.Event, err)
+	}
+}
+
+// completeMessage prefixes msg with the instance name and fills in the time
+// and the device's avatar
+func (app *App) completeMessage(msg notify.Message) notify.Message {
+	msg.Instance = app.Config.Server.Instance()
+	msg.Text = fmt.Sprintf("[%s] %s", msg.Instance, msg.Text)
+	if msg.Time.IsZero() {
+		msg.Time = app.clock()
+	}
+	if device := app.messageDevice(msg); device != nil && msg.ImageURL == "" {
+		msg.ImageURL = device.AvatarURL
+	}
+	return msg
+}
+
+// notifyGateOpened tells GateNotifier about an open in the background,
+// whatever notifications.events says. Muting the device or picking other
+// providers for it or its gate still keeps it quiet.
+func (app *App) notifyGateOpened(msg notify.Message) {
+	notifier := app.GateNotifier
+	var prefs *config.DeviceNotifyConfig
+	if device := app.messageDevice(msg); device != nil {
+		prefs = device.Notifications
+	}
+	if prefs != nil && prefs.Enabled != nil && !*prefs.Enabled {
+		return
+	}
+	if providers := app.messageProviders(msg, prefs); len(providers) > 0 {
+		notifier = notifier.Only(providers)
+	}
+	if len(notifier) == 0 {
+		return
+	}
+
+	msg = app.completeMessage(msg)
+	app.notifying.Add(1)
+	go func() {
+		defer app.notifying.Done()
+		if err := notifier.Notify(msg); err != nil {
+			app.Logger.Errorf("Failed to send gate open notification: %v", err)
+		}
+	}()
+}
+
+// isGateOpenEvent reports whether event is sent for opens, which
+// GateNotifier already hears about
+func isGateOpenEvent(event string) bool {
+	return event == "arrived" || event == "left"
+}
+
+// Send a test notification API, to check the configured providers. Sends
+// through all of them, or only {"provider": "telegram"} and the like, and
+// reports what failed instead of only logging it.
+func (app *App) TestNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Provider string `json:"provider"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		app.sendJSONError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	notifier := app.Notifier
+	if notifier == nil {
+		app.sendJSONError(w, "Notifications are not configured", http.StatusBadRequest)
+		return
+	}
+	if req.Provider != "" {
+		group, _ := notifier.(notify.Group)
+		only := group.Only([]string{req.Provider})
+		if len(only) == 0 {
+			app.sendJSONError(w, fmt.Sprintf("Notification provider %q is not configured", req.Provider), http.StatusBadRequest)
+			return
+		}
+		notifier = only
+	}
+
+	instance := app.Config.Server.Instance()
+	if err := notifier.Notify(notify.Message{
+		Event:    "test",
+		Text:     fmt.Sprintf("[%s] Test notification from UniFi Gate Opener", instance),
+		Instance: instance,
+		Time:     app.clock(),
+	}); err != nil {
+		app.Logger.Errorf("Failed to send test notification: %v", err)
+		app.sendJSONError(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"success": true}); err != nil {
+		app.Logger.Errorf("Failed to encode response: %v", err)
+	}
+}
+
+// notifyInBackground sends msg without holding up the caller, which may be
+// holding monitoringMu while the notifier waits on the network
+func (app *App) notifyInBackground(msg notify.Message) {
+	app.notifying.Add(1)
+	go func() {
+		defer app.notifying.Done()
+		app.sendNotification(msg)
+	}()
+}
+
+// notifierFor picks the notifiers msg should go to, nil if none. A device's
+// own notification settings take precedence over those of the gate the
+// event is at, which take precedence over the global ones.
+func (app *App) notifierFor(msg notify.Message) notify.Notifier {
+	if app.Notifier == nil {
+		return nil
+	}
+
+	var prefs *config.DeviceNotifyConfig
+	if device := app.messageDevice(msg); device != nil {
+		prefs = device.Notifications
+	}
+	if !prefs.Wants(msg.Event, app.Config.Notifications.Events) {
+		return nil
+	}
+
+	group, ok := app.Notifier.(notify.Group)
+	if !ok {
+		return app.Notifier
+	}
+	if providers := app.messageProviders(msg, prefs); len(providers) > 0 {
+		group = group.Only(providers)
+	}
+	if isGateOpenEvent(msg.Event) {
+		names := make([]string, len(app.GateNotifier))
+		for i, n := range app.GateNotifier {
+			names[i] = n.Name
+		}
+		group = group.Without(names)
+	}
+	if len(group) > 0 {
+		return group
+	}
+	return nil
+}
+
+// messageProviders are the providers msg is limited to by the device's
+// prefs or else its gate, nil for all of them
+func (app *App) messageProviders(msg notify.Message, prefs *config.DeviceNotifyConfig) []string {
+	if prefs != nil && len(prefs.Providers) > 0 {
+		return prefs.Providers
+	}
+	return app.Config.Notifications.GateProviders(msg.Gate)
+}
+
+// messageDevice is the tracked device msg is about, nil if none
+func (app *App) messageDevice(msg notify.Message) *config.DeviceConfig {
+	if msg.DeviceMAC == "" {
+		return nil
+	}
+	return app.findDevice(msg.DeviceMAC)
+}
+
+// checkAbsentDevices notifies about devices that haven't shown up by their
+// expected time. Each device is checked once a day, on the first poll after
+// its deadline, so arriving late neither cancels nor repeats the alert. Only
+// runs after successful polls, so a controller outage can't cause alerts.
+func (app *App) checkAbsentDevices() {
+	now := app.clock()
+	today := now.Format("2006-01-02")
+
+	var absent []notify.Message
+	app.monitoringMu.Lock()
+	for _, state := range app.deviceStates {
+		if state.ExpectedBy == "" || state.absentCheckedOn == today {
+			continue
+		}
+		offset, err := config.ParseClock(state.ExpectedBy)
+		if err != nil {
+			continue
+		}
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		if now.Before(midnight.Add(offset)) {
+			continue
+		}
+
+		// Any sighting today counts, the device doesn't have to still be around
+		state.absentCheckedOn = today
+		if state.IsConnected || !state.LastSeen.Before(midnight) {
+			continue
+		}
+
+		absent = append(absent, notify.Message{
+			Event:      "device_absent",
+			Text:       fmt.Sprintf("%s has not been seen since %s (expected by %s)", state.Name, formatLastSeen(state.LastSeen), state.ExpectedBy),
+			DeviceMAC:  state.MAC,
+			DeviceName: state.Name,
+			Gate:       state.Gate,
+			Time:       now,
+		})
+	}
+	app.monitoringMu.Unlock()
+
+	for _, msg := range absent {
+		app.Logger.Infof("Device %s absent: %s", msg.DeviceName, msg.Text)
+
+		if app.Config.Gate.LogActivity {
+			if err := app.logEvent(&database.LogEntry{
+				DeviceMAC:  msg.DeviceMAC,
+				DeviceName: msg.DeviceName,
+				Event:      "device_absent",
+				Message:    msg.Text,
+			}); err != nil {
+				app.Logger.Errorf("Failed to log event for %s: %v", msg.DeviceMAC, err)
+			}
+		}
+
+		app.sendNotification(msg)
+	}
+}
+
+// validExpectedBy rejects an expected_by that isn't empty or "HH:MM"
+func validExpectedBy(w http.ResponseWriter, expectedBy string) bool {
+	if expectedBy == "" {
+		return true
+	}
+	if _, err := config.ParseClock(expectedBy); err != nil {
+		http.Error(w, "expected_by must be HH:MM", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func formatLastSeen(t time.Time) string {
+	if t.IsZero() {
+		return "ever"
+	}
+	return t.Local().Format("Mon 15:04")
+}
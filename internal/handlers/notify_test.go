@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+	"github.com/fbettag/unifi-gate-opener/internal/notify"
+)
+
+// recordingNotifier keeps every message it is asked to send
+type recordingNotifier struct {
+	mu       sync.Mutex
+	messages []notify.Message
+}
+
+func (n *recordingNotifier) Notify(msg notify.Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.messages = append(n.messages, msg)
+	return nil
+}
+
+func (n *recordingNotifier) sent() []notify.Message {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]notify.Message(nil), n.messages...)
+}
+
+func TestCheckAbsentDevices(t *testing.T) {
+	// newApp returns an app tracking a device expected by 16:30, with a clock
+	// the test can move
+	newApp := func(t *testing.T) (*App, *DeviceState, *recordingNotifier, *time.Time) {
+		app := newTestApp(t)
+		app.Config.Server.InstanceName = "home"
+		notifier := &recordingNotifier{}
+		app.Notifier = notifier
+
+		state := trackDevice(app, testDeviceMAC, "Kid's Phone")
+		state.ExpectedBy = "16:30"
+
+		now := time.Date(2024, 3, 4, 12, 0, 0, 0, time.Local)
+		app.now = func() time.Time { return now }
+		return app, state, notifier, &now
+	}
+
+	t.Run("Device seen before the deadline", func(t *testing.T) {
+		app, state, notifier, now := newApp(t)
+		state.LastSeen = time.Date(2024, 3, 4, 16, 10, 0, 0, time.Local)
+
+		*now = time.Date(2024, 3, 4, 16, 31, 0, 0, time.Local)
+		app.checkAbsentDevices()
+
+		if got := len(notifier.sent()); got != 0 {
+			t.Errorf("Expected no notification, got %d", got)
+		}
+	})
+
+	t.Run("Device not seen by the deadline", func(t *testing.T) {
+		app, state, notifier, now := newApp(t)
+		state.LastSeen = time.Date(2024, 3, 3, 18, 0, 0, 0, time.Local)
+
+		app.checkAbsentDevices()
+		if got := len(notifier.sent()); got != 0 {
+			t.Fatalf("Expected no notification before the deadline, got %d", got)
+		}
+
+		*now = time.Date(2024, 3, 4, 16, 31, 0, 0, time.Local)
+		app.checkAbsentDevices()
+		*now = now.Add(time.Minute)
+		app.checkAbsentDevices()
+
+		sent := notifier.sent()
+		if len(sent) != 1 {
+			t.Fatalf("Expected 1 notification, got %d", len(sent))
+		}
+		if sent[0].Event != "device_absent" || sent[0].DeviceMAC != testDeviceMAC {
+			t.Errorf("Unexpected notification: %+v", sent[0])
+		}
+		if !strings.HasPrefix(sent[0].Text, "[home] Kid's Phone") {
+			t.Errorf("Expected the instance prefix and device name, got %q", sent[0].Text)
+		}
+	})
+
+	t.Run("Checked again the next day", func(t *testing.T) {
+		app, _, notifier, now := newApp(t)
+
+		*now = time.Date(2024, 3, 4, 17, 0, 0, 0, time.Local)
+		app.checkAbsentDevices()
+		*now = now.Add(24 * time.Hour)
+		app.checkAbsentDevices()
+
+		if got := len(notifier.sent()); got != 2 {
+			t.Errorf("Expected 2 notifications, got %d", got)
+		}
+	})
+
+	t.Run("Connected device is not absent", func(t *testing.T) {
+		app, state, notifier, now := newApp(t)
+		state.IsConnected = true
+
+		*now = time.Date(2024, 3, 4, 17, 0, 0, 0, time.Local)
+		app.checkAbsentDevices()
+
+		if got := len(notifier.sent()); got != 0 {
+			t.Errorf("Expected no notification, got %d", got)
+		}
+	})
+
+	t.Run("Device without a deadline is ignored", func(t *testing.T) {
+		app, state, notifier, now := newApp(t)
+		state.ExpectedBy = ""
+
+		*now = time.Date(2024, 3, 4, 23, 0, 0, 0, time.Local)
+		app.checkAbsentDevices()
+
+		if got := len(notifier.sent()); got != 0 {
+			t.Errorf("Expected no notification, got %d", got)
+		}
+	})
+}
+
+func TestDeviceNotificationPreferences(t *testing.T) {
+	const otherMAC = "AA:BB:CC:DD:EE:02"
+	disabled := false
+
+	newApp := func(t *testing.T, notifier notify.Notifier) *App {
+		app := newTestApp(t)
+		newTestRelay(t, app)
+		app.Notifier = notifier
+		app.Config.Notifications.Events = []string{"device_absent", "arrived"}
+		app.Config.Devices = []config.DeviceConfig{
+			{MAC: testDeviceMAC, Name: "Kid's Phone", Enabled: true},
+			{MAC: otherMAC, Name: "My Phone", Enabled: true},
+		}
+		return app
+	}
+	arrive := func(app *App, mac, name string) {
+		app.checkAndOpenGate(trackDevice(app, mac, name), directionArriving)
+		app.notifying.Wait()
+	}
+
+	t.Run("Muted device doesn't notify", func(t *testing.T) {
+		notifier := &recordingNotifier{}
+		app := newApp(t, notifier)
+		app.Config.Devices[1].Notifications = &config.DeviceNotifyConfig{Enabled: &disabled}
+
+		arrive(app, otherMAC, "My Phone")
+		arrive(app, testDeviceMAC, "Kid's Phone")
+
+		sent := notifier.sent()
+		if len(sent) != 1 {
+			t.Fatalf("Expected 1 notification, got %d", len(sent))
+		}
+		if sent[0].Event != "arrived" || sent[0].DeviceName != "Kid's Phone" {
+			t.Errorf("Expected the kid's arrival, got %+v", sent[0])
+		}
+	})
+
+	t.Run("Device events replace the global ones", func(t *testing.T) {
+		notifier := &recordingNotifier{}
+		app := newApp(t, notifier)
+		app.Config.Devices[0].Notifications = &config.DeviceNotifyConfig{Events: []string{"left"}}
+
+		arrive(app, testDeviceMAC, "Kid's Phone")
+		if got := len(notifier.sent()); got != 0 {
+			t.Errorf("Expected no notification, got %d", got)
+		}
+
+		state := app.deviceStates[testDeviceMAC]
+		state.clearTriggers() // past the cooldown
+		app.checkAndOpenGate(state, directionLeaving)
+		app.notifying.Wait()
+		if sent := notifier.sent(); len(sent) != 1 || sent[0].Event != "left" {
+			t.Errorf("Expected a departure notification, got %+v", sent)
+		}
+	})
+
+	t.Run("Device picks its providers", func(t *testing.T) {
+		webhook, chat := &recordingNotifier{}, &recordingNotifier{}
+		app := newApp(t, notify.Group{
+			{Name: "webhook", Notifier: webhook},
+			{Name: "chat", Notifier: chat},
+		})
+		app.Config.Devices[0].Notifications = &config.DeviceNotifyConfig{Providers: []string{"chat"}}
+
+		arrive(app, testDeviceMAC, "Kid's Phone")
+		arrive(app, otherMAC, "My Phone")
+
+		if got := len(chat.sent()); got != 2 {
+			t.Errorf("Expected 2 chat notifications, got %d", got)
+		}
+		if sent := webhook.sent(); len(sent) != 1 || sent[0].DeviceName != "My Phone" {
+			t.Errorf("Expected only My Phone on the webhook, got %+v", sent)
+		}
+	})
+
+	t.Run("Events go to their gate's providers", func(t *testing.T) {
+		front, side := &recordingNotifier{}, &recordingNotifier{}
+		app := newApp(t, notify.Group{
+			{Name: "phone", Notifier: front},
+			{Name: "chat", Notifier: side},
+		})
+		app.Config.Gates = []config.RelayConfig{{Name: "Side", TriggerURL: app.Config.Shelly.TriggerURL}}
+		app.Config.Notifications.Gates = map[string][]string{"main": {"phone"}, "side": {"chat"}}
+
+		arrive(app, testDeviceMAC, "Kid's Phone")
+		state := trackDevice(app, otherMAC, "My Phone")
+		state.Gate = "Side"
+		app.checkAndOpenGate(state, directionArriving)
+		app.notifying.Wait()
+
+		if sent := front.sent(); len(sent) != 1 || sent[0].DeviceName != "Kid's Phone" || sent[0].Gate != "" {
+			t.Errorf("Expected only the main gate's arrival on the phone, got %+v", sent)
+		}
+		if sent := side.sent(); len(sent) != 1 || sent[0].DeviceName != "My Phone" || sent[0].Gate != "Side" {
+			t.Errorf("Expected only the side gate's arrival in the chat, got %+v", sent)
+		}
+	})
+
+	t.Run("Device providers win over the gate's", func(t *testing.T) {
+		front, side := &recordingNotifier{}, &recordingNotifier{}
+		app := newApp(t, notify.Group{
+			{Name: "phone", Notifier: front},
+			{Name: "chat", Notifier: side},
+		})
+		app.Config.Notifications.Gates = map[string][]string{"main": {"phone"}}
+		app.Config.Devices[0].Notifications = &config.DeviceNotifyConfig{Providers: []string{"chat"}}
+
+		arrive(app, testDeviceMAC, "Kid's Phone")
+		if len(front.sent()) != 0 || len(side.sent()) != 1 {
+			t.Errorf("Expected the device's provider alone, got %d and %d", len(front.sent()), len(side.sent()))
+		}
+	})
+
+	t.Run("Unknown events are rejected", func(t *testing.T) {
+		app := newApp(t, nil)
+		markConfigured(app)
+
+		w := httptest.NewRecorder()
+		app.AddDeviceHandler(w, httptest.NewRequest("POST", "/api/devices",
+			strings.NewReader(`{"mac":"AA:BB:CC:DD:EE:03","name":"Tablet","notifications":{"events":["opened"]}}`)))
+		if w.Code != 400 {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestTestNotificationHandler(t *testing.T) {
+	t.Run("Sends through every provider", func(t *testing.T) {
+		app := newTestApp(t)
+		webhook, chat := &recordingNotifier{}, &recordingNotifier{}
+		app.Notifier = notify.Group{{Name: "webhook", Notifier: webhook}, {Name: "telegram", Notifier: chat}}
+
+		w, resp := postJSON(t, app.TestNotificationHandler, "/api/test-notification", nil)
+		if w.Code != http.StatusOK || resp["success"] != true {
+			t.Fatalf("Expected a successful test, got %d: %v", w.Code, resp)
+		}
+		if len(webhook.sent()) != 1 || len(chat.sent()) != 1 || chat.sent()[0].Event != "test" {
+			t.Errorf("Expected one test message per provider, got %+v and %+v", webhook.sent(), chat.sent())
+		}
+	})
+
+	t.Run("Only the picked provider", func(t *testing.T) {
+		app := newTestApp(t)
+		webhook, chat := &recordingNotifier{}, &recordingNotifier{}
+		app.Notifier = notify.Group{{Name: "webhook", Notifier: webhook}, {Name: "telegram", Notifier: chat}}
+
+		w, _ := postJSON(t, app.TestNotificationHandler, "/api/test-notification", map[string]string{"provider": "telegram"})
+		if w.Code != http.StatusOK || len(webhook.sent()) != 0 || len(chat.sent()) != 1 {
+			t.Errorf("Expected only Telegram to be tested, got %d", w.Code)
+		}
+
+		w, _ = postJSON(t, app.TestNotificationHandler, "/api/test-notification", map[string]string{"provider": "pager"})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for an unconfigured provider, got %d", w.Code)
+		}
+	})
+
+	t.Run("Failures are reported", func(t *testing.T) {
+		app := newTestApp(t)
+		app.Notifier = notify.Group{{Name: "telegram", Notifier: failingNotifier{}}}
+
+		w, resp := postJSON(t, app.TestNotificationHandler, "/api/test-notification", nil)
+		if w.Code != http.StatusBadGateway || !strings.Contains(resp["error"].(string), "chat not found") {
+			t.Errorf("Expected the failure to be reported, got %d: %v", w.Code, resp)
+		}
+	})
+
+	t.Run("Not configured", func(t *testing.T) {
+		app := newTestApp(t)
+		w, _ := postJSON(t, app.TestNotificationHandler, "/api/test-notification", nil)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+}
+
+// failingNotifier fails every message
+type failingNotifier struct{}
+
+func (failingNotifier) Notify(notify.Message) error {
+	return errors.New("telegram returned status 400: Bad Request: chat not found")
+}
+
+func TestFailingNotificationDoesntFailOpen(t *testing.T) {
+	app := newTestApp(t)
+	hits := newTestRelay(t, app)
+	app.Notifier = notify.Group{{Name: "telegram", Notifier: failingNotifier{}}}
+	app.Config.Notifications.Events = []string{"arrived"}
+
+	if !app.checkAndOpenGate(trackDevice(app, testDeviceMAC, "Phone"), directionArriving) {
+		t.Error("Expected the gate to open")
+	}
+	app.notifying.Wait()
+	if got := atomic.LoadInt32(hits); got != 1 {
+		t.Errorf("Expected 1 trigger at the relay, got %d", got)
+	}
+}
+
+func TestGateOpenNotifications(t *testing.T) {
+	newApp := func(t *testing.T) (*App, *recordingNotifier, *recordingNotifier) {
+		app := newTestApp(t)
+		newTestRelay(t, app)
+		webhook, telegram := &recordingNotifier{}, &recordingNotifier{}
+		group := notify.Group{{Name: "webhook", Notifier: webhook}, {Name: "telegram", Notifier: telegram}}
+		app.Notifier = group
+		app.GateNotifier = group.Only([]string{"telegram"})
+		app.Config.Server.InstanceName = "home"
+		app.Config.Devices = []config.DeviceConfig{{MAC: testDeviceMAC, Name: "Kid's Phone", Enabled: true}}
+		return app, webhook, telegram
+	}
+	arrive := func(app *App) {
+		app.checkAndOpenGate(trackDevice(app, testDeviceMAC, "Kid's Phone"), directionArriving)
+		app.notifying.Wait()
+	}
+
+	t.Run("Automatic opens despite the events filter", func(t *testing.T) {
+		app, webhook, telegram := newApp(t)
+		arrive(app)
+
+		if sent := telegram.sent(); len(sent) != 1 || sent[0].Event != "arrived" || sent[0].Text != "[home] Kid's Phone arrived, gate opened" {
+			t.Errorf("Expected the arrival on Telegram, got %+v", sent)
+		}
+		if got := len(webhook.sent()); got != 0 {
+			t.Errorf("Expected the webhook to follow the events filter, got %d", got)
+		}
+	})
+
+	t.Run("Once with the event enabled too", func(t *testing.T) {
+		app, webhook, telegram := newApp(t)
+		app.Config.Notifications.Events = []string{"arrived"}
+		arrive(app)
+
+		if len(telegram.sent()) != 1 || len(webhook.sent()) != 1 {
+			t.Errorf("Expected one arrival each, got %d on Telegram and %d on the webhook", len(telegram.sent()), len(webhook.sent()))
+		}
+	})
+
+	t.Run("Manual and external opens", func(t *testing.T) {
+		app, webhook, telegram := newApp(t)
+		app.Config.Server.TriggerToken = "doorbell-token"
+
+		if w, _ := postJSON(t, app.TestGateHandler, "/api/test-gate", nil); w.Code != http.StatusOK {
+			t.Fatalf("Expected the manual open to work, got %d", w.Code)
+		}
+		req := httptest.NewRequest("POST", "/api/gate/trigger", strings.NewReader(`{"actor":"Doorbell"}`))
+		req.Header.Set("Authorization", "Bearer doorbell-token")
+		w := httptest.NewRecorder()
+		app.ExternalTriggerHandler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected the external open to work, got %d", w.Code)
+		}
+		app.notifying.Wait()
+
+		sent := telegram.sent()
+		if len(sent) != 2 || sent[0].Event != "gate_triggered" || !strings.Contains(sent[1].Text, "Gate opened by Doorbell") {
+			t.Errorf("Expected both opens on Telegram, got %+v", sent)
+		}
+		if got := len(webhook.sent()); got != 0 {
+			t.Errorf("Expected nothing on the webhook, got %d", got)
+		}
+	})
+
+	t.Run("Muted device stays quiet", func(t *testing.T) {
+		app, _, telegram := newApp(t)
+		muted := false
+		app.Config.Devices[0].Notifications = &config.DeviceNotifyConfig{Enabled: &muted}
+		arrive(app)
+
+		if got := len(telegram.sent()); got != 0 {
+			t.Errorf("Expected no notification, got %d", got)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// devicePresence is whether a tracked device was connected at a given time
+type devicePresence struct {
+	MAC       string     `json:"mac"`
+	Name      string     `json:"name"`
+	Connected bool       `json:"connected"`
+	APMAC     string     `json:"ap_mac,omitempty"`
+	Since     *time.Time `json:"since,omitempty"` // null without any logged events before then
+}
+
+// Which tracked devices were connected at a point in time, replayed from the
+// activity log. Takes an RFC 3339 "at", defaulting to now.
+func (app *App) GetPresenceHandler(w http.ResponseWriter, r *http.Request) {
+	at := app.clock()
+	if value := r.URL.Query().Get("at"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "invalid at: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		at = t
+	}
+
+	replayed, err := app.DB.PresenceAt(at)
+	if err != nil {
+		app.Logger.Errorf("Failed to reconstruct presence: %v", err)
+		http.Error(w, "Failed to get presence", http.StatusInternalServerError)
+		return
+	}
+
+	devices := make([]devicePresence, 0, len(app.Config.Devices))
+	present := []string{}
+	for _, device := range app.Config.Devices {
+		presence := devicePresence{MAC: device.MAC, Name: device.Name}
+		if state, ok := replayed[strings.ToUpper(device.MAC)]; ok {
+			since := state.Since
+			presence.Connected = state.Connected
+			presence.APMAC = state.AP
+			presence.Since = &since
+		}
+		if presence.Connected {
+			present = append(present, device.Name)
+		}
+		devices = append(devices, presence)
+	}
+
+	response := map[string]interface{}{
+		"at":      at,
+		"present": present,
+		"devices": devices,
+	}
+	// Connections are only logged with activity logging on
+	if !app.Config.Gate.LogActivity {
+		response["warning"] = "Activity logging is disabled, presence may be incomplete"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		app.Logger.Errorf("Failed to encode presence: %v", err)
+	}
+}
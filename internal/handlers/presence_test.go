@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+)
+
+func TestGetPresenceHandler(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Gate.LogActivity = true
+	app.Config.Devices = []config.DeviceConfig{
+		{MAC: testDeviceMAC, Name: "Phone", Enabled: true},
+		{MAC: "AA:BB:CC:DD:EE:02", Name: "Watch", Enabled: true},
+	}
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for _, event := range []struct {
+		at    time.Duration
+		mac   string
+		event string
+	}{
+		{8 * time.Hour, "aa:bb:cc:dd:ee:01", "connected"},
+		{9 * time.Hour, "aa:bb:cc:dd:ee:02", "connected"},
+		{14 * time.Hour, "aa:bb:cc:dd:ee:02", "disconnected"},
+	} {
+		if _, err := app.DB.Exec(`
+			INSERT INTO logs (device_mac, device_name, event, to_ap, timestamp)
+			VALUES (?, '', ?, ?, ?)
+		`, event.mac, event.event, testInteriorAP, day.Add(event.at).Format("2006-01-02 15:04:05")); err != nil {
+			t.Fatalf("Failed to seed event: %v", err)
+		}
+	}
+
+	t.Run("Devices connected at the time", func(t *testing.T) {
+		w, resp := getJSON(t, app.GetPresenceHandler, "/api/presence?at=2024-05-01T15:00:00Z")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+
+		present, _ := resp["present"].([]interface{})
+		if len(present) != 1 || present[0] != "Phone" {
+			t.Errorf("Expected only Phone present, got %v", resp["present"])
+		}
+		if _, ok := resp["warning"]; ok {
+			t.Errorf("Expected no warning with activity logging on, got %v", resp["warning"])
+		}
+
+		devices, _ := resp["devices"].([]interface{})
+		if len(devices) != 2 {
+			t.Fatalf("Expected 2 devices, got %v", resp["devices"])
+		}
+		phone := devices[0].(map[string]interface{})
+		if phone["ap_mac"] != testInteriorAP || phone["since"] != "2024-05-01T08:00:00Z" {
+			t.Errorf("Expected Phone on the interior AP since 08:00, got %v", phone)
+		}
+	})
+
+	t.Run("Nobody before the first event", func(t *testing.T) {
+		_, resp := getJSON(t, app.GetPresenceHandler, "/api/presence?at=2024-05-01T07:00:00Z")
+		if present, _ := resp["present"].([]interface{}); len(present) != 0 {
+			t.Errorf("Expected nobody present, got %v", present)
+		}
+	})
+
+	t.Run("Warns without activity logging", func(t *testing.T) {
+		app.Config.Gate.LogActivity = false
+		defer func() { app.Config.Gate.LogActivity = true }()
+
+		_, resp := getJSON(t, app.GetPresenceHandler, "/api/presence")
+		if _, ok := resp["warning"]; !ok {
+			t.Error("Expected a warning about incomplete presence")
+		}
+	})
+
+	t.Run("Invalid time", func(t *testing.T) {
+		w := serve(http.HandlerFunc(app.GetPresenceHandler), "GET", "/api/presence?at=yesterday", nil)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+}
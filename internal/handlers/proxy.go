@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// redirect is http.Redirect to a path on this site, made absolute with the
+// host and scheme a trusted reverse proxy says the client asked for
+func (app *App) redirect(w http.ResponseWriter, r *http.Request, path string, code int) {
+	http.Redirect(w, r, app.absoluteURL(r, path), code)
+}
+
+// absoluteURL prefixes path with the forwarded scheme and host when the
+// request came through a trusted proxy that sent X-Forwarded-Host. Anything
+// else gets path back unchanged, which browsers resolve against the URL
+// they asked for.
+func (app *App) absoluteURL(r *http.Request, path string) string {
+	if !app.trustedProxy(r) {
+		return path
+	}
+	host := firstForwarded(r.Header.Get("X-Forwarded-Host"))
+	if host == "" || strings.ContainsAny(host, "/\\@?# ") {
+		return path
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	switch proto := strings.ToLower(firstForwarded(r.Header.Get("X-Forwarded-Proto"))); proto {
+	case "http", "https":
+		scheme = proto
+	}
+	return scheme + "://" + host + path
+}
+
+// trustedProxy reports whether the request came straight from one of
+// server.trusted_proxies
+func (app *App) trustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, proxy := range app.Config.Server.TrustedProxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if trusted := net.ParseIP(proxy); trusted != nil && trusted.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstForwarded returns the first of a comma-separated forwarded header's
+// values, the one the client-facing proxy set
+func firstForwarded(value string) string {
+	first, _, _ := strings.Cut(value, ",")
+	return strings.TrimSpace(first)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardedRedirects(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Server.TrustedProxies = []string{"10.0.0.0/8", "fd00::1"}
+	router := app.Routes()
+
+	redirect := func(remoteAddr string, headers map[string]string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusTemporaryRedirect {
+			t.Fatalf("Expected a redirect, got %d", w.Code)
+		}
+		return w.Header().Get("Location")
+	}
+	forwarded := map[string]string{"X-Forwarded-Host": "gate.example.com", "X-Forwarded-Proto": "https"}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"Trusted proxy", "10.1.2.3:41000", forwarded, "https://gate.example.com/setup"},
+		{"Trusted proxy by address", "[fd00::1]:41000", forwarded, "https://gate.example.com/setup"},
+		{"Untrusted peer", "192.0.2.7:41000", forwarded, "/setup"},
+		{"Trusted proxy without forwarded host", "10.1.2.3:41000", map[string]string{"X-Forwarded-Proto": "https"}, "/setup"},
+		{"First of several hosts", "10.1.2.3:41000", map[string]string{"X-Forwarded-Host": "gate.example.com, internal:8080"}, "http://gate.example.com/setup"},
+		{"Unknown scheme is ignored", "10.1.2.3:41000", map[string]string{"X-Forwarded-Host": "gate.example.com", "X-Forwarded-Proto": "javascript"}, "http://gate.example.com/setup"},
+		{"Host that isn't one is ignored", "10.1.2.3:41000", map[string]string{"X-Forwarded-Host": "evil.example/path"}, "/setup"},
+	}
+	for _, tt := range tests {
+		if got := redirect(tt.remoteAddr, tt.headers); got != tt.want {
+			t.Errorf("%s: expected redirect to %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
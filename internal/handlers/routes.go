@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"io/fs"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Routes wires up all pages and API endpoints with their middleware
+func (app *App) Routes() *mux.Router {
+	router := mux.NewRouter()
+
+	// Identify the instance, even on redirects
+	router.Use(app.InstanceHeaderMiddleware)
+
+	// Shed load beyond the configured number of requests in flight
+	router.Use(app.ConcurrencyLimitMiddleware)
+
+	// Gzip API responses, log and device lists can get large
+	router.Use(app.CompressionMiddleware)
+
+	// Check if setup is complete middleware (must come before routing)
+	router.Use(app.CheckSetupMiddleware)
+
+	// Static files
+	staticFS, _ := fs.Sub(app.WebFS, "web/static")
+	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
+
+	// Setup wizard routes (no auth required)
+	router.HandleFunc("/setup", app.SetupWizardHandler).Methods("GET")
+	router.HandleFunc("/api/setup", app.SetupAPIHandler).Methods("POST")
+	router.HandleFunc("/api/test-unifi", app.TestUniFiHandler).Methods("POST")
+	router.HandleFunc("/api/test-unifi-sites", app.TestUniFiSitesHandler).Methods("POST")
+	router.HandleFunc("/api/test-unifi-paths", app.TestUniFiPathsHandler).Methods("POST")
+
+	// Probes for container orchestration, before and after setup
+	router.HandleFunc("/healthz", app.HealthHandler).Methods("GET")
+	router.HandleFunc("/readyz", app.ReadyHandler).Methods("GET")
+
+	// Public routes
+	router.HandleFunc("/", app.IndexHandler).Methods("GET")
+	router.HandleFunc("/login", app.LoginPageHandler).Methods("GET")
+	router.HandleFunc("/api/login", app.LoginHandler).Methods("POST")
+	router.HandleFunc("/api/logs.ics", app.LogFeedHandler).Methods("GET")              // feed token instead of a session
+	router.HandleFunc("/api/gate/trigger", app.ExternalTriggerHandler).Methods("POST") // trigger token instead of a session
+
+	// Protected routes (require authentication)
+	protected := router.PathPrefix("/").Subrouter()
+	protected.Use(app.AuthMiddleware)
+
+	// Dashboard
+	protected.HandleFunc("/dashboard", app.DashboardHandler).Methods("GET")
+	protected.HandleFunc("/logout", app.LogoutHandler).Methods("GET", "POST")
+
+	// API routes
+	api := protected.PathPrefix("/api").Subrouter()
+	api.HandleFunc("/devices", app.GetDevicesHandler).Methods("GET")
+	api.HandleFunc("/devices", app.AddDeviceHandler).Methods("POST")
+	api.HandleFunc("/devices/bulk", app.BulkAddDevicesHandler).Methods("POST")
+	api.HandleFunc("/devices/temporary", app.AddTemporaryDeviceHandler).Methods("POST")
+	api.HandleFunc("/devices/{id}", app.GetDeviceHandler).Methods("GET")
+	api.HandleFunc("/devices/{id}", app.UpdateDeviceHandler).Methods("PUT")
+	api.HandleFunc("/devices/{id}", app.DeleteDeviceHandler).Methods("DELETE")
+	api.HandleFunc("/devices/{id}/reset-cooldown", app.ResetCooldownHandler).Methods("POST")
+	api.HandleFunc("/devices/{id}/would-open", app.WouldOpenHandler).Methods("GET")
+
+	api.HandleFunc("/settings", app.GetSettingsHandler).Methods("GET")
+	api.HandleFunc("/settings", app.UpdateSettingsHandler).Methods("PUT")
+	api.HandleFunc("/settings/history", app.GetSettingsHistoryHandler).Methods("GET")
+	api.HandleFunc("/password", app.ChangePasswordHandler).Methods("PUT")
+	api.HandleFunc("/users", app.GetUsersHandler).Methods("GET")
+	api.HandleFunc("/users", app.AddUserHandler).Methods("POST")
+	api.HandleFunc("/users/{username}", app.DeleteUserHandler).Methods("DELETE")
+	api.HandleFunc("/sessions", app.GetSessionsHandler).Methods("GET")
+	api.HandleFunc("/sessions/{id}", app.RevokeSessionHandler).Methods("DELETE")
+	api.HandleFunc("/tokens", app.GetTokensHandler).Methods("GET")
+	api.HandleFunc("/tokens", app.CreateTokenHandler).Methods("POST")
+	api.HandleFunc("/tokens/{id}", app.RevokeTokenHandler).Methods("DELETE")
+	api.HandleFunc("/export", app.ExportBundleHandler).Methods("GET")
+	api.HandleFunc("/import", app.ImportBundleHandler).Methods("POST")
+
+	api.HandleFunc("/logs", app.GetLogsHandler).Methods("GET")
+	api.HandleFunc("/logs/stream", app.LogStreamHandler).Methods("GET")
+	api.HandleFunc("/ws", app.WebSocketHandler).Methods("GET")
+	api.HandleFunc("/logs/export", app.ExportLogsHandler).Methods("GET")
+	api.HandleFunc("/logs/{id:[0-9]+}", app.GetLogHandler).Methods("GET")
+	api.HandleFunc("/status", app.GetStatusHandler).Methods("GET")
+	api.HandleFunc("/status.txt", app.GetStatusTextHandler).Methods("GET")
+	api.HandleFunc("/presence", app.GetPresenceHandler).Methods("GET")
+	api.HandleFunc("/stats", app.GetStatsHandler).Methods("GET")
+	api.HandleFunc("/database/integrity", app.IntegrityCheckHandler).Methods("GET")
+	api.HandleFunc("/database/optimize", app.OptimizeDatabaseHandler).Methods("POST")
+
+	api.HandleFunc("/unifi/aps", app.GetAccessPointsHandler).Methods("GET")
+	api.HandleFunc("/unifi/aps/stats", app.GetAccessPointStatsHandler).Methods("GET")
+	api.HandleFunc("/unifi/clients", app.GetUniFiClientsHandler).Methods("GET")
+	api.HandleFunc("/unifi/clients/{mac}/raw", app.GetUniFiClientRawHandler).Methods("GET")
+	api.HandleFunc("/unifi/known-clients", app.GetKnownClientsHandler).Methods("GET")
+	api.HandleFunc("/gate/open", app.OpenGateHandler).Methods("POST")
+	api.HandleFunc("/test-gate", app.TestGateHandler).Methods("POST")
+	api.HandleFunc("/test-gate/confirm", app.OpenConfirmationHandler).Methods("POST")
+	api.HandleFunc("/test-gate-url", app.TestGateURLHandler).Methods("POST")
+	api.HandleFunc("/test-notification", app.TestNotificationHandler).Methods("POST")
+	api.HandleFunc("/simulate", app.SimulateHandler).Methods("POST")
+	api.HandleFunc("/learning", app.GetLearningHandler).Methods("GET")
+	api.HandleFunc("/learning", app.StartLearningHandler).Methods("POST")
+
+	return router
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/fbettag/unifi-gate-opener/internal/auth"
+)
+
+// serve sends a request through the full router, optionally with a session cookie
+func serve(router http.Handler, method, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader("{"))
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// loginCookie returns a valid session cookie for app
+func loginCookie(t *testing.T, app *App) *http.Cookie {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	if err := app.SessionStore.Login(httptest.NewRequest("POST", "/api/login", nil), w); err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == auth.SessionName {
+			return cookie
+		}
+	}
+	t.Fatal("Login should set a session cookie")
+	return nil
+}
+
+func TestRoutesBeforeSetup(t *testing.T) {
+	app := newTestApp(t)
+	router := app.Routes()
+
+	t.Run("Setup endpoints are reachable", func(t *testing.T) {
+		for _, path := range []string{"/api/setup", "/api/test-unifi", "/api/test-unifi-sites"} {
+			// The handlers reject the malformed body, so the request got through
+			if w := serve(router, "POST", path, nil); w.Code != http.StatusBadRequest {
+				t.Errorf("POST %s: expected status 400, got %d", path, w.Code)
+			}
+		}
+	})
+
+	t.Run("Everything else redirects to setup", func(t *testing.T) {
+		// The setup check runs before authentication, so API calls
+		// are redirected rather than rejected as unauthorized
+		for _, path := range []string{"/", "/dashboard", "/api/devices", "/api/status"} {
+			w := serve(router, "GET", path, nil)
+			if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "/setup" {
+				t.Errorf("GET %s: expected redirect to /setup, got %d %s", path, w.Code, w.Header().Get("Location"))
+			}
+		}
+	})
+}
+
+func TestRoutesAfterSetup(t *testing.T) {
+	app := newTestApp(t)
+	markConfigured(app)
+	router := app.Routes()
+
+	t.Run("Setup is blocked", func(t *testing.T) {
+		for _, route := range []struct{ method, path string }{
+			{"GET", "/setup"},
+			{"POST", "/api/setup"},
+			{"POST", "/api/test-unifi"},
+			{"POST", "/api/test-unifi-sites"},
+		} {
+			w := serve(router, route.method, route.path, nil)
+			if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "/" {
+				t.Errorf("%s %s: expected redirect to /, got %d %s", route.method, route.path, w.Code, w.Header().Get("Location"))
+			}
+		}
+	})
+
+	protectedAPI := []struct{ method, path string }{
+		{"GET", "/api/devices"},
+		{"POST", "/api/devices"},
+		{"POST", "/api/devices/bulk"},
+		{"POST", "/api/devices/temporary"},
+		{"GET", "/api/devices/AA:BB:CC:DD:EE:01"},
+		{"PUT", "/api/devices/AA:BB:CC:DD:EE:01"},
+		{"DELETE", "/api/devices/AA:BB:CC:DD:EE:01"},
+		{"POST", "/api/devices/AA:BB:CC:DD:EE:01/reset-cooldown"},
+		{"GET", "/api/devices/AA:BB:CC:DD:EE:01/would-open"},
+		{"GET", "/api/settings"},
+		{"PUT", "/api/settings"},
+		{"GET", "/api/settings/history"},
+		{"PUT", "/api/password"},
+		{"GET", "/api/sessions"},
+		{"DELETE", "/api/sessions/ABC"},
+		{"GET", "/api/users"},
+		{"POST", "/api/users"},
+		{"DELETE", "/api/users/alice"},
+		{"GET", "/api/tokens"},
+		{"POST", "/api/tokens"},
+		{"DELETE", "/api/tokens/0a1b2c3d"},
+		{"GET", "/api/export"},
+		{"POST", "/api/import"},
+		{"GET", "/api/logs"},
+		{"GET", "/api/logs/export"},
+		{"GET", "/api/logs/1"},
+		{"GET", "/api/status"},
+		{"GET", "/api/status.txt"},
+		{"GET", "/api/presence"},
+		{"GET", "/api/stats"},
+		{"GET", "/api/database/integrity"},
+		{"POST", "/api/database/optimize"},
+		{"GET", "/api/unifi/aps"},
+		{"GET", "/api/unifi/aps/stats"},
+		{"GET", "/api/unifi/clients"},
+		{"GET", "/api/unifi/clients/aa:bb:cc:dd:ee:ff/raw"},
+		{"GET", "/api/unifi/known-clients"},
+		{"GET", "/api/ws"},
+		{"POST", "/api/gate/open"},
+		{"POST", "/api/test-gate"},
+		{"POST", "/api/test-gate/confirm"},
+		{"POST", "/api/test-gate-url"},
+		{"POST", "/api/test-notification"},
+		{"POST", "/api/simulate"},
+		{"GET", "/api/learning"},
+		{"POST", "/api/learning"},
+	}
+
+	t.Run("API requires authentication", func(t *testing.T) {
+		for _, route := range protectedAPI {
+			if w := serve(router, route.method, route.path, nil); w.Code != http.StatusUnauthorized {
+				t.Errorf("%s %s: expected status 401, got %d", route.method, route.path, w.Code)
+			}
+		}
+	})
+
+	t.Run("Pages redirect to login", func(t *testing.T) {
+		for path, location := range map[string]string{
+			"/dashboard": "/login?next=%2Fdashboard",
+			"/logout":    "/login",
+		} {
+			w := serve(router, "GET", path, nil)
+			if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != location {
+				t.Errorf("GET %s: expected redirect to %s, got %d %s", path, location, w.Code, w.Header().Get("Location"))
+			}
+		}
+	})
+
+	t.Run("Login is public", func(t *testing.T) {
+		// Malformed body reaches the handler instead of being rejected as unauthorized
+		if w := serve(router, "POST", "/api/login", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("Authenticated requests reach the API", func(t *testing.T) {
+		cookie := loginCookie(t, app)
+		for _, path := range []string{"/api/devices", "/api/status", "/api/settings"} {
+			if w := serve(router, "GET", path, cookie); w.Code != http.StatusOK {
+				t.Errorf("GET %s: expected status 200, got %d", path, w.Code)
+			}
+		}
+	})
+}
+
+func TestLoginRedirect(t *testing.T) {
+	app := newTestApp(t)
+	markConfigured(app)
+	if err := app.Config.SetAdminPassword("testpassword123"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	router := app.Routes()
+
+	t.Run("Deep link survives the login", func(t *testing.T) {
+		w := serve(router, "GET", "/dashboard?x=1", nil)
+		if w.Code != http.StatusTemporaryRedirect {
+			t.Fatalf("Expected a redirect to the login, got %d", w.Code)
+		}
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil || location.Path != "/login" {
+			t.Fatalf("Expected a redirect to /login, got %q", w.Header().Get("Location"))
+		}
+		next := location.Query().Get("next")
+		if next != "/dashboard?x=1" {
+			t.Fatalf("Expected next /dashboard?x=1, got %q", next)
+		}
+
+		_, resp := postJSON(t, app.LoginHandler, "/api/login", map[string]string{
+			"username": "admin",
+			"password": "testpassword123",
+			"next":     next,
+		})
+		if resp["redirect"] != "/dashboard?x=1" {
+			t.Errorf("Expected redirect /dashboard?x=1, got %v", resp["redirect"])
+		}
+	})
+
+	t.Run("Only local paths are followed", func(t *testing.T) {
+		for _, next := range []string{"", "https://evil.test/", "//evil.test/", "/\\evil.test/", "dashboard"} {
+			_, resp := postJSON(t, app.LoginHandler, "/api/login", map[string]string{
+				"username": "admin",
+				"password": "testpassword123",
+				"next":     next,
+			})
+			if resp["redirect"] != "/dashboard" {
+				t.Errorf("Expected redirect /dashboard for next %q, got %v", next, resp["redirect"])
+			}
+		}
+	})
+
+	t.Run("Configured landing page", func(t *testing.T) {
+		app.Config.Server.LoginRedirect = "/dashboard#logs"
+		defer func() { app.Config.Server.LoginRedirect = "" }()
+
+		_, resp := postJSON(t, app.LoginHandler, "/api/login", map[string]string{
+			"username": "admin",
+			"password": "testpassword123",
+		})
+		if resp["redirect"] != "/dashboard#logs" {
+			t.Errorf("Expected redirect /dashboard#logs, got %v", resp["redirect"])
+		}
+	})
+
+	t.Run("Logged in users skip the login page", func(t *testing.T) {
+		w := serve(router, "GET", "/login?next=%2Fdashboard%3Fx%3D1", loginCookie(t, app))
+		if got := w.Header().Get("Location"); got != "/dashboard?x=1" {
+			t.Errorf("Expected a redirect to /dashboard?x=1, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+)
+
+func TestGateSchedule(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Gate.LogActivity = true
+	hits := newTestRelay(t, app)
+	app.Config.Gate.Schedule = config.Schedule{
+		TimeZone: "UTC",
+		Windows:  []config.ScheduleWindow{{Start: "06:00", End: "22:00"}},
+	}
+	now := time.Date(2024, 3, 4, 23, 30, 0, 0, time.UTC)
+	app.now = func() time.Time { return now }
+	state := trackDevice(app, testDeviceMAC, "Phone")
+
+	t.Run("No automatic opens outside the schedule", func(t *testing.T) {
+		if app.checkAndOpenGate(state, directionArriving) {
+			t.Fatal("Expected the gate to stay shut overnight")
+		}
+		if got := atomic.LoadInt32(hits); got != 0 {
+			t.Errorf("Expected no trigger at the relay, got %d", got)
+		}
+
+		logs, err := app.DB.GetLogs(10, 0)
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		if len(logs) != 1 || logs[0].Event != "gate_skipped_schedule" || logs[0].GateOpened {
+			t.Errorf("Expected a gate_skipped_schedule entry, got %+v", logs)
+		}
+	})
+
+	t.Run("Logged without activity logging", func(t *testing.T) {
+		app.Config.Gate.LogActivity = false
+		defer func() { app.Config.Gate.LogActivity = true }()
+
+		app.checkAndOpenGate(state, directionLeaving)
+		logs, err := app.DB.GetLogs(1, 0)
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		if len(logs) != 1 || logs[0].Event != "gate_skipped_schedule" || logs[0].Direction != directionLeaving {
+			t.Errorf("Expected the skip to be logged anyway, got %+v", logs)
+		}
+	})
+
+	t.Run("Simulate and would-open give the same decision", func(t *testing.T) {
+		if open, code, _ := app.openDecision(state, directionArriving); open || code != reasonOutsideSchedule {
+			t.Errorf("Expected %s, got %v %q", reasonOutsideSchedule, open, code)
+		}
+		app.isMonitoring = true
+		defer func() { app.isMonitoring = false }()
+		if open, code := app.wouldOpen(&config.DeviceConfig{MAC: testDeviceMAC, Enabled: true}); open || code != reasonOutsideSchedule {
+			t.Errorf("Expected would-open to say %s, got %v %q", reasonOutsideSchedule, open, code)
+		}
+		if result := app.simulateArrival(testDeviceMAC, true); result.Decision != "skip" {
+			t.Errorf("Expected the simulation to skip, got %+v", result)
+		}
+	})
+
+	t.Run("Manual opens ignore the schedule", func(t *testing.T) {
+		w, resp := postJSON(t, app.TestGateHandler, "/api/test-gate", nil)
+		if w.Code != http.StatusOK || resp["success"] != true {
+			t.Fatalf("Expected the manual open to work, got %d: %v", w.Code, resp)
+		}
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected 1 trigger at the relay, got %d", got)
+		}
+	})
+
+	t.Run("Automatic opens inside the schedule", func(t *testing.T) {
+		now = time.Date(2024, 3, 5, 7, 0, 0, 0, time.UTC)
+		if !app.checkAndOpenGate(state, directionArriving) {
+			t.Fatal("Expected the gate to open in the morning")
+		}
+	})
+}
+
+func TestDeviceInSchedule(t *testing.T) {
+	app := newTestApp(t)
+	markConfigured(app)
+	app.Config.Devices = []config.DeviceConfig{{MAC: "aa:bb:cc:dd:ee:01", Name: "Phone", Enabled: true}}
+	app.Config.Gate.Schedule = config.Schedule{
+		TimeZone: "UTC",
+		Windows:  []config.ScheduleWindow{{Start: "06:00", End: "22:00"}},
+	}
+	now := time.Date(2024, 3, 4, 23, 30, 0, 0, time.UTC)
+	app.now = func() time.Time { return now }
+	router := app.Routes()
+	cookie := loginCookie(t, app)
+
+	inSchedule := func(t *testing.T) bool {
+		t.Helper()
+		w := serve(router, "GET", "/api/devices/aa:bb:cc:dd:ee:01", cookie)
+		var detail struct {
+			InSchedule *bool `json:"in_schedule"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &detail); err != nil || detail.InSchedule == nil {
+			t.Fatalf("Expected in_schedule in the detail, got %d: %s", w.Code, w.Body.String())
+		}
+		return *detail.InSchedule
+	}
+
+	t.Run("Outside the window", func(t *testing.T) {
+		if inSchedule(t) {
+			t.Error("Expected the device to be outside the schedule overnight")
+		}
+	})
+
+	t.Run("Inside the window", func(t *testing.T) {
+		now = time.Date(2024, 3, 5, 7, 0, 0, 0, time.UTC)
+		if !inSchedule(t) {
+			t.Error("Expected the device to be inside the schedule in the morning")
+		}
+	})
+
+	t.Run("Without a schedule", func(t *testing.T) {
+		now = time.Date(2024, 3, 4, 23, 30, 0, 0, time.UTC)
+		app.Config.Gate.Schedule = config.Schedule{}
+		if !inSchedule(t) {
+			t.Error("Expected the device to be inside the schedule without windows")
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/fbettag/unifi-gate-opener/internal/auth"
+	"github.com/gorilla/mux"
+)
+
+// activeSession is a listed session, marking the one making the request
+type activeSession struct {
+	auth.SessionInfo
+	Current bool `json:"current"`
+}
+
+// List active admin sessions. Only server-side sessions can be listed, with
+// the cookie backend the list is empty and tracked is false.
+func (app *App) GetSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"tracked":  app.SessionStore.TracksSessions(),
+		"sessions": []activeSession{},
+	}
+
+	if app.SessionStore.TracksSessions() {
+		infos, err := app.SessionStore.Sessions()
+		if err != nil {
+			app.Logger.Errorf("Failed to list sessions: %v", err)
+			http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+			return
+		}
+
+		current := app.SessionStore.SessionID(r)
+		list := make([]activeSession, 0, len(infos))
+		for _, info := range infos {
+			list = append(list, activeSession{SessionInfo: info, Current: info.ID == current})
+		}
+		response["sessions"] = list
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		app.Logger.Errorf("Failed to encode sessions: %v", err)
+	}
+}
+
+// Revoke a session, logging out whoever holds it
+func (app *App) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	if err := app.SessionStore.Revoke(id); err != nil {
+		switch {
+		case errors.Is(err, auth.ErrSessionsNotTracked):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, auth.ErrSessionNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			app.Logger.Errorf("Failed to revoke session: %v", err)
+			http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		}
+		return
+	}
+	app.Logger.Infof("Revoked session from %s", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"success": true}); err != nil {
+		app.Logger.Errorf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/fbettag/unifi-gate-opener/internal/auth"
+)
+
+func TestSessionsHandlers(t *testing.T) {
+	t.Run("List and revoke server-side sessions", func(t *testing.T) {
+		app := newTestApp(t)
+		markConfigured(app)
+		store, err := auth.NewFilesystemSessionStore(app.Config.SessionSecret, filepath.Join(t.TempDir(), "sessions"))
+		if err != nil {
+			t.Fatalf("Failed to create session store: %v", err)
+		}
+		app.SessionStore = store
+		router := app.Routes()
+
+		laptop := loginCookie(t, app)
+		phone := loginCookie(t, app)
+
+		w := serve(router, "GET", "/api/sessions", laptop)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Tracked  bool `json:"tracked"`
+			Sessions []struct {
+				ID      string `json:"id"`
+				IP      string `json:"ip"`
+				Current bool   `json:"current"`
+			} `json:"sessions"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode sessions: %v", err)
+		}
+		if !resp.Tracked || len(resp.Sessions) != 2 {
+			t.Fatalf("Expected 2 tracked sessions, got %+v", resp)
+		}
+
+		var phoneID string
+		for _, session := range resp.Sessions {
+			if session.IP != "192.0.2.1" {
+				t.Errorf("Expected the login IP, got %q", session.IP)
+			}
+			if !session.Current {
+				phoneID = session.ID
+			}
+		}
+		if phoneID == "" {
+			t.Fatal("Expected exactly one session to be the current one")
+		}
+
+		if w := serve(router, "DELETE", "/api/sessions/"+phoneID, laptop); w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if w := serve(router, "GET", "/api/status", phone); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the revoked session to be logged out, got %d", w.Code)
+		}
+		if w := serve(router, "GET", "/api/status", laptop); w.Code != http.StatusOK {
+			t.Errorf("Expected the other session to stay logged in, got %d", w.Code)
+		}
+
+		if w := serve(router, "DELETE", "/api/sessions/"+phoneID, laptop); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 revoking it again, got %d", w.Code)
+		}
+		if w := serve(router, "DELETE", "/api/sessions/nope", laptop); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 for a bogus ID, got %d", w.Code)
+		}
+	})
+
+	t.Run("Cookie sessions aren't tracked", func(t *testing.T) {
+		app := newTestApp(t)
+		markConfigured(app)
+		router := app.Routes()
+		cookie := loginCookie(t, app)
+
+		w := serve(router, "GET", "/api/sessions", cookie)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		var resp map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode sessions: %v", err)
+		}
+		if resp["tracked"] != false || len(resp["sessions"].([]interface{})) != 0 {
+			t.Errorf("Expected no tracked sessions, got %v", resp)
+		}
+
+		if w := serve(router, "DELETE", "/api/sessions/ABC", cookie); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+	"github.com/fbettag/unifi-gate-opener/internal/gate"
+)
+
+// redactedValue stands in for secrets in the settings history
+const redactedValue = "[redacted]"
+
+// settingsSnapshot flattens the settings editable through the settings API
+func settingsSnapshot(cfg *config.Config) map[string]string {
+	return map[string]string{
+		"unifi.controller_url": cfg.UniFi.ControllerURL,
+		"unifi.username":       cfg.UniFi.Username,
+		"unifi.password":       cfg.UniFi.Password,
+		"unifi.site_id":        cfg.UniFi.SiteID,
+		"unifi.gate_ap_mac":    cfg.UniFi.GateAPMAC,
+		"unifi.poll_interval":  strconv.Itoa(cfg.UniFi.PollInterval),
+		"unifi.min_signal":     strconv.Itoa(cfg.UniFi.MinSignal),
+		"unifi.unifi_os":       strconv.FormatBool(cfg.UniFi.UnifiOS),
+		"shelly.trigger_url":   cfg.Shelly.TriggerURL,
+		"shelly.close_url":     cfg.Shelly.CloseURL,
+		"shelly.method":        cfg.Shelly.Method,
+		"shelly.body":          cfg.Shelly.Body,
+		"shelly.username":      cfg.Shelly.Username,
+		"shelly.password":      cfg.Shelly.Password,
+		"shelly.bearer_token":  cfg.Shelly.BearerToken,
+		"gate.open_duration":   strconv.Itoa(cfg.Gate.OpenDuration),
+		"gate.log_activity":    strconv.FormatBool(cfg.Gate.LogActivity),
+		"gate.observe_only":    strconv.FormatBool(cfg.Gate.ObserveOnly),
+	}
+}
+
+// redactSetting hides secrets before a value is stored in the history
+func redactSetting(setting, value string) string {
+	switch setting {
+	case "unifi.password", "shelly.password", "shelly.bearer_token":
+		if value == "" {
+			return ""
+		}
+		return redactedValue
+	case "shelly.trigger_url", "shelly.close_url":
+		return gate.RedactURL(value)
+	default:
+		return value
+	}
+}
+
+// recordSettingChanges stores what differs between a snapshot taken before an
+// update and the current settings. Changed secrets are recorded redacted, so
+// the history shows that they changed but not to what.
+func (app *App) recordSettingChanges(before map[string]string) {
+	var changes []database.SettingChange
+	for setting, newValue := range settingsSnapshot(app.Config) {
+		if oldValue := before[setting]; oldValue != newValue {
+			changes = append(changes, database.SettingChange{
+				Setting:  setting,
+				OldValue: redactSetting(setting, oldValue),
+				NewValue: redactSetting(setting, newValue),
+			})
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Setting < changes[j].Setting })
+	if err := app.DB.RecordSettingChanges(changes); err != nil {
+		app.Logger.Errorf("Failed to record settings history: %v", err)
+	}
+}
+
+// Get settings history API
+func (app *App) GetSettingsHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset := 100, 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil {
+			limit = v
+		}
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil {
+			offset = v
+		}
+	}
+
+	changes, err := app.DB.GetSettingsHistory(limit, offset)
+	if err != nil {
+		app.Logger.Errorf("Failed to get settings history: %v", err)
+		http.Error(w, "Failed to get settings history", http.StatusInternalServerError)
+		return
+	}
+	if changes == nil {
+		changes = []database.SettingChange{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(changes); err != nil {
+		app.Logger.Errorf("Failed to encode settings history: %v", err)
+	}
+}
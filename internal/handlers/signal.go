@@ -0,0 +1,71 @@
+package handlers
+
+const (
+	// signalSamples is how many of a device's latest signal readings at its
+	// current AP are kept for the trend
+	signalSamples = 5
+	// signalTrendThreshold is how many dB the signal has to rise or fall
+	// across the samples to count as a clear trend, readings jitter by a few
+	signalTrendThreshold = 4
+)
+
+// recordSignal adds a poll's signal reading at ap, starting over when the
+// device moved to another AP since readings from different APs don't compare
+func (s *DeviceState) recordSignal(ap string, signal int) {
+	if ap != s.signalAP {
+		s.signalAP = ap
+		s.signals = s.signals[:0]
+	}
+	// UniFi reports 0 when it has no reading
+	if signal == 0 {
+		return
+	}
+	if len(s.signals) == signalSamples {
+		s.signals = append(s.signals[:0], s.signals[1:]...)
+	}
+	s.signals = append(s.signals, signal)
+}
+
+// clearSignals forgets the readings, e.g. once the device disconnected
+func (s *DeviceState) clearSignals() {
+	s.signalAP = ""
+	s.signals = s.signals[:0]
+}
+
+// signal is the latest reading at the current AP, 0 without one
+func (s *DeviceState) signal() int {
+	if len(s.signals) == 0 {
+		return 0
+	}
+	return s.signals[len(s.signals)-1]
+}
+
+// signalTrend estimates from the signal at the current AP whether the device
+// is approaching it (rising, directionArriving) or moving away from it
+// (falling, directionLeaving). It's directionUnknown with fewer than two
+// readings or without a clear change.
+func (s *DeviceState) signalTrend() string {
+	if len(s.signals) < 2 {
+		return directionUnknown
+	}
+
+	// Average the older and newer half so a single outlier can't decide
+	half := len(s.signals) / 2
+	older, newer := 0, 0
+	for _, signal := range s.signals[:half] {
+		older += signal
+	}
+	for _, signal := range s.signals[len(s.signals)-half:] {
+		newer += signal
+	}
+	change := (newer - older) / half
+
+	switch {
+	case change >= signalTrendThreshold:
+		return directionArriving
+	case change <= -signalTrendThreshold:
+		return directionLeaving
+	default:
+		return directionUnknown
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/fbettag/unifi-gate-opener/internal/unifi"
+)
+
+func TestSignalTrend(t *testing.T) {
+	tests := []struct {
+		name    string
+		signals []int
+		want    string
+	}{
+		{"No readings", nil, directionUnknown},
+		{"Single reading", []int{-60}, directionUnknown},
+		{"Rising", []int{-80, -74, -67, -61}, directionArriving},
+		{"Falling", []int{-55, -60, -66, -72}, directionLeaving},
+		{"Jitter", []int{-62, -60, -63, -61, -62}, directionUnknown},
+		{"Outlier doesn't decide", []int{-60, -61, -75, -60, -61}, directionUnknown},
+		{"Missing readings are skipped", []int{-80, 0, -70, 0, -60}, directionArriving},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &DeviceState{}
+			for _, signal := range tt.signals {
+				state.recordSignal(testGateAP, signal)
+			}
+			if got := state.signalTrend(); got != tt.want {
+				t.Errorf("signalTrend() = %s for %v, want %s", got, state.signals, tt.want)
+			}
+		})
+	}
+
+	t.Run("Keeps the latest readings", func(t *testing.T) {
+		state := &DeviceState{}
+		for signal := -90; signal <= -50; signal += 5 {
+			state.recordSignal(testGateAP, signal)
+		}
+		if len(state.signals) != signalSamples || state.signals[signalSamples-1] != -50 {
+			t.Errorf("Expected the last %d readings, got %v", signalSamples, state.signals)
+		}
+	})
+
+	t.Run("Starts over at another AP", func(t *testing.T) {
+		state := &DeviceState{}
+		state.recordSignal(testInteriorAP, -40)
+		state.recordSignal(testInteriorAP, -60)
+		state.recordSignal(testGateAP, -70)
+		if len(state.signals) != 1 || state.signalTrend() != directionUnknown {
+			t.Errorf("Expected only the gate AP reading, got %v", state.signals)
+		}
+	})
+}
+
+func TestRequireApproaching(t *testing.T) {
+	arriveWith := func(t *testing.T, signals ...int) (*App, *int32) {
+		app := newTestApp(t)
+		app.Config.Gate.LogActivity = true
+		app.Config.Gate.RequireApproaching = true
+		app.Config.Gate.ConfirmPolls = len(signals)
+		hits := newTestRelay(t, app)
+		trackDevice(app, testDeviceMAC, "Car")
+
+		for _, signal := range signals {
+			app.processClients([]unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 5, Signal: signal}})
+		}
+		return app, hits
+	}
+
+	t.Run("Approaching device opens", func(t *testing.T) {
+		_, hits := arriveWith(t, -78, -70, -62)
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected the gate to open, got %d opens", got)
+		}
+	})
+
+	t.Run("Departing device doesn't", func(t *testing.T) {
+		app, hits := arriveWith(t, -55, -63, -72)
+		if got := atomic.LoadInt32(hits); got != 0 {
+			t.Errorf("Expected no open, got %d", got)
+		}
+
+		logs, err := app.DB.GetLogs(10, 0)
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		if len(logs) == 0 || logs[0].Event != "gate_skipped" || logs[0].Direction != directionArriving {
+			t.Errorf("Expected the skipped arrival to be logged, got %+v", logs)
+		}
+	})
+
+	t.Run("Ignored unless required", func(t *testing.T) {
+		app := newTestApp(t)
+		app.Config.Gate.ConfirmPolls = 3
+		hits := newTestRelay(t, app)
+		trackDevice(app, testDeviceMAC, "Car")
+
+		for _, signal := range []int{-55, -63, -72} {
+			app.processClients([]unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 5, Signal: signal}})
+		}
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected the gate to open, got %d opens", got)
+		}
+	})
+}
+
+func TestMinSignal(t *testing.T) {
+	arriveWith := func(t *testing.T, min, signal int) (*App, *int32) {
+		app := newTestApp(t)
+		app.Config.Gate.LogActivity = true
+		app.Config.UniFi.MinSignal = min
+		hits := newTestRelay(t, app)
+		trackDevice(app, testDeviceMAC, "Neighbor")
+
+		app.processClients([]unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 5, Signal: signal}})
+		return app, hits
+	}
+
+	t.Run("Weak signal is ignored", func(t *testing.T) {
+		app, hits := arriveWith(t, -70, -82)
+		if got := atomic.LoadInt32(hits); got != 0 {
+			t.Errorf("Expected no open, got %d", got)
+		}
+
+		logs, err := app.DB.GetLogs(10, 0)
+		if err != nil {
+			t.Fatalf("Failed to get logs: %v", err)
+		}
+		if len(logs) == 0 || logs[0].Event != "ignored_weak_signal" || logs[0].Direction != directionArriving {
+			t.Errorf("Expected the weak arrival to be logged, got %+v", logs)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		min    int
+		signal int
+	}{
+		{"Strong enough", -70, -60},
+		{"Exactly the minimum", -70, -70},
+		{"No reading", -70, 0},
+		{"Disabled", 0, -90},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, hits := arriveWith(t, tt.min, tt.signal)
+			if got := atomic.LoadInt32(hits); got != 1 {
+				t.Errorf("Expected the gate to open, got %d opens", got)
+			}
+		})
+	}
+}
+
+func TestMinSignalPending(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Gate.LogActivity = true
+	app.Config.Gate.ConfirmPolls = 1
+	app.Config.UniFi.MinSignal = -70
+	hits := newTestRelay(t, app)
+	trackDevice(app, testDeviceMAC, "Phone")
+
+	poll := func(signal int) {
+		app.processClients([]unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 5, Signal: signal}})
+	}
+	poll(-82)
+	poll(-80)
+	if got := atomic.LoadInt32(hits); got != 0 {
+		t.Fatalf("Expected no open while the signal is weak, got %d", got)
+	}
+	logs, err := app.DB.GetLogs(10, 0)
+	if err != nil {
+		t.Fatalf("Failed to get logs: %v", err)
+	}
+	weak := 0
+	for _, entry := range logs {
+		if entry.Event == "ignored_weak_signal" {
+			weak++
+		}
+	}
+	if weak != 1 {
+		t.Errorf("Expected the weak signal to be logged once, got %d", weak)
+	}
+
+	poll(-60)
+	if got := atomic.LoadInt32(hits); got != 1 {
+		t.Errorf("Expected the gate to open once the signal is strong enough, got %d opens", got)
+	}
+	poll(-60)
+	if got := atomic.LoadInt32(hits); got != 1 {
+		t.Errorf("Expected a single open, got %d", got)
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// simulationResult describes what a simulated arrival did or would do
+type simulationResult struct {
+	MAC        string   `json:"mac"`
+	Name       string   `json:"name"`
+	Direction  string   `json:"direction"`
+	Decision   string   `json:"decision"` // "open" or "skip"
+	Reasons    []string `json:"reasons"`
+	DryRun     bool     `json:"dry_run"`
+	GateOpened bool     `json:"gate_opened"`
+}
+
+// Simulate a device arriving at the gate API
+func (app *App) SimulateHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MAC    string `json:"mac"`
+		DryRun bool   `json:"dry_run"` // decide only, never trigger the relay
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.sendJSONError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.MAC) == "" {
+		app.sendJSONError(w, "MAC address is required", http.StatusBadRequest)
+		return
+	}
+
+	result := app.simulateArrival(strings.TrimSpace(req.MAC), req.DryRun)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		app.Logger.Errorf("Failed to encode simulation result: %v", err)
+	}
+}
+
+// simulateArrival runs the decision path of a device connecting to the gate
+// AP: the open decision, the signal checks of openApproaching and the
+// pre-open delay of openAtGate. Unless dryRun is set an open goes through
+// openGate, so the relay fires, the cooldown starts and the event is logged
+// like a real one. The device's tracked AP is left alone so the next poll
+// isn't confused.
+func (app *App) simulateArrival(mac string, dryRun bool) simulationResult {
+	app.monitoringMu.Lock()
+	defer app.monitoringMu.Unlock()
+
+	result := simulationResult{
+		MAC:       strings.ToUpper(mac),
+		Direction: directionArriving,
+		Decision:  "skip",
+		DryRun:    dryRun,
+	}
+
+	state, reason := app.simulationState(result.MAC)
+	result.Reasons = append(result.Reasons, reason)
+	if state == nil {
+		return result
+	}
+	result.Name = state.Name
+
+	if app.Config.UniFi.GateAPMAC == "" {
+		result.Reasons = append(result.Reasons, "No gate access point is configured")
+		return result
+	}
+	if !app.Config.Gate.TriggerOnConnect {
+		result.Reasons = append(result.Reasons, "Opening on connect is disabled")
+		return result
+	}
+
+	open, _, reason := app.openDecision(state, directionArriving)
+	result.Reasons = append(result.Reasons, reason)
+	if !open {
+		return result
+	}
+	switch weak, falling := app.signalHold(state); {
+	case weak:
+		result.Reasons = append(result.Reasons, fmt.Sprintf("Signal %d dBm is weaker than the minimum of %d dBm", state.signal(), app.Config.UniFi.MinSignal))
+		return result
+	case falling:
+		result.Reasons = append(result.Reasons, "Signal at the gate AP is falling, device is moving away")
+		return result
+	}
+	if app.Config.Gate.ObserveOnly {
+		result.Reasons = append(result.Reasons, "Observe-only mode, the gate is never triggered")
+	} else {
+		result.Decision = "open"
+	}
+
+	delay := time.Duration(app.Config.Gate.PreOpenDelay) * time.Second
+	if delay > 0 {
+		result.Reasons = append(result.Reasons, fmt.Sprintf("Opens after the pre-open delay of %v", delay))
+	}
+
+	if dryRun {
+		result.Reasons = append(result.Reasons, "Dry run, the gate was not triggered")
+		return result
+	}
+
+	app.Logger.Infof("Simulating arrival of %s at the gate", state.Name)
+	if delay > 0 {
+		// Only tracked devices get their delayed open
+		if app.deviceStates[state.MAC] != state {
+			result.Decision = "skip"
+			result.Reasons = append(result.Reasons, "Device isn't monitored, a delayed open would be dropped")
+			return result
+		}
+		app.openAtGate(state, directionArriving)
+		return result
+	}
+
+	switch app.openGate(state, directionArriving, reason) {
+	case openTriggered:
+		result.GateOpened = true
+	case openDebounced:
+		result.GateOpened = true
+		result.Reasons = append(result.Reasons, "Gate was just triggered, counted as opened for this device")
+	case openObserved:
+		result.Reasons = append(result.Reasons, "Logged as would open")
+	default:
+		result.Reasons = append(result.Reasons, "Triggering the gate failed")
+	}
+	return result
+}
+
+// simulationState finds the state to simulate with. Devices that aren't
+// being monitored right now get a throwaway state with their stored cooldown.
+// Callers must hold monitoringMu.
+func (app *App) simulationState(mac string) (*DeviceState, string) {
+	if state, ok := app.deviceStates[mac]; ok {
+		return state, "Device is monitored"
+	}
+
+	for _, device := range app.Config.Devices {
+		if !strings.EqualFold(device.MAC, mac) {
+			continue
+		}
+		if !device.Enabled {
+			return nil, "Device is disabled"
+		}
+
+		lastTrigger, _ := app.DB.GetLastGateTrigger(device.MAC)
+		return &DeviceState{
+			MAC:             mac,
+			Name:            device.Name,
+			SSID:            device.SSID,
+			LastGateTrigger: lastTrigger,
+			BypassCooldown:  device.BypassCooldown,
+			Gate:            device.Gate,
+		}, "Device is configured but not monitored yet"
+	}
+
+	return nil, "Device is not configured"
+}
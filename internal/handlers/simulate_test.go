@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+)
+
+// simulate posts a simulated arrival and decodes the result
+func simulate(t *testing.T, app *App, body string) simulationResult {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	app.SimulateHandler(w, httptest.NewRequest("POST", "/api/simulate", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result simulationResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode simulation result: %v", err)
+	}
+	return result
+}
+
+func TestSimulateArrival(t *testing.T) {
+	body := `{"mac":"aa:bb:cc:dd:ee:01"}`
+
+	t.Run("Opens the gate and starts the cooldown", func(t *testing.T) {
+		app := newTestApp(t)
+		hits := newTestRelay(t, app)
+		state := trackDevice(app, testDeviceMAC, "Phone")
+
+		result := simulate(t, app, body)
+		if result.Decision != "open" || !result.GateOpened {
+			t.Errorf("Expected the gate to open, got %+v", result)
+		}
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected 1 trigger, got %d", got)
+		}
+		if state.LastGateTrigger.IsZero() {
+			t.Error("Simulated open should start the cooldown")
+		}
+		if state.CurrentAP != "" {
+			t.Errorf("Simulation should not move the device, got AP %s", state.CurrentAP)
+		}
+
+		// The next arrival runs into the cooldown
+		result = simulate(t, app, body)
+		if result.Decision != "skip" || result.GateOpened {
+			t.Errorf("Expected the cooldown to skip the open, got %+v", result)
+		}
+		if !strings.Contains(strings.Join(result.Reasons, " "), "cooldown") {
+			t.Errorf("Expected cooldown among the reasons, got %v", result.Reasons)
+		}
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected no further trigger, got %d", got)
+		}
+	})
+
+	t.Run("Dry run decides without triggering", func(t *testing.T) {
+		app := newTestApp(t)
+		hits := newTestRelay(t, app)
+		state := trackDevice(app, testDeviceMAC, "Phone")
+
+		result := simulate(t, app, `{"mac":"aa:bb:cc:dd:ee:01","dry_run":true}`)
+		if result.Decision != "open" || result.GateOpened || !result.DryRun {
+			t.Errorf("Expected a dry-run open decision, got %+v", result)
+		}
+		if got := atomic.LoadInt32(hits); got != 0 {
+			t.Errorf("Dry run should not trigger the gate, got %d triggers", got)
+		}
+		if !state.LastGateTrigger.IsZero() {
+			t.Error("Dry run should not start the cooldown")
+		}
+	})
+
+	t.Run("Dry run reports an active cooldown", func(t *testing.T) {
+		app := newTestApp(t)
+		newTestRelay(t, app)
+		state := trackDevice(app, testDeviceMAC, "Phone")
+		state.LastGateTrigger = time.Now().Add(-time.Minute)
+
+		result := simulate(t, app, `{"mac":"aa:bb:cc:dd:ee:01","dry_run":true}`)
+		if result.Decision != "skip" {
+			t.Errorf("Expected skip, got %+v", result)
+		}
+	})
+
+	t.Run("Skips when connect opens are disabled", func(t *testing.T) {
+		app := newTestApp(t)
+		hits := newTestRelay(t, app)
+		trackDevice(app, testDeviceMAC, "Phone")
+		app.Config.Gate.TriggerOnConnect = false
+
+		if result := simulate(t, app, body); result.Decision != "skip" {
+			t.Errorf("Expected skip, got %+v", result)
+		}
+		if got := atomic.LoadInt32(hits); got != 0 {
+			t.Errorf("Expected no trigger, got %d", got)
+		}
+	})
+
+	t.Run("Observe-only never triggers", func(t *testing.T) {
+		app := newTestApp(t)
+		hits := newTestRelay(t, app)
+		trackDevice(app, testDeviceMAC, "Phone")
+		app.Config.Gate.ObserveOnly = true
+
+		result := simulate(t, app, body)
+		if result.Decision != "skip" || result.GateOpened {
+			t.Errorf("Expected no open in observe-only mode, got %+v", result)
+		}
+		reasons := strings.Join(result.Reasons, " ")
+		if !strings.Contains(reasons, "Observe-only") || strings.Contains(reasons, "failed") {
+			t.Errorf("Expected observe-only as the reason, got %v", result.Reasons)
+		}
+		if got := atomic.LoadInt32(hits); got != 0 {
+			t.Errorf("Expected no trigger, got %d", got)
+		}
+	})
+
+	t.Run("Debounced open counts as opened", func(t *testing.T) {
+		app := newTestApp(t)
+		hits := newTestRelay(t, app)
+		app.GateController.SetDebounce(time.Minute)
+		trackDevice(app, testDeviceMAC, "Phone")
+		if err := app.GateController.OpenGate(); err != nil {
+			t.Fatalf("Failed to open gate: %v", err)
+		}
+
+		result := simulate(t, app, body)
+		if result.Decision != "open" || !result.GateOpened {
+			t.Errorf("Expected the debounced open to count, got %+v", result)
+		}
+		if reasons := strings.Join(result.Reasons, " "); !strings.Contains(reasons, "just triggered") {
+			t.Errorf("Expected the debounce among the reasons, got %v", result.Reasons)
+		}
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected 1 trigger, got %d", got)
+		}
+	})
+
+	t.Run("Weak signal holds the open back", func(t *testing.T) {
+		app := newTestApp(t)
+		hits := newTestRelay(t, app)
+		state := trackDevice(app, testDeviceMAC, "Phone")
+		state.signals = []int{-85}
+		app.Config.UniFi.MinSignal = -70
+
+		result := simulate(t, app, body)
+		if result.Decision != "skip" || !strings.Contains(strings.Join(result.Reasons, " "), "weaker") {
+			t.Errorf("Expected the weak signal to skip the open, got %+v", result)
+		}
+		if got := atomic.LoadInt32(hits); got != 0 {
+			t.Errorf("Expected no trigger, got %d", got)
+		}
+	})
+
+	t.Run("Configured device that isn't monitored yet", func(t *testing.T) {
+		app := newTestApp(t)
+		hits := newTestRelay(t, app)
+		app.Config.Devices = []config.DeviceConfig{{MAC: testDeviceMAC, Name: "Phone", Enabled: true}}
+
+		result := simulate(t, app, body)
+		if result.Decision != "open" || result.Name != "Phone" {
+			t.Errorf("Expected the gate to open for Phone, got %+v", result)
+		}
+		if got := atomic.LoadInt32(hits); got != 1 {
+			t.Errorf("Expected 1 trigger, got %d", got)
+		}
+	})
+
+	t.Run("Unknown and disabled devices are skipped", func(t *testing.T) {
+		app := newTestApp(t)
+		hits := newTestRelay(t, app)
+		app.Config.Devices = []config.DeviceConfig{{MAC: "AA:BB:CC:DD:EE:02", Name: "Tablet"}}
+
+		for _, mac := range []string{"AA:BB:CC:DD:EE:02", "AA:BB:CC:DD:EE:03"} {
+			if result := simulate(t, app, `{"mac":"`+mac+`"}`); result.Decision != "skip" {
+				t.Errorf("%s: expected skip, got %+v", mac, result)
+			}
+		}
+		if got := atomic.LoadInt32(hits); got != 0 {
+			t.Errorf("Expected no trigger, got %d", got)
+		}
+	})
+
+	t.Run("MAC is required", func(t *testing.T) {
+		app := newTestApp(t)
+
+		w := httptest.NewRecorder()
+		app.SimulateHandler(w, httptest.NewRequest("POST", "/api/simulate", strings.NewReader(`{}`)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+}
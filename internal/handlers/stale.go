@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/unifi"
+)
+
+// checkStaleness notices a controller that keeps returning the same client
+// list, e.g. a frozen or caching one. Once the newest last_seen hasn't moved
+// for unifi.stale_after seconds the data counts as stale and openDecision
+// refuses opens until it moves again.
+func (app *App) checkStaleness(clients []unifi.WirelessClient) {
+	threshold := time.Duration(app.Config.UniFi.StaleAfter) * time.Second
+	var newest int64
+	for _, client := range clients {
+		if client.LastSeen > newest {
+			newest = client.LastSeen
+		}
+	}
+	now := app.clock()
+
+	app.monitoringMu.Lock()
+	defer app.monitoringMu.Unlock()
+
+	// Without clients there's nothing to act on, stale or not
+	if threshold <= 0 || newest == 0 || newest != app.lastSeenMax {
+		app.lastSeenMax = newest
+		app.lastSeenMoved = now
+		if !app.staleSince.IsZero() {
+			app.Logger.Infof("UniFi controller data is fresh again after %s, opening the gate resumes",
+				now.Sub(app.staleSince).Round(time.Second))
+			app.staleSince = time.Time{}
+		}
+		return
+	}
+
+	if app.staleSince.IsZero() && now.Sub(app.lastSeenMoved) >= threshold {
+		app.staleSince = now
+		app.Logger.Warnf("UniFi controller data is stale, last_seen hasn't changed for %s; not opening the gate until it does",
+			now.Sub(app.lastSeenMoved).Round(time.Second))
+	}
+}
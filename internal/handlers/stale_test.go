@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStaleControllerData(t *testing.T) {
+	// setup polls a mock controller whose client reports lastSeen, on a
+	// fake clock that tests advance
+	setup := func(t *testing.T, staleAfter int) (*App, *mockController, *time.Time) {
+		app := newTestApp(t)
+		markConfigured(app)
+		app.isMonitoring = true
+		app.Config.UniFi.StaleAfter = staleAfter
+
+		mock := newMockController(t)
+		mock.Clients = []map[string]interface{}{mockClient("aa:bb:cc:dd:ee:99", testInteriorAP)}
+		app.UniFiClient = app.newUniFiClient(mock.Server.URL, "user", "pass")
+		if err := app.UniFiClient.Login(); err != nil {
+			t.Fatalf("Failed to login to mock controller: %v", err)
+		}
+
+		clock := time.Date(2024, 6, 2, 12, 0, 0, 0, time.Local)
+		app.now = func() time.Time { return clock }
+		return app, mock, &clock
+	}
+	advance := func(mock *mockController, seconds int64) {
+		mock.Clients[0]["last_seen"] = mock.Clients[0]["last_seen"].(int64) + seconds
+	}
+
+	t.Run("Frozen timestamps suppress opens", func(t *testing.T) {
+		app, mock, clock := setup(t, 60)
+		hits := newTestRelay(t, app)
+		state := trackDevice(app, testDeviceMAC, "Phone")
+
+		app.pollUniFi()
+		*clock = clock.Add(30 * time.Second)
+		app.pollUniFi()
+		if status, _ := app.monitoringState(); status != monitoringRunning {
+			t.Fatalf("Expected data to be fresh before stale_after, got %s", status)
+		}
+
+		*clock = clock.Add(31 * time.Second)
+		app.pollUniFi()
+		if status, _ := app.monitoringState(); status != monitoringStaleData {
+			t.Fatalf("Expected data to be stale, got %s", status)
+		}
+		if app.checkAndOpenGate(state, directionArriving) || atomic.LoadInt32(hits) != 0 {
+			t.Error("Expected no open on stale data")
+		}
+
+		// Fresh data lifts the suppression
+		advance(mock, 5)
+		*clock = clock.Add(time.Second)
+		app.pollUniFi()
+		if status, _ := app.monitoringState(); status != monitoringRunning {
+			t.Errorf("Expected data to be fresh again, got %s", status)
+		}
+		if !app.checkAndOpenGate(state, directionArriving) || atomic.LoadInt32(hits) != 1 {
+			t.Error("Expected the gate to open on fresh data")
+		}
+	})
+
+	t.Run("Advancing timestamps stay fresh", func(t *testing.T) {
+		app, mock, clock := setup(t, 60)
+		for i := 0; i < 10; i++ {
+			app.pollUniFi()
+			advance(mock, 30)
+			*clock = clock.Add(30 * time.Second)
+		}
+		if status, _ := app.monitoringState(); status != monitoringRunning {
+			t.Errorf("Expected data to stay fresh, got %s", status)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		app, _, clock := setup(t, 0)
+		for i := 0; i < 10; i++ {
+			app.pollUniFi()
+			*clock = clock.Add(time.Minute)
+		}
+		if status, _ := app.monitoringState(); status != monitoringRunning {
+			t.Errorf("Expected staleness detection to be off, got %s", status)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+)
+
+// statsResponse is what /api/stats returns: opens today and this week, and
+// the breakdown of the requested range, this week by default
+type statsResponse struct {
+	Today    int `json:"today"`
+	ThisWeek int `json:"this_week"`
+	*database.Stats
+}
+
+// startOfDay is midnight of t's day in its time zone
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek is midnight of the Monday of t's week
+func startOfWeek(t time.Time) time.Time {
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return startOfDay(t).AddDate(0, 0, -daysSinceMonday)
+}
+
+// Gate open statistics API, optionally since a given time (RFC 3339)
+func (app *App) GetStatsHandler(w http.ResponseWriter, r *http.Request) {
+	since, err := timeParam(r.URL.Query(), "since")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := app.clock().Local()
+	week, err := app.DB.GetStats(startOfWeek(now))
+	if err != nil {
+		app.Logger.Errorf("Failed to get stats: %v", err)
+		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
+		return
+	}
+	today, err := app.DB.GetStats(startOfDay(now))
+	if err != nil {
+		app.Logger.Errorf("Failed to get stats: %v", err)
+		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
+		return
+	}
+
+	response := statsResponse{Today: today.Opens, ThisWeek: week.Opens, Stats: week}
+	if !since.IsZero() {
+		if response.Stats, err = app.DB.GetStats(since); err != nil {
+			app.Logger.Errorf("Failed to get stats: %v", err)
+			http.Error(w, "Failed to get stats", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Show the names devices have now rather than when they were logged
+	for i, device := range response.ByDevice {
+		if configured := app.findDevice(device.MAC); configured != nil {
+			response.ByDevice[i].Name = configured.Name
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		app.Logger.Errorf("Failed to encode stats: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+)
+
+func TestStartOfWeek(t *testing.T) {
+	for _, tt := range []struct {
+		day  time.Time
+		want time.Time
+	}{
+		{time.Date(2024, 5, 13, 9, 0, 0, 0, time.UTC), time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)},  // Monday
+		{time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC), time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)},  // Wednesday
+		{time.Date(2024, 5, 19, 23, 0, 0, 0, time.UTC), time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)}, // Sunday
+	} {
+		if got := startOfWeek(tt.day); !got.Equal(tt.want) {
+			t.Errorf("startOfWeek(%s) = %s, want %s", tt.day, got, tt.want)
+		}
+	}
+}
+
+func TestGetStatsHandler(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Devices = []config.DeviceConfig{{MAC: testDeviceMAC, Name: "Renamed Phone", Enabled: true}}
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.Local) // a Wednesday
+	app.now = func() time.Time { return now }
+
+	for _, event := range []struct {
+		at   time.Time
+		mac  string
+		name string
+	}{
+		{now.Add(-time.Hour), testDeviceMAC, "Phone"},       // today
+		{now.AddDate(0, 0, -2), testDeviceMAC, "Phone"},     // Monday
+		{now.AddDate(0, 0, -2), "AA:BB:CC:DD:EE:02", "Car"}, // Monday
+		{now.AddDate(0, 0, -7), "AA:BB:CC:DD:EE:02", "Car"}, // last week
+	} {
+		if _, err := app.DB.Exec(`
+			INSERT INTO logs (device_mac, device_name, event, gate_opened, message, timestamp)
+			VALUES (?, ?, 'gate_triggered', TRUE, '', ?)
+		`, event.mac, event.name, event.at.UTC().Format("2006-01-02 15:04:05")); err != nil {
+			t.Fatalf("Failed to seed logs: %v", err)
+		}
+	}
+
+	t.Run("This week", func(t *testing.T) {
+		w, resp := getJSON(t, app.GetStatsHandler, "/api/stats")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		if resp["today"] != float64(1) || resp["this_week"] != float64(3) || resp["opens"] != float64(3) {
+			t.Errorf("Expected 1 open today and 3 this week, got %v", resp)
+		}
+		if resp["busiest_hour"] != float64(12) {
+			t.Errorf("Expected the busiest hour to be 12, got %v", resp["busiest_hour"])
+		}
+		devices, _ := resp["by_device"].([]interface{})
+		if len(devices) != 2 {
+			t.Fatalf("Expected 2 devices, got %v", resp["by_device"])
+		}
+		first, _ := devices[0].(map[string]interface{})
+		if first["name"] != "Renamed Phone" || first["opens"] != float64(2) {
+			t.Errorf("Expected the phone first under its current name, got %v", first)
+		}
+	})
+
+	t.Run("Since", func(t *testing.T) {
+		since := now.AddDate(0, 0, -10).Format(time.RFC3339)
+		_, resp := getJSON(t, app.GetStatsHandler, "/api/stats?since="+url.QueryEscape(since))
+		if resp["opens"] != float64(4) || resp["this_week"] != float64(3) {
+			t.Errorf("Expected 4 opens in the range and 3 this week, got %v", resp)
+		}
+	})
+
+	t.Run("Invalid since", func(t *testing.T) {
+		w := serve(http.HandlerFunc(app.GetStatsHandler), "GET", "/api/stats?since=monday", nil)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+}
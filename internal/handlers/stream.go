@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Interval between keep-alive comments on idle streams
+var streamHeartbeatInterval = 15 * time.Second
+
+// Stream logs API (Server-Sent Events)
+func (app *App) LogStreamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	deviceFilter := r.URL.Query().Get("device")
+	eventFilter := r.URL.Query().Get("event")
+
+	events, unsubscribe := app.DB.Subscribe(64)
+	defer unsubscribe()
+
+	// Streams stay open far longer than the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		app.Logger.Debugf("Failed to clear write deadline for log stream: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case entry, ok := <-events:
+			if !ok {
+				return
+			}
+			if deviceFilter != "" && !strings.EqualFold(entry.DeviceMAC, deviceFilter) {
+				continue
+			}
+			if eventFilter != "" && entry.Event != eventFilter {
+				continue
+			}
+
+			data, err := json.Marshal(entry)
+			if err != nil {
+				app.Logger.Errorf("Failed to encode log entry: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: log\ndata: %s\n\n", entry.ID, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+)
+
+func TestLogStreamHandler(t *testing.T) {
+	app := newTestApp(t)
+	server := httptest.NewServer(http.HandlerFunc(app.LogStreamHandler))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?event=gate_triggered")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %s", ct)
+	}
+
+	// The subscription is registered before headers are flushed
+	for _, event := range []string{"connected", "gate_triggered"} {
+		if err := app.DB.LogEvent(&database.LogEntry{
+			DeviceMAC:  testDeviceMAC,
+			DeviceName: "Phone",
+			Event:      event,
+			Message:    event + " message",
+		}); err != nil {
+			t.Fatalf("Failed to log event: %v", err)
+		}
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("Stream closed before receiving an event")
+			}
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+
+			var entry database.LogEntry
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &entry); err != nil {
+				t.Fatalf("Failed to decode streamed entry: %v", err)
+			}
+			if entry.Event != "gate_triggered" {
+				t.Errorf("Expected only gate_triggered events, got %s", entry.Event)
+			}
+			if entry.DeviceName != "Phone" {
+				t.Errorf("Expected device name Phone, got %s", entry.DeviceName)
+			}
+			return
+		case <-timeout:
+			t.Fatal("Timed out waiting for streamed event")
+		}
+	}
+}
+
+func TestLogStreamHeartbeat(t *testing.T) {
+	original := streamHeartbeatInterval
+	streamHeartbeatInterval = 10 * time.Millisecond
+	defer func() { streamHeartbeatInterval = original }()
+
+	app := newTestApp(t)
+	server := httptest.NewServer(http.HandlerFunc(app.LogStreamHandler))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if scanner.Text() == ": heartbeat" {
+			return
+		}
+	}
+	t.Fatal("Expected a heartbeat comment on an idle stream")
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+)
+
+const (
+	// defaultTemporaryHours is how long a temporary device is tracked
+	defaultTemporaryHours = 24
+	// maxTemporaryHours keeps temporary devices from becoming permanent ones
+	maxTemporaryHours = 7 * 24
+	// expiryInterval is how often expired temporary devices are removed
+	expiryInterval = time.Minute
+)
+
+// Add a temporary device API, for a visitor whose device should open the gate
+// for a while without being added for good. Takes {"mac", "name", "gate",
+// "hours"}, tracking the device for 24 hours unless told otherwise.
+func (app *App) AddTemporaryDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MAC   string `json:"mac"`
+		Name  string `json:"name"`
+		Gate  string `json:"gate"` // empty for the primary gate
+		Hours int    `json:"hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.sendJSONError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	mac, err := config.NormalizeMAC(req.MAC)
+	if err != nil {
+		app.sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Hours == 0 {
+		req.Hours = defaultTemporaryHours
+	}
+	if req.Hours < 0 || req.Hours > maxTemporaryHours {
+		app.sendJSONError(w, "hours must be between 1 and 168", http.StatusBadRequest)
+		return
+	}
+	gateName, err := app.Config.ResolveGate(req.Gate)
+	if err != nil {
+		app.sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		req.Name = app.discoveredName(mac)
+	}
+
+	app.devicesMu.Lock()
+	defer app.devicesMu.Unlock()
+	if err := app.Config.AddDevice(mac, req.Name); err != nil {
+		app.sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	expiresAt := app.clock().Add(time.Duration(req.Hours) * time.Hour).UTC()
+	device := app.Config.GetDevice(mac)
+	device.Gate = gateName
+	device.ExpiresAt = &expiresAt
+
+	record := deviceRecord(*device)
+	if err := app.DB.AddDevice(&record); err != nil {
+		app.Config.RemoveDevice(mac)
+		if errors.Is(err, database.ErrDeviceExists) {
+			app.sendJSONError(w, config.ErrDeviceExists.Error(), http.StatusBadRequest)
+			return
+		}
+		app.Logger.Errorf("Failed to store device %s: %v", mac, err)
+		app.sendJSONError(w, "Failed to save device", http.StatusInternalServerError)
+		return
+	}
+	if err := app.saveConfig(); err != nil {
+		app.sendJSONError(w, "Failed to save configuration", http.StatusInternalServerError)
+		return
+	}
+	app.Logger.Infof("Tracking %s (%s) until %s", device.Name, mac, expiresAt.Format(time.RFC3339))
+
+	app.monitoringMu.Lock()
+	if app.isMonitoring {
+		stateKey := strings.ToUpper(mac)
+		app.deviceStates[stateKey] = &DeviceState{
+			MAC:  stateKey,
+			Name: device.Name,
+			Gate: device.Gate,
+		}
+	}
+	app.monitoringMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(device); err != nil {
+		app.Logger.Errorf("Failed to encode device: %v", err)
+	}
+}
+
+// startExpiryJob removes expired temporary devices until monitoring stops
+func (app *App) startExpiryJob(stop chan bool) {
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+
+	app.removeExpiredDevices()
+	for {
+		select {
+		case <-ticker.C:
+			app.removeExpiredDevices()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// removeExpiredDevices stops tracking the temporary devices whose time is up,
+// along with what the monitor knows about them
+func (app *App) removeExpiredDevices() {
+	app.devicesMu.Lock()
+	defer app.devicesMu.Unlock()
+
+	now := app.clock()
+	var expired []config.DeviceConfig
+	for _, device := range app.Config.Devices {
+		if device.ExpiresAt != nil && !now.Before(*device.ExpiresAt) {
+			expired = append(expired, device)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+
+	for _, device := range expired {
+		if err := app.DB.RemoveDevice(device.MAC); err != nil && !errors.Is(err, database.ErrDeviceNotFound) {
+			app.Logger.Errorf("Failed to remove expired device %s: %v", device.MAC, err)
+			continue
+		}
+		app.Config.RemoveDevice(device.MAC)
+
+		app.monitoringMu.Lock()
+		delete(app.deviceStates, strings.ToUpper(device.MAC))
+		app.monitoringMu.Unlock()
+
+		app.Logger.Infof("Temporary device %s (%s) expired, no longer tracking it", device.Name, device.MAC)
+	}
+
+	if err := app.saveConfig(); err != nil {
+		app.Logger.Errorf("Failed to save configuration: %v", err)
+	}
+}
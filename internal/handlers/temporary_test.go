@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+	"github.com/fbettag/unifi-gate-opener/internal/unifi"
+)
+
+func TestTemporaryDevices(t *testing.T) {
+	app := newTestApp(t)
+	markConfigured(app)
+	hits := newTestRelay(t, app)
+	app.isMonitoring = true
+	now := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	app.now = func() time.Time { return now }
+
+	router := app.Routes()
+	cookie := loginCookie(t, app)
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, body := range []string{`{"mac":"visitor","name":"Visitor"}`, `{"mac":"AA:BB:CC:DD:EE:01","hours":-1}`, `{"mac":"AA:BB:CC:DD:EE:01","hours":1000}`} {
+		if w := send("POST", "/api/devices/temporary", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, w.Code)
+		}
+	}
+
+	w := send("POST", "/api/devices/temporary", `{"mac":"AA:BB:CC:DD:EE:01","name":"Visitor"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	expiresAt := now.Add(24 * time.Hour)
+
+	t.Run("Expiry is in the devices API", func(t *testing.T) {
+		var devices []config.DeviceConfig
+		if err := json.NewDecoder(send("GET", "/api/devices", "").Body).Decode(&devices); err != nil {
+			t.Fatalf("Failed to decode devices: %v", err)
+		}
+		if len(devices) != 1 || devices[0].ExpiresAt == nil || !devices[0].ExpiresAt.Equal(expiresAt) {
+			t.Fatalf("Expected the visitor to expire in a day, got %+v", devices)
+		}
+		stored, err := app.DB.ListDevices()
+		if err != nil || len(stored) != 1 || stored[0].ExpiresAt == nil || !stored[0].ExpiresAt.Equal(expiresAt) {
+			t.Errorf("Expected the expiry to be stored, got %+v (%v)", stored, err)
+		}
+	})
+
+	t.Run("Temporary device opens the gate", func(t *testing.T) {
+		app.processClients([]unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 5}})
+		if atomic.LoadInt32(hits) != 1 {
+			t.Errorf("Expected the gate to open for the visitor, got %d", *hits)
+		}
+	})
+
+	t.Run("Removed once expired", func(t *testing.T) {
+		now = expiresAt.Add(-time.Minute)
+		app.removeExpiredDevices()
+		if len(app.Config.Devices) != 1 {
+			t.Fatalf("Expected the visitor to be kept until the expiry, got %+v", app.Config.Devices)
+		}
+
+		now = expiresAt
+		app.removeExpiredDevices()
+		if len(app.Config.Devices) != 0 {
+			t.Errorf("Expected the visitor to be removed, got %+v", app.Config.Devices)
+		}
+		if stored, _ := app.DB.ListDevices(); len(stored) != 0 {
+			t.Errorf("Expected the visitor to be removed from the database, got %+v", stored)
+		}
+		if _, tracked := app.deviceStates[testDeviceMAC]; tracked {
+			t.Error("Expected the visitor's state to be removed")
+		}
+	})
+}
+
+// Run with -race, expiry runs in the background while devices are edited
+func TestExpiryDuringDeviceUpdates(t *testing.T) {
+	app := newTestApp(t)
+	markConfigured(app)
+	app.Config.Devices = []config.DeviceConfig{{MAC: "aa:bb:cc:dd:ee:01", Name: "Phone", Enabled: true}}
+	past := time.Now().Add(-time.Hour)
+	for i := 0; i < 20; i++ {
+		mac := fmt.Sprintf("aa:bb:cc:dd:ef:%02x", i)
+		app.Config.Devices = append(app.Config.Devices, config.DeviceConfig{MAC: mac, Name: "Visitor", Enabled: true, ExpiresAt: &past})
+	}
+	for _, device := range app.Config.Devices {
+		if err := app.storeDevice(device); err != nil {
+			t.Fatalf("Failed to store device: %v", err)
+		}
+	}
+	router := app.Routes()
+	cookie := loginCookie(t, app)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			app.removeExpiredDevices()
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest("PUT", "/api/devices/aa:bb:cc:dd:ee:01", strings.NewReader(fmt.Sprintf(`{"name":"Phone %d","enabled":true}`, i)))
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	wg.Wait()
+
+	if len(app.Config.Devices) != 1 || app.Config.Devices[0].Name != "Phone 19" {
+		t.Errorf("Expected only the updated phone left, got %+v", app.Config.Devices)
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/fbettag/unifi-gate-opener/internal/auth"
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+	"github.com/gorilla/mux"
+)
+
+// List API tokens, without the tokens themselves
+func (app *App) GetTokensHandler(w http.ResponseWriter, r *http.Request) {
+	tokens, err := app.DB.ListAPITokens()
+	if err != nil {
+		app.Logger.Errorf("Failed to list API tokens: %v", err)
+		app.sendJSONError(w, "Failed to list API tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"tokens": tokens}); err != nil {
+		app.Logger.Errorf("Failed to encode API tokens: %v", err)
+	}
+}
+
+// Create an API token. The token is only ever shown in this response, the
+// database keeps its hash.
+func (app *App) CreateTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.sendJSONError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		app.sendJSONError(w, "A name is required", http.StatusBadRequest)
+		return
+	}
+
+	token, id, hash, err := auth.NewAPIToken()
+	if err != nil {
+		app.Logger.Errorf("Failed to generate API token: %v", err)
+		app.sendJSONError(w, "Failed to create API token", http.StatusInternalServerError)
+		return
+	}
+	record := &database.APIToken{ID: id, Name: name, Hash: hash}
+	if err := app.DB.AddAPIToken(record); err != nil {
+		app.Logger.Errorf("Failed to store API token: %v", err)
+		app.sendJSONError(w, "Failed to create API token", http.StatusInternalServerError)
+		return
+	}
+	app.Logger.Infof("Created API token %q (%s)", name, id)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"id":         record.ID,
+		"name":       record.Name,
+		"created_at": record.CreatedAt,
+		"token":      token,
+	}); err != nil {
+		app.Logger.Errorf("Failed to encode response: %v", err)
+	}
+}
+
+// Revoke an API token
+func (app *App) RevokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	if err := app.DB.RemoveAPIToken(id); err != nil {
+		if errors.Is(err, database.ErrTokenNotFound) {
+			app.sendJSONError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		app.Logger.Errorf("Failed to revoke API token: %v", err)
+		app.sendJSONError(w, "Failed to revoke API token", http.StatusInternalServerError)
+		return
+	}
+	app.Logger.Infof("Revoked API token %s", id)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"success": true}); err != nil {
+		app.Logger.Errorf("Failed to encode response: %v", err)
+	}
+}
+
+// bearerToken returns the token of an Authorization: Bearer header, false
+// if the request has none
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return strings.TrimSpace(token), ok
+}
+
+// validAPIToken reports whether token is a stored, unrevoked API token and
+// records its use
+func (app *App) validAPIToken(token string) bool {
+	id, ok := auth.APITokenID(token)
+	if !ok {
+		return false
+	}
+	stored, err := app.DB.GetAPIToken(id)
+	if err != nil {
+		if !errors.Is(err, database.ErrTokenNotFound) {
+			app.Logger.Errorf("Failed to look up API token: %v", err)
+		}
+		return false
+	}
+	if !auth.VerifyAPIToken(stored.Hash, token) {
+		return false
+	}
+	if err := app.DB.TouchAPIToken(id, app.clock()); err != nil {
+		app.Logger.Errorf("Failed to record API token use: %v", err)
+	}
+	return true
+}
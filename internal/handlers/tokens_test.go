@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPITokens(t *testing.T) {
+	app := newTestApp(t)
+	markConfigured(app)
+	router := app.Routes()
+	cookie := loginCookie(t, app)
+	send := func(method, path, body string, auth func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if auth != nil {
+			auth(req)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	session := func(req *http.Request) { req.AddCookie(cookie) }
+	bearer := func(token string) func(*http.Request) {
+		return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }
+	}
+
+	if w := send("POST", "/api/tokens", `{"name":"  "}`, session); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a name, got %d", w.Code)
+	}
+
+	w := send("POST", "/api/tokens", `{"name":"Script"}`, session)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 creating, got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		ID    string `json:"id"`
+		Name  string `json:"name"`
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.Token == "" || created.Name != "Script" {
+		t.Fatalf("Expected the new token, got %s (%v)", w.Body.String(), err)
+	}
+
+	t.Run("Token is stored hashed", func(t *testing.T) {
+		stored, err := app.DB.GetAPIToken(created.ID)
+		if err != nil {
+			t.Fatalf("Expected the token to be stored: %v", err)
+		}
+		if stored.Hash == created.Token || !strings.HasPrefix(stored.Hash, "$2") {
+			t.Errorf("Expected a bcrypt hash, got %q", stored.Hash)
+		}
+	})
+
+	t.Run("Listing leaves out the token", func(t *testing.T) {
+		w := send("GET", "/api/tokens", "", session)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), created.ID) {
+			t.Fatalf("Expected the token listed, got %d: %s", w.Code, w.Body.String())
+		}
+		if body := w.Body.String(); strings.Contains(body, created.Token) || strings.Contains(body, "$2") {
+			t.Errorf("Expected neither token nor hash in the list, got %s", body)
+		}
+	})
+
+	t.Run("Token authenticates API requests", func(t *testing.T) {
+		if w := send("GET", "/api/status", "", bearer(created.Token)); w.Code != http.StatusOK {
+			t.Errorf("Expected status 200 with the token, got %d", w.Code)
+		}
+		stored, _ := app.DB.GetAPIToken(created.ID)
+		if stored == nil || stored.LastUsedAt == nil {
+			t.Errorf("Expected the use to be recorded, got %+v", stored)
+		}
+
+		for _, token := range []string{created.Token + "0", "ugo_ffffffff_" + strings.Repeat("0", 32), "not-a-token"} {
+			if w := send("GET", "/api/status", "", bearer(token)); w.Code != http.StatusUnauthorized {
+				t.Errorf("%q: expected status 401, got %d", token, w.Code)
+			}
+		}
+		// A bad token isn't rescued by a session
+		w := send("GET", "/api/status", "", func(req *http.Request) {
+			session(req)
+			bearer("not-a-token")(req)
+		})
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 for a bad token with a session, got %d", w.Code)
+		}
+	})
+
+	t.Run("Revoked tokens stop working", func(t *testing.T) {
+		if w := send("DELETE", "/api/tokens/"+created.ID, "", session); w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 revoking, got %d", w.Code)
+		}
+		if w := send("DELETE", "/api/tokens/"+created.ID, "", session); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 revoking again, got %d", w.Code)
+		}
+		if w := send("GET", "/api/status", "", bearer(created.Token)); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 with the revoked token, got %d", w.Code)
+		}
+	})
+}
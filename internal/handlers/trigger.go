@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/database"
+	"github.com/fbettag/unifi-gate-opener/internal/gate"
+	"github.com/fbettag/unifi-gate-opener/internal/notify"
+)
+
+// Log entries for external triggers use this in place of a device MAC
+const externalTriggerMAC = "external"
+
+// ExternalTriggerHandler opens the gate for another system, e.g. a doorbell
+// camera recognizing a plate. Such systems can't log in, so the endpoint is
+// protected by the configured trigger token, sent as a bearer token.
+func (app *App) ExternalTriggerHandler(w http.ResponseWriter, r *http.Request) {
+	token := app.Config.Server.TriggerToken
+	if token == "" {
+		http.NotFound(w, r)
+		return
+	}
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		app.Logger.Warnf("Rejected external gate trigger from %s: bad token", r.RemoteAddr)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Actor  string `json:"actor"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	actor := strings.TrimSpace(req.Actor)
+	if actor == "" {
+		actor = "External"
+	}
+
+	if app.Config.Gate.ManualOpenRequiresMonitoring {
+		app.monitoringMu.RLock()
+		monitoring := app.isMonitoring
+		app.monitoringMu.RUnlock()
+		if !monitoring {
+			http.Error(w, "Monitoring is stopped, manual opens are disabled", http.StatusConflict)
+			return
+		}
+	}
+
+	// Held across the open so concurrent triggers can't both pass the cooldown
+	app.lastExternalTriggerMu.Lock()
+	defer app.lastExternalTriggerMu.Unlock()
+
+	cooldown := time.Duration(app.Config.Gate.OpenDuration)*time.Minute - app.clock().Sub(app.lastExternalTrigger)
+	if cooldown > 0 && !app.Config.Gate.ExternalTriggerBypassCooldown {
+		app.Logger.Infof("External gate trigger by %s skipped, cooldown active for %s", actor, cooldown.Round(time.Second))
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(cooldown.Seconds()))))
+		app.sendJSONError(w, fmt.Sprintf("Cooldown active for %s", cooldown.Round(time.Second)), http.StatusTooManyRequests)
+		return
+	}
+
+	if err := app.gateController().OpenGate(); errors.Is(err, gate.ErrDebounced) {
+		app.Logger.Infof("External gate trigger by %s skipped: %v", actor, err)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]bool{"success": true, "debounced": true}); err != nil {
+			app.Logger.Errorf("Failed to encode response: %v", err)
+		}
+		return
+	} else if err != nil {
+		app.Logger.Errorf("External gate trigger by %s failed: %v", actor, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	app.lastExternalTrigger = app.clock()
+
+	message := "Gate opened by " + actor
+	if reason := strings.TrimSpace(req.Reason); reason != "" {
+		message += ": " + reason
+	}
+	app.Logger.Info(message)
+	app.broadcast(liveEvent{Type: "gate", Event: "gate_triggered", Time: app.clock()})
+	app.publishGateTrigger(mqttGateTrigger{Time: app.clock(), DeviceMAC: externalTriggerMAC, DeviceName: actor, Direction: externalTriggerMAC})
+	app.notifyGateOpened(notify.Message{Event: "gate_triggered", Text: message})
+
+	if app.Config.Gate.LogActivity {
+		if err := app.logEvent(&database.LogEntry{
+			DeviceMAC:  externalTriggerMAC,
+			DeviceName: actor,
+			Event:      "gate_triggered",
+			Direction:  externalTriggerMAC,
+			GateOpened: true,
+			Message:    message,
+		}); err != nil {
+			app.Logger.Errorf("Failed to log external trigger: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"success": true}); err != nil {
+		app.Logger.Errorf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExternalTriggerHandler(t *testing.T) {
+	setup := func(t *testing.T) (*App, http.Handler, *int32) {
+		app := newTestApp(t)
+		markConfigured(app)
+		hits := newTestRelay(t, app)
+		app.Config.Server.TriggerToken = "trigger-secret"
+		app.Config.Gate.LogActivity = true
+		app.Config.Gate.OpenDuration = 5
+		return app, app.Routes(), hits
+	}
+	trigger := func(router http.Handler, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/gate/trigger", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Authorized trigger opens and logs the actor", func(t *testing.T) {
+		app, router, hits := setup(t)
+
+		w := trigger(router, "trigger-secret", `{"actor":"Doorbell","reason":"Plate ABC-123"}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body)
+		}
+		if atomic.LoadInt32(hits) != 1 {
+			t.Errorf("Expected the gate to open once, got %d", *hits)
+		}
+
+		logs, err := app.DB.GetLogsByDevice(externalTriggerMAC, 10)
+		if err != nil || len(logs) != 1 {
+			t.Fatalf("Expected one logged open, got %v (%v)", logs, err)
+		}
+		if logs[0].DeviceName != "Doorbell" || logs[0].Message != "Gate opened by Doorbell: Plate ABC-123" {
+			t.Errorf("Unexpected log entry %+v", logs[0])
+		}
+	})
+
+	t.Run("Actor defaults without a body", func(t *testing.T) {
+		app, router, _ := setup(t)
+
+		if w := trigger(router, "trigger-secret", ""); w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body)
+		}
+		logs, _ := app.DB.GetLogsByDevice(externalTriggerMAC, 10)
+		if len(logs) != 1 || logs[0].DeviceName != "External" {
+			t.Errorf("Expected the open logged as External, got %+v", logs)
+		}
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		_, router, hits := setup(t)
+
+		for _, token := range []string{"", "wrong"} {
+			if w := trigger(router, token, "{}"); w.Code != http.StatusUnauthorized {
+				t.Errorf("Token %q: expected status 401, got %d", token, w.Code)
+			}
+		}
+		if atomic.LoadInt32(hits) != 0 {
+			t.Errorf("Expected the gate to stay closed, got %d opens", *hits)
+		}
+	})
+
+	t.Run("Disabled without a token", func(t *testing.T) {
+		app, router, _ := setup(t)
+		app.Config.Server.TriggerToken = ""
+
+		if w := trigger(router, "", "{}"); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("Cooldown", func(t *testing.T) {
+		app, router, hits := setup(t)
+		now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+		app.now = func() time.Time { return now }
+
+		trigger(router, "trigger-secret", "{}")
+		now = now.Add(2 * time.Minute)
+		w := trigger(router, "trigger-secret", "{}")
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "180" {
+			t.Errorf("Expected 429 with Retry-After 180, got %d %q", w.Code, w.Header().Get("Retry-After"))
+		}
+		if atomic.LoadInt32(hits) != 1 {
+			t.Errorf("Expected one open within the cooldown, got %d", *hits)
+		}
+
+		now = now.Add(3 * time.Minute)
+		if w := trigger(router, "trigger-secret", "{}"); w.Code != http.StatusOK {
+			t.Errorf("Expected an open after the cooldown, got %d", w.Code)
+		}
+	})
+
+	t.Run("Cooldown bypassed", func(t *testing.T) {
+		app, router, hits := setup(t)
+		app.Config.Gate.ExternalTriggerBypassCooldown = true
+
+		for i := 0; i < 2; i++ {
+			if w := trigger(router, "trigger-secret", "{}"); w.Code != http.StatusOK {
+				t.Errorf("Expected status 200, got %d", w.Code)
+			}
+		}
+		if atomic.LoadInt32(hits) != 2 {
+			t.Errorf("Expected two opens, got %d", *hits)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+	"github.com/gorilla/mux"
+)
+
+// List the admin users, marking the one making the request
+func (app *App) GetUsersHandler(w http.ResponseWriter, r *http.Request) {
+	current := app.SessionStore.Username(r)
+	users := []map[string]interface{}{}
+	for _, user := range app.Config.AdminUsers() {
+		users = append(users, map[string]interface{}{
+			"username": user.Username,
+			"current":  user.Username == current,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"users": users}); err != nil {
+		app.Logger.Errorf("Failed to encode users: %v", err)
+	}
+}
+
+// Add an admin user with their own password
+func (app *App) AddUserHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		app.sendJSONError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := app.Config.CheckPasswordPolicy(req.Password); err != nil {
+		app.sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := app.Config.AddAdminUser(req.Username, req.Password); err != nil {
+		switch {
+		case errors.Is(err, config.ErrEmptyUsername):
+			app.sendJSONError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, config.ErrUserExists):
+			app.sendJSONError(w, err.Error(), http.StatusConflict)
+		default:
+			app.Logger.Errorf("Failed to add user: %v", err)
+			app.sendJSONError(w, "Failed to add user", http.StatusInternalServerError)
+		}
+		return
+	}
+	if err := app.saveConfig(); err != nil {
+		app.sendJSONError(w, "Failed to save configuration", http.StatusInternalServerError)
+		return
+	}
+	app.Logger.Infof("Added admin user %q", req.Username)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"success": true}); err != nil {
+		app.Logger.Errorf("Failed to encode response: %v", err)
+	}
+}
+
+// Remove an admin user, their sessions stop working with the next request
+func (app *App) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+
+	if err := app.Config.RemoveAdminUser(username); err != nil {
+		switch {
+		case errors.Is(err, config.ErrUserNotFound):
+			app.sendJSONError(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, config.ErrLastUser):
+			app.sendJSONError(w, err.Error(), http.StatusConflict)
+		default:
+			app.Logger.Errorf("Failed to remove user: %v", err)
+			app.sendJSONError(w, "Failed to remove user", http.StatusInternalServerError)
+		}
+		return
+	}
+	if err := app.saveConfig(); err != nil {
+		app.sendJSONError(w, "Failed to save configuration", http.StatusInternalServerError)
+		return
+	}
+	app.closeUserWebSockets(username)
+	app.Logger.Infof("Removed admin user %q", username)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"success": true}); err != nil {
+		app.Logger.Errorf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+)
+
+func TestAdminUsers(t *testing.T) {
+	app := newTestApp(t)
+	markConfigured(app)
+	if err := app.Config.SetAdminPassword("testpassword123"); err != nil {
+		t.Fatalf("Failed to set admin password: %v", err)
+	}
+	router := app.Routes()
+	send := func(method, path, body string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	login := func(username, password string) []*http.Cookie {
+		t.Helper()
+		w := send("POST", "/api/login", `{"username":"`+username+`","password":"`+password+`"}`, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected %s to log in, got %d", username, w.Code)
+		}
+		return w.Result().Cookies()
+	}
+
+	admin := login("admin", "testpassword123")
+
+	if w := send("POST", "/api/users", `{"username":"alice","password":"weak"}`, admin); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a weak password, got %d", w.Code)
+	}
+	if w := send("POST", "/api/users", `{"username":"alice","password":"Alice-Pass-1"}`, admin); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 adding alice, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := send("POST", "/api/users", `{"username":"alice","password":"Alice-Pass-2"}`, admin); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 adding alice again, got %d", w.Code)
+	}
+
+	alice := login("alice", "Alice-Pass-1")
+	if w := send("POST", "/api/login", `{"username":"alice","password":"testpassword123"}`, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected another user's password to be rejected, got %d", w.Code)
+	}
+
+	t.Run("Listing marks the current user", func(t *testing.T) {
+		w := send("GET", "/api/users", "", alice)
+		body := w.Body.String()
+		if w.Code != http.StatusOK || !strings.Contains(body, `"username":"admin"`) || !strings.Contains(body, `{"current":true,"username":"alice"}`) {
+			t.Errorf("Expected both users with alice current, got %d: %s", w.Code, body)
+		}
+		if strings.Contains(body, "$2") {
+			t.Errorf("Expected no password hashes, got %s", body)
+		}
+	})
+
+	t.Run("Password change is per user", func(t *testing.T) {
+		w := send("PUT", "/api/password", `{"current_password":"Alice-Pass-1","new_password":"Alice-Pass-2"}`, alice)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if !app.Config.VerifyUser("alice", "Alice-Pass-2") || !app.Config.VerifyUser("admin", "testpassword123") {
+			t.Error("Expected only alice's password to change")
+		}
+	})
+
+	t.Run("Removing a user ends their sessions", func(t *testing.T) {
+		if w := send("DELETE", "/api/users/alice", "", admin); w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 removing alice, got %d", w.Code)
+		}
+		if w := send("GET", "/api/status", "", alice); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected alice's session to end, got %d", w.Code)
+		}
+		if w := send("GET", "/api/status", "", admin); w.Code != http.StatusOK {
+			t.Errorf("Expected the admin to stay logged in, got %d", w.Code)
+		}
+		if w := send("DELETE", "/api/users/alice", "", admin); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 removing alice again, got %d", w.Code)
+		}
+		if w := send("DELETE", "/api/users/admin", "", admin); w.Code != http.StatusConflict {
+			t.Errorf("Expected the last user to stay, got %d", w.Code)
+		}
+	})
+}
+
+func TestLegacyAdminSession(t *testing.T) {
+	app := newTestApp(t)
+	markConfigured(app)
+	if err := app.Config.SetAdminPassword("testpassword123"); err != nil {
+		t.Fatalf("Failed to set admin password: %v", err)
+	}
+	// alice comes first, the migrated admin second
+	app.Config.Admin.Users = []config.AdminUser{{Username: "alice"}}
+	if err := app.Config.SetUserPassword("alice", "Alice-Pass-1"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	app.Config.MigrateAdminUser()
+	router := app.Routes()
+
+	// Logged in before there were several users
+	legacy := loginCookie(t, app)
+	alice := httptest.NewRecorder()
+	if err := app.SessionStore.LoginAs(httptest.NewRequest("POST", "/api/login", nil), alice, "alice"); err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	aliceCookie := alice.Result().Cookies()[0]
+
+	send := func(method, path, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Changes the migrated admin's password", func(t *testing.T) {
+		w := send("PUT", "/api/password", `{"current_password":"testpassword123","new_password":"Admin-Pass-2"}`, legacy)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if !app.Config.VerifyUser("admin", "Admin-Pass-2") || !app.Config.VerifyUser("alice", "Alice-Pass-1") {
+			t.Error("Expected only the admin's password to change")
+		}
+	})
+
+	t.Run("Ends with the migrated admin", func(t *testing.T) {
+		if w := send("GET", "/api/status", "", legacy); w.Code != http.StatusOK {
+			t.Fatalf("Expected the session to be valid, got %d", w.Code)
+		}
+		if w := send("DELETE", "/api/users/admin", "", aliceCookie); w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 removing admin, got %d", w.Code)
+		}
+		if w := send("GET", "/api/status", "", legacy); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the session to end, got %d", w.Code)
+		}
+	})
+}
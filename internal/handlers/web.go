@@ -2,13 +2,19 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fbettag/unifi-gate-opener/internal/config"
 	"github.com/fbettag/unifi-gate-opener/internal/database"
 	"github.com/fbettag/unifi-gate-opener/internal/gate"
+	"github.com/fbettag/unifi-gate-opener/internal/notify"
 	"github.com/fbettag/unifi-gate-opener/internal/unifi"
 	"github.com/gorilla/mux"
 )
@@ -16,10 +22,12 @@ import (
 // Middleware to check if setup is complete
 func (app *App) CheckSetupMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Always allow static files and login page
+		// Always allow static files, login page and health probes
 		if (len(r.URL.Path) > 7 && r.URL.Path[:7] == "/static") ||
 			r.URL.Path == "/login" ||
-			r.URL.Path == "/api/login" {
+			r.URL.Path == "/api/login" ||
+			r.URL.Path == "/healthz" ||
+			r.URL.Path == "/readyz" {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -30,9 +38,10 @@ func (app *App) CheckSetupMiddleware(next http.Handler) http.Handler {
 			if r.URL.Path == "/setup" ||
 				r.URL.Path == "/api/setup" ||
 				r.URL.Path == "/api/test-unifi" ||
-				r.URL.Path == "/api/test-unifi-sites" {
+				r.URL.Path == "/api/test-unifi-sites" ||
+				r.URL.Path == "/api/test-unifi-paths" {
 				// Redirect to home page which will then redirect to login/dashboard
-				http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+				app.redirect(w, r, "/", http.StatusTemporaryRedirect)
 				return
 			}
 		} else {
@@ -41,12 +50,13 @@ func (app *App) CheckSetupMiddleware(next http.Handler) http.Handler {
 			if r.URL.Path == "/setup" ||
 				r.URL.Path == "/api/setup" ||
 				r.URL.Path == "/api/test-unifi" ||
-				r.URL.Path == "/api/test-unifi-sites" {
+				r.URL.Path == "/api/test-unifi-sites" ||
+				r.URL.Path == "/api/test-unifi-paths" {
 				next.ServeHTTP(w, r)
 				return
 			}
 			// For all other routes, redirect to setup
-			http.Redirect(w, r, "/setup", http.StatusTemporaryRedirect)
+			app.redirect(w, r, "/setup", http.StatusTemporaryRedirect)
 			return
 		}
 
@@ -54,40 +64,91 @@ func (app *App) CheckSetupMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// Middleware to identify this instance on every response
+func (app *App) InstanceHeaderMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Instance-Name", app.Config.Server.Instance())
+		next.ServeHTTP(w, r)
+	})
+}
+
 // Middleware to check authentication
 func (app *App) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !app.SessionStore.IsAuthenticated(r) {
+		// Scripts authenticate with an API token instead of a session
+		if token, ok := bearerToken(r); ok {
+			if !app.validAPIToken(token) {
+				app.Logger.Warnf("Rejected API token from %s", r.RemoteAddr)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Sessions of removed users end with them
+		authenticated := app.SessionStore.IsAuthenticated(r)
+		if authenticated && !app.Config.HasAdminUser(app.sessionUser(r)) {
+			authenticated = false
+		}
+
+		if !authenticated {
 			if r.URL.Path[:4] == "/api" {
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			} else {
-				http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
+				target := "/login"
+				// Come back to the page after logging in, but not to logging out again
+				if r.Method == http.MethodGet && r.URL.Path != "/logout" {
+					target += "?next=" + url.QueryEscape(r.URL.RequestURI())
+				}
+				app.redirect(w, r, target, http.StatusTemporaryRedirect)
 			}
 			return
 		}
+		if err := app.SessionStore.Touch(r, w); err != nil {
+			app.Logger.Errorf("Failed to refresh session activity: %v", err)
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// sessionUser returns the admin user the request's session belongs to, see
+// config.Config.SessionUser
+func (app *App) sessionUser(r *http.Request) string {
+	return app.Config.SessionUser(app.SessionStore.Username(r))
+}
+
+// loginRedirect returns where to go after logging in: next if it is a path
+// on this site, the configured landing page otherwise
+func (app *App) loginRedirect(next string) string {
+	// Only local paths, "//host" and "/\host" would leave the site
+	if strings.HasPrefix(next, "/") && !strings.HasPrefix(next, "//") && !strings.HasPrefix(next, "/\\") {
+		if u, err := url.Parse(next); err == nil && u.Scheme == "" && u.Host == "" {
+			return next
+		}
+	}
+	return app.Config.Server.LoginRedirectPath()
+}
+
 // Index handler - redirects to appropriate page
 func (app *App) IndexHandler(w http.ResponseWriter, r *http.Request) {
 	if !app.Config.IsConfigured() {
-		http.Redirect(w, r, "/setup", http.StatusTemporaryRedirect)
+		app.redirect(w, r, "/setup", http.StatusTemporaryRedirect)
 		return
 	}
 
 	if app.SessionStore.IsAuthenticated(r) {
-		http.Redirect(w, r, "/dashboard", http.StatusTemporaryRedirect)
+		app.redirect(w, r, "/dashboard", http.StatusTemporaryRedirect)
 		return
 	}
 
-	http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
+	app.redirect(w, r, "/login", http.StatusTemporaryRedirect)
 }
 
 // Setup wizard page
 func (app *App) SetupWizardHandler(w http.ResponseWriter, r *http.Request) {
 	if app.Config.IsConfigured() {
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		app.redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
@@ -107,9 +168,14 @@ func (app *App) SetupAPIHandler(w http.ResponseWriter, r *http.Request) {
 			Password      string `json:"password"`
 			SiteID        string `json:"site_id"`
 			GateAPMAC     string `json:"gate_ap_mac"`
+			UnifiOS       bool   `json:"unifi_os"`
 		} `json:"unifi"`
 		Shelly struct {
-			TriggerURL string `json:"trigger_url"`
+			TriggerURL  string  `json:"trigger_url"`
+			CloseURL    *string `json:"close_url"` // unchanged when omitted
+			Username    string  `json:"username"`
+			Password    string  `json:"password"`
+			BearerToken string  `json:"bearer_token"`
 		} `json:"shelly"`
 		Gate struct {
 			OpenDuration int `json:"open_duration"`
@@ -121,9 +187,22 @@ func (app *App) SetupAPIHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update configuration
-	app.Config.Admin.Username = req.Admin.Username
-	if err := app.Config.SetAdminPassword(req.Admin.Password); err != nil {
+	if err := app.Config.CheckPasswordPolicy(req.Admin.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Shelly.CloseURL != nil && *req.Shelly.CloseURL == "" && app.Config.Gate.CloseOnDeparture {
+		http.Error(w, "shelly.close_url is needed by gate.close_on_departure", http.StatusBadRequest)
+		return
+	}
+
+	// Update configuration, the setup's admin is the only user
+	app.Config.Admin.Username, app.Config.Admin.PasswordHash, app.Config.Admin.Users = "", "", nil
+	if err := app.Config.AddAdminUser(req.Admin.Username, req.Admin.Password); err != nil {
+		if errors.Is(err, config.ErrEmptyUsername) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Failed to set password", http.StatusInternalServerError)
 		return
 	}
@@ -133,30 +212,35 @@ func (app *App) SetupAPIHandler(w http.ResponseWriter, r *http.Request) {
 	app.Config.UniFi.Password = req.UniFi.Password
 	app.Config.UniFi.SiteID = req.UniFi.SiteID
 	app.Config.UniFi.GateAPMAC = req.UniFi.GateAPMAC
+	app.Config.UniFi.UnifiOS = req.UniFi.UnifiOS
 	app.Config.UniFi.PollInterval = 1 // Default to 1 second
 
 	app.Config.Shelly.TriggerURL = req.Shelly.TriggerURL
+	if req.Shelly.CloseURL != nil {
+		app.Config.Shelly.CloseURL = *req.Shelly.CloseURL
+	}
+	app.Config.Shelly.Username = req.Shelly.Username
+	app.Config.Shelly.Password = req.Shelly.Password
+	app.Config.Shelly.BearerToken = req.Shelly.BearerToken
 	app.Config.Gate.OpenDuration = req.Gate.OpenDuration
 
 	app.Config.SetupComplete = true
 
 	// Save configuration
-	if err := config.SaveConfig("config.yaml", app.Config); err != nil {
+	if err := app.saveConfig(); err != nil {
 		http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
 		return
 	}
 
 	// Initialize UniFi client
-	unifiLogger := unifi.NewLogrusAdapter(app.Logger)
-	app.UniFiClient = unifi.NewClient(
+	app.UniFiClient = app.newUniFiClient(
 		app.Config.UniFi.ControllerURL,
 		app.Config.UniFi.Username,
 		app.Config.UniFi.Password,
-		unifiLogger,
 	)
 
-	// Login to UniFi
-	if err := app.UniFiClient.Login(); err != nil {
+	// Login to UniFi, a single attempt so setup isn't held up
+	if err := app.UniFiClient.LoginOnce(); err != nil {
 		app.Logger.Errorf("Failed to login to UniFi after setup: %v", err)
 		// Don't fail setup, monitoring will retry
 	}
@@ -164,14 +248,20 @@ func (app *App) SetupAPIHandler(w http.ResponseWriter, r *http.Request) {
 	// Start monitoring
 	go app.StartMonitoring()
 
-	// Log in the user
-	if err := app.SessionStore.Login(r, w); err != nil {
-		app.Logger.Errorf("Failed to create session after setup: %v", err)
-		// Don't fail setup, continue anyway
+	// Log in the user, unless they have to prove they know the password
+	loginRequired := app.RequireSetupLogin || !app.Config.Server.SetupAutoLogin
+	if !loginRequired {
+		if err := app.SessionStore.LoginAs(r, w, app.Config.Admin.Users[0].Username); err != nil {
+			app.Logger.Errorf("Failed to create session after setup: %v", err)
+			// Don't fail setup, continue anyway
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]bool{"success": true}); err != nil {
+	if err := json.NewEncoder(w).Encode(map[string]bool{
+		"success":        true,
+		"login_required": loginRequired,
+	}); err != nil {
 		app.Logger.Errorf("Failed to encode response: %v", err)
 	}
 }
@@ -179,7 +269,7 @@ func (app *App) SetupAPIHandler(w http.ResponseWriter, r *http.Request) {
 // Login page
 func (app *App) LoginPageHandler(w http.ResponseWriter, r *http.Request) {
 	if app.SessionStore.IsAuthenticated(r) {
-		http.Redirect(w, r, "/dashboard", http.StatusTemporaryRedirect)
+		app.redirect(w, r, app.loginRedirect(r.URL.Query().Get("next")), http.StatusTemporaryRedirect)
 		return
 	}
 
@@ -191,6 +281,7 @@ func (app *App) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		Next     string `json:"next"` // page that sent the user to the login
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -198,32 +289,76 @@ func (app *App) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify credentials
-	if req.Username != app.Config.Admin.Username ||
-		!app.Config.VerifyAdminPassword(req.Password) {
+	// Verify credentials against any of the admin users
+	if req.Username == "" || !app.Config.VerifyUser(req.Username, req.Password) {
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
 	// Create session
-	if err := app.SessionStore.Login(r, w); err != nil {
+	if err := app.SessionStore.LoginAs(r, w, req.Username); err != nil {
 		http.Error(w, "Failed to create session", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]bool{"success": true}); err != nil {
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"redirect": app.loginRedirect(req.Next),
+	}); err != nil {
 		app.Logger.Errorf("Failed to encode response: %v", err)
 	}
 }
 
 // Logout handler
 func (app *App) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if login := app.SessionStore.LoginID(r); login != "" {
+		app.closeWebSockets(login)
+	}
 	if err := app.SessionStore.Logout(r, w); err != nil {
 		app.Logger.Errorf("Failed to logout: %v", err)
 		// Continue with redirect anyway
 	}
-	http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
+	app.redirect(w, r, "/login", http.StatusTemporaryRedirect)
+}
+
+// Change admin password API
+func (app *App) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// The password of whoever is logged in
+	username := app.sessionUser(r)
+
+	if !app.Config.VerifyUser(username, req.CurrentPassword) {
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+	if err := app.Config.CheckPasswordPolicy(req.NewPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := app.Config.SetUserPassword(username, req.NewPassword); err != nil {
+		http.Error(w, "Failed to set password", http.StatusInternalServerError)
+		return
+	}
+	if err := app.saveConfig(); err != nil {
+		http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"success": true}); err != nil {
+		app.Logger.Errorf("Failed to encode response: %v", err)
+	}
 }
 
 // Dashboard page
@@ -234,16 +369,20 @@ func (app *App) DashboardHandler(w http.ResponseWriter, r *http.Request) {
 	// Get connected devices
 	connectedDevices, _ := app.DB.GetConnectedDevices()
 
+	_, monitoringReason := app.monitoringState()
+
 	data := struct {
 		Config           *config.Config
 		RecentActivity   []database.LogEntry
 		ConnectedDevices map[string]bool
 		IsMonitoring     bool
+		MonitoringReason string
 	}{
 		Config:           app.Config,
 		RecentActivity:   logs,
 		ConnectedDevices: connectedDevices,
 		IsMonitoring:     app.isMonitoring,
+		MonitoringReason: monitoringReason,
 	}
 
 	app.renderTemplate(w, "dashboard.html", data)
@@ -251,31 +390,173 @@ func (app *App) DashboardHandler(w http.ResponseWriter, r *http.Request) {
 
 // Get devices API
 func (app *App) GetDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	// The gate is spelled out, so devices on the primary one say so too
+	devices := make([]config.DeviceConfig, len(app.Config.Devices))
+	for i, device := range app.Config.Devices {
+		device.Gate = device.GateName()
+		devices[i] = device
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(app.Config.Devices); err != nil {
+	if err := json.NewEncoder(w).Encode(devices); err != nil {
 		app.Logger.Errorf("Failed to encode devices: %v", err)
 	}
 }
 
+// deviceDetail is a tracked device's configuration along with what the
+// monitor currently knows about it
+type deviceDetail struct {
+	config.DeviceConfig
+	Monitored       bool       `json:"monitored"`
+	IsConnected     bool       `json:"is_connected"`
+	CurrentAP       string     `json:"current_ap,omitempty"`
+	LastSeen        *time.Time `json:"last_seen,omitempty"`
+	LastGateTrigger *time.Time `json:"last_gate_trigger,omitempty"`
+	SignalTrend     string     `json:"signal_trend,omitempty"` // arriving or leaving the current AP by its signal, or unknown
+	InSchedule      bool       `json:"in_schedule"`            // gate.schedule allows automatic opens right now
+
+	Opens *database.OpenBreakdown `json:"opens,omitempty"` // over the last ?days=, 30 by default
+}
+
+// defaultOpenBreakdownDays is the window of a device's open counts
+const defaultOpenBreakdownDays = 30
+
+// Get a single device API, with its gate opens by direction
+func (app *App) GetDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	device := app.findDevice(mux.Vars(r)["id"])
+	if device == nil {
+		http.Error(w, config.ErrDeviceNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	days := defaultOpenBreakdownDays
+	if d := r.URL.Query().Get("days"); d != "" {
+		v, err := strconv.Atoi(d)
+		if err != nil || v <= 0 {
+			http.Error(w, "days must be a positive number", http.StatusBadRequest)
+			return
+		}
+		days = v
+	}
+
+	detail := deviceDetail{DeviceConfig: *device}
+	detail.Gate = device.GateName()
+	detail.InSchedule = app.Config.Gate.Schedule.Allows(app.clock())
+	opens, err := app.DB.GetDeviceOpenBreakdown(device.MAC, app.clock().AddDate(0, 0, -days))
+	if err != nil {
+		app.Logger.Errorf("Failed to count gate opens for %s: %v", device.MAC, err)
+	} else {
+		detail.Opens = opens
+	}
+	app.monitoringMu.RLock()
+	if state, ok := app.deviceStates[strings.ToUpper(device.MAC)]; ok {
+		detail.Monitored = true
+		detail.IsConnected = state.IsConnected
+		detail.CurrentAP = state.CurrentAP
+		detail.SignalTrend = state.signalTrend()
+		if !state.LastSeen.IsZero() {
+			lastSeen := state.LastSeen
+			detail.LastSeen = &lastSeen
+		}
+		if !state.LastGateTrigger.IsZero() {
+			lastTrigger := state.LastGateTrigger
+			detail.LastGateTrigger = &lastTrigger
+		}
+	}
+	app.monitoringMu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(detail); err != nil {
+		app.Logger.Errorf("Failed to encode device: %v", err)
+	}
+}
+
+// findDevice looks up a tracked device by MAC, ignoring case
+func (app *App) findDevice(mac string) *config.DeviceConfig {
+	for i := range app.Config.Devices {
+		if strings.EqualFold(app.Config.Devices[i].MAC, mac) {
+			return &app.Config.Devices[i]
+		}
+	}
+	return nil
+}
+
 // Add device API
 func (app *App) AddDeviceHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		MAC  string `json:"mac"`
-		Name string `json:"name"`
+		MAC            string                     `json:"mac"`
+		Name           string                     `json:"name"`
+		SSID           string                     `json:"ssid"`
+		BypassCooldown bool                       `json:"bypass_cooldown"`
+		ExpectedBy     string                     `json:"expected_by"`
+		AvatarURL      string                     `json:"avatar_url"`
+		Announcement   string                     `json:"announcement"` // empty for notifications.tts.message
+		Gate           string                     `json:"gate"`         // empty for the primary gate
+		Notifications  *config.DeviceNotifyConfig `json:"notifications"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
+	mac, err := config.NormalizeMAC(req.MAC)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.MAC = mac
+	if !validExpectedBy(w, req.ExpectedBy) {
+		return
+	}
+	if err := req.Notifications.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	avatarURL, err := config.NormalizeAvatarURL(req.AvatarURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	gateName, err := app.Config.ResolveGate(req.Gate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Fall back to what UniFi reported for this client in the last poll
+	if strings.TrimSpace(req.Name) == "" {
+		req.Name = app.discoveredName(req.MAC)
+	}
 
+	app.devicesMu.Lock()
+	defer app.devicesMu.Unlock()
 	if err := app.Config.AddDevice(req.MAC, req.Name); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	device := app.Config.GetDevice(req.MAC)
+	device.SSID = req.SSID
+	device.BypassCooldown = req.BypassCooldown
+	device.ExpectedBy = req.ExpectedBy
+	device.AvatarURL = avatarURL
+	device.Announcement = strings.TrimSpace(req.Announcement)
+	device.Gate = gateName
+	device.Notifications = req.Notifications
+
+	record := deviceRecord(*device)
+	if err := app.DB.AddDevice(&record); err != nil {
+		app.Config.RemoveDevice(req.MAC)
+		if errors.Is(err, database.ErrDeviceExists) {
+			http.Error(w, config.ErrDeviceExists.Error(), http.StatusBadRequest)
+			return
+		}
+		app.Logger.Errorf("Failed to store device %s: %v", req.MAC, err)
+		http.Error(w, "Failed to save device", http.StatusInternalServerError)
+		return
+	}
 
 	// Save configuration
-	if err := config.SaveConfig("config.yaml", app.Config); err != nil {
+	if err := app.saveConfig(); err != nil {
 		http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
 		return
 	}
@@ -285,8 +566,12 @@ func (app *App) AddDeviceHandler(w http.ResponseWriter, r *http.Request) {
 	if app.isMonitoring {
 		normalizedMAC := strings.ToUpper(req.MAC)
 		app.deviceStates[normalizedMAC] = &DeviceState{
-			MAC:  normalizedMAC,
-			Name: req.Name,
+			MAC:            normalizedMAC,
+			Name:           device.Name,
+			SSID:           req.SSID,
+			BypassCooldown: req.BypassCooldown,
+			ExpectedBy:     req.ExpectedBy,
+			Gate:           device.Gate,
 		}
 	}
 	app.monitoringMu.Unlock()
@@ -299,41 +584,106 @@ func (app *App) AddDeviceHandler(w http.ResponseWriter, r *http.Request) {
 
 // Update device API
 func (app *App) UpdateDeviceHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	mac := vars["id"]
+	mac, err := config.NormalizeMAC(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stateKey := strings.ToUpper(mac)
 
 	var req struct {
-		Name    string `json:"name"`
-		Enabled bool   `json:"enabled"`
+		Name           string `json:"name"`
+		Enabled        bool   `json:"enabled"`
+		SSID           string `json:"ssid"`
+		BypassCooldown bool   `json:"bypass_cooldown"`
+		ExpectedBy     string `json:"expected_by"`
+		AvatarURL      string `json:"avatar_url"`
+		Announcement   string `json:"announcement"`
+		// Left unchanged when omitted
+		Gate          *string                    `json:"gate"`
+		Notifications *config.DeviceNotifyConfig `json:"notifications"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
+	if !validExpectedBy(w, req.ExpectedBy) {
+		return
+	}
+	if err := req.Notifications.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	avatarURL, err := config.NormalizeAvatarURL(req.AvatarURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var gateName *string
+	if req.Gate != nil {
+		resolved, err := app.Config.ResolveGate(*req.Gate)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		gateName = &resolved
+	}
 
+	app.devicesMu.Lock()
+	defer app.devicesMu.Unlock()
 	if err := app.Config.UpdateDevice(mac, req.Name, req.Enabled); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		status := http.StatusBadRequest
+		if errors.Is(err, config.ErrDeviceNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	device := app.Config.GetDevice(mac)
+	device.SSID = req.SSID
+	device.BypassCooldown = req.BypassCooldown
+	device.ExpectedBy = req.ExpectedBy
+	device.AvatarURL = avatarURL
+	device.Announcement = strings.TrimSpace(req.Announcement)
+	if gateName != nil {
+		device.Gate = *gateName
+	}
+	if req.Notifications != nil {
+		device.Notifications = req.Notifications
+	}
+
+	if err := app.storeDevice(*device); err != nil {
+		app.Logger.Errorf("Failed to store device %s: %v", mac, err)
+		http.Error(w, "Failed to save device", http.StatusInternalServerError)
 		return
 	}
 
 	// Save configuration
-	if err := config.SaveConfig("config.yaml", app.Config); err != nil {
+	if err := app.saveConfig(); err != nil {
 		http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
 		return
 	}
 
 	// Update monitoring state
 	app.monitoringMu.Lock()
-	if state, exists := app.deviceStates[mac]; exists {
-		state.Name = req.Name
+	if state, exists := app.deviceStates[stateKey]; exists {
+		state.Name = device.Name
+		state.SSID = req.SSID
+		state.BypassCooldown = req.BypassCooldown
+		state.ExpectedBy = req.ExpectedBy
+		state.Gate = device.Gate
 		if !req.Enabled {
-			delete(app.deviceStates, mac)
+			delete(app.deviceStates, stateKey)
 		}
 	} else if req.Enabled && app.isMonitoring {
-		app.deviceStates[mac] = &DeviceState{
-			MAC:  mac,
-			Name: req.Name,
+		app.deviceStates[stateKey] = &DeviceState{
+			MAC:            stateKey,
+			Name:           device.Name,
+			SSID:           req.SSID,
+			BypassCooldown: req.BypassCooldown,
+			ExpectedBy:     req.ExpectedBy,
+			Gate:           device.Gate,
 		}
 	}
 	app.monitoringMu.Unlock()
@@ -346,25 +696,65 @@ func (app *App) UpdateDeviceHandler(w http.ResponseWriter, r *http.Request) {
 
 // Delete device API
 func (app *App) DeleteDeviceHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	mac := vars["id"]
+	mac, err := config.NormalizeMAC(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
+	app.devicesMu.Lock()
+	defer app.devicesMu.Unlock()
 	if err := app.Config.RemoveDevice(mac); err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	if err := app.DB.RemoveDevice(mac); err != nil && !errors.Is(err, database.ErrDeviceNotFound) {
+		app.Logger.Errorf("Failed to remove device %s: %v", mac, err)
+		http.Error(w, "Failed to remove device", http.StatusInternalServerError)
+		return
+	}
 
 	// Save configuration
-	if err := config.SaveConfig("config.yaml", app.Config); err != nil {
+	if err := app.saveConfig(); err != nil {
 		http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
 		return
 	}
 
 	// Remove from monitoring
 	app.monitoringMu.Lock()
-	delete(app.deviceStates, mac)
+	delete(app.deviceStates, strings.ToUpper(mac))
+	app.monitoringMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"success": true}); err != nil {
+		app.Logger.Errorf("Failed to encode response: %v", err)
+	}
+}
+
+// Reset a device's cooldown so its next arrival opens right away
+func (app *App) ResetCooldownHandler(w http.ResponseWriter, r *http.Request) {
+	mac := mux.Vars(r)["id"]
+
+	device := app.findDevice(mac)
+	if device == nil {
+		http.Error(w, config.ErrDeviceNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err := app.DB.ClearLastGateTrigger(device.MAC); err != nil {
+		app.Logger.Errorf("Failed to clear last gate trigger for %s: %v", device.MAC, err)
+		http.Error(w, "Failed to reset cooldown", http.StatusInternalServerError)
+		return
+	}
+
+	app.monitoringMu.Lock()
+	if state, ok := app.deviceStates[strings.ToUpper(device.MAC)]; ok {
+		state.clearTriggers()
+	}
 	app.monitoringMu.Unlock()
 
+	app.Logger.Infof("Cooldown reset for %s (%s)", device.Name, device.MAC)
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]bool{"success": true}); err != nil {
 		app.Logger.Errorf("Failed to encode response: %v", err)
@@ -380,14 +770,22 @@ func (app *App) GetSettingsHandler(w http.ResponseWriter, r *http.Request) {
 			"site_id":        app.Config.UniFi.SiteID,
 			"gate_ap_mac":    app.Config.UniFi.GateAPMAC,
 			"poll_interval":  app.Config.UniFi.PollInterval,
+			"min_signal":     app.Config.UniFi.MinSignal,
+			"unifi_os":       app.Config.UniFi.UnifiOS,
 		},
 		"shelly": map[string]interface{}{
 			"trigger_url": app.Config.Shelly.TriggerURL,
+			"close_url":   app.Config.Shelly.CloseURL,
+			"method":      app.Config.Shelly.Method,
+			"body":        app.Config.Shelly.Body,
+			"username":    app.Config.Shelly.Username,
 		},
 		"gate": map[string]interface{}{
 			"open_duration": app.Config.Gate.OpenDuration,
 			"log_activity":  app.Config.Gate.LogActivity,
+			"observe_only":  app.Config.Gate.ObserveOnly,
 		},
+		"gates": app.Config.GateNames(), // devices can be assigned to any of these
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -396,6 +794,72 @@ func (app *App) GetSettingsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Export config API, downloads devices and gate settings for another instance
+func (app *App) ExportBundleHandler(w http.ResponseWriter, r *http.Request) {
+	bundle := app.Config.ExportBundle()
+
+	filename := fmt.Sprintf("gate-opener-export-%s.json", bundle.ExportedAt.Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := json.NewEncoder(w).Encode(bundle); err != nil {
+		app.Logger.Errorf("Failed to encode export: %v", err)
+	}
+}
+
+// Import config API, replaces devices and gate settings from an export
+func (app *App) ImportBundleHandler(w http.ResponseWriter, r *http.Request) {
+	var bundle config.Bundle
+	if err := json.NewDecoder(r.Body).Decode(&bundle); err != nil {
+		app.sendJSONError(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	app.devicesMu.Lock()
+	defer app.devicesMu.Unlock()
+
+	// Import into a copy so a failed database write leaves the running config alone
+	next := *app.Config
+	if err := next.ImportBundle(bundle); err != nil {
+		app.sendJSONError(w, fmt.Sprintf("Invalid import: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	records := make([]database.Device, len(next.Devices))
+	for i, device := range next.Devices {
+		records[i] = deviceRecord(device)
+	}
+	if err := app.DB.ReplaceDevices(records); err != nil {
+		app.Logger.Errorf("Failed to store imported devices: %v", err)
+		http.Error(w, "Failed to save devices", http.StatusInternalServerError)
+		return
+	}
+	app.Config.Devices = next.Devices
+	app.Config.Gate = next.Gate
+
+	if err := app.saveConfig(); err != nil {
+		http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
+		return
+	}
+
+	// Track the imported devices from now on
+	app.monitoringMu.Lock()
+	if app.isMonitoring {
+		app.deviceStates = make(map[string]*DeviceState)
+		app.loadDeviceStates()
+	}
+	app.monitoringMu.Unlock()
+
+	app.Logger.Infof("Imported %d devices from bundle", len(bundle.Devices))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"devices": len(bundle.Devices),
+	}); err != nil {
+		app.Logger.Errorf("Failed to encode response: %v", err)
+	}
+}
+
 // Update settings API
 func (app *App) UpdateSettingsHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
@@ -406,13 +870,23 @@ func (app *App) UpdateSettingsHandler(w http.ResponseWriter, r *http.Request) {
 			SiteID        string `json:"site_id"`
 			GateAPMAC     string `json:"gate_ap_mac"`
 			PollInterval  int    `json:"poll_interval"`
+			MinSignal     *int   `json:"min_signal"` // unchanged when omitted
+			UnifiOS       *bool  `json:"unifi_os"`   // unchanged when omitted
 		} `json:"unifi"`
 		Shelly struct {
-			TriggerURL string `json:"trigger_url"`
+			TriggerURL string  `json:"trigger_url"`
+			CloseURL   *string `json:"close_url"` // unchanged when omitted
+			Method     *string `json:"method"`    // unchanged when omitted
+			Body       *string `json:"body"`      // unchanged when omitted
+			// Unchanged when omitted, the secrets are never sent back
+			Username    *string `json:"username"`
+			Password    *string `json:"password"`
+			BearerToken *string `json:"bearer_token"`
 		} `json:"shelly"`
 		Gate struct {
-			OpenDuration int  `json:"open_duration"`
-			LogActivity  bool `json:"log_activity"`
+			OpenDuration int   `json:"open_duration"`
+			LogActivity  bool  `json:"log_activity"`
+			ObserveOnly  *bool `json:"observe_only"` // unchanged when omitted
 		} `json:"gate"`
 	}
 
@@ -421,6 +895,21 @@ func (app *App) UpdateSettingsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Shelly.Method != nil && !gate.ValidMethod(*req.Shelly.Method) {
+		http.Error(w, "shelly.method must be GET, POST or PUT", http.StatusBadRequest)
+		return
+	}
+	if req.UniFi.MinSignal != nil && *req.UniFi.MinSignal > 0 {
+		http.Error(w, "unifi.min_signal must be a negative dBm value, or 0 to disable it", http.StatusBadRequest)
+		return
+	}
+	if req.Shelly.CloseURL != nil && *req.Shelly.CloseURL == "" && app.Config.Gate.CloseOnDeparture {
+		http.Error(w, "shelly.close_url is needed by gate.close_on_departure", http.StatusBadRequest)
+		return
+	}
+
+	before := settingsSnapshot(app.Config)
+
 	// Update configuration
 	app.Config.UniFi.ControllerURL = req.UniFi.ControllerURL
 	app.Config.UniFi.Username = req.UniFi.Username
@@ -430,31 +919,64 @@ func (app *App) UpdateSettingsHandler(w http.ResponseWriter, r *http.Request) {
 	app.Config.UniFi.SiteID = req.UniFi.SiteID
 	app.Config.UniFi.GateAPMAC = req.UniFi.GateAPMAC
 	app.Config.UniFi.PollInterval = req.UniFi.PollInterval
+	if req.UniFi.MinSignal != nil {
+		app.Config.UniFi.MinSignal = *req.UniFi.MinSignal
+	}
+	if req.UniFi.UnifiOS != nil {
+		app.Config.UniFi.UnifiOS = *req.UniFi.UnifiOS
+	}
 
 	app.Config.Shelly.TriggerURL = req.Shelly.TriggerURL
+	if req.Shelly.CloseURL != nil {
+		app.Config.Shelly.CloseURL = *req.Shelly.CloseURL
+	}
+	if req.Shelly.Method != nil {
+		app.Config.Shelly.Method = strings.ToUpper(*req.Shelly.Method)
+	}
+	if req.Shelly.Body != nil {
+		app.Config.Shelly.Body = *req.Shelly.Body
+	}
+	if req.Shelly.Username != nil {
+		app.Config.Shelly.Username = *req.Shelly.Username
+	}
+	if req.Shelly.Password != nil {
+		app.Config.Shelly.Password = *req.Shelly.Password
+	}
+	if req.Shelly.BearerToken != nil {
+		app.Config.Shelly.BearerToken = *req.Shelly.BearerToken
+	}
 	app.Config.Gate.OpenDuration = req.Gate.OpenDuration
 	app.Config.Gate.LogActivity = req.Gate.LogActivity
+	if req.Gate.ObserveOnly != nil {
+		app.Config.Gate.ObserveOnly = *req.Gate.ObserveOnly
+	}
 
 	// Save configuration
-	if err := config.SaveConfig("config.yaml", app.Config); err != nil {
+	if err := app.saveConfig(); err != nil {
 		http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
 		return
 	}
+	app.recordSettingChanges(before)
 
 	// Update gate controller URL
-	if app.GateController != nil {
-		app.GateController.UpdateURL(req.Shelly.TriggerURL)
-	}
-
-	// Restart monitoring if UniFi settings changed
-	if app.isMonitoring {
+	controller := app.gateController()
+	controller.UpdateURL(app.Config.Shelly.BuildTriggerURL())
+	controller.UpdateCloseURL(app.Config.Shelly.CloseURL)
+	controller.SetAuth(app.Config.Shelly.Username, app.Config.Shelly.Password, app.Config.Shelly.BearerToken)
+	app.setGateRequest(controller)
+	app.resetRelays()
+
+	// Restart monitoring if UniFi settings changed, or retry if it refused
+	// to start without a gate AP
+	app.monitoringMu.RLock()
+	restart := app.isMonitoring || app.gateAPErr != nil
+	app.monitoringMu.RUnlock()
+	if restart {
 		app.StopMonitoring()
-		unifiLogger := unifi.NewLogrusAdapter(app.Logger)
-		app.UniFiClient = unifi.NewClient(
+		app.UniFiClient = app.newUniFiClient(
 			app.Config.UniFi.ControllerURL,
 			app.Config.UniFi.Username,
 			app.Config.UniFi.Password,
-			unifiLogger,
 		)
 		go app.StartMonitoring()
 	}
@@ -467,36 +989,168 @@ func (app *App) UpdateSettingsHandler(w http.ResponseWriter, r *http.Request) {
 
 // Get logs API
 func (app *App) GetLogsHandler(w http.ResponseWriter, r *http.Request) {
-	limit := 100
-	offset := 0
+	filter, err := logFilterFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Limit = 100
 
 	if l := r.URL.Query().Get("limit"); l != "" {
 		if v, err := strconv.Atoi(l); err == nil {
-			limit = v
+			filter.Limit = v
 		}
 	}
 
 	if o := r.URL.Query().Get("offset"); o != "" {
 		if v, err := strconv.Atoi(o); err == nil {
-			offset = v
+			filter.Offset = v
 		}
 	}
 
-	logs, err := app.DB.GetLogs(limit, offset)
+	logs, total, err := app.DB.GetLogsFiltered(filter)
 	if err != nil {
 		http.Error(w, "Failed to get logs", http.StatusInternalServerError)
 		return
 	}
+	if logs == nil {
+		logs = []database.LogEntry{}
+	}
 
+	// The body stays a plain array, the total for paging goes in a header
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(logs); err != nil {
 		app.Logger.Errorf("Failed to encode logs: %v", err)
 	}
 }
 
+// Get a single log entry API
+func (app *App) GetLogHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid log ID", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := app.DB.GetLogByID(id)
+	if err != nil {
+		app.Logger.Errorf("Failed to get log %d: %v", id, err)
+		http.Error(w, "Failed to get log", http.StatusInternalServerError)
+		return
+	}
+	if entry == nil {
+		http.Error(w, "Log entry not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entry); err != nil {
+		app.Logger.Errorf("Failed to encode log: %v", err)
+	}
+}
+
+// logFilterFromQuery reads the device, event, since and until log filters
+// from the query string, from and to being accepted for since and until.
+// Times are RFC 3339.
+func logFilterFromQuery(r *http.Request) (database.LogFilter, error) {
+	query := r.URL.Query()
+	filter := database.LogFilter{
+		DeviceMAC: query.Get("device"),
+		Event:     query.Get("event"),
+	}
+
+	var err error
+	if filter.Since, err = timeParam(query, "since", "from"); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = timeParam(query, "until", "to"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// timeParam parses the first of names given in query as RFC3339, zero if
+// none is given
+func timeParam(query url.Values, names ...string) (time.Time, error) {
+	for _, name := range names {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		return t, nil
+	}
+	return time.Time{}, nil
+}
+
+// Export logs API, downloads filtered logs as a JSON array
+func (app *App) ExportLogsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := logFilterFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filename := fmt.Sprintf("gate-logs-%s.json", time.Now().Format("20060102-150405"))
+
+	// Stream entries one by one so large exports don't build up in memory.
+	// Nothing is written until the query has returned its first row, so a
+	// failing query still gets a proper error status.
+	started := false
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		_, err := io.WriteString(w, "[")
+		return err
+	}
+	err = app.DB.EachLog(filter, func(entry database.LogEntry) error {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		sep := ","
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+			sep = ""
+		}
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		app.Logger.Errorf("Failed to export logs: %v", err)
+		if !started {
+			http.Error(w, "Failed to export logs", http.StatusInternalServerError)
+		}
+		// Otherwise the headers are already sent, so the download is cut short
+		return
+	}
+	if !started {
+		if err := start(); err != nil {
+			return
+		}
+	}
+	if _, err := io.WriteString(w, "]\n"); err != nil {
+		app.Logger.Errorf("Failed to export logs: %v", err)
+	}
+}
+
 // Get status API
 func (app *App) GetStatusHandler(w http.ResponseWriter, r *http.Request) {
+	monitoringState, monitoringReason := app.monitoringState()
+
 	app.monitoringMu.RLock()
+	isMonitoring := app.isMonitoring
 	deviceStates := make(map[string]interface{})
 	for mac, state := range app.deviceStates {
 		deviceStates[mac] = map[string]interface{}{
@@ -509,11 +1163,15 @@ func (app *App) GetStatusHandler(w http.ResponseWriter, r *http.Request) {
 	app.monitoringMu.RUnlock()
 
 	status := map[string]interface{}{
-		"is_monitoring": app.isMonitoring,
-		"devices":       deviceStates,
+		"instance":          app.Config.Server.Instance(),
+		"is_monitoring":     isMonitoring,
+		"monitoring_state":  monitoringState,
+		"monitoring_reason": monitoringReason,
+		"devices":           deviceStates,
 		"config": map[string]interface{}{
 			"gate_ap_mac":   app.Config.UniFi.GateAPMAC,
 			"poll_interval": app.Config.UniFi.PollInterval,
+			"observe_only":  app.Config.Gate.ObserveOnly,
 		},
 	}
 
@@ -523,6 +1181,40 @@ func (app *App) GetStatusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Get status as plain text, one "key: value" line per metric, for checks
+// with curl and grep or a status bar script
+func (app *App) GetStatusTextHandler(w http.ResponseWriter, r *http.Request) {
+	monitoringState, monitoringReason := app.monitoringState()
+
+	app.monitoringMu.RLock()
+	lastPoll, lastErr := app.lastPollAt, app.lastPollErr
+	connected := 0
+	for _, state := range app.deviceStates {
+		if state.IsConnected {
+			connected++
+		}
+	}
+	tracked := len(app.deviceStates)
+	app.monitoringMu.RUnlock()
+
+	polled := "never"
+	if !lastPoll.IsZero() {
+		polled = lastPoll.UTC().Format(time.RFC3339)
+	}
+	lastError := "none"
+	if lastErr != nil {
+		lastError = lastErr.Error()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "instance: %s\n", app.Config.Server.Instance())
+	fmt.Fprintf(w, "monitoring: %s\n", monitoringState)
+	fmt.Fprintf(w, "monitoring_reason: %s\n", monitoringReason)
+	fmt.Fprintf(w, "last_poll: %s\n", polled)
+	fmt.Fprintf(w, "connected: %d/%d\n", connected, tracked)
+	fmt.Fprintf(w, "last_error: %s\n", lastError)
+}
+
 // Get UniFi access points API
 func (app *App) GetAccessPointsHandler(w http.ResponseWriter, r *http.Request) {
 	if app.UniFiClient == nil {
@@ -531,7 +1223,7 @@ func (app *App) GetAccessPointsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Ensure we're logged in
-	if err := app.UniFiClient.Login(); err != nil {
+	if err := app.UniFiClient.EnsureLoggedIn(); err != nil {
 		http.Error(w, "Failed to connect to UniFi", http.StatusInternalServerError)
 		return
 	}
@@ -555,17 +1247,13 @@ func (app *App) GetUniFiClientsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Ensure we're logged in
-	if err := app.UniFiClient.Login(); err != nil {
-		http.Error(w, "Failed to connect to UniFi", http.StatusInternalServerError)
-		return
-	}
-
-	clients, err := app.UniFiClient.GetActiveClients(app.Config.UniFi.SiteID)
+	clients, cachedAt, err := app.cachedActiveClients()
 	if err != nil {
+		app.Logger.Errorf("Failed to get UniFi clients: %v", err)
 		http.Error(w, "Failed to get clients", http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Age", strconv.Itoa(int(app.clock().Sub(cachedAt).Seconds())))
 
 	// Format clients for frontend
 	formattedClients := make([]map[string]interface{}, len(clients))
@@ -585,26 +1273,239 @@ func (app *App) GetUniFiClientsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Test gate API
+// cachedActiveClients returns the controller's active clients and when they
+// were fetched. The controller is asked at most once per clients_cache_ttl,
+// or clients_min_interval if that's longer, callers in between get the same
+// list, and concurrent callers wait for a single fetch instead of each
+// starting their own.
+func (app *App) cachedActiveClients() ([]unifi.WirelessClient, time.Time, error) {
+	app.clientsCacheMu.Lock()
+	defer app.clientsCacheMu.Unlock()
+
+	now := app.clock()
+	ttl := time.Duration(max(app.Config.UniFi.ClientsCacheTTL, app.Config.UniFi.ClientsMinInterval)) * time.Second
+	if app.clientsCache != nil && now.Sub(app.clientsCachedAt) < ttl {
+		return app.clientsCache, app.clientsCachedAt, nil
+	}
+
+	if err := app.UniFiClient.EnsureLoggedIn(); err != nil {
+		return nil, time.Time{}, err
+	}
+	clients, err := app.UniFiClient.GetActiveClients(app.Config.UniFi.SiteID)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if clients == nil {
+		clients = []unifi.WirelessClient{}
+	}
+
+	app.clientsCache = clients
+	app.clientsCachedAt = now
+	return clients, now, nil
+}
+
+// Raw UniFi fields for one client, for working out why a device doesn't match
+func (app *App) GetUniFiClientRawHandler(w http.ResponseWriter, r *http.Request) {
+	mac := mux.Vars(r)["mac"]
+
+	find := func(clients []unifi.WirelessClient) *unifi.WirelessClient {
+		for i := range clients {
+			if strings.EqualFold(clients[i].MAC, mac) {
+				return &clients[i]
+			}
+		}
+		return nil
+	}
+
+	// Prefer what monitoring saw, that's what matching worked with
+	source := "poll"
+	app.monitoringMu.RLock()
+	client := find(app.lastClients)
+	polledAt := app.lastPollAt
+	app.monitoringMu.RUnlock()
+
+	if client == nil {
+		if app.UniFiClient == nil {
+			http.Error(w, "UniFi not configured", http.StatusBadRequest)
+			return
+		}
+		if err := app.UniFiClient.EnsureLoggedIn(); err != nil {
+			http.Error(w, "Failed to connect to UniFi", http.StatusInternalServerError)
+			return
+		}
+		clients, err := app.UniFiClient.GetActiveClients(app.Config.UniFi.SiteID)
+		if err != nil {
+			http.Error(w, "Failed to get clients", http.StatusInternalServerError)
+			return
+		}
+		source = "fetch"
+		polledAt = time.Now()
+		client = find(clients)
+	}
+
+	if client == nil {
+		http.Error(w, "Client not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"source":    source,
+		"polled_at": polledAt,
+		"client":    client,
+	}); err != nil {
+		app.Logger.Errorf("Failed to encode client: %v", err)
+	}
+}
+
+// Test gate API, opens the gate or closes it with {"action": "close"}. With
+// dry=true, in the query or body, the open request is only sent somewhere
+// harmless, see dryOpenGate.
 func (app *App) TestGateHandler(w http.ResponseWriter, r *http.Request) {
-	if app.GateController == nil {
-		app.GateController = gate.NewController(app.Config.Shelly.TriggerURL, app.Logger)
+	var req struct {
+		Nonce  string `json:"nonce"`
+		Action string `json:"action"` // "open" (default) or "close"
+		Dry    bool   `json:"dry"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	dry := req.Dry || r.URL.Query().Get("dry") == "true"
+
+	switch req.Action {
+	case "", "open":
+		if dry {
+			app.dryOpenGate(w)
+			return
+		}
+		app.manualOpenGate(w, req.Nonce, "Gate opened via manual test")
+	case "close":
+		if dry {
+			http.Error(w, "Only opens can be dry", http.StatusBadRequest)
+			return
+		}
+		app.manualCloseGate(w)
+	default:
+		http.Error(w, fmt.Sprintf("unknown action %q", req.Action), http.StatusBadRequest)
 	}
+}
 
-	if err := app.GateController.OpenGate(); err != nil {
+// Open the gate API, for scripts and home automation rather than the test
+// button. Works whether or not monitoring is running.
+func (app *App) OpenGateHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Nonce string `json:"nonce"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	app.manualOpenGate(w, req.Nonce, "Gate opened via API")
+}
+
+// dryOpenGate builds the primary gate's open request and sends it to
+// shelly.dry_open_url, so its shape can be checked without the gate moving.
+// Nothing is logged or broadcast.
+func (app *App) dryOpenGate(w http.ResponseWriter) {
+	result, err := app.gateController().DryOpen(app.Config.Shelly.DryOpenURL)
+	if errors.Is(err, gate.ErrNoDryOpenURL) {
+		http.Error(w, "Dry opens require shelly.dry_open_url", http.StatusBadRequest)
+		return
+	}
+	if err != nil && result == nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Log the test if activity logging is enabled
+	response := map[string]interface{}{
+		"success": err == nil,
+		"dry":     true,
+		"request": result,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		app.Logger.Warnf("Dry gate open failed: %v", err)
+		response["error"] = err.Error()
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		app.Logger.Errorf("Failed to encode response: %v", err)
+	}
+}
+
+// manualOpenGate opens the gate on request, logging message on success
+func (app *App) manualOpenGate(w http.ResponseWriter, nonce, message string) {
+	if app.Config.Gate.ManualOpenRequiresMonitoring {
+		app.monitoringMu.RLock()
+		monitoring := app.isMonitoring
+		app.monitoringMu.RUnlock()
+		if !monitoring {
+			http.Error(w, "Monitoring is stopped, manual opens are disabled", http.StatusConflict)
+			return
+		}
+	}
+
+	if app.Config.Gate.RequireOpenConfirmation {
+		if err := app.consumeOpenNonce(nonce); err != nil {
+			app.Logger.Warnf("Rejected manual gate open: %v", err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := app.gateController().OpenGate(); errors.Is(err, gate.ErrDebounced) {
+		// Triggered a moment ago, by another click or the monitor
+		app.Logger.Infof("Manual gate open skipped: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]bool{"success": true, "debounced": true}); err != nil {
+			app.Logger.Errorf("Failed to encode response: %v", err)
+		}
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	app.learnManualOpen()
+	app.broadcast(liveEvent{Type: "gate", Event: "gate_triggered", Time: app.clock()})
+	app.publishGateTrigger(mqttGateTrigger{Time: app.clock(), DeviceMAC: "manual", DeviceName: "Manual", Direction: "manual"})
+	app.notifyGateOpened(notify.Message{Event: "gate_triggered", Text: message})
+
+	// Log the open if activity logging is enabled
 	if app.Config.Gate.LogActivity {
-		if err := app.DB.LogEvent(&database.LogEntry{
+		if err := app.logEvent(&database.LogEntry{
 			DeviceMAC:  "manual",
 			DeviceName: "Manual Test",
 			Event:      "gate_triggered",
 			Direction:  "manual",
 			GateOpened: true,
-			Message:    "Gate opened via manual test",
+			Message:    message,
+		}); err != nil {
+			app.Logger.Errorf("Failed to log test event: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"success": true}); err != nil {
+		app.Logger.Errorf("Failed to encode response: %v", err)
+	}
+}
+
+// manualCloseGate closes the gate from the UI or API
+func (app *App) manualCloseGate(w http.ResponseWriter) {
+	if err := app.gateController().CloseGate(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if app.Config.Gate.LogActivity {
+		if err := app.logEvent(&database.LogEntry{
+			DeviceMAC:  "manual",
+			DeviceName: "Manual Test",
+			Event:      "gate_closed",
+			Direction:  "manual",
+			Message:    "Gate closed via manual test",
 		}); err != nil {
 			app.Logger.Errorf("Failed to log test event: %v", err)
 		}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+	"github.com/gorilla/mux"
+)
+
+// Reason codes of would-open answers besides those of openDecision
+const (
+	reasonDeviceDisabled  = "device_disabled"
+	reasonNotMonitoring   = "not_monitoring"
+	reasonNoGateAP        = "no_gate_ap"
+	reasonConnectDisabled = "trigger_on_connect_disabled"
+	reasonObserveOnly     = "observe_only"
+)
+
+// Would a device arriving at the gate open it right now API. A cheap,
+// side-effect free answer for automations to poll, with a reason code to
+// match on; /api/simulate with dry_run explains the same in words.
+func (app *App) WouldOpenHandler(w http.ResponseWriter, r *http.Request) {
+	mac, err := config.NormalizeMAC(mux.Vars(r)["id"])
+	if err != nil {
+		app.sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	device := app.findDevice(mac)
+	if device == nil {
+		app.sendJSONError(w, config.ErrDeviceNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	open, code := app.wouldOpen(device)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"would_open": open,
+		"reason":     code,
+	}); err != nil {
+		app.Logger.Errorf("Failed to encode response: %v", err)
+	}
+}
+
+// wouldOpen runs the checks an arrival at the gate AP goes through, in the
+// same order, against the live state
+func (app *App) wouldOpen(device *config.DeviceConfig) (bool, string) {
+	if !device.Enabled {
+		return false, reasonDeviceDisabled
+	}
+
+	app.monitoringMu.RLock()
+	defer app.monitoringMu.RUnlock()
+
+	switch {
+	case !app.isMonitoring:
+		return false, reasonNotMonitoring
+	case app.Config.UniFi.GateAPMAC == "":
+		return false, reasonNoGateAP
+	case !app.Config.Gate.TriggerOnConnect:
+		return false, reasonConnectDisabled
+	}
+
+	state, _ := app.simulationState(strings.ToUpper(device.MAC))
+	if state == nil {
+		return false, reasonDeviceDisabled
+	}
+	open, code, _ := app.openDecision(state, directionArriving)
+	if open && app.Config.Gate.ObserveOnly {
+		return false, reasonObserveOnly
+	}
+	return open, code
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/config"
+)
+
+func TestWouldOpenHandler(t *testing.T) {
+	newApp := func(t *testing.T) (*App, *DeviceState) {
+		app := newTestApp(t)
+		markConfigured(app)
+		app.Config.Devices = []config.DeviceConfig{
+			{MAC: "aa:bb:cc:dd:ee:01", Name: "Phone", Enabled: true},
+			{MAC: "aa:bb:cc:dd:ee:02", Name: "Car", Enabled: false},
+		}
+		app.isMonitoring = true
+		return app, trackDevice(app, testDeviceMAC, "Phone")
+	}
+	ask := func(t *testing.T, app *App, mac string) (int, bool, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		app.Routes().ServeHTTP(w, func() *http.Request {
+			req := httptest.NewRequest("GET", "/api/devices/"+mac+"/would-open", nil)
+			req.AddCookie(loginCookie(t, app))
+			return req
+		}())
+		var resp struct {
+			WouldOpen bool   `json:"would_open"`
+			Reason    string `json:"reason"`
+		}
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode %s: %v", w.Body.String(), err)
+			}
+		}
+		return w.Code, resp.WouldOpen, resp.Reason
+	}
+
+	t.Run("Device without cooldown would open", func(t *testing.T) {
+		app, _ := newApp(t)
+		code, open, reason := ask(t, app, "AA-BB-CC-DD-EE-01")
+		if code != http.StatusOK || !open || reason != reasonNoCooldown {
+			t.Errorf("Expected an open without cooldown, got %d %v %q", code, open, reason)
+		}
+	})
+
+	t.Run("Device in its cooldown would not", func(t *testing.T) {
+		app, state := newApp(t)
+		hits := newTestRelay(t, app)
+		state.LastGateTrigger = time.Now()
+
+		code, open, reason := ask(t, app, "aa:bb:cc:dd:ee:01")
+		if code != http.StatusOK || open || reason != reasonCooldown {
+			t.Errorf("Expected the cooldown to block it, got %d %v %q", code, open, reason)
+		}
+		if *hits != 0 || app.deviceStates[testDeviceMAC].LastGateTrigger != state.LastGateTrigger {
+			t.Error("Expected no side effects")
+		}
+
+		state.BypassCooldown = true
+		if _, open, reason := ask(t, app, "aa:bb:cc:dd:ee:01"); !open || reason != reasonCooldownBypassed {
+			t.Errorf("Expected the bypass to open, got %v %q", open, reason)
+		}
+	})
+
+	t.Run("Other reasons", func(t *testing.T) {
+		app, _ := newApp(t)
+		if _, open, reason := ask(t, app, "aa:bb:cc:dd:ee:02"); open || reason != reasonDeviceDisabled {
+			t.Errorf("Expected the disabled device not to open, got %v %q", open, reason)
+		}
+
+		app.Config.Gate.ObserveOnly = true
+		if _, open, reason := ask(t, app, "aa:bb:cc:dd:ee:01"); open || reason != reasonObserveOnly {
+			t.Errorf("Expected observe-only not to open, got %v %q", open, reason)
+		}
+
+		app.isMonitoring = false
+		if _, open, reason := ask(t, app, "aa:bb:cc:dd:ee:01"); open || reason != reasonNotMonitoring {
+			t.Errorf("Expected no open without monitoring, got %v %q", open, reason)
+		}
+	})
+
+	t.Run("Unknown and invalid MACs", func(t *testing.T) {
+		app, _ := newApp(t)
+		if code, _, _ := ask(t, app, "aa:bb:cc:dd:ee:03"); code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", code)
+		}
+		if code, _, _ := ask(t, app, "phone"); code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", code)
+		}
+	})
+}
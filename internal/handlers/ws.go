@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsPingInterval is how often idle connections are pinged, and their
+	// session checked for having been logged out or revoked
+	wsPingInterval = 30 * time.Second
+	// wsWriteTimeout bounds a single write to a client
+	wsWriteTimeout = 10 * time.Second
+	// wsBuffer is how many events may queue for a slow client before it
+	// misses some
+	wsBuffer = 64
+	// wsShutdownTimeout bounds waiting for clients to be told about a shutdown
+	wsShutdownTimeout = 2 * time.Second
+)
+
+// liveEvent is pushed to /api/ws clients when a tracked device connects,
+// disconnects or roams, or the gate is triggered
+type liveEvent struct {
+	Type   string      `json:"type"`  // "device" or "gate"
+	Event  string      `json:"event"` // connected, disconnected, roamed or gate_triggered
+	Device *liveDevice `json:"device,omitempty"`
+	Time   time.Time   `json:"time"`
+}
+
+// liveDevice is a tracked device's state after the change
+type liveDevice struct {
+	MAC             string     `json:"mac"`
+	Name            string     `json:"name"`
+	IsConnected     bool       `json:"is_connected"`
+	CurrentAP       string     `json:"current_ap,omitempty"`
+	Gate            string     `json:"gate,omitempty"`
+	LastSeen        *time.Time `json:"last_seen,omitempty"`
+	LastGateTrigger *time.Time `json:"last_gate_trigger,omitempty"`
+}
+
+// wsClient is a connected /api/ws client
+type wsClient struct {
+	login  string // login it authenticated with, see auth.SessionStore.LoginID
+	user   string // admin user it belongs to, see App.sessionUser
+	events chan liveEvent
+	done   chan struct{}
+	once   sync.Once
+
+	// Close frame sent once done is closed, set before closing it
+	closeCode   int
+	closeReason string
+}
+
+// close ends the connection with a going away close frame, telling the
+// dashboard to reconnect
+func (c *wsClient) close() {
+	c.closeWith(websocket.CloseGoingAway, "")
+}
+
+// closeWith ends the connection with the given close code and reason. Only
+// the first call counts.
+func (c *wsClient) closeWith(code int, reason string) {
+	c.once.Do(func() {
+		c.closeCode, c.closeReason = code, reason
+		close(c.done)
+	})
+}
+
+// liveHub tracks the /api/ws clients
+type liveHub struct {
+	mu      sync.Mutex
+	clients map[*wsClient]struct{}
+	serving sync.WaitGroup // running WebSocketHandlers
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// The default origin check keeps other sites from using the session cookie
+}
+
+// Live device and gate updates over a WebSocket, so the dashboard doesn't
+// have to be reloaded. Events are sent as JSON text messages.
+func (app *App) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade already answered the request
+		app.Logger.Debugf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	client := &wsClient{
+		login:  app.SessionStore.LoginID(r),
+		user:   app.sessionUser(r),
+		events: make(chan liveEvent, wsBuffer),
+		done:   make(chan struct{}),
+	}
+	app.live.mu.Lock()
+	if app.live.clients == nil {
+		app.live.clients = make(map[*wsClient]struct{})
+	}
+	app.live.clients[client] = struct{}{}
+	app.live.serving.Add(1)
+	app.live.mu.Unlock()
+	defer func() {
+		app.live.mu.Lock()
+		delete(app.live.clients, client)
+		app.live.mu.Unlock()
+		app.live.serving.Done()
+	}()
+
+	// Clients only send control frames, reading processes them and notices
+	// the client going away
+	go func() {
+		defer client.close()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-client.done:
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(client.closeCode, client.closeReason), time.Now().Add(wsWriteTimeout))
+			return
+		case <-ping.C:
+			if !app.SessionStore.IsAuthenticated(r) {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session ended"), time.Now().Add(wsWriteTimeout))
+				return
+			}
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		case event := <-client.events:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// broadcast sends an event to every /api/ws client. Clients that don't keep
+// up miss events rather than holding up monitoring.
+func (app *App) broadcast(event liveEvent) {
+	app.live.mu.Lock()
+	defer app.live.mu.Unlock()
+
+	for client := range app.live.clients {
+		select {
+		case client.events <- event:
+		default:
+		}
+	}
+}
+
+// broadcastDevice sends a device's current state to /api/ws clients
+func (app *App) broadcastDevice(event string, state *DeviceState) {
+	device := &liveDevice{
+		MAC:         state.MAC,
+		Name:        state.Name,
+		IsConnected: state.IsConnected,
+		CurrentAP:   state.CurrentAP,
+		Gate:        state.Gate,
+	}
+	if !state.LastSeen.IsZero() {
+		lastSeen := state.LastSeen
+		device.LastSeen = &lastSeen
+	}
+	if !state.LastGateTrigger.IsZero() {
+		lastTrigger := state.LastGateTrigger
+		device.LastGateTrigger = &lastTrigger
+	}
+
+	eventType := "device"
+	if event == "gate_triggered" {
+		eventType = "gate"
+	}
+	app.broadcast(liveEvent{Type: eventType, Event: event, Device: device, Time: app.clock()})
+}
+
+// closeWebSockets disconnects the /api/ws clients of a login, or all of them
+// with an empty login. Clients of a login that logged out are closed with a
+// policy violation, which sends the dashboard to the login page; on shutdown
+// they're told the server is going away, so they reconnect.
+func (app *App) closeWebSockets(login string) {
+	app.live.mu.Lock()
+	defer app.live.mu.Unlock()
+
+	for client := range app.live.clients {
+		switch {
+		case login == "":
+			client.close()
+		case client.login == login:
+			client.closeWith(websocket.ClosePolicyViolation, "logged out")
+		}
+	}
+}
+
+// closeUserWebSockets disconnects the live update clients of a removed admin
+// user, sending their dashboards to the login page like logging out does
+func (app *App) closeUserWebSockets(user string) {
+	app.live.mu.Lock()
+	defer app.live.mu.Unlock()
+
+	for client := range app.live.clients {
+		if client.user == user {
+			client.closeWith(websocket.ClosePolicyViolation, "user removed")
+		}
+	}
+}
+
+// Shutdown disconnects the live update clients so they can reconnect to the
+// next instance instead of waiting on a dead connection
+func (app *App) Shutdown() {
+	app.closeWebSockets("")
+
+	closed := make(chan struct{})
+	go func() {
+		app.live.serving.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(wsShutdownTimeout):
+		app.Logger.Warn("Timed out closing live update connections")
+	}
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fbettag/unifi-gate-opener/internal/unifi"
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocket(t *testing.T) {
+	connect := func(t *testing.T, app *App, server *httptest.Server, cookie *http.Cookie) *websocket.Conn {
+		t.Helper()
+		app.live.mu.Lock()
+		before := len(app.live.clients)
+		app.live.mu.Unlock()
+
+		header := http.Header{}
+		header.Set("Cookie", cookie.Name+"="+cookie.Value)
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/ws", header)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		// Wait for the handler to register the client
+		for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+			app.live.mu.Lock()
+			registered := len(app.live.clients)
+			app.live.mu.Unlock()
+			if registered > before {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("WebSocket client was never registered")
+			}
+		}
+		return conn
+	}
+
+	newServer := func(t *testing.T) (*App, *httptest.Server, *http.Cookie) {
+		app := newTestApp(t)
+		markConfigured(app)
+		server := httptest.NewServer(app.Routes())
+		t.Cleanup(server.Close)
+		return app, server, loginCookie(t, app)
+	}
+
+	readEvent := func(t *testing.T, conn *websocket.Conn) liveEvent {
+		t.Helper()
+		var event liveEvent
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if err := conn.ReadJSON(&event); err != nil {
+			t.Fatalf("Failed to read event: %v", err)
+		}
+		return event
+	}
+
+	t.Run("Requires a session", func(t *testing.T) {
+		_, server, _ := newServer(t)
+		_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/ws", nil)
+		if err == nil {
+			t.Fatal("Expected the connection to be refused")
+		}
+		if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected status 401, got %v", resp)
+		}
+	})
+
+	t.Run("Device and gate events", func(t *testing.T) {
+		app, server, cookie := newServer(t)
+		newTestRelay(t, app)
+		trackDevice(app, testDeviceMAC, "Phone")
+		conn := connect(t, app, server, cookie)
+
+		app.processClients([]unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testInteriorAP, Uptime: 100}})
+		event := readEvent(t, conn)
+		if event.Type != "device" || event.Event != "connected" || event.Device == nil ||
+			event.Device.MAC != testDeviceMAC || !event.Device.IsConnected || event.Device.CurrentAP != testInteriorAP {
+			t.Errorf("Expected the phone connecting, got %+v %+v", event, event.Device)
+		}
+
+		// Roaming to the gate from inside opens it
+		app.processClients([]unifi.WirelessClient{{MAC: "aa:bb:cc:dd:ee:01", AP_MAC: testGateAP, Uptime: 110}})
+		if event := readEvent(t, conn); event.Type != "gate" || event.Event != "gate_triggered" {
+			t.Errorf("Expected the gate to be triggered, got %+v", event)
+		}
+		if event := readEvent(t, conn); event.Event != "roamed" || event.Device.CurrentAP != testGateAP {
+			t.Errorf("Expected the phone roaming to the gate AP, got %+v", event)
+		}
+
+		app.processClients(nil)
+		if event := readEvent(t, conn); event.Event != "disconnected" || event.Device.IsConnected {
+			t.Errorf("Expected the phone disconnecting, got %+v", event)
+		}
+	})
+
+	t.Run("Closed on logout", func(t *testing.T) {
+		app, server, cookie := newServer(t)
+		other := connect(t, app, server, loginCookie(t, app))
+		conn := connect(t, app, server, cookie)
+
+		req, _ := http.NewRequest("POST", server.URL+"/logout", nil)
+		req.AddCookie(cookie)
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to logout: %v", err)
+		}
+		resp.Body.Close()
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+			t.Errorf("Expected the connection to be closed as logged out, got %v", err)
+		}
+
+		// Other logins stay connected
+		app.broadcast(liveEvent{Type: "gate", Event: "gate_triggered"})
+		if event := readEvent(t, other); event.Event != "gate_triggered" {
+			t.Errorf("Expected the other login to get events, got %+v", event)
+		}
+	})
+
+	t.Run("Closed when the user is removed", func(t *testing.T) {
+		app, server, cookie := newServer(t)
+		if err := app.Config.AddAdminUser("alice", "Alice-Pass-1"); err != nil {
+			t.Fatalf("Failed to add user: %v", err)
+		}
+		w := httptest.NewRecorder()
+		if err := app.SessionStore.LoginAs(httptest.NewRequest("POST", "/api/login", nil), w, "alice"); err != nil {
+			t.Fatalf("Failed to login: %v", err)
+		}
+		alice := connect(t, app, server, w.Result().Cookies()[0])
+		admin := connect(t, app, server, cookie)
+
+		req, _ := http.NewRequest("DELETE", server.URL+"/api/users/alice", nil)
+		req.AddCookie(cookie)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to remove user: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+
+		alice.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := alice.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+			t.Errorf("Expected the connection to be closed, got %v", err)
+		}
+		app.broadcast(liveEvent{Type: "gate", Event: "gate_triggered"})
+		if event := readEvent(t, admin); event.Event != "gate_triggered" {
+			t.Errorf("Expected the admin to stay connected, got %+v", event)
+		}
+	})
+
+	t.Run("Closed on shutdown", func(t *testing.T) {
+		app, server, cookie := newServer(t)
+		conn := connect(t, app, server, cookie)
+
+		app.Shutdown()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("Expected the connection to be closed, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package mqtt
+
+import (
+	"fmt"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// connectTimeout bounds connecting to the broker
+	connectTimeout = 10 * time.Second
+	// publishTimeout bounds waiting for the broker to take a message
+	publishTimeout = 5 * time.Second
+)
+
+// Client publishes retained state to an MQTT broker
+type Client struct {
+	client paho.Client
+}
+
+// Connect connects to brokerURL, e.g. tcp://host:1883, with optional
+// credentials. Once connected the client reconnects by itself.
+func Connect(brokerURL, username, password, clientID string) (*Client, error) {
+	opts := paho.NewClientOptions().
+		AddBroker(brokerURL).
+		SetClientID(clientID).
+		SetUsername(username).
+		SetPassword(password).
+		SetConnectTimeout(connectTimeout).
+		SetAutoReconnect(true)
+
+	client := paho.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(connectTimeout) {
+		client.Disconnect(0)
+		return nil, fmt.Errorf("timed out connecting to MQTT broker %s", brokerURL)
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT broker %s: %w", brokerURL, err)
+	}
+	return &Client{client: client}, nil
+}
+
+// Publish sends a retained message with QoS 1, so subscribers joining later
+// get the latest state
+func (c *Client) Publish(topic string, payload []byte) error {
+	token := c.client.Publish(topic, 1, true, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("timed out publishing to %s", topic)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Close disconnects, giving messages in flight a moment to go out
+func (c *Client) Close() {
+	c.client.Disconnect(250)
+}
@@ -0,0 +1,25 @@
+package mqtt
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestConnectUnreachable(t *testing.T) {
+	// Grab a free port and close it again so nothing is listening
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	_, err = Connect("tcp://"+addr, "", "", "test")
+	if err == nil {
+		t.Fatal("Expected an error connecting to a closed port")
+	}
+	if !strings.Contains(err.Error(), addr) {
+		t.Errorf("Expected the broker in the error, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BatchedEvent is the event batchers coalesce, several devices arriving
+// together in one car
+const BatchedEvent = "arrived"
+
+// Batcher holds back arrivals for a short window and sends those within it
+// as one message, e.g. "Dad and 2 others arrived". Other messages pass
+// straight through.
+type Batcher struct {
+	next    Notifier
+	window  time.Duration
+	onError func(error) // failures of batches sent once the window is over
+
+	mu      sync.Mutex
+	pending []Message
+	timer   *time.Timer
+}
+
+// NewBatcher batches arrivals within window before handing them to next.
+// onError, if not nil, receives errors sending a batch after the window.
+func NewBatcher(next Notifier, window time.Duration, onError func(error)) *Batcher {
+	return &Batcher{next: next, window: window, onError: onError}
+}
+
+func (b *Batcher) Notify(msg Message) error {
+	if msg.Event != BatchedEvent || b.window <= 0 {
+		return b.next.Notify(msg)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, msg)
+	// The window starts with the first arrival, later ones don't extend it
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.window, func() {
+			if err := b.Flush(); err != nil && b.onError != nil {
+				b.onError(err)
+			}
+		})
+	}
+	return nil
+}
+
+// Flush sends the arrivals held back right away, e.g. on shutdown
+func (b *Batcher) Flush() error {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+	return b.next.Notify(batchMessage(pending))
+}
+
+// batchMessage combines arrivals into one message about the first device
+func batchMessage(msgs []Message) Message {
+	if len(msgs) == 1 {
+		return msgs[0]
+	}
+
+	msg := msgs[0]
+	msg.Count = len(msgs)
+	if len(msgs) == 2 {
+		msg.Text = fmt.Sprintf("%s and %s arrived", msgs[0].DeviceName, msgs[1].DeviceName)
+	} else {
+		msg.Text = fmt.Sprintf("%s and %d others arrived", msgs[0].DeviceName, len(msgs)-1)
+	}
+	if msg.Instance != "" {
+		msg.Text = fmt.Sprintf("[%s] %s", msg.Instance, msg.Text)
+	}
+	return msg
+}
+
+// Batched returns the group with each notifier batching arrivals within
+// window, so per-device provider choices still apply
+func (g Group) Batched(window time.Duration, onError func(error)) Group {
+	batched := make(Group, len(g))
+	for i, n := range g {
+		name := n.Name
+		batched[i] = Named{Name: name, Notifier: NewBatcher(n.Notifier, window, func(err error) {
+			if onError != nil {
+				onError(fmt.Errorf("%s: %w", name, err))
+			}
+		})}
+	}
+	return batched
+}
+
+// Flush sends what the group's batchers hold back
+func (g Group) Flush() error {
+	var errs []error
+	for _, n := range g {
+		if b, ok := n.Notifier.(*Batcher); ok {
+			if err := b.Flush(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", n.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
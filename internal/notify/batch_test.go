@@ -0,0 +1,138 @@
+package notify
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder collects the messages it is sent
+type recorder struct {
+	mu   sync.Mutex
+	msgs []Message
+	sent chan struct{}
+}
+
+func newRecorder() *recorder {
+	return &recorder{sent: make(chan struct{}, 10)}
+}
+
+func (r *recorder) Notify(msg Message) error {
+	r.mu.Lock()
+	r.msgs = append(r.msgs, msg)
+	r.mu.Unlock()
+	r.sent <- struct{}{}
+	return nil
+}
+
+func (r *recorder) messages() []Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Message(nil), r.msgs...)
+}
+
+func arrival(name string) Message {
+	return Message{Event: "arrived", Text: "[home] " + name + " arrived, gate opened", Instance: "home", DeviceName: name}
+}
+
+func TestBatcher(t *testing.T) {
+	t.Run("Arrivals within the window make one message", func(t *testing.T) {
+		next := newRecorder()
+		batcher := NewBatcher(next, 20*time.Millisecond, nil)
+		for _, name := range []string{"Dad", "Mom", "Kid"} {
+			if err := batcher.Notify(arrival(name)); err != nil {
+				t.Fatalf("Notify failed: %v", err)
+			}
+		}
+		if len(next.messages()) != 0 {
+			t.Fatal("Expected the arrivals to be held back")
+		}
+
+		select {
+		case <-next.sent:
+		case <-time.After(time.Second):
+			t.Fatal("Expected the batch to be sent after the window")
+		}
+		msgs := next.messages()
+		if len(msgs) != 1 {
+			t.Fatalf("Expected one batched message, got %+v", msgs)
+		}
+		if msgs[0].Text != "[home] Dad and 2 others arrived" || msgs[0].Count != 3 || msgs[0].DeviceName != "Dad" {
+			t.Errorf("Unexpected batched message %+v", msgs[0])
+		}
+	})
+
+	t.Run("Two arrivals are named", func(t *testing.T) {
+		next := newRecorder()
+		batcher := NewBatcher(next, time.Hour, nil)
+		batcher.Notify(arrival("Dad"))
+		batcher.Notify(arrival("Mom"))
+		if err := batcher.Flush(); err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+		if msgs := next.messages(); len(msgs) != 1 || msgs[0].Text != "[home] Dad and Mom arrived" {
+			t.Errorf("Expected both named, got %+v", msgs)
+		}
+	})
+
+	t.Run("A lone arrival is sent as is", func(t *testing.T) {
+		next := newRecorder()
+		batcher := NewBatcher(next, time.Hour, nil)
+		batcher.Notify(arrival("Dad"))
+		batcher.Flush()
+		if msgs := next.messages(); len(msgs) != 1 || msgs[0] != arrival("Dad") {
+			t.Errorf("Expected the original message, got %+v", msgs)
+		}
+		// Nothing left to send
+		batcher.Flush()
+		if msgs := next.messages(); len(msgs) != 1 {
+			t.Errorf("Expected no more messages, got %+v", msgs)
+		}
+	})
+
+	t.Run("Other events and no window pass through", func(t *testing.T) {
+		next := newRecorder()
+		NewBatcher(next, time.Hour, nil).Notify(Message{Event: "left", Text: "Dad left"})
+		NewBatcher(next, 0, nil).Notify(arrival("Dad"))
+		if msgs := next.messages(); len(msgs) != 2 {
+			t.Errorf("Expected both sent right away, got %+v", msgs)
+		}
+	})
+
+	t.Run("Errors after the window are reported", func(t *testing.T) {
+		reported := make(chan error, 1)
+		failing := notifierFunc(func(Message) error { return errors.New("unreachable") })
+		group := Group{{Name: "webhook", Notifier: failing}}.Batched(10*time.Millisecond, func(err error) { reported <- err })
+
+		if err := group.Notify(arrival("Dad")); err != nil {
+			t.Fatalf("Expected the arrival to be held back, got %v", err)
+		}
+		select {
+		case err := <-reported:
+			if err.Error() != "webhook: unreachable" {
+				t.Errorf("Expected the provider's error, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected the error to be reported")
+		}
+	})
+}
+
+func TestGroupBatched(t *testing.T) {
+	webhook, chat := newRecorder(), newRecorder()
+	group := Group{{Name: "webhook", Notifier: webhook}, {Name: "chat", Notifier: chat}}.Batched(time.Hour, nil)
+
+	group.Notify(arrival("Dad"))
+	group.Only([]string{"chat"}).Notify(arrival("Mom"))
+	if err := group.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	if msgs := webhook.messages(); len(msgs) != 1 || msgs[0].Count != 0 {
+		t.Errorf("Expected the webhook to get Dad alone, got %+v", msgs)
+	}
+	if msgs := chat.messages(); len(msgs) != 1 || msgs[0].Count != 2 {
+		t.Errorf("Expected chat to get both, got %+v", msgs)
+	}
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body of
+// a signed webhook request, keyed with the shared secret
+const SignatureHeader = "X-Signature-256"
+
+// EventWebhook posts events as JSON to a URL, for home automation to react
+// to. Unlike notifications these are every logged event, not a selection.
+type EventWebhook struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewEventWebhook posts to url, signing requests if secret isn't empty
+func NewEventWebhook(url, secret string) *EventWebhook {
+	return &EventWebhook{
+		url:    url,
+		secret: secret,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (w *EventWebhook) Send(event interface{}) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.secret != "" {
+		req.Header.Set(SignatureHeader, Sign(body, w.secret))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("event webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the SignatureHeader value for body
+func Sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
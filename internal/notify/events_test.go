@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEventWebhook(t *testing.T) {
+	t.Run("Signed with the secret", func(t *testing.T) {
+		var body []byte
+		var signature string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ = io.ReadAll(r.Body)
+			signature = r.Header.Get(SignatureHeader)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		if err := NewEventWebhook(server.URL, "s3cret").Send(map[string]string{"event": "gate_triggered"}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		if string(body) != `{"event":"gate_triggered"}` {
+			t.Errorf("Unexpected body %s", body)
+		}
+
+		// What a receiver would check
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(body)
+		if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+			t.Errorf("Expected signature %s, got %s", want, signature)
+		}
+	})
+
+	t.Run("Unsigned without a secret", func(t *testing.T) {
+		signed := true
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, signed = r.Header[SignatureHeader]
+		}))
+		defer server.Close()
+
+		if err := NewEventWebhook(server.URL, "").Send(map[string]string{}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		if signed {
+			t.Error("Expected no signature without a secret")
+		}
+	})
+
+	t.Run("Error status", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		if err := NewEventWebhook(server.URL, "").Send(map[string]string{}); err == nil {
+			t.Error("Expected an error for a failing webhook")
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Named is a notifier with the name used to pick it, e.g. "webhook"
+type Named struct {
+	Name string
+	Notifier
+}
+
+// Group delivers every message to all of its notifiers
+type Group []Named
+
+func (g Group) Notify(msg Message) error {
+	var errs []error
+	for _, n := range g {
+		if err := n.Notify(msg); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", n.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Only returns the notifiers of the group with one of the given names
+func (g Group) Only(names []string) Group {
+	var only Group
+	for _, n := range g {
+		for _, name := range names {
+			if n.Name == name {
+				only = append(only, n)
+				break
+			}
+		}
+	}
+	return only
+}
+
+// Without returns the notifiers of the group with none of the given names
+func (g Group) Without(names []string) Group {
+	var without Group
+	for _, n := range g {
+		if !slices.Contains(names, n.Name) {
+			without = append(without, n)
+		}
+	}
+	return without
+}
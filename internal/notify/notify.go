@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Message is a notification about something the user should know about
+type Message struct {
+	Event      string    `json:"event"` // e.g. "device_absent"
+	Text       string    `json:"text"`
+	Instance   string    `json:"instance,omitempty"`
+	DeviceMAC  string    `json:"device_mac,omitempty"`
+	DeviceName string    `json:"device_name,omitempty"`
+	Gate       string    `json:"gate,omitempty"`      // the additional gate the event is about, empty for the primary one
+	ImageURL   string    `json:"image_url,omitempty"` // the device's avatar, shown as a thumbnail where supported
+	Count      int       `json:"count,omitempty"`     // devices in a batched message, see Batcher
+	Time       time.Time `json:"time"`
+}
+
+// Notifier delivers messages to the user
+type Notifier interface {
+	Notify(msg Message) error
+}
+
+// Webhook posts messages as JSON to a URL
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		url: url,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (w *Webhook) Notify(msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notification webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	t.Run("Posts the message as JSON", func(t *testing.T) {
+		var got Message
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" {
+				t.Errorf("Expected POST, got %s", r.Method)
+			}
+			if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected JSON content type, got %s", ct)
+			}
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Failed to decode message: %v", err)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		msg := Message{Event: "device_absent", Text: "Phone not home", Instance: "home", Time: time.Now().UTC().Truncate(time.Second)}
+		if err := NewWebhook(server.URL).Notify(msg); err != nil {
+			t.Fatalf("Notify failed: %v", err)
+		}
+		if got != msg {
+			t.Errorf("Expected %+v, got %+v", msg, got)
+		}
+	})
+
+	t.Run("Error status", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		if err := NewWebhook(server.URL).Notify(Message{Text: "test"}); err == nil {
+			t.Error("Expected an error for a failing webhook")
+		}
+	})
+}
+
+// notifierFunc adapts a function to a Notifier
+type notifierFunc func(Message) error
+
+func (f notifierFunc) Notify(msg Message) error { return f(msg) }
+
+func TestGroup(t *testing.T) {
+	var sent []string
+	record := func(name string) Notifier {
+		return notifierFunc(func(Message) error {
+			sent = append(sent, name)
+			return nil
+		})
+	}
+	group := Group{
+		{Name: "webhook", Notifier: record("webhook")},
+		{Name: "broken", Notifier: notifierFunc(func(Message) error { return errors.New("unreachable") })},
+		{Name: "chat", Notifier: record("chat")},
+	}
+
+	t.Run("Sends to every notifier", func(t *testing.T) {
+		sent = nil
+		err := group.Notify(Message{Text: "test"})
+		if err == nil || !strings.Contains(err.Error(), "broken: unreachable") {
+			t.Errorf("Expected the broken notifier's error, got %v", err)
+		}
+		if len(sent) != 2 {
+			t.Errorf("Expected 2 notifications despite the failure, got %v", sent)
+		}
+	})
+
+	t.Run("Only picks by name", func(t *testing.T) {
+		sent = nil
+		if err := group.Only([]string{"chat", "missing"}).Notify(Message{Text: "test"}); err != nil {
+			t.Fatalf("Notify failed: %v", err)
+		}
+		if len(sent) != 1 || sent[0] != "chat" {
+			t.Errorf("Expected only chat, got %v", sent)
+		}
+	})
+
+	t.Run("Without leaves out by name", func(t *testing.T) {
+		sent = nil
+		if err := group.Without([]string{"webhook", "broken"}).Notify(Message{Text: "test"}); err != nil {
+			t.Fatalf("Notify failed: %v", err)
+		}
+		if len(sent) != 1 || sent[0] != "chat" {
+			t.Errorf("Expected only chat, got %v", sent)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// telegramAPI is the Bot API base URL
+const telegramAPI = "https://api.telegram.org"
+
+// Telegram sends messages to a chat through a Telegram bot
+type Telegram struct {
+	apiURL   string
+	botToken string
+	chatID   string
+	client   *http.Client
+}
+
+// NewTelegram sends to chatID, a numeric ID or @channelname, as the bot with
+// botToken from @BotFather
+func NewTelegram(botToken, chatID string) *Telegram {
+	return &Telegram{
+		apiURL:   telegramAPI,
+		botToken: botToken,
+		chatID:   chatID,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (t *Telegram) Notify(msg Message) error {
+	body, err := json.Marshal(map[string]string{
+		"chat_id": t.chatID,
+		"text":    msg.Text,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.client.Post(t.apiURL+"/bot"+t.botToken+"/sendMessage", "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The URL holds the bot token, keep it out of the logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to send Telegram message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Telegram explains what's wrong, e.g. "Bad Request: chat not found"
+		var result struct {
+			Description string `json:"description"`
+		}
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&result); err == nil && result.Description != "" {
+			return fmt.Errorf("telegram returned status %d: %s", resp.StatusCode, result.Description)
+		}
+		return fmt.Errorf("telegram returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTelegram(t *testing.T) {
+	t.Run("Sends the text to the chat", func(t *testing.T) {
+		var path string
+		var got map[string]string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected JSON content type, got %s", ct)
+			}
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Failed to decode message: %v", err)
+			}
+			w.Write([]byte(`{"ok":true,"result":{}}`))
+		}))
+		defer server.Close()
+
+		telegram := NewTelegram("123:abc", "-1001234")
+		telegram.apiURL = server.URL
+		if err := telegram.Notify(Message{Event: "arrived", Text: "[home] Phone arrived, gate opened"}); err != nil {
+			t.Fatalf("Notify failed: %v", err)
+		}
+		if path != "/bot123:abc/sendMessage" {
+			t.Errorf("Expected the sendMessage method of the bot, got %s", path)
+		}
+		if got["chat_id"] != "-1001234" || got["text"] != "[home] Phone arrived, gate opened" {
+			t.Errorf("Unexpected message %v", got)
+		}
+	})
+
+	t.Run("Error description", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+		}))
+		defer server.Close()
+
+		telegram := NewTelegram("123:abc", "42")
+		telegram.apiURL = server.URL
+		err := telegram.Notify(Message{Text: "test"})
+		if err == nil || !strings.Contains(err.Error(), "chat not found") {
+			t.Errorf("Expected Telegram's description, got %v", err)
+		}
+	})
+
+	t.Run("Token kept out of errors", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		server.Close()
+
+		telegram := NewTelegram("123:secret", "42")
+		telegram.apiURL = server.URL
+		err := telegram.Notify(Message{Text: "test"})
+		if err == nil {
+			t.Fatal("Expected an error for an unreachable API")
+		}
+		if strings.Contains(err.Error(), "secret") {
+			t.Errorf("Expected the bot token to be left out, got %v", err)
+		}
+	})
+}
@@ -1,34 +1,183 @@
 package unifi
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/unpoller/unifi/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// DefaultLoginTimeout bounds each login attempt
+	DefaultLoginTimeout = 10 * time.Second
+	// DefaultLoginRetries is how often a failed login is retried
+	DefaultLoginRetries = 2
+
+	// Timeout for requests once logged in
+	requestTimeout = 30 * time.Second
 )
 
 // Client wraps the unpoller/unifi client
 type Client struct {
+	mu       sync.RWMutex
 	client   *unifi.Unifi
+	logins   singleflight.Group // concurrent logins share one request
 	baseURL  string
 	username string
 	password string
 	logger   Logger
+
+	loginTimeout time.Duration
+	loginRetries int
+	loginBackoff time.Duration // delay before the first retry, doubled after each
+	paths        apiPaths      // detected unless set, see SetUnifiOS
 }
 
 // NewClient creates a new UniFi client using the unpoller/unifi library
 func NewClient(baseURL, username, password string, logger Logger) *Client {
 	return &Client{
-		baseURL:  strings.TrimRight(baseURL, "/"),
-		username: username,
-		password: password,
-		logger:   logger,
+		baseURL:      normalizeBaseURL(baseURL),
+		username:     username,
+		password:     password,
+		logger:       logger,
+		loginTimeout: DefaultLoginTimeout,
+		loginRetries: DefaultLoginRetries,
+		loginBackoff: time.Second,
 	}
 }
 
-// Login authenticates with the UniFi controller
+// SetLoginOptions changes the per-attempt login timeout and the number of
+// retries. A zero timeout keeps the default.
+func (c *Client) SetLoginOptions(timeout time.Duration, retries int) {
+	if timeout > 0 {
+		c.loginTimeout = timeout
+	}
+	if retries >= 0 {
+		c.loginRetries = retries
+	}
+}
+
+// Login authenticates with the UniFi controller, retrying with backoff when
+// the controller is slow or unreachable. Rejected credentials are not retried.
+// Callers arriving while a login is in flight wait for it and share its result.
 func (c *Client) Login() error {
+	if err := checkBaseURL(c.baseURL); err != nil {
+		return err
+	}
+
+	_, err, _ := c.logins.Do("login", func() (interface{}, error) {
+		return nil, c.loginWithRetries()
+	})
+	return err
+}
+
+// EnsureLoggedIn logs in unless a session already exists
+func (c *Client) EnsureLoggedIn() error {
+	if c.session() != nil {
+		return nil
+	}
+	return c.Login()
+}
+
+// LoggedIn reports whether the client holds a session with the controller
+func (c *Client) LoggedIn() bool {
+	return c.session() != nil
+}
+
+func (c *Client) loginWithRetries() error {
+	var err error
+	backoff := c.loginBackoff
+
+	for attempt := 0; attempt <= c.loginRetries; attempt++ {
+		if attempt > 0 {
+			c.logger.Infof("Retrying UniFi login in %v (attempt %d of %d)", backoff, attempt+1, c.loginRetries+1)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		err = c.login()
+		if err == nil || !retryLogin(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// LoginOnce makes a single login attempt, for interactive checks where the
+// user should hear about a problem right away rather than after retries
+func (c *Client) LoginOnce() error {
+	if err := checkBaseURL(c.baseURL); err != nil {
+		return err
+	}
+	_, err, _ := c.logins.Do("login", func() (interface{}, error) {
+		return nil, c.login()
+	})
+	return err
+}
+
+// normalizeBaseURL trims trailing slashes and makes IPv6 hosts parseable:
+// bare addresses get brackets and zones are escaped, so "https://fe80::1%eth0"
+// becomes "https://[fe80::1%25eth0]".
+func normalizeBaseURL(baseURL string) string {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+
+	scheme, rest, ok := strings.Cut(baseURL, "://")
+	if !ok {
+		return baseURL
+	}
+	host, path := rest, ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		host, path = rest[:i], rest[i:]
+	}
+
+	if !strings.HasPrefix(host, "[") {
+		// Without brackets a port can't be told apart, the whole host is the address
+		if addr, _, _ := strings.Cut(host, "%"); strings.Contains(addr, ":") && net.ParseIP(addr) != nil {
+			host = "[" + host + "]"
+		}
+	}
+	if strings.HasPrefix(host, "[") && strings.Contains(host, "%") && !strings.Contains(host, "%25") {
+		host = strings.Replace(host, "%", "%25", 1)
+	}
+
+	return scheme + "://" + host + path
+}
+
+// checkBaseURL rejects controller URLs that can't be used for requests
+func checkBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid controller URL %q", baseURL)
+	}
+	return nil
+}
+
+// session returns the logged in unpoller client, nil before the first login
+func (c *Client) session() *unifi.Unifi {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client
+}
+
+// retryLogin reports whether a failed login might succeed on another attempt.
+// Wrong credentials and unknown hostnames won't fix themselves.
+func retryLogin(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false
+	}
+	return !errors.Is(err, unifi.ErrAuthenticationFailed)
+}
+
+func (c *Client) login() error {
 	c.logger.Debugf("Attempting to login to UniFi controller at %s", c.baseURL)
 	c.logger.Debugf("Username: %s", c.username)
 
@@ -38,37 +187,55 @@ func (c *Client) Login() error {
 		Pass:      c.password,
 		URL:       c.baseURL,
 		VerifySSL: false, // Allow self-signed certificates
-		Timeout:   30 * time.Second,
+		Timeout:   c.loginTimeout,
 		ErrorLog:  c.logger.Errorf,
 		DebugLog:  c.logger.Debugf,
 	}
 
-	// Create client
-	client, err := unifi.NewUnifi(config)
+	// Create client, this already logs in
+	var client *unifi.Unifi
+	var err error
+	if c.paths == detectPaths {
+		client, err = unifi.NewUnifi(config)
+	} else {
+		c.logger.Debugf("Using %s API paths", c.paths)
+		client, err = newSession(config, c.paths)
+	}
 	if err != nil {
-		c.logger.Errorf("Failed to create UniFi client: %v", err)
+		c.logger.Errorf("Login failed: %v", err)
+		if isTimeout(err) {
+			return fmt.Errorf("login timed out after %v: %w", c.loginTimeout, err)
+		}
+		if errors.Is(err, unifi.ErrAuthenticationFailed) {
+			return fmt.Errorf("failed to login: %w", err)
+		}
 		return fmt.Errorf("failed to create UniFi client: %w", err)
 	}
 
-	// Login
-	c.logger.Debugf("Calling Login() on UniFi client...")
-	if err := client.Login(); err != nil {
-		c.logger.Errorf("Login failed: %v", err)
-		return fmt.Errorf("failed to login: %w", err)
-	}
+	// The login timeout is deliberately short, regular requests get longer
+	client.Client.Timeout = requestTimeout
+	client.Config.Timeout = requestTimeout
 
+	c.mu.Lock()
 	c.client = client
+	c.mu.Unlock()
 	c.logger.Infof("Successfully logged in to UniFi controller")
 	return nil
 }
 
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
 // GetSites returns all sites
 func (c *Client) GetSites() ([]Site, error) {
-	if c.client == nil {
+	client := c.session()
+	if client == nil {
 		return nil, fmt.Errorf("not logged in")
 	}
 
-	unifiSites, err := c.client.GetSites()
+	unifiSites, err := client.GetSites()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get sites: %w", err)
 	}
@@ -88,7 +255,8 @@ func (c *Client) GetSites() ([]Site, error) {
 
 // GetAccessPoints returns all access points for a site
 func (c *Client) GetAccessPoints(siteID string) ([]AccessPoint, error) {
-	if c.client == nil {
+	client := c.session()
+	if client == nil {
 		return nil, fmt.Errorf("not logged in")
 	}
 
@@ -98,7 +266,7 @@ func (c *Client) GetAccessPoints(siteID string) ([]AccessPoint, error) {
 		sites = []*unifi.Site{{Name: siteID}}
 	}
 
-	devices, err := c.client.GetDevices(sites)
+	devices, err := client.GetDevices(sites)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get devices: %w", err)
 	}
@@ -124,23 +292,25 @@ func (c *Client) GetAccessPoints(siteID string) ([]AccessPoint, error) {
 
 // GetActiveClients returns all active wireless clients for a site
 func (c *Client) GetActiveClients(siteID string) ([]WirelessClient, error) {
-	if c.client == nil {
+	session := c.session()
+	if session == nil {
 		return nil, fmt.Errorf("not logged in")
 	}
 
 	// Get clients for specific site
 	sites := []*unifi.Site{{Name: siteID}}
-	clients, err := c.client.GetClients(sites)
+	clients, err := session.GetClients(sites)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get clients: %w", err)
 	}
 
 	// Convert to our WirelessClient type and filter for active clients
-	var activeClients []WirelessClient
+	activeClients := make([]WirelessClient, 0, len(clients))
+	cutoff := time.Now().Add(-5 * time.Minute)
 	for _, client := range clients {
 		// Check if client is wireless and was seen recently (within 5 minutes)
 		lastSeenTime := time.Unix(int64(client.LastSeen.Val), 0)
-		if !client.IsWired.Val && time.Since(lastSeenTime) < 5*time.Minute {
+		if !client.IsWired.Val && lastSeenTime.After(cutoff) {
 			wc := WirelessClient{
 				ID:         client.ID,
 				MAC:        client.Mac,
@@ -169,6 +339,34 @@ func (c *Client) GetActiveClients(siteID string) ([]WirelessClient, error) {
 	return activeClients, nil
 }
 
+// GetKnownClients returns the clients a user named in the controller, e.g.
+// to pick devices to track without them having to be connected
+func (c *Client) GetKnownClients(siteID string) ([]KnownClient, error) {
+	session := c.session()
+	if session == nil {
+		return nil, fmt.Errorf("not logged in")
+	}
+
+	var response struct {
+		Data []KnownClient `json:"data"`
+	}
+	if err := session.GetData(fmt.Sprintf("/api/s/%s/rest/user", siteID), &response); err != nil {
+		return nil, fmt.Errorf("failed to get known clients: %w", err)
+	}
+
+	// rest/user also lists every client ever seen, only named ones were
+	// set up by someone
+	known := make([]KnownClient, 0, len(response.Data))
+	for _, client := range response.Data {
+		client.Name = strings.TrimSpace(client.Name)
+		if client.Name != "" {
+			known = append(known, client)
+		}
+	}
+
+	return known, nil
+}
+
 // GetClientHistory is not directly supported by the library, returning empty for now
 func (c *Client) GetClientHistory(siteID, mac string, hours int) ([]WirelessClient, error) {
 	// This would require implementing event parsing from the UniFi API
@@ -2,10 +2,14 @@ package unifi
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -104,6 +108,16 @@ func newMockUniFiServer() *mockUniFiServer {
 				"meta": map[string]interface{}{"rc": "ok"},
 				"data": clients,
 			})
+		} else if strings.HasSuffix(r.URL.Path, "/rest/user") {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"meta": map[string]interface{}{"rc": "ok"},
+				"data": []map[string]interface{}{
+					{"_id": "u1", "mac": "aa:bb:cc:dd:ee:01", "name": "Alice's Phone", "note": "car", "last_seen": 1714560000},
+					{"_id": "u2", "mac": "aa:bb:cc:dd:ee:02", "hostname": "android-1234"},
+					{"_id": "u3", "mac": "aa:bb:cc:dd:ee:03", "name": " Garage Tablet "},
+				},
+			})
 		} else {
 			http.NotFound(w, r)
 		}
@@ -265,6 +279,37 @@ func TestGetActiveClients(t *testing.T) {
 	}
 }
 
+func TestGetKnownClients(t *testing.T) {
+	mock := newMockUniFiServer()
+	defer mock.Close()
+
+	username, password, siteID := mock.getTestCredentials()
+	client := NewClient(mock.URL, username, password, NewTestLogger(t))
+
+	if _, err := client.GetKnownClients(siteID); err == nil {
+		t.Error("GetKnownClients should fail without login")
+	}
+	if err := client.Login(); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	known, err := client.GetKnownClients(siteID)
+	if err != nil {
+		t.Fatalf("GetKnownClients failed: %v", err)
+	}
+
+	// Unnamed clients were never set up by anyone
+	if len(known) != 2 {
+		t.Fatalf("Expected 2 named clients, got %+v", known)
+	}
+	if known[0].MAC != "aa:bb:cc:dd:ee:01" || known[0].Name != "Alice's Phone" || known[0].Note != "car" {
+		t.Errorf("Unexpected first client %+v", known[0])
+	}
+	if known[1].Name != "Garage Tablet" {
+		t.Errorf("Expected the name to be trimmed, got %q", known[1].Name)
+	}
+}
+
 func TestClientErrors(t *testing.T) {
 	logger := NewTestLogger(t)
 	
@@ -401,4 +446,205 @@ func TestClientAdvancedScenarios(t *testing.T) {
 		
 		t.Logf("GetActiveClients returned %d clients", len(clients))
 	})
-}
\ No newline at end of file
+}
+func TestLoginTimeoutAndRetries(t *testing.T) {
+	logger := NewTestLogger(t)
+
+	// newSlowController answers logins after delay(attempt), 1-based
+	newSlowController := func(delay func(attempt int32) time.Duration, status int) (*httptest.Server, *int32) {
+		var attempts int32
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/login", func(w http.ResponseWriter, r *http.Request) {
+			attempt := atomic.AddInt32(&attempts, 1)
+			select {
+			case <-time.After(delay(attempt)):
+			case <-r.Context().Done():
+				return
+			}
+			w.WriteHeader(status)
+			w.Write([]byte(`{"meta":{"rc":"ok"},"data":[]}`))
+		})
+		mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"meta":{"rc":"ok","server_version":"7.0.0"},"data":[]}`))
+		})
+		server := httptest.NewTLSServer(mux)
+		t.Cleanup(server.Close)
+		return server, &attempts
+	}
+
+	t.Run("Times out and retries", func(t *testing.T) {
+		server, attempts := newSlowController(func(int32) time.Duration { return time.Second }, http.StatusOK)
+
+		client := NewClient(server.URL, "user", "pass", logger)
+		client.SetLoginOptions(50*time.Millisecond, 2)
+		client.loginBackoff = time.Millisecond
+
+		err := client.Login()
+		if err == nil {
+			t.Fatal("Login should time out")
+		}
+		if !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("Expected a timeout error, got %v", err)
+		}
+		if got := atomic.LoadInt32(attempts); got != 3 {
+			t.Errorf("Expected 3 login attempts, got %d", got)
+		}
+	})
+
+	t.Run("Succeeds on retry", func(t *testing.T) {
+		server, attempts := newSlowController(func(attempt int32) time.Duration {
+			if attempt == 1 {
+				return time.Second
+			}
+			return 0
+		}, http.StatusOK)
+
+		client := NewClient(server.URL, "user", "pass", logger)
+		client.SetLoginOptions(50*time.Millisecond, 2)
+		client.loginBackoff = time.Millisecond
+
+		if err := client.Login(); err != nil {
+			t.Fatalf("Login should succeed on retry: %v", err)
+		}
+		if got := atomic.LoadInt32(attempts); got < 2 {
+			t.Errorf("Expected a retried login, got %d attempts", got)
+		}
+		if client.client.Client.Timeout != requestTimeout {
+			t.Errorf("Expected request timeout %v after login, got %v", requestTimeout, client.client.Client.Timeout)
+		}
+	})
+
+	t.Run("Bad credentials are not retried", func(t *testing.T) {
+		server, attempts := newSlowController(func(int32) time.Duration { return 0 }, http.StatusUnauthorized)
+
+		client := NewClient(server.URL, "user", "wrong", logger)
+		client.loginBackoff = time.Millisecond
+
+		if err := client.Login(); err == nil {
+			t.Fatal("Login should fail with bad credentials")
+		}
+		if got := atomic.LoadInt32(attempts); got != 1 {
+			t.Errorf("Expected a single login attempt, got %d", got)
+		}
+	})
+
+	t.Run("Single attempt", func(t *testing.T) {
+		server, attempts := newSlowController(func(int32) time.Duration { return time.Second }, http.StatusOK)
+
+		client := NewClient(server.URL, "user", "pass", logger)
+		client.SetLoginOptions(50*time.Millisecond, 2)
+
+		if err := client.LoginOnce(); err == nil {
+			t.Fatal("LoginOnce should time out")
+		}
+		if got := atomic.LoadInt32(attempts); got != 1 {
+			t.Errorf("Expected a single login attempt, got %d", got)
+		}
+	})
+}
+
+func TestEnsureLoggedInConcurrent(t *testing.T) {
+	var logins int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/login", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&logins, 1)
+		// Keep the login in flight long enough for every caller to arrive
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`{"meta":{"rc":"ok"},"data":[]}`))
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"meta":{"rc":"ok","server_version":"7.0.0"},"data":[]}`))
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL, "user", "pass", NewTestLogger(t))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 25)
+	for i := 0; i < 25; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- client.EnsureLoggedIn()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("EnsureLoggedIn failed: %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&logins); got != 1 {
+		t.Errorf("Expected 1 backend login, got %d", got)
+	}
+
+	// An existing session is reused
+	if err := client.EnsureLoggedIn(); err != nil {
+		t.Fatalf("EnsureLoggedIn failed: %v", err)
+	}
+	if got := atomic.LoadInt32(&logins); got != 1 {
+		t.Errorf("Expected no further login, got %d", got)
+	}
+}
+
+func TestIPv6ControllerURL(t *testing.T) {
+	t.Run("Normalization", func(t *testing.T) {
+		tests := map[string]string{
+			"https://[fe80::1]:8443/":     "https://[fe80::1]:8443",
+			"https://fe80::1":             "https://[fe80::1]",
+			"https://[fe80::1%eth0]:8443": "https://[fe80::1%25eth0]:8443",
+			"https://fe80::1%eth0/":       "https://[fe80::1%25eth0]",
+			"https://[fe80::1%25eth0]":    "https://[fe80::1%25eth0]",
+			"https://unifi.local:8443/":   "https://unifi.local:8443",
+			"https://192.168.1.1:8443":    "https://192.168.1.1:8443",
+		}
+		for input, want := range tests {
+			if got := normalizeBaseURL(input); got != want {
+				t.Errorf("normalizeBaseURL(%q): expected %q, got %q", input, want, got)
+			}
+			if err := checkBaseURL(normalizeBaseURL(input)); err != nil {
+				t.Errorf("Expected %q to be usable, got %v", input, err)
+			}
+		}
+	})
+
+	t.Run("Requests reach the IPv6 host", func(t *testing.T) {
+		listener, err := net.Listen("tcp6", "[::1]:0")
+		if err != nil {
+			t.Skipf("IPv6 loopback not available: %v", err)
+		}
+
+		mock := newMockUniFiServer()
+		defer mock.Close()
+
+		var hosts sync.Map
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hosts.Store(r.Host, true)
+			mock.Server.Config.Handler.ServeHTTP(w, r)
+		}))
+		server.Listener.Close()
+		server.Listener = listener
+		server.StartTLS()
+		defer server.Close()
+
+		client := NewClient(server.URL+"/", "user", "pass", NewTestLogger(t))
+		if err := client.Login(); err != nil {
+			t.Fatalf("Failed to login over IPv6: %v", err)
+		}
+		sites, err := client.GetSites()
+		if err != nil {
+			t.Fatalf("Failed to get sites over IPv6: %v", err)
+		}
+		if len(sites) != 2 {
+			t.Errorf("Expected 2 sites from the mock controller, got %d", len(sites))
+		}
+
+		want := strings.TrimPrefix(server.URL, "https://")
+		if _, ok := hosts.Load(want); !ok {
+			t.Errorf("Expected requests for host %s", want)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package unifi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/unpoller/unifi/v5"
+)
+
+// Diagnosis categories for failed controller requests
+const (
+	DiagnosisDNS                = "dns"
+	DiagnosisConnectionRefused  = "connection_refused"
+	DiagnosisTimeout            = "timeout"
+	DiagnosisTLS                = "tls"
+	DiagnosisBadCredentials     = "bad_credentials"
+	DiagnosisSiteNotFound       = "site_not_found"
+	DiagnosisUnexpectedResponse = "unexpected_response"
+	DiagnosisUnknown            = "unknown"
+)
+
+// Diagnosis explains why a request to the controller failed
+type Diagnosis struct {
+	Category string `json:"category"`
+	Message  string `json:"message"`
+}
+
+// DiagnoseError classifies an error from Login or a controller request into
+// a category with a message the user can act on
+func DiagnoseError(err error) Diagnosis {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var certErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+
+	switch {
+	case errors.As(err, &dnsErr):
+		return Diagnosis{DiagnosisDNS, "Could not resolve the controller hostname. Please check the URL."}
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return Diagnosis{DiagnosisConnectionRefused, "The controller refused the connection. Please check the host and port and that the controller is running."}
+	case errors.As(err, &recordErr), errors.As(err, &alertErr), errors.As(err, &certErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr),
+		strings.Contains(errorString(err), "server gave HTTP response to HTTPS client"):
+		return Diagnosis{DiagnosisTLS, "TLS handshake with the controller failed. Please check that the URL uses the right scheme (https) and port."}
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return Diagnosis{DiagnosisTimeout, "The controller did not respond in time. Please check the URL and network connectivity."}
+	case errors.Is(err, unifi.ErrAuthenticationFailed):
+		return Diagnosis{DiagnosisBadCredentials, "The controller rejected the username or password. Please use a local UniFi account."}
+	case errors.Is(err, unifi.ErrInvalidStatusCode):
+		return Diagnosis{DiagnosisUnexpectedResponse, "The controller returned an unexpected response. Please check the URL."}
+	default:
+		return Diagnosis{DiagnosisUnknown, "Failed to connect to UniFi Controller. Please check your credentials and URL."}
+	}
+}
+
+// DiagnoseSiteError is DiagnoseError for requests made after a successful
+// login, where an error status from the controller means the site is unknown
+func DiagnoseSiteError(err error) Diagnosis {
+	diagnosis := DiagnoseError(err)
+	if diagnosis.Category == DiagnosisUnexpectedResponse {
+		return Diagnosis{DiagnosisSiteNotFound, "Connected to UniFi but the site was not found. Please check the Site ID."}
+	}
+	return diagnosis
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
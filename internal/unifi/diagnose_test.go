@@ -0,0 +1,46 @@
+package unifi
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/unpoller/unifi/v5"
+)
+
+func TestDiagnoseError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"DNS", &net.DNSError{Err: "no such host", Name: "unifi.invalid", IsNotFound: true}, DiagnosisDNS},
+		{"Refused", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, DiagnosisConnectionRefused},
+		{"Timeout", &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, DiagnosisTimeout},
+		{"Credentials", fmt.Errorf("failed to login: %w", unifi.ErrAuthenticationFailed), DiagnosisBadCredentials},
+		{"Status", fmt.Errorf("failed to get devices: %w", unifi.ErrInvalidStatusCode), DiagnosisUnexpectedResponse},
+		{"Unknown", errors.New("something else"), DiagnosisUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnosis := DiagnoseError(tt.err)
+			if diagnosis.Category != tt.expected {
+				t.Errorf("Expected category %s, got %s", tt.expected, diagnosis.Category)
+			}
+			if diagnosis.Message == "" {
+				t.Error("Expected a message")
+			}
+		})
+	}
+
+	t.Run("Status after login means unknown site", func(t *testing.T) {
+		diagnosis := DiagnoseSiteError(fmt.Errorf("failed to get devices: %w", unifi.ErrInvalidStatusCode))
+		if diagnosis.Category != DiagnosisSiteNotFound {
+			t.Errorf("Expected category %s, got %s", DiagnosisSiteNotFound, diagnosis.Category)
+		}
+	})
+}
@@ -22,6 +22,18 @@ type Site struct {
 	NoDelete    bool   `json:"attr_no_delete,omitempty"`
 }
 
+// KnownClient is a client the controller remembers because a user named it,
+// whether or not it's connected right now
+type KnownClient struct {
+	ID       string `json:"_id"`
+	MAC      string `json:"mac"`
+	Name     string `json:"name"`
+	Hostname string `json:"hostname,omitempty"`
+	Note     string `json:"note,omitempty"`
+	LastSeen int64  `json:"last_seen,omitempty"`
+	IsWired  bool   `json:"is_wired,omitempty"`
+}
+
 // WirelessClient represents a wireless client device
 type WirelessClient struct {
 	ID               string `json:"_id"`
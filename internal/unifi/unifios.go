@@ -0,0 +1,143 @@
+package unifi
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/unpoller/unifi/v5"
+)
+
+// apiPaths picks which API paths the client talks to the controller on
+type apiPaths int
+
+const (
+	// detectPaths leaves it to the library, which asks the controller
+	detectPaths apiPaths = iota
+	// classicPaths are those of a standalone Network application
+	classicPaths
+	// unifiOSPaths are those of UniFi OS consoles (UDM, Cloud Key Gen2+),
+	// which log in at /api/auth/login and serve the rest under /proxy/network
+	unifiOSPaths
+)
+
+func (p apiPaths) String() string {
+	switch p {
+	case classicPaths:
+		return "classic"
+	case unifiOSPaths:
+		return "UniFi OS"
+	default:
+		return "detected"
+	}
+}
+
+const (
+	unifiOSLoginPath = "/api/auth/login"
+	unifiOSPrefix    = "/proxy/network"
+)
+
+// SetUnifiOS makes the client use the UniFi OS paths instead of detecting
+// them, for consoles the detection gets wrong, e.g. behind a reverse proxy
+func (c *Client) SetUnifiOS(unifiOS bool) {
+	c.paths = detectPaths
+	if unifiOS {
+		c.paths = unifiOSPaths
+	}
+}
+
+// newSession logs in with the API paths given instead of the detected ones.
+// The library keeps its choice to itself, so the paths are left classic
+// there and rewritten on the way out for UniFi OS.
+func newSession(config *unifi.Config, paths apiPaths) (*unifi.Unifi, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating cookiejar: %w", err)
+	}
+
+	var transport http.RoundTripper = &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: !config.VerifySSL}, // nolint: gosec
+	}
+	if paths == unifiOSPaths {
+		base, err := url.Parse(config.URL)
+		if err != nil {
+			return nil, err
+		}
+		transport = &unifiOSTransport{base: transport, basePath: strings.TrimRight(base.Path, "/")}
+	}
+
+	session := &unifi.Unifi{
+		Config: config,
+		Client: &http.Client{Timeout: config.Timeout, Jar: jar, Transport: transport},
+	}
+	if err := session.Login(); err != nil {
+		return nil, err
+	}
+	if _, err := session.GetServerData(); err != nil {
+		return nil, fmt.Errorf("unable to get server version: %w", err)
+	}
+	return session, nil
+}
+
+// unifiOSTransport rewrites the classic API paths to those of UniFi OS, the
+// same way the library does once it detected a console
+type unifiOSTransport struct {
+	base     http.RoundTripper
+	basePath string // path of the controller URL, if it has one
+}
+
+func (t *unifiOSTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := strings.TrimPrefix(req.URL.Path, t.basePath)
+	switch {
+	case path == unifi.APILoginPath:
+		path = unifiOSLoginPath
+	case path == unifi.APILogoutPath:
+		path = "/api/auth/logout"
+	case !strings.HasPrefix(path, unifiOSPrefix) && path != unifiOSLoginPath:
+		path = unifiOSPrefix + path
+	}
+
+	req = req.Clone(req.Context())
+	req.URL.Path = t.basePath + path
+	req.URL.RawPath = ""
+	return t.base.RoundTrip(req)
+}
+
+// PathProbe is the outcome of trying to log in with both kinds of API paths
+type PathProbe struct {
+	UnifiOS      bool // UniFi OS paths worked, set unifi.unifi_os
+	Classic      bool // the classic paths worked
+	UnifiOSError error
+	ClassicError error
+}
+
+// OK reports whether either kind of paths worked
+func (p PathProbe) OK() bool {
+	return p.UnifiOS || p.Classic
+}
+
+// ProbeAPIPaths tries logging in with the UniFi OS and the classic API
+// paths, once each, so the setup wizard can tell which the controller uses
+func ProbeAPIPaths(baseURL, username, password string, timeout time.Duration, logger Logger) PathProbe {
+	try := func(paths apiPaths) error {
+		client := NewClient(baseURL, username, password, logger)
+		client.SetLoginOptions(timeout, 0)
+		client.paths = paths
+		err := client.LoginOnce()
+		if err != nil {
+			logger.Debugf("Login with %s API paths failed: %v", paths, err)
+		}
+		return err
+	}
+
+	var probe PathProbe
+	probe.UnifiOSError = try(unifiOSPaths)
+	probe.UnifiOS = probe.UnifiOSError == nil
+	probe.ClassicError = try(classicPaths)
+	probe.Classic = probe.ClassicError == nil
+	return probe
+}
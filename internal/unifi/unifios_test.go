@@ -0,0 +1,138 @@
+package unifi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// newMockConsole fakes a UniFi OS console whose root page doesn't give it
+// away, as behind some reverse proxies, and records the paths requested
+func newMockConsole(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var paths []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "TOKEN", Value: "console-session", Path: "/"})
+		w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/proxy/network/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"meta":{"rc":"ok","server_version":"8.0.0"},"data":[]}`))
+	})
+	mux.HandleFunc("/proxy/network/api/s/default/rest/user", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("TOKEN"); err != nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"meta":{"rc":"ok"},"data":[{"_id":"u1","mac":"aa:bb:cc:dd:ee:01","name":"Phone"}]}`))
+	})
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), paths...)
+	}
+}
+
+func TestUnifiOS(t *testing.T) {
+	logger := NewTestLogger(t)
+
+	t.Run("Detection misses the console", func(t *testing.T) {
+		server, _ := newMockConsole(t)
+		client := NewClient(server.URL, "user", "pass", logger)
+		if err := client.LoginOnce(); err == nil {
+			t.Fatal("Expected the classic login to fail")
+		}
+	})
+
+	t.Run("UniFi OS paths are used when set", func(t *testing.T) {
+		server, requested := newMockConsole(t)
+		client := NewClient(server.URL, "user", "pass", logger)
+		client.SetUnifiOS(true)
+
+		if err := client.LoginOnce(); err != nil {
+			t.Fatalf("Expected the login to succeed, got %v", err)
+		}
+		known, err := client.GetKnownClients("default")
+		if err != nil || len(known) != 1 || known[0].Name != "Phone" {
+			t.Fatalf("Expected the console's clients, got %+v (%v)", known, err)
+		}
+
+		want := []string{"/api/auth/login", "/proxy/network/status", "/proxy/network/api/s/default/rest/user"}
+		got := requested()
+		if len(got) != len(want) {
+			t.Fatalf("Expected requests to %v, got %v", want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Expected request %d to %s, got %s", i, want[i], got[i])
+			}
+		}
+	})
+
+	t.Run("Controller URL with a path keeps it", func(t *testing.T) {
+		transport := &unifiOSTransport{base: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: r}, nil
+		}), basePath: "/unifi"}
+
+		for path, want := range map[string]string{
+			"/unifi/api/login":              "/unifi/api/auth/login",
+			"/unifi/api/s/default/stat/sta": "/unifi/proxy/network/api/s/default/stat/sta",
+			"/unifi/proxy/network/status":   "/unifi/proxy/network/status",
+		} {
+			req := httptest.NewRequest("GET", "https://console"+path, nil)
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("RoundTrip failed: %v", err)
+			}
+			if got := resp.Request.URL.Path; got != want {
+				t.Errorf("%s: expected %s, got %s", path, want, got)
+			}
+		}
+	})
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestProbeAPIPaths(t *testing.T) {
+	logger := NewTestLogger(t)
+
+	t.Run("UniFi OS console", func(t *testing.T) {
+		server, _ := newMockConsole(t)
+		probe := ProbeAPIPaths(server.URL, "user", "pass", 0, logger)
+		if !probe.UnifiOS || probe.Classic || !probe.OK() {
+			t.Errorf("Expected only the UniFi OS paths to work, got %+v", probe)
+		}
+	})
+
+	t.Run("Standalone controller", func(t *testing.T) {
+		mock := newMockUniFiServer()
+		defer mock.Close()
+		probe := ProbeAPIPaths(mock.URL, "user", "pass", 0, logger)
+		if probe.UnifiOS || !probe.Classic {
+			t.Errorf("Expected only the classic paths to work, got %+v", probe)
+		}
+	})
+
+	t.Run("Nothing works", func(t *testing.T) {
+		probe := ProbeAPIPaths("https://", "user", "pass", 0, logger)
+		if probe.OK() || probe.UnifiOSError == nil || probe.ClassicError == nil {
+			t.Errorf("Expected both to fail, got %+v", probe)
+		}
+	})
+}